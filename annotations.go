@@ -0,0 +1,116 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+)
+
+// Annotation holds free-text notes and key/value annotations attached to a
+// container (by name, so they survive redeploys) or an image (by ID). They
+// live in the app database rather than in Docker labels, which are immutable.
+type Annotation struct {
+	ResourceType string            `json:"resource_type"`
+	ResourceID   string            `json:"resource_id"`
+	Notes        string            `json:"notes"`
+	Annotations  map[string]string `json:"annotations"`
+	UpdatedBy    string            `json:"updated_by"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+// ContainerWithMeta adds app metadata to a container list entry without
+// changing the shape of the Docker response
+type ContainerWithMeta struct {
+	container.Summary
+	Notes       string            `json:"Notes,omitempty"`
+	Annotations map[string]string `json:"Annotations,omitempty"`
+	Favorite    bool              `json:"Favorite,omitempty"`
+	Pinned      bool              `json:"Pinned,omitempty"`
+	Protected   bool              `json:"Protected,omitempty"`
+	Runtime     *ContainerRuntime `json:"Runtime,omitempty"`
+}
+
+type ImageWithMeta struct {
+	image.Summary
+	Notes       string            `json:"Notes,omitempty"`
+	Annotations map[string]string `json:"Annotations,omitempty"`
+	Favorite    bool              `json:"Favorite,omitempty"`
+	Pinned      bool              `json:"Pinned,omitempty"`
+}
+
+func (s *Store) GetAnnotation(resourceType, resourceID string) (*Annotation, error) {
+	a := &Annotation{ResourceType: resourceType, ResourceID: resourceID, Annotations: map[string]string{}}
+	var annotations string
+	var updatedAt int64
+	err := s.queryRow(`SELECT notes, annotations, updated_by, updated_at FROM annotations
+		WHERE resource_type = ? AND resource_id = ?`, resourceType, resourceID).
+		Scan(&a.Notes, &annotations, &a.UpdatedBy, &updatedAt)
+	if err == sql.ErrNoRows {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(annotations), &a.Annotations); err != nil {
+		return nil, err
+	}
+	a.UpdatedAt = time.Unix(updatedAt, 0)
+	return a, nil
+}
+
+func (s *Store) SaveAnnotation(a *Annotation) error {
+	annotations, err := json.Marshal(a.Annotations)
+	if err != nil {
+		return err
+	}
+	a.UpdatedAt = time.Now()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(s.rebind(`DELETE FROM annotations WHERE resource_type = ? AND resource_id = ?`),
+		a.ResourceType, a.ResourceID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(s.rebind(`INSERT INTO annotations (resource_type, resource_id, notes, annotations, updated_by, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)`),
+		a.ResourceType, a.ResourceID, a.Notes, string(annotations), a.UpdatedBy, a.UpdatedAt.Unix()); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) DeleteAnnotation(resourceType, resourceID string) error {
+	_, err := s.exec(`DELETE FROM annotations WHERE resource_type = ? AND resource_id = ?`, resourceType, resourceID)
+	return err
+}
+
+// ListAnnotations returns all annotations of a resource type keyed by resource ID
+func (s *Store) ListAnnotations(resourceType string) (map[string]*Annotation, error) {
+	rows, err := s.query(`SELECT resource_id, notes, annotations, updated_by, updated_at FROM annotations
+		WHERE resource_type = ?`, resourceType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := map[string]*Annotation{}
+	for rows.Next() {
+		a := &Annotation{ResourceType: resourceType}
+		var annotations string
+		var updatedAt int64
+		if err := rows.Scan(&a.ResourceID, &a.Notes, &annotations, &a.UpdatedBy, &updatedAt); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(annotations), &a.Annotations)
+		a.UpdatedAt = time.Unix(updatedAt, 0)
+		result[a.ResourceID] = a
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+)
+
+const templateLabel = labelPrefix + "template"
+
+// AppTemplate describes a deployable application: which image to run and the
+// ports, environment and volumes it needs. Stored in the templates table with
+// everything but the top-level fields in the definition column.
+type AppTemplate struct {
+	ID          string           `json:"id"`
+	Name        string           `json:"name" binding:"required,resourcename"`
+	Description string           `json:"description"`
+	Image       string           `json:"image" binding:"required"`
+	Ports       []TemplatePort   `json:"ports" binding:"dive"`
+	Env         []TemplateEnv    `json:"env" binding:"dive"`
+	Volumes     []TemplateVolume `json:"volumes"`
+	Command     []string         `json:"command,omitempty"`
+	Variables   []TemplateVar    `json:"variables,omitempty"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+type TemplatePort struct {
+	ContainerPort string `json:"container_port" binding:"required"`
+	HostPort      string `json:"host_port"`
+	Protocol      string `json:"protocol,omitempty" binding:"omitempty,oneof=tcp udp sctp"`
+	Description   string `json:"description,omitempty"`
+}
+
+type TemplateEnv struct {
+	Name        string `json:"name" binding:"required,envname"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+type TemplateVolume struct {
+	ContainerPath string `json:"container_path"`
+	Description   string `json:"description,omitempty"`
+}
+
+type templateDefinition struct {
+	Ports     []TemplatePort   `json:"ports"`
+	Env       []TemplateEnv    `json:"env"`
+	Volumes   []TemplateVolume `json:"volumes"`
+	Command   []string         `json:"command,omitempty"`
+	Variables []TemplateVar    `json:"variables,omitempty"`
+}
+
+type DeployTemplateRequest struct {
+	Name      string            `json:"name" binding:"omitempty,containername"`
+	Env       map[string]string `json:"env" binding:"dive,keys,envname,endkeys"`
+	EnvFile   string            `json:"env_file"`
+	Ports     map[string]string `json:"ports"`
+	Variables map[string]string `json:"variables"`
+	Secrets   map[string]string `json:"secrets"`
+	Configs   map[string]string `json:"configs"`
+	Project   string            `json:"project"`
+	// Stop and remove the deployment after this long, e.g. "2h" or "7d"
+	TTL string `json:"ttl" binding:"omitempty,ttl"`
+	// Memory limit such as "512m", counted against memory quotas
+	Memory string `json:"memory" binding:"omitempty,bytesize"`
+}
+
+// Seed catalog, inserted on startup when a template of that name doesn't exist yet
+var builtinTemplates = []AppTemplate{
+	{
+		Name:        "nginx",
+		Description: "Nginx web server",
+		Image:       "nginx:latest",
+		Ports:       []TemplatePort{{ContainerPort: "80", HostPort: "8082", Description: "HTTP"}},
+		Volumes:     []TemplateVolume{{ContainerPath: "/usr/share/nginx/html", Description: "Website content"}},
+	},
+	{
+		Name:        "postgres",
+		Description: "PostgreSQL database",
+		Image:       "postgres:{{ .Version }}",
+		Ports:       []TemplatePort{{ContainerPort: "5432", HostPort: "{{ .Port }}", Description: "PostgreSQL"}},
+		Env: []TemplateEnv{
+			{Name: "POSTGRES_PASSWORD", Description: "Superuser password", Default: "{{ .Password }}"},
+			{Name: "POSTGRES_USER", Description: "Superuser name", Default: "postgres"},
+			{Name: "POSTGRES_DB", Description: "Default database", Default: "postgres"},
+		},
+		Volumes: []TemplateVolume{{ContainerPath: "/var/lib/postgresql/data", Description: "Database files"}},
+		Variables: []TemplateVar{
+			{Name: "Version", Description: "PostgreSQL major version", Default: "16", Pattern: `^[0-9]+(\.[0-9]+)?$`},
+			{Name: "Port", Type: "port", Description: "Host port", Default: "5432"},
+			{Name: "Password", Type: "password", Description: "Superuser password (generated when empty)", Secret: true, Generate: true},
+		},
+	},
+	{
+		Name:        "mysql",
+		Description: "MySQL database",
+		Image:       "mysql:8",
+		Ports:       []TemplatePort{{ContainerPort: "3306", HostPort: "{{ .Port }}", Description: "MySQL"}},
+		Env: []TemplateEnv{
+			{Name: "MYSQL_ROOT_PASSWORD", Description: "Root password", Default: "{{ .Password }}"},
+			{Name: "MYSQL_DATABASE", Description: "Database created on first start"},
+		},
+		Volumes: []TemplateVolume{{ContainerPath: "/var/lib/mysql", Description: "Database files"}},
+		Variables: []TemplateVar{
+			{Name: "Port", Type: "port", Description: "Host port", Default: "3306"},
+			{Name: "Password", Type: "password", Description: "Root password (generated when empty)", Secret: true, Generate: true},
+		},
+	},
+	{
+		Name:        "redis",
+		Description: "Redis in-memory data store",
+		Image:       "redis:7",
+		Ports:       []TemplatePort{{ContainerPort: "6379", HostPort: "6379", Description: "Redis"}},
+		Volumes:     []TemplateVolume{{ContainerPath: "/data", Description: "Persistence files"}},
+	},
+	{
+		Name:        "wordpress",
+		Description: "WordPress CMS (needs a MySQL database)",
+		Image:       "wordpress:latest",
+		Ports:       []TemplatePort{{ContainerPort: "80", HostPort: "8083", Description: "HTTP"}},
+		Env: []TemplateEnv{
+			{Name: "WORDPRESS_DB_HOST", Description: "Database host:port", Required: true},
+			{Name: "WORDPRESS_DB_USER", Description: "Database user", Default: "root"},
+			{Name: "WORDPRESS_DB_PASSWORD", Description: "Database password", Required: true},
+			{Name: "WORDPRESS_DB_NAME", Description: "Database name", Default: "wordpress"},
+		},
+		Volumes: []TemplateVolume{{ContainerPath: "/var/www/html", Description: "WordPress files"}},
+	},
+	{
+		Name:        "mongo",
+		Description: "MongoDB document database",
+		Image:       "mongo:7",
+		Ports:       []TemplatePort{{ContainerPort: "27017", HostPort: "27017", Description: "MongoDB"}},
+		Env: []TemplateEnv{
+			{Name: "MONGO_INITDB_ROOT_USERNAME", Description: "Root user", Default: "root"},
+			{Name: "MONGO_INITDB_ROOT_PASSWORD", Description: "Root password", Required: true},
+		},
+		Volumes: []TemplateVolume{{ContainerPath: "/data/db", Description: "Database files"}},
+	},
+}
+
+func (s *Store) SeedTemplates() error {
+	for _, t := range builtinTemplates {
+		if _, err := s.GetTemplate(t.Name); err == nil {
+			continue
+		}
+		t := t
+		if err := s.CreateTemplate(&t); err != nil {
+			return fmt.Errorf("seeding template %s: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) CreateTemplate(t *AppTemplate) error {
+	definition, err := json.Marshal(templateDefinition{Ports: t.Ports, Env: t.Env, Volumes: t.Volumes, Command: t.Command, Variables: t.Variables})
+	if err != nil {
+		return err
+	}
+	t.ID = newID()
+	t.CreatedAt = time.Now()
+	t.UpdatedAt = t.CreatedAt
+	_, err = s.exec(`INSERT INTO templates (id, name, description, image, definition, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		t.ID, t.Name, t.Description, t.Image, string(definition), t.CreatedAt.Unix(), t.UpdatedAt.Unix())
+	return err
+}
+
+func (s *Store) UpdateTemplate(t *AppTemplate) error {
+	definition, err := json.Marshal(templateDefinition{Ports: t.Ports, Env: t.Env, Volumes: t.Volumes, Command: t.Command, Variables: t.Variables})
+	if err != nil {
+		return err
+	}
+	t.UpdatedAt = time.Now()
+	_, err = s.exec(`UPDATE templates SET name = ?, description = ?, image = ?, definition = ?, updated_at = ? WHERE id = ?`,
+		t.Name, t.Description, t.Image, string(definition), t.UpdatedAt.Unix(), t.ID)
+	return err
+}
+
+func (s *Store) DeleteTemplate(id string) error {
+	_, err := s.exec(`DELETE FROM templates WHERE id = ?`, id)
+	return err
+}
+
+// GetTemplate looks a template up by ID or name
+func (s *Store) GetTemplate(idOrName string) (*AppTemplate, error) {
+	return scanTemplate(s.queryRow(`SELECT id, name, description, image, definition, created_at, updated_at
+		FROM templates WHERE id = ? OR name = ?`, idOrName, idOrName))
+}
+
+func (s *Store) ListTemplates() ([]AppTemplate, error) {
+	rows, err := s.query(`SELECT id, name, description, image, definition, created_at, updated_at FROM templates ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []AppTemplate{}
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, *t)
+	}
+	return templates, rows.Err()
+}
+
+func scanTemplate(row rowScanner) (*AppTemplate, error) {
+	var t AppTemplate
+	var definition string
+	var createdAt, updatedAt int64
+	if err := row.Scan(&t.ID, &t.Name, &t.Description, &t.Image, &definition, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	var def templateDefinition
+	if err := json.Unmarshal([]byte(definition), &def); err != nil {
+		return nil, err
+	}
+	t.Ports, t.Env, t.Volumes, t.Command, t.Variables = def.Ports, def.Env, def.Volumes, def.Command, def.Variables
+	t.CreatedAt = time.Unix(createdAt, 0)
+	t.UpdatedAt = time.Unix(updatedAt, 0)
+	return &t, nil
+}
+
+func validateTemplate(t *AppTemplate) error {
+	if t.Name == "" {
+		return fmt.Errorf("template name is required")
+	}
+	if t.Image == "" {
+		return fmt.Errorf("template image is required")
+	}
+	if err := validateTemplateVars(t); err != nil {
+		return err
+	}
+	for _, p := range t.Ports {
+		if _, err := strconv.Atoi(p.ContainerPort); err != nil && !hasPlaceholder(p.ContainerPort) {
+			return fmt.Errorf("invalid container port: %q", p.ContainerPort)
+		}
+	}
+	for _, e := range t.Env {
+		if e.Name == "" {
+			return fmt.Errorf("env variables need a name")
+		}
+	}
+	for _, v := range t.Volumes {
+		if !path.IsAbs(v.ContainerPath) && !hasPlaceholder(v.ContainerPath) {
+			return fmt.Errorf("volume path must be absolute: %q", v.ContainerPath)
+		}
+	}
+	return nil
+}
+
+// ensureImage pulls an image unless it's already present locally
+func ensureImage(ctx context.Context, cli *client.Client, ref string) error {
+	if _, err := cli.ImageInspect(ctx, ref); err == nil {
+		return nil
+	}
+	if err := checkDiskSpace(ctx, cli); err != nil {
+		return err
+	}
+	fmt.Printf("Image %s not found locally, pulling from registry\n", ref)
+	return pullImage(ctx, cli, ref)
+}
+
+// pullImage pulls an image through the registry mirror when one is set up,
+// else from its registry, and waits for the pull to finish. In offline mode
+// the local image is used as it is, and a missing one is an error.
+func pullImage(ctx context.Context, cli *client.Client, ref string) error {
+	if offlineMode {
+		if _, err := cli.ImageInspect(ctx, ref); err != nil {
+			return fmt.Errorf("image %s is not present locally: %w", ref, errOffline)
+		}
+		return nil
+	}
+	if pullFromMirror(ctx, cli, ref) {
+		return nil
+	}
+	return pullAndWait(ctx, cli, ref)
+}
+
+func pullAndWait(ctx context.Context, cli *client.Client, ref string) error {
+	reader, err := cli.ImagePull(ctx, ref, image.PullOptions{})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, err = io.Copy(io.Discard, reader)
+	return err
+}
+
+// buildTemplateSpec turns a template and the user-supplied values into a
+// container spec. Variables are resolved first and substituted into every
+// placeholder. Each template volume becomes a named volume owned by the new
+// container. Env defaults that use secret variables are left out of the
+// spec and returned separately as secretEnv, to go through the secrets
+// store.
+func buildTemplateSpec(tmpl *AppTemplate, req DeployTemplateRequest) (spec *ContainerSpec, values map[string]string, secretEnv map[string]string, err error) {
+	if err := checkSecretPlaceholders(tmpl); err != nil {
+		return nil, nil, nil, err
+	}
+	values, err = resolveTemplateVars(tmpl.Variables, req.Variables)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	t, err := renderTemplate(tmpl, values)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// The image may come from variables, check what they produced
+	if err := validateImageRef(t.Image); err != nil {
+		return nil, nil, nil, err
+	}
+
+	config := &container.Config{
+		Image:        t.Image,
+		Cmd:          t.Command,
+		ExposedPorts: nat.PortSet{},
+		Labels: map[string]string{
+			templateLabel: t.Name,
+		},
+	}
+	if req.Project != "" {
+		config.Labels[projectLabel] = req.Project
+	}
+	hostConfig := &container.HostConfig{
+		PortBindings:  nat.PortMap{},
+		RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyUnlessStopped},
+	}
+
+	// .env file values fill in template env, explicit env values win
+	fileEnv, err := parseEnvFile(req.EnvFile)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid env file: %v", err)
+	}
+	fromFile := map[string]string{}
+	for _, kv := range fileEnv {
+		name, value, _ := strings.Cut(kv, "=")
+		fromFile[name] = value
+	}
+
+	secret := secretTemplateVars(tmpl.Variables)
+	secretEnv = map[string]string{}
+	var missing []string
+	for i, e := range t.Env {
+		value, ok := req.Env[e.Name]
+		if !ok || value == "" {
+			value = fromFile[e.Name]
+		}
+		if value == "" {
+			value = e.Default
+			if value != "" && usesSecretVar(tmpl.Env[i].Default, secret) {
+				secretEnv[e.Name] = value
+				continue
+			}
+		}
+		if value == "" {
+			if e.Required {
+				missing = append(missing, e.Name)
+			}
+			continue
+		}
+		config.Env = append(config.Env, e.Name+"="+value)
+	}
+	if len(missing) > 0 {
+		return nil, nil, nil, fmt.Errorf("missing required env: %v", missing)
+	}
+	for _, kv := range fileEnv {
+		name, value, _ := strings.Cut(kv, "=")
+		if !hasEnv(config.Env, name) {
+			config.Env = append(config.Env, name+"="+value)
+		}
+	}
+
+	for _, p := range t.Ports {
+		protocol := p.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		port := nat.Port(p.ContainerPort + "/" + protocol)
+		config.ExposedPorts[port] = struct{}{}
+
+		hostPort := p.HostPort
+		if override, ok := req.Ports[p.ContainerPort]; ok {
+			hostPort = override
+		}
+		if hostPort == "" {
+			continue
+		}
+		hostConfig.PortBindings[port] = []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: hostPort}}
+	}
+
+	for _, v := range t.Volumes {
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+			Type:   mount.TypeVolume,
+			Source: req.Name + "-" + path.Base(v.ContainerPath),
+			Target: v.ContainerPath,
+		})
+	}
+
+	return &ContainerSpec{Config: config, HostConfig: hostConfig}, values, secretEnv, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/gin-gonic/gin"
+)
+
+// Destructive actions that need an admin's approval when REQUIRE_APPROVAL is
+// set and the caller isn't an admin
+const (
+	approvalRemove     = "remove"
+	approvalBulkRemove = "bulk_remove"
+	approvalPrune      = "prune"
+	// Images and tags from the image report
+	approvalImageCleanup = "image_cleanup"
+)
+
+const (
+	approvalPending  = "pending"
+	approvalApproved = "approved"
+	approvalRejected = "rejected"
+	approvalFailed   = "failed"
+	// Claimed by an admin and being executed
+	approvalRunning = "running"
+)
+
+// Approval is a destructive request waiting for, or decided by, an admin
+type Approval struct {
+	ID          string          `json:"id"`
+	Action      string          `json:"action"`
+	Targets     []string        `json:"targets"`
+	Status      string          `json:"status"`
+	RequestedBy string          `json:"requested_by"`
+	DecidedBy   string          `json:"decided_by,omitempty"`
+	Reason      string          `json:"reason,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	DecidedAt   *time.Time      `json:"decided_at,omitempty"`
+}
+
+func (s *Store) CreateApproval(a *Approval) error {
+	a.ID = newID()
+	a.Status = approvalPending
+	a.CreatedAt = time.Now()
+	if a.Targets == nil {
+		a.Targets = []string{}
+	}
+	targets, err := json.Marshal(a.Targets)
+	if err != nil {
+		return err
+	}
+	_, err = s.exec(`INSERT INTO approvals (id, action, targets, status, requested_by, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		a.ID, a.Action, string(targets), a.Status, a.RequestedBy, a.CreatedAt.Unix())
+	return err
+}
+
+// ClaimApproval moves a pending approval to status, reporting false when it
+// was already decided, so two admins can't both execute it
+func (s *Store) ClaimApproval(id, status, decidedBy, reason string) (bool, error) {
+	res, err := s.exec(`UPDATE approvals SET status = ?, decided_by = ?, reason = ?, decided_at = ? WHERE id = ? AND status = ?`,
+		status, decidedBy, reason, time.Now().Unix(), id, approvalPending)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// FinishApproval records the outcome of an executed approval
+func (s *Store) FinishApproval(a *Approval) error {
+	_, err := s.exec(`UPDATE approvals SET status = ?, result = ?, error = ? WHERE id = ?`,
+		a.Status, string(a.Result), a.Error, a.ID)
+	return err
+}
+
+const approvalColumns = `id, action, targets, status, requested_by, decided_by, reason, result, error, created_at, decided_at`
+
+func scanApproval(row rowScanner) (*Approval, error) {
+	var a Approval
+	var targets, result string
+	var createdAt, decidedAt int64
+	if err := row.Scan(&a.ID, &a.Action, &targets, &a.Status, &a.RequestedBy, &a.DecidedBy, &a.Reason, &result, &a.Error, &createdAt, &decidedAt); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(targets), &a.Targets)
+	if result != "" {
+		a.Result = json.RawMessage(result)
+	}
+	a.CreatedAt = time.Unix(createdAt, 0)
+	if decidedAt > 0 {
+		t := time.Unix(decidedAt, 0)
+		a.DecidedAt = &t
+	}
+	return &a, nil
+}
+
+func (s *Store) GetApproval(id string) (*Approval, error) {
+	return scanApproval(s.queryRow(`SELECT `+approvalColumns+` FROM approvals WHERE id = ?`, id))
+}
+
+// ListApprovals returns approvals newest first, optionally with one status
+func (s *Store) ListApprovals(status string) ([]Approval, error) {
+	rows, err := s.query(`SELECT `+approvalColumns+` FROM approvals WHERE ? = '' OR status = ? ORDER BY created_at DESC LIMIT 200`, status, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	approvals := []Approval{}
+	for rows.Next() {
+		a, err := scanApproval(rows)
+		if err != nil {
+			return nil, err
+		}
+		approvals = append(approvals, *a)
+	}
+	return approvals, rows.Err()
+}
+
+// requestApproval answers a destructive request from a non-admin with a
+// pending approval instead of executing it
+func requestApproval(ctx *gin.Context, store *Store, action string, targets []string) {
+	a := &Approval{Action: action, Targets: targets, RequestedBy: actorName(ctx)}
+	if err := store.CreateApproval(a); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating approval request: " + err.Error()})
+		return
+	}
+	fmt.Printf("📝 %s requested %s approval %s\n", a.RequestedBy, action, a.ID)
+	ctx.JSON(http.StatusAccepted, gin.H{
+		"message":    "Action requires admin approval",
+		"approval":   a,
+		"suggestion": "Yêu cầu đã được ghi nhận, admin cần xác nhận qua POST /approvals/" + a.ID + "/approve",
+	})
+}
+
+// systemPrune removes stopped containers, unused networks, dangling images
+// and build cache, and with volumes the unused anonymous volumes
+func systemPrune(volumes bool) (string, error) {
+	args := []string{"system", "prune", "-f"}
+	if volumes {
+		args = append(args, "--volumes")
+	}
+	output, err := exec.Command("docker", args...).CombinedOutput()
+	return string(output), err
+}
+
+// executeApproval runs an approved action and returns its result. Removed
+// containers go to the trash when it's enabled.
+func executeApproval(ctx context.Context, cli *client.Client, trash *Trash, a *Approval) (any, error) {
+	switch a.Action {
+	case approvalRemove:
+		if len(a.Targets) != 1 {
+			return nil, fmt.Errorf("remove needs exactly one container")
+		}
+		trashed, err := trash.Remove(ctx, cli, a.Targets[0], a.DecidedBy, false)
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{"removed": a.Targets[0], "trashed": trashed}, nil
+	case approvalBulkRemove:
+		results := map[string]any{}
+		failed := 0
+		for _, id := range a.Targets {
+			if _, err := trash.Remove(ctx, cli, id, a.DecidedBy, false); err != nil {
+				results[id] = gin.H{"status": "error", "message": err.Error()}
+				failed++
+				continue
+			}
+			results[id] = gin.H{"status": "success"}
+		}
+		if failed > 0 {
+			return results, fmt.Errorf("%d of %d containers could not be removed", failed, len(a.Targets))
+		}
+		return results, nil
+	case approvalPrune:
+		output, err := systemPrune(containsString(a.Targets, "volumes"))
+		return gin.H{"output": output}, err
+	case approvalImageCleanup:
+		results, reclaimed := removeReportImages(ctx, cli, a.Targets)
+		return gin.H{"results": results, "space_reclaimed": reclaimed}, nil
+	}
+	return nil, fmt.Errorf("unknown action: %s", a.Action)
+}
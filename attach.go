@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// Longest an attach request collects output, however chatty the container
+const maxAttachWait = 30 * time.Second
+
+// attachAndSend writes input to a container's stdin and collects the output
+// it produces until it has been quiet for idle. It's a request/response take
+// on an interactive session, enough to drive a REPL from the dashboard. The
+// exchange is recorded with rec.
+func attachAndSend(ctx context.Context, cli *client.Client, containerID, input string, idle time.Duration, closeStdin bool, rec *SessionRecorder) (string, error) {
+	info, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := cli.ContainerAttach(ctx, info.ID, container.AttachOptions{
+		Stream: true,
+		Stdin:  true,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Close()
+
+	// Non-TTY streams are multiplexed, merge stdout and stderr back together
+	pr, pw := io.Pipe()
+	go func() {
+		var err error
+		if info.Config != nil && info.Config.Tty {
+			_, err = io.Copy(pw, resp.Reader)
+		} else {
+			_, err = stdcopy.StdCopy(pw, pw, resp.Reader)
+		}
+		pw.CloseWithError(err)
+	}()
+
+	chunks := make(chan []byte)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(chunks)
+		defer pr.Close()
+		buf := make([]byte, 4096)
+		for {
+			n, err := pr.Read(buf)
+			if n > 0 {
+				select {
+				case chunks <- append([]byte(nil), buf[:n]...):
+				case <-done:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	if input != "" {
+		rec.Input(input)
+		if _, err := io.WriteString(resp.Conn, input); err != nil {
+			return "", err
+		}
+	}
+	if closeStdin {
+		resp.CloseWrite()
+	}
+
+	var output bytes.Buffer
+	deadline := time.After(maxAttachWait)
+	quiet := time.NewTimer(idle)
+	defer quiet.Stop()
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				return output.String(), nil
+			}
+			output.Write(chunk)
+			rec.Output(chunk)
+			quiet.Reset(idle)
+		case <-quiet.C:
+			return output.String(), nil
+		case <-deadline:
+			return output.String(), nil
+		case <-ctx.Done():
+			return output.String(), ctx.Err()
+		}
+	}
+}
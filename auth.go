@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const roleAdmin = "admin"
+
+// Browsers can't set headers on a WebSocket, so terminals take the API key
+// as a subprotocol too: new WebSocket(url, ["terminal", "apikey." + key])
+const websocketKeyProtocol = "apikey."
+
+// resolveUser identifies the caller from an API key sent as X-API-Key,
+// "Authorization: Bearer <key>" or the WebSocket key subprotocol. Requests
+// without a key are anonymous.
+func resolveUser(store *Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("X-API-Key")
+		if key == "" {
+			if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+				key = strings.TrimPrefix(auth, "Bearer ")
+			}
+		}
+		if key == "" {
+			key = websocketAPIKey(c.Request)
+		}
+
+		if key != "" {
+			user, err := store.UserByAPIKey(key)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+				return
+			}
+			c.Set("user", user)
+			c.Set("actor", user.Username)
+		}
+		// For the hooks around the container operations of the request
+		c.Request = c.Request.WithContext(withActor(c.Request.Context(), actorName(c)))
+		c.Next()
+	}
+}
+
+func websocketAPIKey(r *http.Request) string {
+	for _, protocol := range strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",") {
+		if key, ok := strings.CutPrefix(strings.TrimSpace(protocol), websocketKeyProtocol); ok {
+			return key
+		}
+	}
+	return ""
+}
+
+func currentUser(c *gin.Context) *User {
+	if v, ok := c.Get("user"); ok {
+		return v.(*User)
+	}
+	return nil
+}
+
+func actorName(c *gin.Context) string {
+	if actor := c.GetString("actor"); actor != "" {
+		return actor
+	}
+	return "anonymous"
+}
+
+func isAdmin(c *gin.Context) bool {
+	user := currentUser(c)
+	return user != nil && user.Role == roleAdmin
+}
+
+// callerRole is the caller's role, "anonymous" without an API key
+func callerRole(c *gin.Context) string {
+	if user := currentUser(c); user != nil {
+		return user.Role
+	}
+	return roleAnonymous
+}
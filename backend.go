@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/gin-gonic/gin"
+)
+
+// Container backends selectable with CONTAINER_BACKEND
+const (
+	backendDocker     = "docker"
+	backendContainerd = "containerd"
+)
+
+// BackendContainer is a container as the backend interface reports it
+type BackendContainer struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Image   string            `json:"image"`
+	State   string            `json:"state"`
+	Labels  map[string]string `json:"labels"`
+	Created time.Time         `json:"created"`
+}
+
+type BackendCreateRequest struct {
+	Name   string            `json:"name" binding:"required,resourcename"`
+	Image  string            `json:"image" binding:"required,imageref"`
+	Env    []string          `json:"env"`
+	Labels map[string]string `json:"labels"`
+}
+
+// ContainerBackend is the container lifecycle shared by every runtime the
+// server can drive. Only dockerd is implemented: a containerd backend needs
+// the containerd client module, which isn't a dependency of this module.
+type ContainerBackend interface {
+	Name() string
+	List(ctx context.Context) ([]BackendContainer, error)
+	// Create pulls the image when it is missing and returns the new ID
+	Create(ctx context.Context, req BackendCreateRequest) (string, error)
+	Start(ctx context.Context, id string) error
+	// Stop sends SIGTERM and kills the container after timeout
+	Stop(ctx context.Context, id string, timeout time.Duration) error
+	Close() error
+}
+
+// backendName is the CONTAINER_BACKEND setting, docker by default
+func backendName() string {
+	if name := os.Getenv("CONTAINER_BACKEND"); name != "" {
+		return name
+	}
+	return backendDocker
+}
+
+func newBackend() (ContainerBackend, error) {
+	switch name := backendName(); name {
+	case backendDocker:
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			return nil, err
+		}
+		return &dockerBackend{cli: cli}, nil
+	case backendContainerd:
+		return nil, errors.New("the containerd backend is not available yet, use docker")
+	default:
+		return nil, fmt.Errorf("unknown CONTAINER_BACKEND %q, use docker or containerd", name)
+	}
+}
+
+type dockerBackend struct {
+	cli *client.Client
+}
+
+func (b *dockerBackend) Name() string { return backendDocker }
+
+func (b *dockerBackend) Close() error { return b.cli.Close() }
+
+func (b *dockerBackend) List(ctx context.Context) ([]BackendContainer, error) {
+	containers, err := b.cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	list := []BackendContainer{}
+	for _, c := range containers {
+		list = append(list, BackendContainer{
+			ID:      c.ID,
+			Name:    summaryName(c),
+			Image:   c.Image,
+			State:   c.State,
+			Labels:  c.Labels,
+			Created: time.Unix(c.Created, 0).UTC(),
+		})
+	}
+	return list, nil
+}
+
+func (b *dockerBackend) Create(ctx context.Context, req BackendCreateRequest) (string, error) {
+	if err := ensureImage(ctx, b.cli, req.Image); err != nil {
+		return "", err
+	}
+	resp, err := createContainer(ctx, b.cli, &container.Config{Image: req.Image, Env: req.Env, Labels: req.Labels}, &container.HostConfig{}, nil, req.Name)
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (b *dockerBackend) Start(ctx context.Context, id string) error {
+	return startContainer(ctx, b.cli, id, container.StartOptions{})
+}
+
+func (b *dockerBackend) Stop(ctx context.Context, id string, timeout time.Duration) error {
+	seconds := int(timeout.Seconds())
+	return stopContainer(ctx, b.cli, id, container.StopOptions{Timeout: &seconds})
+}
+
+// registerRuntimeRoutes adds list/create/start/stop under /runtime, served
+// by the backend chosen with CONTAINER_BACKEND. The other endpoints always
+// talk to dockerd. Creates and stops are checked like those of /create and
+// /stop/:id, and the backend runs the hooks.
+func registerRuntimeRoutes(r *gin.Engine, store *Store) {
+	runtime := r.Group("/runtime")
+
+	// withBackend opens the backend for one request
+	withBackend := func(handle func(ctx *gin.Context, backend ContainerBackend)) gin.HandlerFunc {
+		return func(ctx *gin.Context) {
+			backend, err := newBackend()
+			if err != nil {
+				ctx.JSON(http.StatusServiceUnavailable, gin.H{
+					"error":      "Container backend is not available: " + err.Error(),
+					"suggestion": "Kiểm tra CONTAINER_BACKEND và daemon tương ứng (dockerd hoặc containerd)",
+				})
+				return
+			}
+			defer backend.Close()
+			handle(ctx, backend)
+		}
+	}
+
+	runtime.GET("", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{"backend": backendName()})
+	})
+
+	runtime.GET("/containers", withBackend(func(ctx *gin.Context, backend ContainerBackend) {
+		containers, err := backend.List(ctx.Request.Context())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing containers: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"backend": backend.Name(), "containers": containers})
+	}))
+
+	runtime.POST("/containers", withBackend(func(ctx *gin.Context, backend ContainerBackend) {
+		var req BackendCreateRequest
+		if !bindJSON(ctx, &req) {
+			return
+		}
+		// Owner, project, protection and the like are set by the server
+		for label := range req.Labels {
+			if strings.HasPrefix(label, labelPrefix) {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error":      "Labels starting with " + labelPrefix + " are reserved: " + label,
+					"suggestion": "Bỏ các label này; owner, project và chế độ bảo vệ do server quản lý qua các endpoint riêng",
+				})
+				return
+			}
+		}
+		if req.Labels == nil {
+			req.Labels = map[string]string{}
+		}
+		req.Labels[ownerLabel] = actorName(ctx)
+
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+		if err := checkQuotas(ctx.Request.Context(), cli, store, actorName(ctx), "", 0, nil); err != nil {
+			respondQuotaError(ctx, err)
+			return
+		}
+
+		id, err := backend.Create(ctx.Request.Context(), req)
+		if respondHookError(ctx, err) {
+			return
+		}
+		if err != nil {
+			ctx.JSON(pullErrorStatus(err), gin.H{"error": "Error creating container: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Container created", "id": id, "backend": backend.Name()})
+	}))
+
+	runtime.POST("/containers/:id/start", withBackend(func(ctx *gin.Context, backend ContainerBackend) {
+		if err := backend.Start(ctx.Request.Context(), ctx.Param("id")); err != nil {
+			if respondHookError(ctx, err) {
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting container: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Container " + ctx.Param("id") + " started"})
+	}))
+
+	runtime.POST("/containers/:id/stop", withBackend(func(ctx *gin.Context, backend ContainerBackend) {
+		var query struct {
+			Timeout int `form:"timeout" binding:"omitempty,min=0,max=600"`
+		}
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			respondBindError(ctx, err)
+			return
+		}
+		timeout := 10 * time.Second
+		if query.Timeout > 0 {
+			timeout = time.Duration(query.Timeout) * time.Second
+		}
+
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+		if !allowUnprotected(ctx, cli, store, ctx.Param("id")) {
+			return
+		}
+
+		if err := backend.Stop(ctx.Request.Context(), ctx.Param("id"), timeout); err != nil {
+			if respondHookError(ctx, err) {
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error stopping container: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Container " + ctx.Param("id") + " stopped"})
+	}))
+}
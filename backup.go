@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Format name and version of backup archives
+const (
+	backupFormat  = "golang-docker-backup"
+	backupVersion = 1
+)
+
+// Archives start with this, then the scrypt salt, the GCM nonce and the
+// sealed gzipped JSON
+var backupMagic = []byte("GDBACKUP1\n")
+
+const backupSaltSize = 16
+
+// backupTables are the tables holding application state, parents before
+// the tables referencing them. Audit logs, jobs and session recordings are
+// history, not state, and stay out of backups.
+var backupTables = []string{
+	"users",
+	"api_keys",
+	"templates",
+	"deployments",
+	"annotations",
+	"favorites",
+	"projects",
+	"secrets",
+	"config_files",
+	"retention_rules",
+	"quotas",
+	"approvals",
+	"trash",
+	"protected_containers",
+	"exec_rules",
+	"proxy_routes",
+	"desired_containers",
+}
+
+// Backup is the content of a backup archive. Secret values are kept in
+// plaintext inside the encrypted archive, so it restores on a server with
+// another master key.
+type Backup struct {
+	Format        string                  `json:"format"`
+	Version       int                     `json:"version"`
+	Driver        string                  `json:"driver"`
+	SchemaVersion int                     `json:"schema_version"`
+	CreatedAt     time.Time               `json:"created_at"`
+	CreatedBy     string                  `json:"created_by"`
+	Tables        map[string]*BackupTable `json:"tables"`
+	Secrets       map[string]string       `json:"secrets"`
+}
+
+type BackupTable struct {
+	Columns []string `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+}
+
+// Summary counts the rows of each table in a backup
+func (b *Backup) Summary() map[string]int {
+	counts := map[string]int{}
+	for name, table := range b.Tables {
+		counts[name] = len(table.Rows)
+	}
+	return counts
+}
+
+// schemaVersion is the latest migration applied to the database
+func (s *Store) schemaVersion() (int, error) {
+	var version int
+	err := s.queryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// ExportBackup reads the application state, decrypting secrets with box
+func (s *Store) ExportBackup(box *SecretBox, actor string) (*Backup, error) {
+	version, err := s.schemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	b := &Backup{
+		Format:        backupFormat,
+		Version:       backupVersion,
+		Driver:        s.driver,
+		SchemaVersion: version,
+		CreatedAt:     time.Now().UTC(),
+		CreatedBy:     actor,
+		Tables:        map[string]*BackupTable{},
+		Secrets:       map[string]string{},
+	}
+	for _, name := range backupTables {
+		table, err := s.exportTable(name)
+		if err != nil {
+			return nil, fmt.Errorf("exporting %s: %w", name, err)
+		}
+		b.Tables[name] = table
+	}
+
+	secrets, err := s.ListSecrets()
+	if err != nil {
+		return nil, err
+	}
+	for _, secret := range secrets {
+		value, err := s.SecretValue(box, secret.Name)
+		if err != nil {
+			return nil, err
+		}
+		b.Secrets[secret.Name] = value
+	}
+	return b, nil
+}
+
+func (s *Store) exportTable(name string) (*BackupTable, error) {
+	rows, err := s.query(`SELECT * FROM ` + name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	table := &BackupTable{Columns: columns, Rows: [][]any{}}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			// Text columns may come back as bytes, which JSON would base64
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		table.Rows = append(table.Rows, values)
+	}
+	return table, rows.Err()
+}
+
+// RestoreBackup replaces the application state with a backup in one
+// transaction, sealing secrets with box. Tables the backup doesn't have are
+// left alone.
+func (s *Store) RestoreBackup(box *SecretBox, b *Backup) error {
+	if b.Format != backupFormat || b.Version != backupVersion {
+		return fmt.Errorf("not a backup archive of this server (format %q version %d)", b.Format, b.Version)
+	}
+	if b.Driver != s.driver {
+		return fmt.Errorf("backup was taken from a %s database, this server uses %s", b.Driver, s.driver)
+	}
+	version, err := s.schemaVersion()
+	if err != nil {
+		return err
+	}
+	if b.SchemaVersion > version {
+		return fmt.Errorf("backup has schema version %d, newer than this server's %d: upgrade the server first", b.SchemaVersion, version)
+	}
+
+	// Secrets are sealed again with this server's master key
+	if secrets := b.Tables["secrets"]; secrets != nil {
+		nameColumn, ciphertextColumn := -1, -1
+		for i, column := range secrets.Columns {
+			switch column {
+			case "name":
+				nameColumn = i
+			case "ciphertext":
+				ciphertextColumn = i
+			}
+		}
+		if nameColumn < 0 || ciphertextColumn < 0 {
+			return errors.New("secrets table of the backup has no name or ciphertext column")
+		}
+		for _, row := range secrets.Rows {
+			name, _ := row[nameColumn].(string)
+			value, ok := b.Secrets[name]
+			if !ok {
+				return fmt.Errorf("backup has no value for secret %s", name)
+			}
+			if row[ciphertextColumn], err = box.Seal(name, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for i := len(backupTables) - 1; i >= 0; i-- {
+		if b.Tables[backupTables[i]] == nil {
+			continue
+		}
+		if _, err := tx.Exec(`DELETE FROM ` + backupTables[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("clearing %s: %w", backupTables[i], err)
+		}
+	}
+	for _, name := range backupTables {
+		table := b.Tables[name]
+		if table == nil {
+			continue
+		}
+		insert := s.rebind(`INSERT INTO ` + name + ` (` + strings.Join(table.Columns, ", ") + `) VALUES (` +
+			strings.TrimSuffix(strings.Repeat("?, ", len(table.Columns)), ", ") + `)`)
+		for _, row := range table.Rows {
+			if len(row) != len(table.Columns) {
+				tx.Rollback()
+				return fmt.Errorf("restoring %s: row has %d values for %d columns", name, len(row), len(table.Columns))
+			}
+			if _, err := tx.Exec(insert, row...); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("restoring %s: %w", name, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// backupKey derives the archive key from the passphrase
+func backupKey(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealBackup encodes a backup as an archive encrypted with the passphrase
+func sealBackup(b *Backup, passphrase string) ([]byte, error) {
+	var plain bytes.Buffer
+	zw := gzip.NewWriter(&plain)
+	if err := json.NewEncoder(zw).Encode(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, backupSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := backupKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	header := append(append(append([]byte{}, backupMagic...), salt...), nonce...)
+	// The header is authenticated too
+	return aead.Seal(header, nonce, plain.Bytes(), header), nil
+}
+
+// openBackup decrypts and decodes an archive
+func openBackup(archive []byte, passphrase string) (*Backup, error) {
+	if !bytes.HasPrefix(archive, backupMagic) {
+		return nil, errors.New("not a backup archive")
+	}
+	rest := archive[len(backupMagic):]
+	if len(rest) < backupSaltSize {
+		return nil, errors.New("backup archive is truncated")
+	}
+	aead, err := backupKey(passphrase, rest[:backupSaltSize])
+	if err != nil {
+		return nil, err
+	}
+	headerSize := len(backupMagic) + backupSaltSize + aead.NonceSize()
+	if len(archive) < headerSize {
+		return nil, errors.New("backup archive is truncated")
+	}
+	header := archive[:headerSize]
+	plain, err := aead.Open(nil, header[headerSize-aead.NonceSize():], archive[headerSize:], header)
+	if err != nil {
+		return nil, errors.New("cannot decrypt backup: wrong passphrase or damaged archive")
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(plain))
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(zr)
+	// Keep integers such as timestamps exact
+	decoder.UseNumber()
+	var b Backup
+	if err := decoder.Decode(&b); err != nil {
+		return nil, fmt.Errorf("decoding backup: %w", err)
+	}
+	for _, table := range b.Tables {
+		for _, row := range table.Rows {
+			for i, v := range row {
+				if n, ok := v.(json.Number); ok {
+					if row[i], err = n.Int64(); err != nil {
+						row[i], _ = n.Float64()
+					}
+				}
+			}
+		}
+	}
+	return &b, nil
+}
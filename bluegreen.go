@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+)
+
+// Marks the short-lived candidate container of a blue/green deployment
+const blueGreenCandidateLabel = labelPrefix + "bluegreen-candidate"
+
+// BlueGreenResult reports a blue/green deployment step by step
+type BlueGreenResult struct {
+	Container string `json:"container"`
+	Image     string `json:"image"`
+	// Ports the candidate was published on while it was verified
+	CandidatePorts []string    `json:"candidate_ports"`
+	CandidateWait  *WaitResult `json:"candidate_wait,omitempty"`
+	NewID          string      `json:"new_id,omitempty"`
+	Wait           *WaitResult `json:"wait,omitempty"`
+	OldContainer   string      `json:"old_container,omitempty"`
+	OldRemoved     bool        `json:"old_removed"`
+	RolledBack     bool        `json:"rolled_back"`
+	Steps          []string    `json:"steps"`
+}
+
+func (r *BlueGreenResult) step(format string, args ...any) {
+	r.Steps = append(r.Steps, fmt.Sprintf(format, args...))
+}
+
+// candidateSpec copies spec for the candidate: published ports move to
+// ports docker picks, and network aliases are dropped so the candidate gets
+// no traffic meant for the live container
+func candidateSpec(spec *ContainerSpec) *ContainerSpec {
+	cfg := *spec.Config
+	cfg.Labels = map[string]string{blueGreenCandidateLabel: "true"}
+	for k, v := range spec.Config.Labels {
+		cfg.Labels[k] = v
+	}
+	// The hostname of the old container would clash in logs and metrics
+	cfg.Hostname = ""
+	hostCfg := *spec.HostConfig
+	hostCfg.PortBindings = nat.PortMap{}
+	for port, bindings := range spec.HostConfig.PortBindings {
+		moved := make([]nat.PortBinding, 0, len(bindings))
+		for _, b := range bindings {
+			moved = append(moved, nat.PortBinding{HostIP: b.HostIP})
+		}
+		hostCfg.PortBindings[port] = moved
+	}
+	hostCfg.RestartPolicy = container.RestartPolicy{}
+	networks := map[string]*network.EndpointSettings{}
+	for name, ep := range spec.Networks {
+		networks[name] = &network.EndpointSettings{DriverOpts: ep.DriverOpts}
+	}
+	return &ContainerSpec{Config: &cfg, HostConfig: &hostCfg, Networks: networks}
+}
+
+func publishedPorts(info container.InspectResponse) []string {
+	ports := []string{}
+	if info.NetworkSettings == nil {
+		return ports
+	}
+	for port, bindings := range info.NetworkSettings.Ports {
+		for _, b := range bindings {
+			ports = append(ports, b.HostIP+":"+b.HostPort+"->"+string(port))
+		}
+	}
+	return ports
+}
+
+func createFromSpec(ctx context.Context, cli *client.Client, spec *ContainerSpec, name string) (string, error) {
+	var netConfig *network.NetworkingConfig
+	if len(spec.Networks) > 0 {
+		netConfig = &network.NetworkingConfig{EndpointsConfig: spec.Networks}
+	}
+	resp, err := createContainer(ctx, cli, spec.Config, spec.HostConfig, netConfig, name)
+	if err != nil {
+		return "", err
+	}
+	if err := copyConfigs(ctx, cli, resp.ID, spec.Config.Labels); err != nil {
+		cli.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
+		return "", fmt.Errorf("copying configs: %w", err)
+	}
+	return resp.ID, nil
+}
+
+// blueGreenDeploy replaces a running container with one built from spec.
+// The new version first runs alongside the old one as a candidate on
+// alternate ports until it passes waitFor. Docker can't rebind the ports of
+// a container, so the swap stops the old container and starts the new
+// version under its name and ports; if that doesn't become ready either,
+// the old container is put back. The old container is removed at the end
+// unless keepOld is set, in which case it stays stopped under a new name.
+func blueGreenDeploy(ctx context.Context, cli *client.Client, containerID string, spec *ContainerSpec, waitFor string, timeout time.Duration, keepOld bool) (*BlueGreenResult, error) {
+	old, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimPrefix(old.Name, "/")
+	result := &BlueGreenResult{Container: name, Image: spec.Config.Image, CandidatePorts: []string{}, Steps: []string{}}
+	if old.State == nil || !old.State.Running {
+		return result, fmt.Errorf("blue/green deployment needs a running container, use redeploy for stopped ones")
+	}
+	if old.HostConfig != nil && old.HostConfig.AutoRemove {
+		return result, fmt.Errorf("containers created with auto_remove can't be replaced")
+	}
+	suffix := strconv.FormatInt(time.Now().Unix(), 10)
+
+	// Green: verify the new version without touching the live container
+	candidateName := name + "-green-" + suffix
+	candidateID, err := createFromSpec(ctx, cli, candidateSpec(spec), candidateName)
+	if err != nil {
+		return result, fmt.Errorf("creating candidate: %w", err)
+	}
+	defer cli.ContainerRemove(context.Background(), candidateID, container.RemoveOptions{Force: true})
+	if err := startContainer(ctx, cli, candidateID, container.StartOptions{}); err != nil {
+		return result, fmt.Errorf("starting candidate: %w", err)
+	}
+	if info, err := cli.ContainerInspect(ctx, candidateID); err == nil {
+		result.CandidatePorts = publishedPorts(info)
+	}
+	result.step("started candidate %s", candidateName)
+	result.CandidateWait, err = waitForContainer(ctx, cli, candidateID, waitFor, timeout)
+	if err != nil {
+		return result, fmt.Errorf("candidate is not %s, %s was left untouched: %w", waitFor, name, err)
+	}
+	result.step("candidate is %s after %s", waitFor, result.CandidateWait.Waited)
+	cli.ContainerStop(ctx, candidateID, container.StopOptions{})
+	result.step("stopped candidate")
+
+	// Swap: the ports and the name move to the new version
+	result.OldContainer = name + "-blue-" + suffix
+	if err := stopContainer(ctx, cli, old.ID, container.StopOptions{}); err != nil {
+		return result, fmt.Errorf("stopping %s: %w", name, err)
+	}
+	if err := cli.ContainerRename(ctx, old.ID, result.OldContainer); err != nil {
+		cli.ContainerStart(context.Background(), old.ID, container.StartOptions{})
+		return result, fmt.Errorf("renaming %s: %w", name, err)
+	}
+	result.step("stopped %s and renamed it to %s", name, result.OldContainer)
+
+	rollback := func(cause error) (*BlueGreenResult, error) {
+		bg := context.Background()
+		if result.NewID != "" {
+			cli.ContainerRemove(bg, result.NewID, container.RemoveOptions{Force: true})
+			result.NewID = ""
+		}
+		result.RolledBack = true
+		if err := cli.ContainerRename(bg, old.ID, name); err != nil {
+			return result, fmt.Errorf("%w; renaming the old container back also failed: %v", cause, err)
+		}
+		if err := cli.ContainerStart(bg, old.ID, container.StartOptions{}); err != nil {
+			return result, fmt.Errorf("%w; restarting the old container also failed: %v", cause, err)
+		}
+		result.OldContainer = ""
+		result.step("rolled back to the old container")
+		return result, cause
+	}
+
+	result.NewID, err = createFromSpec(ctx, cli, spec, name)
+	if err != nil {
+		return rollback(fmt.Errorf("creating new container: %w", err))
+	}
+	if err := startContainer(ctx, cli, result.NewID, container.StartOptions{}); err != nil {
+		return rollback(fmt.Errorf("starting new container: %w", err))
+	}
+	result.step("started new version of %s", name)
+	result.Wait, err = waitForContainer(ctx, cli, result.NewID, waitFor, timeout)
+	if err != nil {
+		return rollback(fmt.Errorf("new container is not %s: %w", waitFor, err))
+	}
+	result.step("new version is %s after %s", waitFor, result.Wait.Waited)
+
+	if !keepOld {
+		if err := removeContainer(ctx, cli, old.ID, container.RemoveOptions{}); err != nil {
+			result.step("removing %s failed: %v", result.OldContainer, err)
+		} else {
+			result.OldRemoved = true
+			result.step("removed %s", result.OldContainer)
+			result.OldContainer = ""
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/build"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	units "github.com/docker/go-units"
+	"github.com/gin-gonic/gin"
+)
+
+type BuildCacheEntry struct {
+	ID          string     `json:"id"`
+	Parents     []string   `json:"parents,omitempty"`
+	Type        string     `json:"type"`
+	Description string     `json:"description"`
+	InUse       bool       `json:"in_use"`
+	Shared      bool       `json:"shared"`
+	Size        int64      `json:"size"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	UsageCount  int        `json:"usage_count"`
+}
+
+// BuildCacheQuery filters and orders GET /build-cache
+type BuildCacheQuery struct {
+	Type string `json:"type" form:"type" binding:"omitempty,oneof=regular source.local source.git.checkout exec.cachemount frontend internal"`
+	// Only entries not used for this long, e.g. "72h" or "7d"
+	UnusedFor string `json:"unused_for" form:"unused_for" binding:"omitempty,ttl"`
+	InUse     *bool  `json:"in_use" form:"in_use"`
+	Sort      string `json:"sort" form:"sort" binding:"omitempty,oneof=size last_used"`
+	Limit     int    `json:"limit" form:"limit" binding:"omitempty,min=1,max=10000"`
+}
+
+// listBuildCache returns the build cache entries matching q, largest first
+// unless q sorts by last use (least recently used first), and their total
+// size
+func listBuildCache(ctx context.Context, cli *client.Client, q BuildCacheQuery) ([]BuildCacheEntry, int64, error) {
+	usage, err := cli.DiskUsage(ctx, types.DiskUsageOptions{Types: []types.DiskUsageObject{types.BuildCacheObject}})
+	if err != nil {
+		return nil, 0, err
+	}
+	var unusedFor time.Duration
+	if q.UnusedFor != "" {
+		unusedFor, _ = parseTTL(q.UnusedFor)
+	}
+
+	entries := []BuildCacheEntry{}
+	var total int64
+	for _, r := range usage.BuildCache {
+		if q.Type != "" && r.Type != q.Type {
+			continue
+		}
+		if q.InUse != nil && r.InUse != *q.InUse {
+			continue
+		}
+		parents := r.Parents
+		if len(parents) == 0 && r.Parent != "" {
+			parents = []string{r.Parent}
+		}
+		entry := BuildCacheEntry{
+			ID:          r.ID,
+			Parents:     parents,
+			Type:        r.Type,
+			Description: r.Description,
+			InUse:       r.InUse,
+			Shared:      r.Shared,
+			Size:        r.Size,
+			CreatedAt:   r.CreatedAt,
+			LastUsedAt:  r.LastUsedAt,
+			UsageCount:  r.UsageCount,
+		}
+		if unusedFor > 0 && (r.InUse || time.Since(entry.lastUsed()) < unusedFor) {
+			continue
+		}
+		entries = append(entries, entry)
+		total += r.Size
+	}
+
+	if q.Sort == "last_used" {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].lastUsed().Before(entries[j].lastUsed()) })
+	} else {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Size > entries[j].Size })
+	}
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[:q.Limit]
+	}
+	return entries, total, nil
+}
+
+func (e BuildCacheEntry) lastUsed() time.Time {
+	if e.LastUsedAt != nil {
+		return *e.LastUsedAt
+	}
+	return e.CreatedAt
+}
+
+// deleteBuildCache prunes the given entries one by one. Entries in use, and
+// those other entries still build on, are kept by the daemon and reported as
+// such.
+func deleteBuildCache(ctx context.Context, cli *client.Client, ids []string) (map[string]any, uint64, error) {
+	entries, _, err := listBuildCache(ctx, cli, BuildCacheQuery{})
+	if err != nil {
+		return nil, 0, err
+	}
+	known := map[string]BuildCacheEntry{}
+	for _, e := range entries {
+		known[e.ID] = e
+	}
+
+	results := map[string]any{}
+	var reclaimed uint64
+	for _, id := range ids {
+		entry, ok := known[id]
+		switch {
+		case !ok:
+			results[id] = gin.H{"status": "not_found"}
+			continue
+		case entry.InUse:
+			results[id] = gin.H{"status": "in_use", "message": "a running build uses this entry"}
+			continue
+		}
+		report, err := cli.BuildCachePrune(ctx, build.CachePruneOptions{
+			// Without All only dangling entries are considered
+			All:     true,
+			Filters: filters.NewArgs(filters.Arg("id", id)),
+		})
+		if err != nil {
+			results[id] = gin.H{"status": "error", "message": err.Error()}
+			continue
+		}
+		if !containsString(report.CachesDeleted, id) {
+			results[id] = gin.H{"status": "kept", "message": "other cache entries still build on this one"}
+			continue
+		}
+		results[id] = gin.H{"status": "deleted", "size": entry.Size}
+		reclaimed += report.SpaceReclaimed
+	}
+	fmt.Printf("🧹 Deleted build cache entries, %s reclaimed\n", units.HumanSize(float64(reclaimed)))
+	return results, reclaimed, nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// Version of the container bundle format
+const bundleVersion = 1
+
+// Bundle is the definition of every managed container of a host, enough to
+// create them again elsewhere
+type Bundle struct {
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exported_at"`
+	ExportedBy string            `json:"exported_by"`
+	Host       string            `json:"host"`
+	Networks   []string          `json:"networks"`
+	Containers []BundleContainer `json:"containers"`
+}
+
+// BundleContainer is one container of a bundle. Secret env vars are
+// redacted and resolved again from the secrets of the importing server.
+type BundleContainer struct {
+	Name        string         `json:"name"`
+	Image       string         `json:"image"`
+	ImageDigest string         `json:"image_digest,omitempty"`
+	Running     bool           `json:"running"`
+	Spec        *ContainerSpec `json:"spec"`
+}
+
+// Networks every Docker host has, which are never created on import
+var builtinNetworks = map[string]bool{"bridge": true, "host": true, "none": true}
+
+// exportBundle collects the containers created through this API, or all
+// containers with all set
+func exportBundle(ctx context.Context, cli *client.Client, all bool, actor string) (*Bundle, error) {
+	options := container.ListOptions{All: true}
+	if !all {
+		options.Filters = filters.NewArgs(filters.Arg("label", ownerLabel))
+	}
+	containers, err := cli.ContainerList(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	bundle := &Bundle{
+		Version:    bundleVersion,
+		ExportedAt: time.Now().UTC(),
+		ExportedBy: actor,
+		Host:       host,
+		Networks:   []string{},
+		Containers: []BundleContainer{},
+	}
+	for _, c := range containers {
+		info, err := cli.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			return nil, fmt.Errorf("inspecting %s: %w", summaryName(c), err)
+		}
+		spec := specFromInspect(info)
+		redactSecretEnv(spec.Config)
+		// Docker fills in the container ID, which means nothing elsewhere
+		if strings.HasPrefix(info.ID, spec.Config.Hostname) {
+			spec.Config.Hostname = ""
+		}
+		bundle.Containers = append(bundle.Containers, BundleContainer{
+			Name:        strings.TrimPrefix(info.Name, "/"),
+			Image:       info.Config.Image,
+			ImageDigest: imageDigest(ctx, cli, info.Image),
+			Running:     info.State != nil && info.State.Running,
+			Spec:        spec,
+		})
+	}
+	sort.Slice(bundle.Containers, func(i, j int) bool { return bundle.Containers[i].Name < bundle.Containers[j].Name })
+	bundle.Networks = bundleNetworks(bundle.Containers)
+	return bundle, nil
+}
+
+// bundleNetworks lists the user-defined networks the containers are on
+func bundleNetworks(containers []BundleContainer) []string {
+	seen := map[string]bool{}
+	networks := []string{}
+	for _, c := range containers {
+		for name := range c.Spec.Networks {
+			if !builtinNetworks[name] && !seen[name] {
+				seen[name] = true
+				networks = append(networks, name)
+			}
+		}
+	}
+	sort.Strings(networks)
+	return networks
+}
+
+// marshalBundleYAML writes the bundle as YAML with the same keys as the
+// JSON, which the Docker types only define json tags for
+func marshalBundleYAML(bundle *Bundle) ([]byte, error) {
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(doc)
+}
+
+// parseBundle reads a bundle in JSON, or YAML when isYAML is set
+func parseBundle(data []byte, isYAML bool) (*Bundle, error) {
+	if isYAML {
+		var doc any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, err
+		}
+	}
+	var bundle Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, err
+	}
+	if bundle.Version != bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", bundle.Version)
+	}
+	for i, c := range bundle.Containers {
+		if err := validateContainerName(c.Name); err != nil {
+			return nil, fmt.Errorf("container %d of the bundle: %w", i, err)
+		}
+		if c.Spec == nil || c.Spec.Config == nil {
+			return nil, fmt.Errorf("container %s of the bundle has no spec", c.Name)
+		}
+	}
+	return &bundle, nil
+}
+
+// ImportOptions control how a bundle is created on this host
+type ImportOptions struct {
+	// Use the image digest instead of the tag, for the exact same images
+	PinDigests bool `json:"pin_digests" form:"pin_digests"`
+	// Skip containers whose name is taken instead of failing the import
+	SkipExisting bool `json:"skip_existing" form:"skip_existing"`
+	// Leave every container stopped
+	NoStart bool `json:"no_start" form:"no_start"`
+	// Seconds to wait for each dependency stage to be ready
+	Timeout int `json:"timeout" form:"timeout" binding:"omitempty,min=1,max=3600"`
+}
+
+// importBundle creates the containers of a bundle, missing networks first,
+// then starts those that were running in dependency order. It stops at the
+// first container that can't be created; those created so far stay.
+func importBundle(ctx context.Context, cli *client.Client, store *Store, box *SecretBox, bundle *Bundle, opts ImportOptions) (map[string]interface{}, error) {
+	results := map[string]interface{}{}
+
+	for _, name := range bundle.Networks {
+		if _, err := cli.NetworkInspect(ctx, name, network.InspectOptions{}); err == nil {
+			continue
+		}
+		if _, err := cli.NetworkCreate(ctx, name, network.CreateOptions{}); err != nil {
+			return results, fmt.Errorf("creating network %s: %w", name, err)
+		}
+		fmt.Printf("🌐 Created network %s for the imported containers\n", name)
+	}
+
+	toStart := []string{}
+	for _, c := range bundle.Containers {
+		if _, err := cli.ContainerInspect(ctx, c.Name); err == nil {
+			if opts.SkipExisting {
+				results[c.Name] = gin.H{"status": "skipped", "message": "a container with this name exists"}
+				continue
+			}
+			return results, fmt.Errorf("a container named %s already exists", c.Name)
+		}
+
+		spec := *c.Spec
+		cfg := *spec.Config
+		spec.Config = &cfg
+		if opts.PinDigests && strings.Contains(c.ImageDigest, "@") {
+			spec.Config.Image = c.ImageDigest
+		}
+		if err := resolveSecretEnv(store, box, spec.Config); err != nil {
+			return results, fmt.Errorf("%s: resolving secrets: %w", c.Name, err)
+		}
+		if err := ensureImage(ctx, cli, spec.Config.Image); err != nil {
+			return results, fmt.Errorf("%s: pulling %s: %w", c.Name, spec.Config.Image, err)
+		}
+		id, err := createFromSpec(ctx, cli, &spec, c.Name)
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		results[c.Name] = gin.H{"status": "created", "id": id[:12]}
+		if c.Running && !opts.NoStart {
+			toStart = append(toStart, id)
+		}
+	}
+
+	if len(toStart) == 0 {
+		return results, nil
+	}
+	args := filters.NewArgs()
+	for _, id := range toStart {
+		args.Add("id", id)
+	}
+	created, err := cli.ContainerList(ctx, container.ListOptions{All: true, Filters: args})
+	if err != nil {
+		return results, err
+	}
+	stages, err := dependencyStages(created)
+	if err != nil {
+		return results, err
+	}
+	timeout := defaultHealthWait
+	if opts.Timeout > 0 {
+		timeout = time.Duration(opts.Timeout) * time.Second
+	}
+	startInOrder(ctx, cli, stages, timeout, results)
+	return results, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/gin-gonic/gin"
+)
+
+// requireExperimental answers 501 and returns false unless the daemon runs
+// with experimental features, which checkpoints need (together with CRIU)
+func requireExperimental(ctx *gin.Context, cli *client.Client) bool {
+	ping, err := cli.Ping(ctx.Request.Context())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Docker daemon is not accessible: " + err.Error()})
+		return false
+	}
+	if !ping.Experimental {
+		ctx.JSON(http.StatusNotImplemented, gin.H{
+			"error":      "Checkpoints need a Docker daemon with experimental features enabled",
+			"suggestion": "Bật \"experimental\": true trong /etc/docker/daemon.json, cài CRIU rồi khởi động lại Docker",
+		})
+		return false
+	}
+	return true
+}
+
+// checkpointErrorStatus maps a daemon error of a checkpoint call to a status
+func checkpointErrorStatus(err error) int {
+	switch {
+	case client.IsErrNotFound(err):
+		return http.StatusNotFound
+	case strings.Contains(err.Error(), "already exists"):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
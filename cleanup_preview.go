@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+// Label Docker sets on volumes created without a name, the only ones a
+// prune removes since Docker 23
+const anonymousVolumeLabel = "com.docker.volume.anonymous"
+
+type CleanupContainer struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Image  string `json:"image"`
+	Status string `json:"status"`
+	Size   int64  `json:"size"`
+	// Trashed containers are stopped too, a cleanup removes them for good
+	InTrash bool `json:"in_trash"`
+}
+
+type CleanupImage struct {
+	ID      string    `json:"id"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+}
+
+type CleanupVolume struct {
+	Name   string `json:"name"`
+	Driver string `json:"driver"`
+	// -1 when the daemon couldn't compute it
+	Size int64 `json:"size"`
+}
+
+type CleanupNetwork struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Driver string `json:"driver"`
+}
+
+// CleanupPreview is what POST /cleanup would remove, with the space it
+// would free. Sizes are estimates: layers shared with other images are
+// counted with each image.
+type CleanupPreview struct {
+	Containers []CleanupContainer `json:"containers"`
+	Images     []CleanupImage     `json:"images"`
+	Volumes    []CleanupVolume    `json:"volumes"`
+	// Volumes are only removed with ?volumes=true
+	VolumesIncluded bool             `json:"volumes_included"`
+	Networks        []CleanupNetwork `json:"networks"`
+	BuildCache      struct {
+		Count int   `json:"count"`
+		Size  int64 `json:"size"`
+	} `json:"build_cache"`
+	Reclaimable map[string]int64 `json:"reclaimable"`
+}
+
+// previewCleanup lists what "docker system prune" removes: stopped
+// containers, dangling images not used by a running container, networks
+// without containers, unused build cache, and with volumes the anonymous
+// volumes no container uses
+func previewCleanup(ctx context.Context, cli *client.Client, volumes bool) (*CleanupPreview, error) {
+	usage, err := cli.DiskUsage(ctx, types.DiskUsageOptions{})
+	if err != nil {
+		return nil, err
+	}
+	preview := &CleanupPreview{
+		Containers:      []CleanupContainer{},
+		Images:          []CleanupImage{},
+		Volumes:         []CleanupVolume{},
+		VolumesIncluded: volumes,
+		Networks:        []CleanupNetwork{},
+		Reclaimable:     map[string]int64{},
+	}
+
+	// Images of running containers stay, even when dangling
+	inUse := map[string]bool{}
+	for _, c := range usage.Containers {
+		if c.State == "running" || c.State == "paused" || c.State == "restarting" {
+			inUse[c.ImageID] = true
+			continue
+		}
+		name := summaryName(*c)
+		preview.Containers = append(preview.Containers, CleanupContainer{
+			ID:      c.ID[:12],
+			Name:    name,
+			Image:   c.Image,
+			Status:  c.Status,
+			Size:    c.SizeRw,
+			InTrash: strings.HasPrefix(name, trashPrefix),
+		})
+		preview.Reclaimable["containers"] += c.SizeRw
+	}
+
+	for _, img := range usage.Images {
+		dangling := len(img.RepoTags) == 0 || (len(img.RepoTags) == 1 && img.RepoTags[0] == "<none>:<none>")
+		if !dangling || inUse[img.ID] {
+			continue
+		}
+		preview.Images = append(preview.Images, CleanupImage{
+			ID:      strings.TrimPrefix(img.ID, "sha256:")[:12],
+			Size:    img.Size,
+			Created: time.Unix(img.Created, 0),
+		})
+		preview.Reclaimable["images"] += img.Size
+	}
+
+	for _, v := range usage.Volumes {
+		if _, anonymous := v.Labels[anonymousVolumeLabel]; !anonymous || v.UsageData == nil || v.UsageData.RefCount > 0 {
+			continue
+		}
+		preview.Volumes = append(preview.Volumes, CleanupVolume{Name: v.Name, Driver: v.Driver, Size: v.UsageData.Size})
+		if volumes && v.UsageData.Size > 0 {
+			preview.Reclaimable["volumes"] += v.UsageData.Size
+		}
+	}
+
+	for _, cache := range usage.BuildCache {
+		if cache.InUse || cache.Shared {
+			continue
+		}
+		preview.BuildCache.Count++
+		preview.BuildCache.Size += cache.Size
+	}
+	preview.Reclaimable["build_cache"] = preview.BuildCache.Size
+
+	networks, err := cli.NetworkList(ctx, network.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range networks {
+		if builtinNetworks[n.Name] || n.Scope != "local" || n.Ingress {
+			continue
+		}
+		// The list leaves out attached containers
+		info, err := cli.NetworkInspect(ctx, n.ID, network.InspectOptions{})
+		if err != nil || len(info.Containers) > 0 {
+			continue
+		}
+		preview.Networks = append(preview.Networks, CleanupNetwork{ID: n.ID[:12], Name: n.Name, Driver: n.Driver})
+	}
+
+	sort.Slice(preview.Containers, func(i, j int) bool { return preview.Containers[i].Size > preview.Containers[j].Size })
+	sort.Slice(preview.Images, func(i, j int) bool { return preview.Images[i].Size > preview.Images[j].Size })
+	sort.Slice(preview.Volumes, func(i, j int) bool { return preview.Volumes[i].Size > preview.Volumes[j].Size })
+	sort.Slice(preview.Networks, func(i, j int) bool { return preview.Networks[i].Name < preview.Networks[j].Name })
+
+	var total int64
+	for _, size := range preview.Reclaimable {
+		total += size
+	}
+	preview.Reclaimable["total"] = total
+	return preview, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	units "github.com/docker/go-units"
+	"github.com/gin-gonic/gin"
+)
+
+// Responses smaller than this aren't worth compressing
+const defaultGzipMinSize = 1024
+
+// gzipWriter holds back the start of a response until it knows whether it
+// reaches the minimum size, then either compresses or passes it through.
+// Flushes decide early so streamed logs and events aren't delayed.
+type gzipWriter struct {
+	gin.ResponseWriter
+	minSize int
+	buf     []byte
+	gz      *gzip.Writer
+	decided bool
+}
+
+// compressible reports whether a content type benefits from gzip. Event
+// streams stay uncompressed, proxies and browsers buffer them otherwise.
+func compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == "application/json",
+		mediaType == "application/x-ndjson",
+		mediaType == "application/javascript",
+		mediaType == "application/xml",
+		mediaType == "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+func (w *gzipWriter) decide() {
+	w.decided = true
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || len(w.buf) < w.minSize {
+		return
+	}
+	switch w.Status() {
+	case http.StatusNoContent, http.StatusNotModified:
+		return
+	}
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(w.buf)
+	}
+	if !compressible(contentType) {
+		return
+	}
+	h.Set("Content-Encoding", "gzip")
+	h.Add("Vary", "Accept-Encoding")
+	h.Del("Content-Length")
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < w.minSize {
+			return len(p), nil
+		}
+		if err := w.flushBuffer(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// flushBuffer decides on compression and writes what was held back
+func (w *gzipWriter) flushBuffer() error {
+	w.decide()
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (w *gzipWriter) Flush() {
+	if !w.decided {
+		w.flushBuffer()
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// finish writes a response that stayed below the minimum size and ends the
+// gzip stream
+func (w *gzipWriter) finish() {
+	if !w.decided {
+		w.flushBuffer()
+	}
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
+
+// gzipMiddleware compresses text and JSON responses of at least minSize
+// bytes for clients that accept gzip. GZIP_MIN_SIZE sets the size ("1KB"
+// by default, "off" disables compression).
+func gzipMiddleware() gin.HandlerFunc {
+	minSize := defaultGzipMinSize
+	if v := os.Getenv("GZIP_MIN_SIZE"); v == "off" {
+		return func(c *gin.Context) { c.Next() }
+	} else if v != "" {
+		size, err := units.FromHumanSize(v)
+		if err != nil || size < 0 {
+			fmt.Printf("⚠️  Invalid GZIP_MIN_SIZE %q, using %d bytes\n", v, defaultGzipMinSize)
+		} else {
+			minSize = int(size)
+		}
+	}
+
+	return func(c *gin.Context) {
+		// WebSocket upgrades take over the connection, HEAD has no body
+		if !strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") ||
+			c.GetHeader("Upgrade") != "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		w := &gzipWriter{ResponseWriter: c.Writer, minSize: minSize}
+		c.Writer = w
+		defer func() {
+			c.Writer = w.ResponseWriter
+			w.finish()
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// configMountLabel records which managed config files are copied into a
+// container, as target=config-name pairs
+const configMountLabel = labelPrefix + "configs"
+
+// Same limit as docker swarm configs
+const maxConfigSize = 500 * 1024
+
+var configName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ConfigFile is a small file managed by the API and copied read-only into
+// containers, like docker configs on a standalone engine
+type ConfigFile struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name" binding:"required,resourcename"`
+	Description string    `json:"description"`
+	Content     string    `json:"content,omitempty"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// configStore is where copyConfigs reads config content from, so containers
+// recreated from a spec get their configs back; set once the store is open
+var configStore *Store
+
+func validateConfigFile(c *ConfigFile) error {
+	if !configName.MatchString(c.Name) {
+		return fmt.Errorf("invalid config name %q: use letters, digits, '.', '_' and '-'", c.Name)
+	}
+	if len(c.Content) > maxConfigSize {
+		return fmt.Errorf("config content exceeds %d bytes", maxConfigSize)
+	}
+	return nil
+}
+
+func (s *Store) CreateConfigFile(c *ConfigFile) error {
+	c.ID = newID()
+	c.CreatedAt = time.Now()
+	c.UpdatedAt = c.CreatedAt
+	_, err := s.exec(`INSERT INTO config_files (id, name, description, content, created_by, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		c.ID, c.Name, c.Description, c.Content, c.CreatedBy, c.CreatedAt.Unix(), c.UpdatedAt.Unix())
+	return err
+}
+
+func (s *Store) UpdateConfigFile(c *ConfigFile) error {
+	c.UpdatedAt = time.Now()
+	_, err := s.exec(`UPDATE config_files SET description = ?, content = ?, updated_at = ? WHERE id = ?`,
+		c.Description, c.Content, c.UpdatedAt.Unix(), c.ID)
+	return err
+}
+
+func (s *Store) DeleteConfigFile(id string) error {
+	_, err := s.exec(`DELETE FROM config_files WHERE id = ?`, id)
+	return err
+}
+
+func (s *Store) GetConfigFile(name string) (*ConfigFile, error) {
+	var c ConfigFile
+	var createdAt, updatedAt int64
+	err := s.queryRow(`SELECT id, name, description, content, created_by, created_at, updated_at FROM config_files WHERE name = ?`, name).
+		Scan(&c.ID, &c.Name, &c.Description, &c.Content, &c.CreatedBy, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	c.CreatedAt = time.Unix(createdAt, 0)
+	c.UpdatedAt = time.Unix(updatedAt, 0)
+	return &c, nil
+}
+
+// ListConfigFiles returns config metadata without the content
+func (s *Store) ListConfigFiles() ([]ConfigFile, error) {
+	rows, err := s.query(`SELECT id, name, description, created_by, created_at, updated_at FROM config_files ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	configs := []ConfigFile{}
+	for rows.Next() {
+		var c ConfigFile
+		var createdAt, updatedAt int64
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.CreatedBy, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		c.CreatedAt = time.Unix(createdAt, 0)
+		c.UpdatedAt = time.Unix(updatedAt, 0)
+		configs = append(configs, c)
+	}
+	return configs, rows.Err()
+}
+
+// attachConfigs checks the referenced configs (target path -> config name)
+// and records them in configMountLabel; copyConfigs writes them into the
+// container once it is created
+func attachConfigs(store *Store, config *container.Config, refs map[string]string) error {
+	if len(refs) == 0 {
+		return nil
+	}
+
+	var pairs []string
+	for target, name := range refs {
+		if !path.IsAbs(target) {
+			return fmt.Errorf("config target %q must be an absolute path", target)
+		}
+		if _, err := store.GetConfigFile(name); err != nil {
+			return fmt.Errorf("config not found: %s", name)
+		}
+		pairs = append(pairs, path.Clean(target)+"="+name)
+	}
+	sort.Strings(pairs)
+
+	if config.Labels == nil {
+		config.Labels = map[string]string{}
+	}
+	config.Labels[configMountLabel] = strings.Join(pairs, ",")
+	return nil
+}
+
+// copyConfigs writes the configs listed in configMountLabel into a container
+// as read-only files. Only the container's filesystem is touched, nothing
+// is shared with the docker host, and it works before the container starts.
+func copyConfigs(ctx context.Context, cli *client.Client, containerID string, labels map[string]string) error {
+	if labels[configMountLabel] == "" {
+		return nil
+	}
+	if configStore == nil {
+		return fmt.Errorf("config store is not available")
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, pair := range strings.Split(labels[configMountLabel], ",") {
+		target, name, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		cfg, err := configStore.GetConfigFile(name)
+		if err != nil {
+			return fmt.Errorf("config not found: %s", name)
+		}
+		// Docker creates missing parent directories when extracting
+		err = tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     strings.TrimPrefix(path.Clean(target), "/"),
+			Mode:     0o444,
+			Size:     int64(len(cfg.Content)),
+			ModTime:  cfg.UpdatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := tw.Write([]byte(cfg.Content)); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return cli.CopyToContainer(ctx, containerID, "/", &buf, container.CopyToContainerOptions{})
+}
+
+// configContainers lists the containers that use a config
+func configContainers(ctx context.Context, cli *client.Client, name string) ([]container.Summary, error) {
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", configMountLabel)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var users []container.Summary
+	for _, c := range containers {
+		for _, pair := range strings.Split(c.Labels[configMountLabel], ",") {
+			if _, ref, _ := strings.Cut(pair, "="); ref == name {
+				users = append(users, c)
+				break
+			}
+		}
+	}
+	return users, nil
+}
+
+// configUsers lists the names of containers that use a config
+func configUsers(ctx context.Context, cli *client.Client, name string) ([]string, error) {
+	containers, err := configContainers(ctx, cli, name)
+	if err != nil {
+		return nil, err
+	}
+	users := []string{}
+	for _, c := range containers {
+		users = append(users, summaryName(c))
+	}
+	return users, nil
+}
+
+// refreshConfigUsers copies the new content of a config into every
+// container that uses it, returning the containers updated and those that
+// failed
+func refreshConfigUsers(ctx context.Context, name string) ([]string, map[string]string, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cli.Close()
+
+	containers, err := configContainers(ctx, cli, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	updated := []string{}
+	failed := map[string]string{}
+	for _, c := range containers {
+		if err := copyConfigs(ctx, cli, c.ID, c.Labels); err != nil {
+			failed[summaryName(c)] = err.Error()
+			continue
+		}
+		updated = append(updated, summaryName(c))
+	}
+	return updated, failed, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-units"
+	"github.com/gin-gonic/gin"
+)
+
+// How long a confirmation token stays valid
+const confirmationTTL = 2 * time.Minute
+
+type confirmation struct {
+	action    string
+	target    string
+	actor     string
+	expiresAt time.Time
+}
+
+// Confirmations implements the two-step flow for force operations: the first
+// request gets a token and an impact summary, the second one executes when it
+// repeats the request with ?confirm=<token>. Tokens are single use and bound
+// to the action, target and caller.
+type Confirmations struct {
+	mu     sync.Mutex
+	tokens map[string]confirmation
+}
+
+func newConfirmations() *Confirmations {
+	return &Confirmations{tokens: map[string]confirmation{}}
+}
+
+func (c *Confirmations) Issue(action, target, actor string) (string, time.Time) {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	token := hex.EncodeToString(buf)
+	expiresAt := time.Now().Add(confirmationTTL)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for t, conf := range c.tokens {
+		if now.After(conf.expiresAt) {
+			delete(c.tokens, t)
+		}
+	}
+	c.tokens[token] = confirmation{action: action, target: target, actor: actor, expiresAt: expiresAt}
+	return token, expiresAt
+}
+
+// Consume reports whether token confirms this action and uses it up
+func (c *Confirmations) Consume(token, action, target, actor string) bool {
+	if token == "" {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	conf, ok := c.tokens[token]
+	if !ok || conf.action != action || conf.target != target || conf.actor != actor || time.Now().After(conf.expiresAt) {
+		return false
+	}
+	delete(c.tokens, token)
+	return true
+}
+
+// Confirmed returns true when the request carries a valid token for the
+// action. Otherwise it answers 428 with a new token and the impact summary.
+func (c *Confirmations) Confirmed(ctx *gin.Context, action, target string, impact any) bool {
+	actor := actorName(ctx)
+	if c.Consume(ctx.Query("confirm"), action, target, actor) {
+		return true
+	}
+	token, expiresAt := c.Issue(action, target, actor)
+	response := gin.H{
+		"error":              "Confirmation required for " + action,
+		"confirmation_token": token,
+		"expires_at":         expiresAt,
+		"impact":             impact,
+		"suggestion":         "Kiểm tra ảnh hưởng rồi gửi lại cùng request với ?confirm=" + token + " trong vòng 2 phút",
+	}
+	if ctx.Query("confirm") != "" {
+		response["error"] = "Invalid or expired confirmation token, a new one was issued"
+	}
+	ctx.JSON(http.StatusPreconditionRequired, response)
+	return false
+}
+
+// containerImpact summarizes what force-removing a running container breaks
+func containerImpact(info container.InspectResponse) gin.H {
+	impact := gin.H{
+		"container": strings.TrimPrefix(info.Name, "/"),
+		"image":     info.Config.Image,
+	}
+	if info.State != nil {
+		impact["state"] = info.State.Status
+		if started, err := time.Parse(time.RFC3339Nano, info.State.StartedAt); err == nil && info.State.Running {
+			impact["uptime"] = units.HumanDuration(time.Since(started))
+		}
+	}
+	ports := []string{}
+	for port, bindings := range info.HostConfig.PortBindings {
+		for _, b := range bindings {
+			ports = append(ports, b.HostPort+":"+string(port))
+		}
+	}
+	sort.Strings(ports)
+	impact["ports"] = ports
+	volumes := []string{}
+	for _, m := range info.Mounts {
+		if m.Name != "" {
+			volumes = append(volumes, m.Name)
+		} else {
+			volumes = append(volumes, m.Source)
+		}
+	}
+	impact["mounts"] = volumes
+	if project := info.Config.Labels[projectLabel]; project != "" {
+		impact["project"] = project
+	}
+	return impact
+}
+
+// imageImpact lists the containers an image force-removal affects
+func imageImpact(ctx context.Context, cli *client.Client, imageID string) (gin.H, int, error) {
+	img, err := cli.ImageInspect(ctx, imageID)
+	if err != nil {
+		return nil, 0, err
+	}
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, 0, err
+	}
+	users := []gin.H{}
+	for _, c := range containers {
+		if c.ImageID == img.ID {
+			users = append(users, gin.H{"name": summaryName(c), "state": c.State})
+		}
+	}
+	impact := gin.H{
+		"image":      img.ID,
+		"tags":       img.RepoTags,
+		"size":       units.HumanSize(float64(img.Size)),
+		"containers": users,
+	}
+	return impact, len(users), nil
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/blkiodev"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	units "github.com/docker/go-units"
+)
+
+// parseGPURequest maps the gpus option of /create to a device request for
+// the NVIDIA runtime. Accepted forms follow docker run --gpus: "all", a GPU
+// count such as "2", or device indices/UUIDs as "device=0,1" or just "0,1".
+func parseGPURequest(gpus string) (*container.DeviceRequest, error) {
+	gpus = strings.TrimSpace(gpus)
+	if gpus == "" {
+		return nil, nil
+	}
+
+	request := &container.DeviceRequest{
+		Driver:       "nvidia",
+		Capabilities: [][]string{{"gpu"}},
+	}
+	if gpus == "all" {
+		request.Count = -1
+		return request, nil
+	}
+
+	if devices, ok := strings.CutPrefix(gpus, "device="); ok {
+		gpus = devices
+	} else if count, err := strconv.Atoi(gpus); err == nil {
+		if count < 1 {
+			return nil, fmt.Errorf("gpu count must be at least 1")
+		}
+		request.Count = count
+		return request, nil
+	}
+
+	for _, id := range strings.Split(gpus, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			return nil, fmt.Errorf("invalid gpus value %q", gpus)
+		}
+		request.DeviceIDs = append(request.DeviceIDs, id)
+	}
+	return request, nil
+}
+
+// parseDeviceMapping parses a devices entry in docker run --device syntax:
+// /dev/host[:/dev/container[:permissions]], permissions being a combination
+// of r, w and m (default rwm)
+func parseDeviceMapping(device string) (container.DeviceMapping, error) {
+	parts := strings.Split(device, ":")
+	mapping := container.DeviceMapping{CgroupPermissions: "rwm"}
+
+	switch len(parts) {
+	case 3:
+		mapping.CgroupPermissions = parts[2]
+		fallthrough
+	case 2:
+		if isCgroupPermissions(parts[1]) && len(parts) == 2 {
+			mapping.CgroupPermissions = parts[1]
+		} else {
+			mapping.PathInContainer = parts[1]
+		}
+		fallthrough
+	case 1:
+		mapping.PathOnHost = parts[0]
+	default:
+		return mapping, fmt.Errorf("invalid device %q", device)
+	}
+	if mapping.PathInContainer == "" {
+		mapping.PathInContainer = mapping.PathOnHost
+	}
+
+	if !strings.HasPrefix(mapping.PathOnHost, "/dev/") {
+		return mapping, fmt.Errorf("device %q: host path must be under /dev/", device)
+	}
+	if !strings.HasPrefix(mapping.PathInContainer, "/") {
+		return mapping, fmt.Errorf("device %q: container path must be absolute", device)
+	}
+	if !isCgroupPermissions(mapping.CgroupPermissions) {
+		return mapping, fmt.Errorf("device %q: permissions must be a combination of r, w and m", device)
+	}
+	return mapping, nil
+}
+
+func isCgroupPermissions(s string) bool {
+	if s == "" || len(s) > 3 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("rwm", c) || strings.Count(s, string(c)) > 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeCapabilities uppercases capability names and strips the CAP_
+// prefix, so "net_admin" and "CAP_NET_ADMIN" are both accepted
+func normalizeCapabilities(caps []string) ([]string, error) {
+	var result []string
+	for _, c := range caps {
+		c = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(c)), "CAP_")
+		if c == "" {
+			return nil, fmt.Errorf("empty capability")
+		}
+		for _, r := range c {
+			if (r < 'A' || r > 'Z') && r != '_' {
+				return nil, fmt.Errorf("invalid capability %q", c)
+			}
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// Mount options accepted for tmpfs, as in docker run --tmpfs
+var tmpfsOptions = map[string]bool{
+	"rw": true, "ro": true, "exec": true, "noexec": true, "suid": true, "nosuid": true,
+	"dev": true, "nodev": true,
+}
+
+func validateTmpfs(tmpfs map[string]string) error {
+	for path, options := range tmpfs {
+		if !strings.HasPrefix(path, "/") || path == "/" {
+			return fmt.Errorf("path %q must be absolute and not the root", path)
+		}
+		if options == "" {
+			continue
+		}
+		for _, opt := range strings.Split(options, ",") {
+			name, value, hasValue := strings.Cut(opt, "=")
+			switch {
+			case tmpfsOptions[name] && !hasValue:
+			case name == "size" && hasValue:
+				if _, err := units.RAMInBytes(value); err != nil {
+					return fmt.Errorf("%s: invalid size %q", path, value)
+				}
+			case name == "mode" && hasValue:
+				if _, err := strconv.ParseUint(value, 8, 32); err != nil {
+					return fmt.Errorf("%s: invalid mode %q", path, value)
+				}
+			case (name == "uid" || name == "gid") && hasValue:
+				if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+					return fmt.Errorf("%s: invalid %s %q", path, name, value)
+				}
+			default:
+				return fmt.Errorf("%s: unsupported option %q", path, opt)
+			}
+		}
+	}
+	return nil
+}
+
+// validStopSignal accepts signal names (SIGTERM or TERM) and numbers
+func validStopSignal(signal string) bool {
+	if n, err := strconv.Atoi(signal); err == nil {
+		return n > 0 && n < 65
+	}
+	name := strings.TrimPrefix(strings.ToUpper(signal), "SIG")
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '+' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// ResourceOptions are the tunables accepted by both /create and
+// POST /containers/:id/update. Unset fields are left unchanged.
+type ResourceOptions struct {
+	// Memory limit such as "512m", counted against memory quotas
+	Memory         *string `json:"memory" binding:"omitempty,bytesize"`
+	OomKillDisable *bool   `json:"oom_kill_disable"`
+	OomScoreAdj    *int    `json:"oom_score_adj" binding:"omitempty,min=-1000,max=1000"`
+	// -1 uses the host's setting
+	MemorySwappiness *int64 `json:"memory_swappiness" binding:"omitempty,min=-1,max=100"`
+	// CPUs and NUMA memory nodes to pin to, as lists such as "0-3,6"
+	CpusetCpus *string `json:"cpuset_cpus"`
+	CpusetMems *string `json:"cpuset_mems"`
+	// Block I/O: relative weight (10-1000, 0 to reset) and per-device limits
+	// keyed by device path, rates as "10mb"
+	BlkioWeight     *uint16           `json:"blkio_weight"`
+	DeviceReadBps   map[string]string `json:"device_read_bps"`
+	DeviceWriteBps  map[string]string `json:"device_write_bps"`
+	DeviceReadIOps  map[string]uint64 `json:"device_read_iops"`
+	DeviceWriteIOps map[string]uint64 `json:"device_write_iops"`
+}
+
+func (o ResourceOptions) validate() error {
+	if o.Memory != nil {
+		if _, err := o.memoryBytes(); err != nil {
+			return err
+		}
+	}
+	if o.MemorySwappiness != nil && (*o.MemorySwappiness < -1 || *o.MemorySwappiness > 100) {
+		return fmt.Errorf("memory_swappiness must be between 0 and 100, or -1 to use the host's setting")
+	}
+	if o.OomScoreAdj != nil && (*o.OomScoreAdj < -1000 || *o.OomScoreAdj > 1000) {
+		return fmt.Errorf("oom_score_adj must be between -1000 and 1000")
+	}
+	if o.CpusetCpus != nil && !validCPUSet(*o.CpusetCpus) {
+		return fmt.Errorf("invalid cpuset_cpus %q: use a list such as \"0-3,6\"", *o.CpusetCpus)
+	}
+	if o.CpusetMems != nil && !validCPUSet(*o.CpusetMems) {
+		return fmt.Errorf("invalid cpuset_mems %q: use a list such as \"0,1\"", *o.CpusetMems)
+	}
+	if o.BlkioWeight != nil && *o.BlkioWeight != 0 && (*o.BlkioWeight < 10 || *o.BlkioWeight > 1000) {
+		return fmt.Errorf("blkio_weight must be between 10 and 1000, or 0 to reset")
+	}
+	for _, limits := range []map[string]string{o.DeviceReadBps, o.DeviceWriteBps} {
+		if _, err := bpsDevices(limits); err != nil {
+			return err
+		}
+	}
+	for _, limits := range []map[string]uint64{o.DeviceReadIOps, o.DeviceWriteIOps} {
+		for path := range limits {
+			if !strings.HasPrefix(path, "/dev/") {
+				return fmt.Errorf("device %q: path must be under /dev/", path)
+			}
+		}
+	}
+	return nil
+}
+
+// memoryBytes is the requested memory limit, 0 when unset
+func (o ResourceOptions) memoryBytes() (int64, error) {
+	if o.Memory == nil {
+		return 0, nil
+	}
+	bytes, err := units.RAMInBytes(*o.Memory)
+	// Docker refuses limits below 6MB
+	if err != nil || bytes < 6*1024*1024 {
+		return 0, fmt.Errorf("invalid memory %q: use at least \"6m\", e.g. \"512m\" or \"2g\"", *o.Memory)
+	}
+	return bytes, nil
+}
+
+// needsRecreate reports whether the options include settings that the
+// daemon can't change on an existing container (docker update ignores them)
+func (o ResourceOptions) needsRecreate() bool {
+	return o.OomKillDisable != nil || o.OomScoreAdj != nil || o.MemorySwappiness != nil ||
+		(o.CpusetCpus != nil && *o.CpusetCpus == "") || (o.CpusetMems != nil && *o.CpusetMems == "") ||
+		(o.BlkioWeight != nil && *o.BlkioWeight == 0) ||
+		o.DeviceReadBps != nil || o.DeviceWriteBps != nil || o.DeviceReadIOps != nil || o.DeviceWriteIOps != nil
+}
+
+// apply sets the options on a host config. Must be called after validate.
+func (o ResourceOptions) apply(hostConfig *container.HostConfig) {
+	r := &hostConfig.Resources
+	if o.Memory != nil {
+		r.Memory, _ = o.memoryBytes()
+	}
+	if o.OomKillDisable != nil {
+		r.OomKillDisable = o.OomKillDisable
+	}
+	if o.OomScoreAdj != nil {
+		hostConfig.OomScoreAdj = *o.OomScoreAdj
+	}
+	if o.MemorySwappiness != nil {
+		r.MemorySwappiness = o.MemorySwappiness
+	}
+	if o.CpusetCpus != nil {
+		r.CpusetCpus = *o.CpusetCpus
+	}
+	if o.CpusetMems != nil {
+		r.CpusetMems = *o.CpusetMems
+	}
+	if o.BlkioWeight != nil {
+		r.BlkioWeight = *o.BlkioWeight
+	}
+	if o.DeviceReadBps != nil {
+		r.BlkioDeviceReadBps, _ = bpsDevices(o.DeviceReadBps)
+	}
+	if o.DeviceWriteBps != nil {
+		r.BlkioDeviceWriteBps, _ = bpsDevices(o.DeviceWriteBps)
+	}
+	if o.DeviceReadIOps != nil {
+		r.BlkioDeviceReadIOps = iopsDevices(o.DeviceReadIOps)
+	}
+	if o.DeviceWriteIOps != nil {
+		r.BlkioDeviceWriteIOps = iopsDevices(o.DeviceWriteIOps)
+	}
+}
+
+func bpsDevices(limits map[string]string) ([]*blkiodev.ThrottleDevice, error) {
+	devices := []*blkiodev.ThrottleDevice{}
+	for path, rate := range limits {
+		if !strings.HasPrefix(path, "/dev/") {
+			return nil, fmt.Errorf("device %q: path must be under /dev/", path)
+		}
+		bytes, err := units.RAMInBytes(rate)
+		if err != nil || bytes <= 0 {
+			return nil, fmt.Errorf("device %s: invalid rate %q, use e.g. \"10mb\"", path, rate)
+		}
+		devices = append(devices, &blkiodev.ThrottleDevice{Path: path, Rate: uint64(bytes)})
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Path < devices[j].Path })
+	return devices, nil
+}
+
+func iopsDevices(limits map[string]uint64) []*blkiodev.ThrottleDevice {
+	devices := []*blkiodev.ThrottleDevice{}
+	for path, rate := range limits {
+		devices = append(devices, &blkiodev.ThrottleDevice{Path: path, Rate: rate})
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Path < devices[j].Path })
+	return devices
+}
+
+// validCPUSet checks the cgroup cpuset list format: comma separated numbers
+// and ranges. An empty string clears the pinning.
+func validCPUSet(set string) bool {
+	if set == "" {
+		return true
+	}
+	for _, part := range strings.Split(set, ",") {
+		low, high, isRange := strings.Cut(part, "-")
+		lo, err := strconv.ParseUint(low, 10, 16)
+		if err != nil {
+			return false
+		}
+		if isRange {
+			hi, err := strconv.ParseUint(high, 10, 16)
+			if err != nil || hi < lo {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validateExtraHost checks a host:IP entry for /etc/hosts. IP may be IPv6
+// or the special "host-gateway" value resolved by the daemon.
+func validateExtraHost(entry string) error {
+	host, ip, ok := strings.Cut(entry, ":")
+	if !ok || host == "" {
+		return fmt.Errorf("invalid extra host %q: expected host:IP", entry)
+	}
+	if ip == "host-gateway" {
+		return nil
+	}
+	if net.ParseIP(strings.Trim(ip, "[]")) == nil {
+		return fmt.Errorf("invalid extra host %q: %q is not an IP address", entry, ip)
+	}
+	return nil
+}
+
+// endpointConfig builds the networking config for attaching a new container
+// to a network, with optional static IPv4/IPv6 and MAC addresses
+func endpointConfig(networkName, ipv4, ipv6, mac string) (*network.NetworkingConfig, error) {
+	if networkName == "" {
+		if ipv4 != "" || ipv6 != "" || mac != "" {
+			return nil, fmt.Errorf("static addresses require a network")
+		}
+		return nil, nil
+	}
+
+	endpoint := &network.EndpointSettings{MacAddress: mac}
+	if ipv4 != "" || ipv6 != "" {
+		switch networkName {
+		case "bridge", "host", "none", "default":
+			return nil, fmt.Errorf("static IP addresses are only supported on user-defined networks")
+		}
+		if ip := net.ParseIP(ipv4); ipv4 != "" && (ip == nil || ip.To4() == nil) {
+			return nil, fmt.Errorf("invalid ipv4_address %q", ipv4)
+		}
+		if ip := net.ParseIP(ipv6); ipv6 != "" && (ip == nil || ip.To4() != nil) {
+			return nil, fmt.Errorf("invalid ipv6_address %q", ipv6)
+		}
+		endpoint.IPAMConfig = &network.EndpointIPAMConfig{IPv4Address: ipv4, IPv6Address: ipv6}
+	}
+	if mac != "" {
+		if _, err := net.ParseMAC(mac); err != nil {
+			return nil, fmt.Errorf("invalid mac_address %q", mac)
+		}
+	}
+
+	return &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{networkName: endpoint},
+	}, nil
+}
+
+var (
+	hostnamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?)*$`)
+	userPattern     = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*(:[A-Za-z0-9_][A-Za-z0-9_.-]*)?$`)
+)
+
+func validHostname(name string) bool {
+	return len(name) <= 253 && hostnamePattern.MatchString(name)
+}
+
+// validUser accepts user, uid, user:group and uid:gid
+func validUser(user string) bool {
+	return userPattern.MatchString(user)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	units "github.com/docker/go-units"
+)
+
+// A container restarting this often within flapWindow of its last start is
+// reported as flapping
+const (
+	flapRestarts = 3
+	flapWindow   = 10 * time.Minute
+)
+
+// ContainerRuntime is what a container list entry leaves out about how a
+// container has been running: since when, how often it restarted and how it
+// last exited
+type ContainerRuntime struct {
+	StartedAt *time.Time `json:"StartedAt,omitempty"`
+	// Human-readable, e.g. "3 hours"; empty unless running. Seconds aren't
+	// given so the /status ETag doesn't change on every poll.
+	Uptime string `json:"Uptime,omitempty"`
+	// Automatic restarts by the restart policy since the last manual start
+	RestartCount int        `json:"RestartCount"`
+	FinishedAt   *time.Time `json:"FinishedAt,omitempty"`
+	// Exit code of the last run, nil if it never exited
+	LastExitCode *int `json:"LastExitCode"`
+	OOMKilled    bool `json:"OOMKilled"`
+	Flapping     bool `json:"Flapping"`
+}
+
+// containerRuntime computes the runtime summary from an inspect response
+func containerRuntime(info container.InspectResponse) *ContainerRuntime {
+	rt := &ContainerRuntime{}
+	if info.ContainerJSONBase == nil || info.State == nil {
+		return rt
+	}
+	rt.RestartCount = info.RestartCount
+	state := info.State
+	rt.OOMKilled = state.OOMKilled
+	if t, err := time.Parse(time.RFC3339Nano, state.StartedAt); err == nil && !t.IsZero() {
+		rt.StartedAt = &t
+	}
+	if t, err := time.Parse(time.RFC3339Nano, state.FinishedAt); err == nil && !t.IsZero() {
+		rt.FinishedAt = &t
+		exitCode := state.ExitCode
+		rt.LastExitCode = &exitCode
+	}
+	var uptime time.Duration
+	if state.Running && rt.StartedAt != nil {
+		uptime = time.Since(*rt.StartedAt)
+		rt.Uptime = units.HumanDuration(uptime)
+	}
+	rt.Flapping = state.Restarting || (state.Running && rt.RestartCount >= flapRestarts && uptime < flapWindow)
+	return rt
+}
+
+// runtimeCache keeps the inspect responses /status needs for runtime
+// summaries. An entry is valid while the container's Status text is
+// unchanged, as every start, stop and restart changes it.
+type runtimeCache struct {
+	mu      sync.Mutex
+	entries map[string]runtimeCacheEntry
+}
+
+type runtimeCacheEntry struct {
+	status string
+	info   container.InspectResponse
+}
+
+func newRuntimeCache() *runtimeCache {
+	return &runtimeCache{entries: map[string]runtimeCacheEntry{}}
+}
+
+// Runtimes returns the runtime summary of every container that could be
+// inspected, inspecting those whose Status changed concurrently
+func (c *runtimeCache) Runtimes(ctx context.Context, cli *client.Client, containers []container.Summary) map[string]*ContainerRuntime {
+	c.mu.Lock()
+	infos := map[string]container.InspectResponse{}
+	missing := []container.Summary{}
+	listed := map[string]bool{}
+	for _, s := range containers {
+		listed[s.ID] = true
+		if e, ok := c.entries[s.ID]; ok && e.status == s.Status {
+			infos[s.ID] = e.info
+		} else {
+			missing = append(missing, s)
+		}
+	}
+	// Forget removed containers
+	for id := range c.entries {
+		if !listed[id] {
+			delete(c.entries, id)
+		}
+	}
+	c.mu.Unlock()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, s := range missing {
+		wg.Add(1)
+		go func(s container.Summary) {
+			defer wg.Done()
+			info, err := cli.ContainerInspect(ctx, s.ID)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			infos[s.ID] = info
+			mu.Unlock()
+			c.mu.Lock()
+			c.entries[s.ID] = runtimeCacheEntry{status: s.Status, info: info}
+			c.mu.Unlock()
+		}(s)
+	}
+	wg.Wait()
+
+	runtimes := map[string]*ContainerRuntime{}
+	for id, info := range infos {
+		runtimes[id] = containerRuntime(info)
+	}
+	return runtimes
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var startedAt = time.Now()
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+	expvar.Publish("uptime_seconds", expvar.Func(func() any { return int64(time.Since(startedAt).Seconds()) }))
+}
+
+// debugEndpointsEnabled reports whether DEBUG_ENDPOINTS turns on the
+// profiling endpoints under /debug. They are off by default: profiles show
+// request data and CPU profiles slow the server down while they run.
+func debugEndpointsEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("DEBUG_ENDPOINTS"))
+	return enabled
+}
+
+// registerDebugRoutes adds pprof, expvar and a goroutine dump under /debug,
+// for admins only. Without DEBUG_ENDPOINTS the routes don't exist.
+func registerDebugRoutes(r *gin.Engine) {
+	if !debugEndpointsEnabled() {
+		return
+	}
+	fmt.Println("🐞 Debug endpoints enabled under /debug")
+
+	debug := r.Group("/debug", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Only admins can use the debug endpoints"})
+			return
+		}
+		ctx.Next()
+	})
+
+	debug.GET("/pprof/*profile", func(ctx *gin.Context) {
+		switch ctx.Param("profile") {
+		case "/cmdline":
+			pprof.Cmdline(ctx.Writer, ctx.Request)
+		case "/profile":
+			pprof.Profile(ctx.Writer, ctx.Request)
+		case "/symbol":
+			pprof.Symbol(ctx.Writer, ctx.Request)
+		case "/trace":
+			pprof.Trace(ctx.Writer, ctx.Request)
+		default:
+			// Index serves the named profiles (heap, goroutine, allocs...) too
+			pprof.Index(ctx.Writer, ctx.Request)
+		}
+	})
+
+	debug.GET("/vars", gin.WrapH(expvar.Handler()))
+
+	// Stacks of all goroutines as text, ?group=true folds identical stacks
+	// with their count
+	debug.GET("/goroutines", func(ctx *gin.Context) {
+		level := 2
+		if group, _ := strconv.ParseBool(ctx.Query("group")); group {
+			level = 1
+		}
+		ctx.Header("Content-Type", "text/plain; charset=utf-8")
+		ctx.Status(http.StatusOK)
+		if err := runtimepprof.Lookup("goroutine").WriteTo(ctx.Writer, level); err != nil {
+			fmt.Printf("⚠️  Error writing goroutine dump: %v\n", err)
+		}
+	})
+
+	// Runtime summary for a quick look without pprof tooling
+	debug.GET("/runtime", func(ctx *gin.Context) {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		ctx.JSON(http.StatusOK, gin.H{
+			"go_version":     runtime.Version(),
+			"goroutines":     runtime.NumGoroutine(),
+			"gomaxprocs":     runtime.GOMAXPROCS(0),
+			"uptime_seconds": int64(time.Since(startedAt).Seconds()),
+			"memory": gin.H{
+				"heap_alloc":    mem.HeapAlloc,
+				"heap_inuse":    mem.HeapInuse,
+				"heap_objects":  mem.HeapObjects,
+				"stack_inuse":   mem.StackInuse,
+				"sys":           mem.Sys,
+				"total_alloc":   mem.TotalAlloc,
+				"num_gc":        mem.NumGC,
+				"gc_pause_last": time.Duration(mem.PauseNs[(mem.NumGC+255)%256]).String(),
+			},
+		})
+	})
+}
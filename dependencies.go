@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/gin-gonic/gin"
+)
+
+// dependsOnLabel lists, comma separated, the containers a container needs
+// running (and healthy, when they have a health check) before it starts
+const dependsOnLabel = labelPrefix + "depends-on"
+
+// How long an orchestrated start waits for a container to become healthy
+const defaultHealthWait = 60 * time.Second
+
+// dependsOn returns the declared dependencies of a container
+func dependsOn(labels map[string]string) []string {
+	deps := []string{}
+	for _, name := range strings.Split(labels[dependsOnLabel], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			deps = append(deps, name)
+		}
+	}
+	return deps
+}
+
+// setContainerDependencies replaces the dependencies of a container. Like
+// project membership they are a label, so the container is recreated with
+// its volumes, unless the dependencies are unchanged.
+func setContainerDependencies(ctx context.Context, cli *client.Client, containerID string, deps []string) (string, error) {
+	info, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return "", err
+	}
+	var labels map[string]string
+	if info.Config != nil {
+		labels = info.Config.Labels
+	}
+	if strings.Join(dependsOn(labels), ",") == strings.Join(deps, ",") {
+		return info.ID, nil
+	}
+	spec := specFromInspect(info)
+	keepAnonymousVolumes(spec, info)
+	if spec.Config.Labels == nil {
+		spec.Config.Labels = map[string]string{}
+	}
+	if len(deps) == 0 {
+		delete(spec.Config.Labels, dependsOnLabel)
+	} else {
+		spec.Config.Labels[dependsOnLabel] = strings.Join(deps, ",")
+	}
+	return recreateContainer(ctx, cli, info.ID, spec, false)
+}
+
+// dependencyStages orders containers so every container comes in a later
+// stage than the dependencies it shares a project with. Dependencies outside
+// the set are ignored here. A cycle is an error naming its containers.
+func dependencyStages(containers []container.Summary) ([][]container.Summary, error) {
+	byName := map[string]container.Summary{}
+	for _, c := range containers {
+		byName[summaryName(c)] = c
+	}
+	pending := map[string][]string{}
+	for name, c := range byName {
+		pending[name] = []string{}
+		for _, dep := range dependsOn(c.Labels) {
+			if _, ok := byName[dep]; ok && dep != name {
+				pending[name] = append(pending[name], dep)
+			}
+		}
+	}
+
+	stages := [][]container.Summary{}
+	done := map[string]bool{}
+	for len(pending) > 0 {
+		ready := []string{}
+		for name, deps := range pending {
+			satisfied := true
+			for _, dep := range deps {
+				if !done[dep] {
+					satisfied = false
+					break
+				}
+			}
+			if satisfied {
+				ready = append(ready, name)
+			}
+		}
+		if len(ready) == 0 {
+			cycle := make([]string, 0, len(pending))
+			for name := range pending {
+				cycle = append(cycle, name)
+			}
+			sort.Strings(cycle)
+			return nil, fmt.Errorf("dependency cycle between %s", strings.Join(cycle, ", "))
+		}
+		sort.Strings(ready)
+		stage := make([]container.Summary, 0, len(ready))
+		for _, name := range ready {
+			stage = append(stage, byName[name])
+			delete(pending, name)
+		}
+		for _, name := range ready {
+			done[name] = true
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+func stageNames(stages [][]container.Summary) [][]string {
+	names := make([][]string, 0, len(stages))
+	for _, stage := range stages {
+		list := make([]string, 0, len(stage))
+		for _, c := range stage {
+			list = append(list, summaryName(c))
+		}
+		names = append(names, list)
+	}
+	return names
+}
+
+// waitReady waits until a container is healthy, or running when it has no
+// health check
+func waitReady(ctx context.Context, cli *client.Client, containerID string, timeout time.Duration) error {
+	_, err := waitForContainer(ctx, cli, containerID, waitForHealthy, timeout)
+	return err
+}
+
+// startInOrder starts containers stage by stage, waiting for each stage to
+// be ready before the next. Containers whose dependency failed are skipped,
+// as are those needing a container outside the project that isn't running.
+func startInOrder(ctx context.Context, cli *client.Client, stages [][]container.Summary, timeout time.Duration, results map[string]interface{}) (success, errors int) {
+	failed := map[string]string{}
+	for _, stage := range stages {
+		started := []container.Summary{}
+		for _, c := range stage {
+			name := summaryName(c)
+			if blocker := blockedBy(ctx, cli, c, failed); blocker != "" {
+				failed[name] = blocker
+				results[name] = gin.H{"status": "skipped", "message": blocker}
+				continue
+			}
+			if c.State != "running" {
+				if err := startContainer(ctx, cli, c.ID, container.StartOptions{}); err != nil {
+					failed[name] = "dependency " + name + " failed to start"
+					results[name] = gin.H{"status": "error", "message": err.Error()}
+					errors++
+					continue
+				}
+			}
+			started = append(started, c)
+		}
+		// A stage's containers become ready in parallel, wait for all
+		type readiness struct {
+			c   container.Summary
+			err error
+		}
+		ready := make(chan readiness, len(started))
+		for _, c := range started {
+			go func(c container.Summary) {
+				ready <- readiness{c, waitReady(ctx, cli, c.ID, timeout)}
+			}(c)
+		}
+		for range started {
+			r := <-ready
+			name := summaryName(r.c)
+			switch {
+			case r.err != nil:
+				failed[name] = "dependency " + name + " is not ready"
+				results[name] = gin.H{"status": "error", "message": r.err.Error()}
+				errors++
+			case r.c.State == "running":
+				results[name] = gin.H{"status": "skipped", "message": "already running"}
+			default:
+				results[name] = gin.H{"status": "success"}
+				success++
+			}
+		}
+	}
+	return success, errors
+}
+
+// blockedBy explains why a container can't start yet, or returns ""
+func blockedBy(ctx context.Context, cli *client.Client, c container.Summary, failed map[string]string) string {
+	for _, dep := range dependsOn(c.Labels) {
+		if _, ok := failed[dep]; ok {
+			return "dependency " + dep + " failed"
+		}
+	}
+	for _, dep := range dependsOn(c.Labels) {
+		info, err := cli.ContainerInspect(ctx, dep)
+		if err != nil {
+			return "dependency " + dep + " does not exist"
+		}
+		if info.State == nil || !info.State.Running {
+			return "dependency " + dep + " is not running"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+// ContainerSpec is the part of a container's configuration needed to
+// recreate it: what was passed to ContainerCreate.
+type ContainerSpec struct {
+	Config     *container.Config                    `json:"config"`
+	HostConfig *container.HostConfig                `json:"host_config"`
+	Networks   map[string]*network.EndpointSettings `json:"networks,omitempty"`
+}
+
+type Deployment struct {
+	ID            string         `json:"id"`
+	ContainerID   string         `json:"container_id"`
+	ContainerName string         `json:"container_name"`
+	Action        string         `json:"action"`
+	Image         string         `json:"image"`
+	ImageDigest   string         `json:"image_digest"`
+	Spec          *ContainerSpec `json:"spec,omitempty"`
+	Actor         string         `json:"actor"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+// specFromInspect extracts a recreatable spec from an inspected container,
+// keeping only the user-configurable endpoint settings
+func specFromInspect(info container.InspectResponse) *ContainerSpec {
+	spec := &ContainerSpec{
+		Config:     info.Config,
+		HostConfig: info.HostConfig,
+		Networks:   map[string]*network.EndpointSettings{},
+	}
+	if info.NetworkSettings != nil {
+		for name, ep := range info.NetworkSettings.Networks {
+			if ep == nil {
+				continue
+			}
+			spec.Networks[name] = &network.EndpointSettings{
+				IPAMConfig: ep.IPAMConfig,
+				Links:      ep.Links,
+				Aliases:    ep.Aliases,
+				DriverOpts: ep.DriverOpts,
+			}
+		}
+	}
+	return spec
+}
+
+// keepAnonymousVolumes mounts the anonymous volumes of an inspected
+// container, such as those from VOLUME entries of its image, into spec at
+// the same paths. Recreating the container for a label change then keeps
+// their data instead of starting on fresh volumes. Binds and named volumes
+// are part of the spec already.
+func keepAnonymousVolumes(spec *ContainerSpec, info container.InspectResponse) {
+	if spec.HostConfig == nil {
+		spec.HostConfig = &container.HostConfig{}
+	}
+	mounted := map[string]bool{}
+	for _, m := range spec.HostConfig.Mounts {
+		mounted[m.Target] = true
+	}
+	for _, bind := range spec.HostConfig.Binds {
+		if parts := strings.Split(bind, ":"); len(parts) >= 2 {
+			mounted[parts[1]] = true
+		}
+	}
+	for _, m := range info.Mounts {
+		if m.Type != mount.TypeVolume || m.Name == "" || mounted[m.Destination] {
+			continue
+		}
+		spec.HostConfig.Mounts = append(spec.HostConfig.Mounts, mount.Mount{
+			Type:     mount.TypeVolume,
+			Source:   m.Name,
+			Target:   m.Destination,
+			ReadOnly: !m.RW,
+		})
+	}
+}
+
+// imageDigest returns the repo digest of an image when it came from a
+// registry, or its local content ID otherwise
+func imageDigest(ctx context.Context, cli *client.Client, ref string) string {
+	img, err := cli.ImageInspect(ctx, ref)
+	if err != nil {
+		return ""
+	}
+	if len(img.RepoDigests) > 0 {
+		return img.RepoDigests[0]
+	}
+	return img.ID
+}
+
+// recordDeployment snapshots the current state of a container into the
+// deployment history
+func recordDeployment(ctx context.Context, cli *client.Client, store *Store, containerID, action, actor string) (*Deployment, error) {
+	info, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Secret values must not end up in the database in plaintext
+	spec := specFromInspect(info)
+	redactSecretEnv(spec.Config)
+
+	d := &Deployment{
+		ID:            newID(),
+		ContainerID:   info.ID,
+		ContainerName: strings.TrimPrefix(info.Name, "/"),
+		Action:        action,
+		Image:         info.Config.Image,
+		ImageDigest:   imageDigest(ctx, cli, info.Image),
+		Spec:          spec,
+		Actor:         actor,
+		CreatedAt:     time.Now(),
+	}
+	if err := store.SaveDeployment(d); err != nil {
+		return nil, err
+	}
+	updateDesired(store, d)
+	return d, nil
+}
+
+// errNotRestored marks a failed recreate whose old container could not be
+// put back under its name or started again
+var errNotRestored = errors.New("the old container could not be restored")
+
+// recreateContainer replaces a container with a new one built from spec under
+// the same name. The old container is kept (renamed and stopped) until the
+// new one starts, and is put back if anything fails; when that fails too the
+// error wraps errNotRestored. The new container is started if the old one
+// was running, or always when alwaysStart is set.
+func recreateContainer(ctx context.Context, cli *client.Client, containerID string, spec *ContainerSpec, alwaysStart bool) (string, error) {
+	old, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return "", err
+	}
+	// Stopping would delete it before the old container can be restored
+	if old.HostConfig != nil && old.HostConfig.AutoRemove {
+		return "", fmt.Errorf("containers created with auto_remove can't be recreated")
+	}
+	name := strings.TrimPrefix(old.Name, "/")
+	wasRunning := old.State != nil && old.State.Running
+	backupName := name + "-old-" + strconv.FormatInt(time.Now().Unix(), 10)
+
+	if wasRunning {
+		if err := stopContainer(ctx, cli, old.ID, container.StopOptions{}); err != nil {
+			return "", fmt.Errorf("stopping old container: %w", err)
+		}
+	}
+	if err := cli.ContainerRename(ctx, old.ID, backupName); err != nil {
+		return "", fmt.Errorf("renaming old container: %w", err)
+	}
+
+	// restore puts the old container back after cause made the recreate fail
+	restore := func(cause error) error {
+		if err := cli.ContainerRename(ctx, old.ID, name); err != nil {
+			return fmt.Errorf("%w; %w: it is still named %s: %v", cause, errNotRestored, backupName, err)
+		}
+		if wasRunning {
+			if err := cli.ContainerStart(ctx, old.ID, container.StartOptions{}); err != nil {
+				return fmt.Errorf("%w; %w: starting it failed: %v", cause, errNotRestored, err)
+			}
+		}
+		return cause
+	}
+
+	var netConfig *network.NetworkingConfig
+	if len(spec.Networks) > 0 {
+		netConfig = &network.NetworkingConfig{EndpointsConfig: spec.Networks}
+	}
+
+	resp, err := createContainer(ctx, cli, spec.Config, spec.HostConfig, netConfig, name)
+	if err != nil {
+		return "", restore(fmt.Errorf("creating new container: %w", err))
+	}
+	if err := copyConfigs(ctx, cli, resp.ID, spec.Config.Labels); err != nil {
+		cli.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
+		return "", restore(fmt.Errorf("copying configs: %w", err))
+	}
+	if wasRunning || alwaysStart {
+		if err := startContainer(ctx, cli, resp.ID, container.StartOptions{}); err != nil {
+			cli.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
+			return "", restore(fmt.Errorf("starting new container: %w", err))
+		}
+	}
+
+	if err := removeContainer(ctx, cli, old.ID, container.RemoveOptions{Force: true}); err != nil {
+		fmt.Printf("⚠️  New container %s is running but old container %s could not be removed: %v\n", name, backupName, err)
+	}
+	return resp.ID, nil
+}
+
+func (s *Store) SaveDeployment(d *Deployment) error {
+	spec, err := json.Marshal(d.Spec)
+	if err != nil {
+		return err
+	}
+	_, err = s.exec(`INSERT INTO deployments (id, container_id, container_name, action, image, image_digest, spec, actor, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.ID, d.ContainerID, d.ContainerName, d.Action, d.Image, d.ImageDigest, string(spec), d.Actor, d.CreatedAt.Unix())
+	return err
+}
+
+// ListDeployments returns the history of a container, newest first. History
+// is tracked by name because redeploys give the container a new ID.
+func (s *Store) ListDeployments(containerName string) ([]Deployment, error) {
+	rows, err := s.query(`SELECT id, container_id, container_name, action, image, image_digest, spec, actor, created_at
+		FROM deployments WHERE container_name = ? ORDER BY created_at DESC`, containerName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deployments := []Deployment{}
+	for rows.Next() {
+		d, err := scanDeployment(rows)
+		if err != nil {
+			return nil, err
+		}
+		deployments = append(deployments, *d)
+	}
+	return deployments, rows.Err()
+}
+
+func (s *Store) GetDeployment(id string) (*Deployment, error) {
+	return scanDeployment(s.queryRow(`SELECT id, container_id, container_name, action, image, image_digest, spec, actor, created_at
+		FROM deployments WHERE id = ?`, id))
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDeployment(row rowScanner) (*Deployment, error) {
+	var d Deployment
+	var spec string
+	var createdAt int64
+	if err := row.Scan(&d.ID, &d.ContainerID, &d.ContainerName, &d.Action, &d.Image, &d.ImageDigest, &spec, &d.Actor, &createdAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(spec), &d.Spec); err != nil {
+		return nil, err
+	}
+	d.CreatedAt = time.Unix(createdAt, 0)
+	return &d, nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// DesiredContainer is a container that should exist on this host. The
+// reconciler creates it again from Spec when it's gone, e.g. after the host
+// was wiped or the daemon reset. Secret env vars are stored redacted.
+type DesiredContainer struct {
+	BundleContainer
+	UpdatedBy string    `json:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (s *Store) SaveDesired(d *DesiredContainer) error {
+	spec, err := json.Marshal(d.Spec)
+	if err != nil {
+		return err
+	}
+	d.UpdatedAt = time.Now()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(s.rebind(`DELETE FROM desired_containers WHERE name = ?`), d.Name); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(s.rebind(`INSERT INTO desired_containers (name, image, image_digest, running, spec, updated_by, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`),
+		d.Name, d.Image, d.ImageDigest, d.Running, string(spec), d.UpdatedBy, d.UpdatedAt.Unix()); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteDesired stops tracking a container and reports whether it was
+func (s *Store) DeleteDesired(name string) (bool, error) {
+	res, err := s.exec(`DELETE FROM desired_containers WHERE name = ?`, name)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) GetDesired(name string) (*DesiredContainer, error) {
+	return scanDesired(s.queryRow(`SELECT name, image, image_digest, running, spec, updated_by, updated_at
+		FROM desired_containers WHERE name = ?`, name))
+}
+
+func (s *Store) ListDesired() ([]DesiredContainer, error) {
+	rows, err := s.query(`SELECT name, image, image_digest, running, spec, updated_by, updated_at
+		FROM desired_containers ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	desired := []DesiredContainer{}
+	for rows.Next() {
+		d, err := scanDesired(rows)
+		if err != nil {
+			return nil, err
+		}
+		desired = append(desired, *d)
+	}
+	return desired, rows.Err()
+}
+
+func scanDesired(row rowScanner) (*DesiredContainer, error) {
+	var d DesiredContainer
+	var spec string
+	var updatedAt int64
+	if err := row.Scan(&d.Name, &d.Image, &d.ImageDigest, &d.Running, &spec, &d.UpdatedBy, &updatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(spec), &d.Spec); err != nil {
+		return nil, err
+	}
+	d.UpdatedAt = time.Unix(updatedAt, 0)
+	return &d, nil
+}
+
+// trackable explains why a container can't be kept in the desired state, or
+// returns ""
+func trackable(c BundleContainer) string {
+	if c.Spec.HostConfig != nil && c.Spec.HostConfig.AutoRemove {
+		return "containers created with auto_remove are meant to go away"
+	}
+	if _, ok := c.Spec.Config.Labels[expiresLabel]; ok {
+		return "containers with an expiry are meant to go away"
+	}
+	return ""
+}
+
+// snapshotDesired records the current definition of containers as their
+// desired state, skipping those that are meant to go away
+func snapshotDesired(store *Store, containers []BundleContainer, actor string) (tracked []string, skipped map[string]string, err error) {
+	tracked, skipped = []string{}, map[string]string{}
+	for _, c := range containers {
+		if reason := trackable(c); reason != "" {
+			skipped[c.Name] = reason
+			continue
+		}
+		if err := store.SaveDesired(&DesiredContainer{BundleContainer: c, UpdatedBy: actor}); err != nil {
+			return tracked, skipped, fmt.Errorf("saving %s: %w", c.Name, err)
+		}
+		tracked = append(tracked, c.Name)
+	}
+	return tracked, skipped, nil
+}
+
+// updateDesired keeps the desired state of a tracked container in step with
+// a new deployment of it. Untracked containers are left alone.
+func updateDesired(store *Store, d *Deployment) {
+	current, err := store.GetDesired(d.ContainerName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		fmt.Printf("⚠️  Error reading desired state of %s: %v\n", d.ContainerName, err)
+		return
+	}
+	current.Image, current.ImageDigest, current.Spec, current.UpdatedBy = d.Image, d.ImageDigest, d.Spec, d.Actor
+	if err := store.SaveDesired(current); err != nil {
+		fmt.Printf("⚠️  Error updating desired state of %s: %v\n", d.ContainerName, err)
+	}
+}
+
+// untrackDesired forgets a container removed on purpose, so the reconciler
+// doesn't bring it back
+func untrackDesired(store *Store, name string) {
+	name = strings.TrimPrefix(name, "/")
+	if removed, err := store.DeleteDesired(name); err != nil {
+		fmt.Printf("⚠️  Error removing %s from the desired state: %v\n", name, err)
+	} else if removed {
+		fmt.Printf("📋 Removed %s from the desired state\n", name)
+	}
+}
+
+// ReconcileResult reports what a reconcile found and did
+type ReconcileResult struct {
+	DryRun  bool                   `json:"dry_run"`
+	Desired int                    `json:"desired"`
+	Missing []string               `json:"missing"`
+	Results map[string]interface{} `json:"results"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// reconcile compares the desired state with the containers on the host and
+// creates the missing ones, starting those that should run in dependency
+// order. Containers that exist are left as they are, even when stopped or
+// changed by hand. With dryRun it only reports what is missing.
+func reconcile(ctx context.Context, cli *client.Client, store *Store, box *SecretBox, dryRun bool, opts ImportOptions) (*ReconcileResult, error) {
+	desired, err := store.ListDesired()
+	if err != nil {
+		return nil, err
+	}
+	result := &ReconcileResult{DryRun: dryRun, Desired: len(desired), Missing: []string{}, Results: map[string]interface{}{}}
+
+	bundle := &Bundle{Version: bundleVersion, Containers: []BundleContainer{}}
+	for _, d := range desired {
+		_, err := cli.ContainerInspect(ctx, d.Name)
+		if err == nil {
+			continue
+		}
+		if !client.IsErrNotFound(err) {
+			return nil, fmt.Errorf("inspecting %s: %w", d.Name, err)
+		}
+		result.Missing = append(result.Missing, d.Name)
+		bundle.Containers = append(bundle.Containers, d.BundleContainer)
+	}
+	if dryRun || len(bundle.Containers) == 0 {
+		return result, nil
+	}
+
+	bundle.Networks = bundleNetworks(bundle.Containers)
+	// Another request may have created one in the meantime
+	opts.SkipExisting = true
+	result.Results, err = importBundle(ctx, cli, store, box, bundle, opts)
+	if err != nil {
+		result.Error = err.Error()
+		return result, err
+	}
+	fmt.Printf("📋 Reconciled %d missing containers: %s\n", len(result.Missing), strings.Join(result.Missing, ", "))
+	return result, nil
+}
+
+// reconcileTask runs reconcile from the scheduler. Runs with nothing
+// missing aren't recorded.
+func reconcileTask(store *Store, box *SecretBox) func(ctx context.Context, cli *client.Client) (any, error) {
+	return func(ctx context.Context, cli *client.Client) (any, error) {
+		result, err := reconcile(ctx, cli, store, box, false, ImportOptions{})
+		if err == nil && len(result.Missing) == 0 {
+			return nil, nil
+		}
+		return result, err
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	units "github.com/docker/go-units"
+)
+
+type VolumeSize struct {
+	Name        string `json:"name"`
+	Destination string `json:"destination"`
+	// -1 when the daemon couldn't compute it
+	Size int64 `json:"size"`
+}
+
+type ContainerSize struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Size of the files written by the container (its writable layer)
+	SizeRw int64 `json:"size_rw"`
+	// Writable layer plus the image it's based on
+	SizeRootFs  int64        `json:"size_root_fs"`
+	Volumes     []VolumeSize `json:"volumes"`
+	VolumesSize int64        `json:"volumes_size"`
+	// Writable layer plus volumes, the disk the container is responsible for
+	Total int64 `json:"total"`
+}
+
+// containerSize reports the disk used by a container and its named volumes.
+// Computing sizes walks the filesystem, so it can be slow on big containers.
+func containerSize(ctx context.Context, cli *client.Client, containerID string) (*ContainerSize, error) {
+	info, _, err := cli.ContainerInspectWithRaw(ctx, containerID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	size := &ContainerSize{ID: info.ID, Name: info.Name[1:], Volumes: []VolumeSize{}}
+	if info.SizeRw != nil {
+		size.SizeRw = *info.SizeRw
+	}
+	if info.SizeRootFs != nil {
+		size.SizeRootFs = *info.SizeRootFs
+	}
+
+	var names []string
+	for _, m := range info.Mounts {
+		if m.Type == mount.TypeVolume {
+			names = append(names, m.Name)
+		}
+	}
+	if len(names) > 0 {
+		usage, err := cli.DiskUsage(ctx, types.DiskUsageOptions{Types: []types.DiskUsageObject{types.VolumeObject}})
+		if err != nil {
+			return nil, err
+		}
+		volumeSizes := map[string]int64{}
+		for _, v := range usage.Volumes {
+			if v.UsageData != nil {
+				volumeSizes[v.Name] = v.UsageData.Size
+			}
+		}
+		for _, m := range info.Mounts {
+			if m.Type != mount.TypeVolume {
+				continue
+			}
+			vs, ok := volumeSizes[m.Name]
+			if !ok {
+				vs = -1
+			}
+			size.Volumes = append(size.Volumes, VolumeSize{Name: m.Name, Destination: m.Destination, Size: vs})
+			if vs > 0 {
+				size.VolumesSize += vs
+			}
+		}
+	}
+	size.Total = size.SizeRw + size.VolumesSize
+	return size, nil
+}
+
+// diskGuard refuses image pulls when the Docker data directory is low on
+// space, rather than letting the daemon fail halfway through a pull.
+// DISK_GUARD is "block" (default), "warn" or "off"; MIN_FREE_DISK is the
+// threshold (default 2GB).
+type diskGuard struct {
+	mode    string
+	minFree uint64
+	path    string
+}
+
+type diskSpaceError struct {
+	path          string
+	free, minFree uint64
+}
+
+func (e *diskSpaceError) Error() string {
+	return fmt.Sprintf("only %s free on %s, below the %s minimum",
+		units.BytesSize(float64(e.free)), e.path, units.BytesSize(float64(e.minFree)))
+}
+
+var (
+	guardOnce sync.Once
+	guard     diskGuard
+)
+
+func loadDiskGuard(ctx context.Context, cli *client.Client) diskGuard {
+	guardOnce.Do(func() {
+		guard.mode = os.Getenv("DISK_GUARD")
+		if guard.mode == "" {
+			guard.mode = "block"
+		}
+		guard.minFree = 2 * 1000 * 1000 * 1000
+		if v := os.Getenv("MIN_FREE_DISK"); v != "" {
+			if n, err := units.FromHumanSize(v); err == nil {
+				guard.minFree = uint64(n)
+			} else {
+				fmt.Printf("⚠️  Invalid MIN_FREE_DISK %q, using 2GB\n", v)
+			}
+		}
+
+		// Check the daemon's data root when it's on this host, / otherwise
+		guard.path = os.Getenv("DOCKER_DATA_ROOT")
+		if guard.path == "" {
+			guard.path = rootPath()
+			if info, err := cli.Info(ctx); err == nil {
+				if _, err := os.Stat(info.DockerRootDir); err == nil {
+					guard.path = info.DockerRootDir
+				}
+			}
+		}
+	})
+	return guard
+}
+
+func freeDiskSpace(path string) (uint64, error) {
+	usage, err := diskUsage(path)
+	return usage.Free, err
+}
+
+// lowDiskSpace returns a *diskSpaceError when free space is below the
+// threshold, whatever the guard mode
+func lowDiskSpace(ctx context.Context, cli *client.Client) error {
+	g := loadDiskGuard(ctx, cli)
+	free, err := freeDiskSpace(g.path)
+	if err != nil || free >= g.minFree {
+		return nil
+	}
+	return &diskSpaceError{path: g.path, free: free, minFree: g.minFree}
+}
+
+// checkDiskSpace is called before pulling an image
+func checkDiskSpace(ctx context.Context, cli *client.Client) error {
+	g := loadDiskGuard(ctx, cli)
+	if g.mode == "off" {
+		return nil
+	}
+	err := lowDiskSpace(ctx, cli)
+	if err != nil && g.mode == "warn" {
+		fmt.Printf("⚠️  Low disk space: %v\n", err)
+		return nil
+	}
+	return err
+}
+
+// pullErrorStatus maps a pull failure to a response status
+func pullErrorStatus(err error) int {
+	var diskErr *diskSpaceError
+	if errors.As(err, &diskErr) {
+		return http.StatusInsufficientStorage
+	}
+	if errors.Is(err, errOffline) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Severities of lint findings, most severe first
+var lintSeverities = []string{"error", "warning", "info"}
+
+// LintFinding is one problem in a Dockerfile. Codes follow hadolint where it
+// has the same rule (DL...), rules of this server start with DM.
+type LintFinding struct {
+	Line        int    `json:"line"`
+	Code        string `json:"code"`
+	Severity    string `json:"severity"`
+	Message     string `json:"message"`
+	Instruction string `json:"instruction"`
+}
+
+// lintReporter records a finding for an instruction: code, severity, message
+type lintReporter func(in dockerInstruction, code, severity, format string, args ...any)
+
+// dockerInstruction is one instruction with its continuation lines joined
+type dockerInstruction struct {
+	Line int
+	Cmd  string
+	Args string
+}
+
+var (
+	escapeDirective = regexp.MustCompile(`^#\s*escape\s*=\s*([\\` + "`" + `])\s*$`)
+	heredocStart    = regexp.MustCompile(`<<-?\s*["']?([A-Za-z_][A-Za-z0-9_]*)["']?`)
+	// Separators between the commands of a RUN, lines for heredocs
+	shellSeparator = regexp.MustCompile(`&&|\|\||;|\||\n`)
+	singlePipe     = regexp.MustCompile(`[^|]\|[^|]`)
+	pipeToShell    = regexp.MustCompile(`\b(curl|wget)\b[^;&|]*\|\s*(sudo\s+)?(ba|z|da)?sh\b`)
+	secretName     = regexp.MustCompile(`(?i)(password|passwd|secret|token|api_?key|private_?key|credentials)`)
+)
+
+// parseDockerfile splits a Dockerfile into instructions, joining lines
+// continued with the escape character and the bodies of heredocs
+func parseDockerfile(text string) []dockerInstruction {
+	escape := `\`
+	var instructions []dockerInstruction
+	var current *dockerInstruction
+	var heredoc string
+	directives := true
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+
+		if heredoc != "" {
+			current.Args += "\n" + raw
+			if line == heredoc {
+				heredoc = ""
+				instructions = append(instructions, *current)
+				current = nil
+			}
+			continue
+		}
+		if directives {
+			if m := escapeDirective.FindStringSubmatch(line); m != nil {
+				escape = m[1]
+				continue
+			}
+			if line != "" && !strings.HasPrefix(line, "#") {
+				directives = false
+			}
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		continued := strings.HasSuffix(line, escape)
+		line = strings.TrimSpace(strings.TrimSuffix(line, escape))
+		if current == nil {
+			cmd, args, _ := strings.Cut(line, " ")
+			current = &dockerInstruction{Line: lineNo, Cmd: strings.ToUpper(cmd), Args: strings.TrimSpace(args)}
+		} else {
+			current.Args += " " + line
+		}
+		if continued {
+			continue
+		}
+		if m := heredocStart.FindStringSubmatch(current.Args); m != nil && (current.Cmd == "RUN" || current.Cmd == "COPY" || current.Cmd == "ADD") {
+			heredoc = m[1]
+			continue
+		}
+		instructions = append(instructions, *current)
+		current = nil
+	}
+	if current != nil {
+		instructions = append(instructions, *current)
+	}
+	return instructions
+}
+
+// lintDockerfile checks a Dockerfile for common mistakes, skipping the
+// codes in ignore
+func lintDockerfile(text string, ignore []string) []LintFinding {
+	findings := []LintFinding{}
+	var add lintReporter = func(in dockerInstruction, code, severity, format string, args ...any) {
+		if containsString(ignore, code) {
+			return
+		}
+		findings = append(findings, LintFinding{
+			Line:        in.Line,
+			Code:        code,
+			Severity:    severity,
+			Message:     fmt.Sprintf(format, args...),
+			Instruction: in.Cmd,
+		})
+	}
+
+	instructions := parseDockerfile(text)
+	if len(instructions) == 0 {
+		findings = append(findings, LintFinding{Line: 1, Code: "DM000", Severity: "error", Message: "the Dockerfile has no instructions"})
+		return findings
+	}
+
+	stages := map[string]bool{}
+	var user *dockerInstruction
+	var lastFrom dockerInstruction
+	cmds, entrypoints := 0, 0
+	pipefail := false
+	for _, in := range instructions {
+		switch in.Cmd {
+		case "FROM":
+			lastFrom, user, cmds, entrypoints, pipefail = in, nil, 0, 0, false
+			lintFrom(in, stages, add)
+
+		case "RUN":
+			lintRun(in, pipefail, add)
+
+		case "SHELL":
+			pipefail = strings.Contains(in.Args, "pipefail")
+
+		case "USER":
+			u := in
+			user = &u
+
+		case "MAINTAINER":
+			add(in, "DL4000", "error", "MAINTAINER is deprecated, use LABEL org.opencontainers.image.authors instead")
+
+		case "ADD", "COPY":
+			lintCopy(in, add)
+
+		case "WORKDIR":
+			dir := strings.Trim(in.Args, `"'`)
+			if !strings.HasPrefix(dir, "/") && !strings.HasPrefix(dir, "$") && !(len(dir) > 1 && dir[1] == ':') {
+				add(in, "DL3000", "error", "use an absolute WORKDIR, %q depends on the previous one", dir)
+			}
+
+		case "CMD", "ENTRYPOINT":
+			if in.Cmd == "CMD" {
+				cmds++
+				if cmds == 2 {
+					add(in, "DL4003", "warning", "more than one CMD in a stage, only the last one takes effect")
+				}
+			} else {
+				entrypoints++
+				if entrypoints == 2 {
+					add(in, "DL4004", "error", "more than one ENTRYPOINT in a stage, only the last one takes effect")
+				}
+			}
+			if !strings.HasPrefix(in.Args, "[") {
+				add(in, "DL3025", "warning", "use the JSON form of %s so signals reach the process instead of a shell", in.Cmd)
+			}
+
+		case "EXPOSE":
+			for _, p := range strings.Fields(in.Args) {
+				number, _, _ := strings.Cut(p, "/")
+				if strings.Contains(number, "$") {
+					continue
+				}
+				for _, part := range strings.SplitN(number, "-", 2) {
+					if n, err := strconv.Atoi(part); err != nil || n < 1 || n > 65535 {
+						add(in, "DL3011", "error", "invalid port %s, ports go from 1 to 65535", p)
+						break
+					}
+				}
+			}
+
+		case "ENV", "ARG":
+			for _, name := range declaredNames(in.Args) {
+				if secretName.MatchString(name) {
+					add(in, "DM002", "warning", "%s %s looks like a secret: values set in the Dockerfile stay in the image, pass it at run time or with a build secret (RUN --mount=type=secret)", in.Cmd, name)
+				}
+			}
+		}
+	}
+
+	switch {
+	case user == nil:
+		add(lastFrom, "DM004", "info", "no USER in the final stage, the container runs as root")
+	case isRootUser(user.Args):
+		add(*user, "DL3002", "warning", "the final USER is root, switch to an unprivileged user last")
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Line < findings[j].Line })
+	return findings
+}
+
+func lintFrom(in dockerInstruction, stages map[string]bool, add lintReporter) {
+	fields := []string{}
+	for _, f := range strings.Fields(in.Args) {
+		if !strings.HasPrefix(f, "--") {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		add(in, "DM000", "error", "FROM needs an image")
+		return
+	}
+	image := fields[0]
+	if len(fields) >= 3 && strings.EqualFold(fields[1], "AS") {
+		stages[strings.ToLower(fields[2])] = true
+	}
+	if image == "scratch" || stages[strings.ToLower(image)] || strings.Contains(image, "$") || strings.Contains(image, "@") {
+		return
+	}
+	// A colon after the last slash is a tag, before it a registry port
+	tagAt := strings.LastIndex(image, ":")
+	switch {
+	case tagAt <= strings.LastIndex(image, "/"):
+		add(in, "DL3006", "warning", "tag the version of %s explicitly, it defaults to latest", image)
+	case image[tagAt+1:] == "latest":
+		add(in, "DL3007", "warning", "%s changes under you, pin a version tag or digest", image)
+	}
+}
+
+func lintRun(in dockerInstruction, pipefail bool, add lintReporter) {
+	script := in.Args
+	cacheMount := strings.Contains(script, "--mount=type=cache")
+	// Flags of RUN itself aren't part of the command
+	for strings.HasPrefix(script, "--") {
+		_, script, _ = strings.Cut(script, " ")
+		script = strings.TrimSpace(script)
+	}
+	if strings.HasPrefix(script, "[") {
+		script = strings.NewReplacer(`["`, "", `"]`, "", `", "`, " ", `","`, " ").Replace(script)
+	}
+
+	aptUsed := false
+	for _, command := range shellSeparator.Split(script, -1) {
+		words := strings.Fields(command)
+		// Skip variable assignments in front of the command
+		for len(words) > 0 && strings.Contains(words[0], "=") && !strings.HasPrefix(words[0], "-") {
+			words = words[1:]
+		}
+		if len(words) == 0 {
+			continue
+		}
+		if words[0] == "sudo" {
+			add(in, "DL3004", "error", "don't use sudo, the build already runs as root unless a USER says otherwise")
+			words = words[1:]
+			if len(words) == 0 {
+				continue
+			}
+		}
+
+		switch words[0] {
+		case "cd":
+			add(in, "DL3003", "warning", "use WORKDIR to change directory, cd only lasts for this RUN")
+		case "apt":
+			add(in, "DL3027", "warning", "apt is meant for interactive use, use apt-get or apt-cache")
+		case "apt-get":
+			aptUsed = true
+			packages, flags := subcommandArgs(words, "install")
+			if packages == nil {
+				continue
+			}
+			if unpinned := unpinnedPackages(packages, "="); len(unpinned) > 0 {
+				add(in, "DL3008", "warning", "pin versions in apt-get install (%s=<version>) so builds are repeatable", strings.Join(unpinned, ", "))
+			}
+			if !hasAnyFlag(flags, "-y", "--yes", "--assume-yes", "-qq", "-qy", "-yq") {
+				add(in, "DL3014", "warning", "use apt-get install -y, the build can't answer prompts")
+			}
+			if !hasAnyFlag(flags, "--no-install-recommends") {
+				add(in, "DL3015", "info", "use --no-install-recommends to avoid installing packages nobody asked for")
+			}
+		case "apk":
+			packages, flags := subcommandArgs(words, "add")
+			if packages == nil {
+				continue
+			}
+			if unpinned := unpinnedPackages(packages, "="); len(unpinned) > 0 {
+				add(in, "DL3018", "warning", "pin versions in apk add (%s=<version>) so builds are repeatable", strings.Join(unpinned, ", "))
+			}
+			if !hasAnyFlag(flags, "--no-cache") && !cacheMount {
+				add(in, "DL3019", "info", "use apk add --no-cache so the package index isn't kept in the layer")
+			}
+		case "pip", "pip3":
+			packages, flags := subcommandArgs(words, "install")
+			if packages == nil {
+				continue
+			}
+			// Requirement files and local paths pin on their own
+			if hasAnyFlag(flags, "-r", "--requirement", "-e", "--editable", "-c", "--constraint") {
+				packages = nil
+			}
+			local := []string{}
+			for _, p := range packages {
+				if !strings.ContainsAny(p, "/") && !strings.HasSuffix(p, ".whl") && !strings.HasSuffix(p, ".tar.gz") && p != "." {
+					local = append(local, p)
+				}
+			}
+			if unpinned := unpinnedPackages(local, "==", ">=", "<=", "~=", "!=", "<", ">", "@"); len(unpinned) > 0 {
+				add(in, "DL3013", "warning", "pin versions in pip install (%s==<version>) so builds are repeatable", strings.Join(unpinned, ", "))
+			}
+			if !hasAnyFlag(flags, "--no-cache-dir") && !cacheMount {
+				add(in, "DL3042", "info", "use pip install --no-cache-dir so the download cache isn't kept in the layer")
+			}
+		}
+	}
+
+	if aptUsed && !cacheMount && strings.Contains(script, "install") && !strings.Contains(script, "/var/lib/apt/lists") {
+		add(in, "DL3009", "info", "delete the apt lists in the same RUN (rm -rf /var/lib/apt/lists/*) to keep them out of the layer")
+	}
+	if pipeToShell.MatchString(script) {
+		add(in, "DM003", "warning", "piping a downloaded script into a shell runs whatever the server sends, download it, check its checksum, then run it")
+	}
+	if !pipefail && singlePipe.MatchString(script) && !strings.Contains(script, "pipefail") {
+		add(in, "DL4006", "warning", "set -o pipefail (SHELL [\"/bin/bash\", \"-o\", \"pipefail\", \"-c\"]) so a failing command before a pipe fails the build")
+	}
+}
+
+// Whole build contexts copied into the image
+var unboundedSources = map[string]bool{".": true, "./": true, "*": true, "./*": true}
+
+func lintCopy(in dockerInstruction, add lintReporter) {
+	args := strings.Fields(in.Args)
+	fromStage := false
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		if strings.HasPrefix(args[0], "--from=") {
+			fromStage = true
+		}
+		args = args[1:]
+	}
+	if len(args) > 0 && strings.HasPrefix(args[0], "[") {
+		args = strings.Fields(strings.NewReplacer("[", "", "]", "", `"`, "", ",", " ").Replace(strings.Join(args, " ")))
+	}
+	if len(args) < 2 || strings.HasPrefix(args[0], "<<") {
+		return
+	}
+	sources := args[:len(args)-1]
+
+	if in.Cmd == "ADD" {
+		for _, src := range sources {
+			if strings.Contains(src, "://") || strings.HasPrefix(src, "git@") {
+				continue
+			}
+			if !isArchive(src) {
+				add(in, "DL3020", "error", "use COPY for files and directories, ADD also fetches URLs and unpacks archives")
+				break
+			}
+		}
+	}
+	if !fromStage {
+		for _, src := range sources {
+			if unboundedSources[src] {
+				add(in, "DM001", "warning", "%s %s copies the whole build context, including .git and local files: copy only what the image needs or exclude the rest in .dockerignore", in.Cmd, src)
+				break
+			}
+		}
+	}
+}
+
+func isArchive(name string) bool {
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tar.xz", ".txz", ".tar.zst"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// subcommandArgs returns the arguments and flags following sub in a command
+// such as "apt-get install -y curl", or nil when sub isn't used
+func subcommandArgs(words []string, sub string) (args, flags []string) {
+	for i, w := range words {
+		if w != sub {
+			continue
+		}
+		args = []string{}
+		for _, w := range words[i+1:] {
+			if strings.HasPrefix(w, "-") {
+				flags = append(flags, w)
+			} else {
+				args = append(args, w)
+			}
+		}
+		// Flags before the subcommand count too
+		for _, w := range words[1:i] {
+			if strings.HasPrefix(w, "-") {
+				flags = append(flags, w)
+			}
+		}
+		return args, flags
+	}
+	return nil, nil
+}
+
+func unpinnedPackages(packages []string, pins ...string) []string {
+	unpinned := []string{}
+	for _, p := range packages {
+		if strings.Contains(p, "$") {
+			continue
+		}
+		pinned := false
+		for _, pin := range pins {
+			if strings.Contains(p, pin) {
+				pinned = true
+				break
+			}
+		}
+		if !pinned {
+			unpinned = append(unpinned, p)
+		}
+	}
+	return unpinned
+}
+
+func hasAnyFlag(flags []string, names ...string) bool {
+	for _, f := range flags {
+		name, _, _ := strings.Cut(f, "=")
+		if containsString(names, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// declaredNames lists the variables an ENV or ARG sets, in both the
+// "NAME value" and "NAME=value ..." forms
+func declaredNames(args string) []string {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return nil
+	}
+	if !strings.Contains(fields[0], "=") {
+		return fields[:1]
+	}
+	names := []string{}
+	for _, f := range fields {
+		if name, _, ok := strings.Cut(f, "="); ok && envVarName.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func isRootUser(user string) bool {
+	name, _, _ := strings.Cut(strings.TrimSpace(user), ":")
+	return name == "root" || name == "0"
+}
+
+// lintSummary counts findings by severity
+func lintSummary(findings []LintFinding) map[string]int {
+	summary := map[string]int{}
+	for _, s := range lintSeverities {
+		summary[s] = 0
+	}
+	for _, f := range findings {
+		summary[f.Severity]++
+	}
+	return summary
+}
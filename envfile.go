@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var envVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// parseEnvFile parses .env file content the way docker compose does: blank
+// lines and # comments are skipped, an optional "export " prefix is allowed,
+// values may be single or double quoted, and double-quoted values support
+// \n, \t, \" and \\ escapes
+func parseEnvFile(content string) ([]string, error) {
+	var env []string
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNo)
+		}
+		if !envVarName.MatchString(key) {
+			return nil, fmt.Errorf("line %d: invalid variable name %q", lineNo, key)
+		}
+
+		value, err := parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		env = setEnv(env, key, value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+func parseEnvValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	switch quote := value[0]; quote {
+	case '\'', '"':
+		end := closingQuote(value, quote)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		if rest := strings.TrimSpace(value[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected characters after quoted value")
+		}
+		value = value[1:end]
+		if quote == '"' {
+			value = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`).Replace(value)
+		}
+		return value, nil
+	}
+
+	// Unquoted values end at an inline " #" comment
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
+
+// closingQuote finds the quote ending a value, skipping escaped double quotes
+func closingQuote(value string, quote byte) int {
+	for i := 1; i < len(value); i++ {
+		switch {
+		case quote == '"' && value[i] == '\\':
+			i++
+		case value[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+func hasEnv(env []string, name string) bool {
+	for _, kv := range env {
+		if strings.HasPrefix(kv, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// buildEnv merges .env file content with explicit variables, which win
+func buildEnv(envFile string, vars map[string]string) ([]string, error) {
+	env, err := parseEnvFile(envFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid env file: %v", err)
+	}
+
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		if !envVarName.MatchString(key) {
+			return nil, fmt.Errorf("invalid variable name %q", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = setEnv(env, key, vars[key])
+	}
+	return env, nil
+}
+
+// Uploaded .env files are expected to be small
+const maxEnvFileSize = 1 << 20
+
+func readEnvUpload(header *multipart.FileHeader) (string, error) {
+	if header.Size > maxEnvFileSize {
+		return "", fmt.Errorf("file exceeds %d bytes", maxEnvFileSize)
+	}
+	file, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxEnvFileSize))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	execEffectAllow = "allow"
+	execEffectDeny  = "deny"
+)
+
+// Role name of callers without an API key in exec rules
+const roleAnonymous = "anonymous"
+
+// ExecRule allows or denies commands run through /exec and the exec
+// terminal. Command is a regular expression matched against each part of a
+// command line, Containers a glob on the container name (empty for all) and
+// Roles the caller roles it applies to (empty for all). Rules are evaluated
+// by ascending priority, deny before allow at equal priority, and the first
+// match decides.
+type ExecRule struct {
+	ID          string    `json:"id"`
+	Effect      string    `json:"effect" binding:"required,oneof=allow deny"`
+	Command     string    `json:"command" binding:"required"`
+	Containers  string    `json:"containers"`
+	Roles       []string  `json:"roles" binding:"dive,oneof=admin user anonymous"`
+	Priority    int       `json:"priority"`
+	Description string    `json:"description" binding:"max=500"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	pattern *regexp.Regexp
+}
+
+func validateExecRule(r *ExecRule) error {
+	pattern, err := regexp.Compile(r.Command)
+	if err != nil {
+		return fmt.Errorf("invalid command pattern %q: %v", r.Command, err)
+	}
+	if _, err := path.Match(r.Containers, ""); err != nil {
+		return fmt.Errorf("invalid containers pattern %q: %v", r.Containers, err)
+	}
+	r.pattern = pattern
+	if r.Roles == nil {
+		r.Roles = []string{}
+	}
+	return nil
+}
+
+func (r *ExecRule) matches(role, containerName, command string) bool {
+	if len(r.Roles) > 0 && !containsString(r.Roles, role) {
+		return false
+	}
+	if r.Containers != "" {
+		if ok, _ := path.Match(r.Containers, containerName); !ok {
+			return false
+		}
+	}
+	return r.pattern.MatchString(command)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// execDefaultEffect applies when no rule matches: EXEC_POLICY_DEFAULT,
+// allow unless set to deny
+func execDefaultEffect() string {
+	if strings.EqualFold(os.Getenv("EXEC_POLICY_DEFAULT"), execEffectDeny) {
+		return execEffectDeny
+	}
+	return execEffectAllow
+}
+
+// Shell operators that chain or nest commands
+var commandSeparators = regexp.MustCompile("&&|\\|\\||[;&|\\n`()]")
+
+// commandParts splits a shell command line into the commands it runs, so
+// "cat /etc/hosts; apt-get install curl" can't pass as a cat. It is not a
+// shell parser; quoting is ignored, which errs on the side of more parts.
+func commandParts(command string) []string {
+	parts := []string{}
+	for _, part := range commandSeparators.Split(command, -1) {
+		// "$" is what's left of a "$(...)" substitution
+		part = strings.Trim(part, " \t\r$")
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// ExecDecision is the outcome of checking a command against the rules
+type ExecDecision struct {
+	Allowed bool      `json:"allowed"`
+	Rule    *ExecRule `json:"rule,omitempty"`
+	// The part of the command that was denied
+	Command string `json:"command,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+// evaluateExecPolicy checks every part of a command. All parts must be
+// allowed; the first denied part decides the outcome.
+func evaluateExecPolicy(rules []ExecRule, role, containerName, command string) ExecDecision {
+	parts := commandParts(command)
+	if len(parts) == 0 {
+		parts = []string{command}
+	}
+	decision := ExecDecision{Allowed: true}
+	for _, part := range parts {
+		effect, rule := execDefaultEffect(), (*ExecRule)(nil)
+		for i := range rules {
+			if rules[i].matches(role, containerName, part) {
+				effect, rule = rules[i].Effect, &rules[i]
+				break
+			}
+		}
+		if effect == execEffectDeny {
+			decision = ExecDecision{Allowed: false, Rule: rule, Command: part}
+			if rule != nil {
+				decision.Reason = fmt.Sprintf("%q is denied by exec rule %s", part, rule.ID)
+				if rule.Description != "" {
+					decision.Reason += " (" + rule.Description + ")"
+				}
+			} else {
+				decision.Reason = fmt.Sprintf("%q matches no exec rule and EXEC_POLICY_DEFAULT is deny", part)
+			}
+			return decision
+		}
+		// Report the first rule that allowed a part
+		if rule != nil && decision.Rule == nil {
+			decision.Rule = rule
+		}
+	}
+	if decision.Rule != nil {
+		decision.Reason = "allowed by exec rule " + decision.Rule.ID
+	} else {
+		decision.Reason = "no exec rule matched, EXEC_POLICY_DEFAULT is allow"
+	}
+	return decision
+}
+
+// CheckExec decides whether the caller may run command in the container and
+// records the attempt in the audit log
+func (s *Store) CheckExec(actor, role, containerName, command string) (ExecDecision, error) {
+	rules, err := s.ListExecRules()
+	if err != nil {
+		return ExecDecision{}, err
+	}
+	decision := evaluateExecPolicy(rules, role, containerName, command)
+	status := http.StatusOK
+	if !decision.Allowed {
+		status = http.StatusForbidden
+	}
+	details := fmt.Sprintf("command=%q decision=%s", command, decision.Reason)
+	if err := s.RecordAudit(actor, "exec", containerName, status, details); err != nil {
+		fmt.Printf("⚠️  Error writing audit log: %v\n", err)
+	}
+	return decision, nil
+}
+
+// enforceExecPolicy checks an exec attempt, answering 403 and returning
+// false when the rules deny it
+func enforceExecPolicy(ctx *gin.Context, store *Store, containerName, command string) bool {
+	decision, err := store.CheckExec(actorName(ctx), callerRole(ctx), strings.TrimPrefix(containerName, "/"), command)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking exec policy: " + err.Error()})
+		return false
+	}
+	if !decision.Allowed {
+		ctx.JSON(http.StatusForbidden, gin.H{
+			"error":      "Command not allowed: " + decision.Reason,
+			"decision":   decision,
+			"suggestion": "Lệnh này bị chặn bởi chính sách exec, xem GET /exec-policy hoặc liên hệ quản trị viên",
+		})
+		return false
+	}
+	return true
+}
+
+func (s *Store) CreateExecRule(r *ExecRule) error {
+	r.ID = newID()
+	r.CreatedAt = time.Now()
+	_, err := s.exec(`INSERT INTO exec_rules (id, effect, command, containers, roles, priority, description, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ID, r.Effect, r.Command, r.Containers, strings.Join(r.Roles, ","), r.Priority, r.Description, r.CreatedBy, r.CreatedAt.Unix())
+	return err
+}
+
+func (s *Store) DeleteExecRule(id string) (bool, error) {
+	res, err := s.exec(`DELETE FROM exec_rules WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ListExecRules returns the rules in evaluation order
+func (s *Store) ListExecRules() ([]ExecRule, error) {
+	rows, err := s.query(`SELECT id, effect, command, containers, roles, priority, description, created_by, created_at FROM exec_rules ORDER BY priority, created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []ExecRule{}
+	for rows.Next() {
+		var r ExecRule
+		var roles string
+		var createdAt int64
+		if err := rows.Scan(&r.ID, &r.Effect, &r.Command, &r.Containers, &roles, &r.Priority, &r.Description, &r.CreatedBy, &createdAt); err != nil {
+			return nil, err
+		}
+		r.Roles = []string{}
+		if roles != "" {
+			r.Roles = strings.Split(roles, ",")
+		}
+		r.CreatedAt = time.Unix(createdAt, 0)
+		// Rules were validated when created
+		r.pattern, err = regexp.Compile(r.Command)
+		if err != nil {
+			return nil, fmt.Errorf("exec rule %s: %w", r.ID, err)
+		}
+		rules = append(rules, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Same priority: deny wins over allow regardless of creation order
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority < rules[j].Priority
+		}
+		return rules[i].Effect == execEffectDeny && rules[j].Effect != execEffectDeny
+	})
+	return rules, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// expiresLabel holds the RFC 3339 time after which the expiry task stops and
+// removes a container
+const expiresLabel = labelPrefix + "expires-at"
+
+const (
+	minTTL = time.Minute
+	maxTTL = 365 * 24 * time.Hour
+)
+
+// parseTTL accepts Go durations ("90m", "2h30m") and whole days ("7d")
+func parseTTL(s string) (time.Duration, error) {
+	var ttl time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ttl %q", s)
+		}
+		ttl = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ttl %q", s)
+		}
+		ttl = d
+	}
+	if ttl < minTTL || ttl > maxTTL {
+		return 0, fmt.Errorf("ttl must be between 1m and 365d")
+	}
+	return ttl, nil
+}
+
+// setExpiry labels a container to expire ttl from now
+func setExpiry(config *container.Config, ttl time.Duration) time.Time {
+	expiresAt := time.Now().Add(ttl).UTC().Truncate(time.Second)
+	if config.Labels == nil {
+		config.Labels = map[string]string{}
+	}
+	config.Labels[expiresLabel] = expiresAt.Format(time.RFC3339)
+	return expiresAt
+}
+
+// ExpiredContainer is a container removed by the expiry task
+type ExpiredContainer struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// expireContainers stops and removes every container whose expiry time has
+// passed. Anonymous volumes go with it, named volumes are kept.
+func expireContainers(ctx context.Context, cli *client.Client) ([]ExpiredContainer, error) {
+	ctx = withActor(ctx, "expiry")
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", expiresLabel)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	expired := []ExpiredContainer{}
+	now := time.Now()
+	for _, c := range containers {
+		expiresAt, err := time.Parse(time.RFC3339, c.Labels[expiresLabel])
+		if err != nil || expiresAt.After(now) {
+			continue
+		}
+		e := ExpiredContainer{ID: c.ID, ExpiresAt: expiresAt}
+		if len(c.Names) > 0 {
+			e.Name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		// Stop first so the container gets its graceful shutdown
+		if c.State == "running" {
+			if err := stopContainer(ctx, cli, c.ID, container.StopOptions{}); err != nil {
+				e.Error = err.Error()
+				// A hook refusing the stop keeps the container
+				var hookErr *HookError
+				if errors.As(err, &hookErr) {
+					expired = append(expired, e)
+					continue
+				}
+			}
+		}
+		if err := removeContainer(ctx, cli, c.ID, container.RemoveOptions{Force: true, RemoveVolumes: true}); err != nil {
+			e.Error = err.Error()
+		} else {
+			fmt.Printf("⏰ Removed expired container %s (expired %s)\n", e.Name, expiresAt.Format(time.RFC3339))
+		}
+		expired = append(expired, e)
+	}
+	return expired, nil
+}
+
+// expiryTask is the scheduler task removing expired containers
+func expiryTask() func(ctx context.Context, cli *client.Client) (any, error) {
+	return func(ctx context.Context, cli *client.Client) (any, error) {
+		expired, err := expireContainers(ctx, cli)
+		if err == nil && len(expired) == 0 {
+			return nil, nil
+		}
+		return expired, err
+	}
+}
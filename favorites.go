@@ -0,0 +1,89 @@
+package main
+
+import "time"
+
+type Favorite struct {
+	User         string    `json:"user"`
+	ResourceType string    `json:"resource_type"`
+	ResourceID   string    `json:"resource_id"`
+	Pinned       bool      `json:"pinned"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// validFavoriteType reports whether favorites can be kept for a resource type
+func validFavoriteType(resourceType string) bool {
+	return resourceType == "container" || resourceType == "image"
+}
+
+// favoriteRank orders list entries: pinned, then favorites, then the rest
+func favoriteRank(favorite, pinned bool) int {
+	switch {
+	case pinned:
+		return 2
+	case favorite:
+		return 1
+	}
+	return 0
+}
+
+func (s *Store) SaveFavorite(f *Favorite) error {
+	f.CreatedAt = time.Now()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(s.rebind(`DELETE FROM favorites WHERE username = ? AND resource_type = ? AND resource_id = ?`),
+		f.User, f.ResourceType, f.ResourceID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(s.rebind(`INSERT INTO favorites (username, resource_type, resource_id, pinned, created_at) VALUES (?, ?, ?, ?, ?)`),
+		f.User, f.ResourceType, f.ResourceID, f.Pinned, f.CreatedAt.Unix()); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) DeleteFavorite(user, resourceType, resourceID string) error {
+	_, err := s.exec(`DELETE FROM favorites WHERE username = ? AND resource_type = ? AND resource_id = ?`,
+		user, resourceType, resourceID)
+	return err
+}
+
+func (s *Store) ListFavorites(user string) ([]Favorite, error) {
+	rows, err := s.query(`SELECT username, resource_type, resource_id, pinned, created_at FROM favorites
+		WHERE username = ? ORDER BY pinned DESC, created_at`, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	favorites := []Favorite{}
+	for rows.Next() {
+		var f Favorite
+		var createdAt int64
+		if err := rows.Scan(&f.User, &f.ResourceType, &f.ResourceID, &f.Pinned, &createdAt); err != nil {
+			return nil, err
+		}
+		f.CreatedAt = time.Unix(createdAt, 0)
+		favorites = append(favorites, f)
+	}
+	return favorites, rows.Err()
+}
+
+// FavoritesByResource returns a user's favorites of one resource type keyed by resource ID
+func (s *Store) FavoritesByResource(user, resourceType string) (map[string]Favorite, error) {
+	favorites, err := s.ListFavorites(user)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]Favorite{}
+	for _, f := range favorites {
+		if f.ResourceType == resourceType {
+			result[f.ResourceID] = f
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,743 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A small GraphQL executor for the dashboard API: queries and subscriptions
+// with arguments, aliases, variables, fragments and @skip/@include.
+// Mutations and introspection aren't supported, the schema is served as SDL
+// by GET /graphql/schema instead.
+
+// gqlField resolves one field of an object type. Type is the GraphQL type of
+// the result, e.g. "String!", "Container" or "[Image!]!". Object results are
+// passed as parent to the resolvers of their own fields.
+type gqlField struct {
+	Type        string
+	Args        string
+	Description string
+	Resolve     func(r *gqlRequest, parent any, args map[string]any) (any, error)
+	// Subscribe replaces Resolve on subscription fields: it calls emit with
+	// each new value until the request ends or emit fails
+	Subscribe func(r *gqlRequest, args map[string]any, emit func(any) error) error
+}
+
+// gqlSchema maps object type names to their fields. "Query" and
+// "Subscription" are the root types.
+type gqlSchema map[string]map[string]gqlField
+
+var gqlScalars = map[string]bool{"String": true, "Int": true, "Float": true, "Boolean": true, "ID": true, "JSON": true}
+
+// gqlError is an error in the GraphQL response format
+type gqlError struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+func (e gqlError) Error() string {
+	return e.Message
+}
+
+// gqlObject is a result object that keeps fields in query order
+type gqlObject struct {
+	keys   []string
+	values map[string]any
+}
+
+func (o *gqlObject) set(key string, value any) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *gqlObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Query document
+
+type gqlVariable string
+
+type gqlSelection struct {
+	Alias      string
+	Name       string
+	Args       map[string]any
+	Directives map[string]map[string]any
+	Selections []gqlSelection
+	// Fragment spreads have Spread set, inline fragments only Selections
+	Spread string
+	Inline bool
+}
+
+type gqlVarDef struct {
+	Name     string
+	Required bool
+	Default  any
+}
+
+type gqlOperation struct {
+	Kind       string
+	Name       string
+	Vars       []gqlVarDef
+	Selections []gqlSelection
+}
+
+type gqlDocument struct {
+	Operations []*gqlOperation
+	Fragments  map[string][]gqlSelection
+}
+
+// Lexer
+
+type gqlToken struct {
+	kind  byte // 'n' name, 'i' int, 'f' float, 's' string, 'p' punctuator, 0 end
+	value string
+	pos   int
+}
+
+func gqlLex(src string) ([]gqlToken, error) {
+	var tokens []gqlToken
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			tokens = append(tokens, gqlToken{'p', "...", i})
+			i += 3
+		case strings.ContainsRune("!$():=@[]{}|&", rune(c)):
+			tokens = append(tokens, gqlToken{'p', string(c), i})
+			i++
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(src) && (src[i] == '_' || src[i] >= 'a' && src[i] <= 'z' || src[i] >= 'A' && src[i] <= 'Z' || src[i] >= '0' && src[i] <= '9') {
+				i++
+			}
+			tokens = append(tokens, gqlToken{'n', src[start:i], start})
+		case c == '-' || c >= '0' && c <= '9':
+			start := i
+			kind := byte('i')
+			i++
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || strings.ContainsRune(".eE+-", rune(src[i]))) {
+				if !(src[i] >= '0' && src[i] <= '9') {
+					kind = 'f'
+				}
+				i++
+			}
+			tokens = append(tokens, gqlToken{kind, src[start:i], start})
+		case c == '"':
+			start := i
+			if strings.HasPrefix(src[i:], `"""`) {
+				end := strings.Index(src[i+3:], `"""`)
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated block string at %d", start)
+				}
+				tokens = append(tokens, gqlToken{'s', strings.TrimSpace(src[i+3 : i+3+end]), start})
+				i += end + 6
+				continue
+			}
+			i++
+			for i < len(src) && src[i] != '"' && src[i] != '\n' {
+				if src[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(src) || src[i] != '"' {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			i++
+			value, err := strconv.Unquote(src[start:i])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at %d", start)
+			}
+			tokens = append(tokens, gqlToken{'s', value, start})
+		default:
+			r, _ := utf8.DecodeRuneInString(src[i:])
+			return nil, fmt.Errorf("unexpected character %q at %d", r, i)
+		}
+	}
+	return append(tokens, gqlToken{0, "", len(src)}), nil
+}
+
+// Parser
+
+type gqlParser struct {
+	tokens []gqlToken
+	pos    int
+}
+
+func (p *gqlParser) peek() gqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *gqlParser) next() gqlToken {
+	t := p.tokens[p.pos]
+	if t.kind != 0 {
+		p.pos++
+	}
+	return t
+}
+
+func (p *gqlParser) is(value string) bool {
+	t := p.peek()
+	return (t.kind == 'p' || t.kind == 'n') && t.value == value
+}
+
+func (p *gqlParser) expect(value string) error {
+	if !p.is(value) {
+		return p.unexpected()
+	}
+	p.next()
+	return nil
+}
+
+func (p *gqlParser) name() (string, error) {
+	if p.peek().kind != 'n' {
+		return "", p.unexpected()
+	}
+	return p.next().value, nil
+}
+
+func (p *gqlParser) unexpected() error {
+	t := p.peek()
+	if t.kind == 0 {
+		return fmt.Errorf("syntax error: unexpected end of query")
+	}
+	return fmt.Errorf("syntax error: unexpected %q at %d", t.value, t.pos)
+}
+
+func parseGraphQL(query string) (*gqlDocument, error) {
+	tokens, err := gqlLex(query)
+	if err != nil {
+		return nil, fmt.Errorf("syntax error: %w", err)
+	}
+	p := &gqlParser{tokens: tokens}
+	doc := &gqlDocument{Fragments: map[string][]gqlSelection{}}
+	for p.peek().kind != 0 {
+		switch {
+		case p.is("{"):
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, &gqlOperation{Kind: "query", Selections: selections})
+		case p.is("query"), p.is("mutation"), p.is("subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, op)
+		case p.is("fragment"):
+			p.next()
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			// Type conditions aren't checked, every type is concrete
+			if err := p.expect("on"); err != nil {
+				return nil, err
+			}
+			if _, err := p.name(); err != nil {
+				return nil, err
+			}
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.Fragments[name] = selections
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.Operations) == 0 {
+		return nil, fmt.Errorf("no operation in query")
+	}
+	return doc, nil
+}
+
+func (p *gqlParser) operation() (*gqlOperation, error) {
+	op := &gqlOperation{Kind: p.next().value}
+	if p.peek().kind == 'n' {
+		op.Name = p.next().value
+	}
+	if p.is("(") {
+		p.next()
+		for !p.is(")") {
+			if err := p.expect("$"); err != nil {
+				return nil, err
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			typ, err := p.typeRef()
+			if err != nil {
+				return nil, err
+			}
+			def := gqlVarDef{Name: name, Required: strings.HasSuffix(typ, "!")}
+			if p.is("=") {
+				p.next()
+				if def.Default, err = p.value(true); err != nil {
+					return nil, err
+				}
+			}
+			op.Vars = append(op.Vars, def)
+		}
+		p.next()
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	var err error
+	op.Selections, err = p.selectionSet()
+	return op, err
+}
+
+func (p *gqlParser) typeRef() (string, error) {
+	var typ string
+	if p.is("[") {
+		p.next()
+		inner, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect("]"); err != nil {
+			return "", err
+		}
+		typ = "[" + inner + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+	if p.is("!") {
+		p.next()
+		typ += "!"
+	}
+	return typ, nil
+}
+
+func (p *gqlParser) selectionSet() ([]gqlSelection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	selections := []gqlSelection{}
+	for !p.is("}") {
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, sel)
+	}
+	p.next()
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("syntax error: empty selection set")
+	}
+	return selections, nil
+}
+
+func (p *gqlParser) selection() (gqlSelection, error) {
+	var sel gqlSelection
+	var err error
+	if p.is("...") {
+		p.next()
+		if p.peek().kind == 'n' && !p.is("on") {
+			sel.Spread = p.next().value
+			sel.Directives, err = p.directives()
+			return sel, err
+		}
+		sel.Inline = true
+		if p.is("on") {
+			p.next()
+			if _, err := p.name(); err != nil {
+				return sel, err
+			}
+		}
+		if sel.Directives, err = p.directives(); err != nil {
+			return sel, err
+		}
+		sel.Selections, err = p.selectionSet()
+		return sel, err
+	}
+
+	if sel.Name, err = p.name(); err != nil {
+		return sel, err
+	}
+	sel.Alias = sel.Name
+	if p.is(":") {
+		p.next()
+		if sel.Name, err = p.name(); err != nil {
+			return sel, err
+		}
+	}
+	if sel.Args, err = p.arguments(); err != nil {
+		return sel, err
+	}
+	if sel.Directives, err = p.directives(); err != nil {
+		return sel, err
+	}
+	if p.is("{") {
+		sel.Selections, err = p.selectionSet()
+	}
+	return sel, err
+}
+
+func (p *gqlParser) arguments() (map[string]any, error) {
+	args := map[string]any{}
+	if !p.is("(") {
+		return args, nil
+	}
+	p.next()
+	for !p.is(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if args[name], err = p.value(false); err != nil {
+			return nil, err
+		}
+	}
+	p.next()
+	return args, nil
+}
+
+func (p *gqlParser) directives() (map[string]map[string]any, error) {
+	directives := map[string]map[string]any{}
+	for p.is("@") {
+		p.next()
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if directives[name], err = p.arguments(); err != nil {
+			return nil, err
+		}
+	}
+	return directives, nil
+}
+
+// value parses an argument value; constant values can't use variables
+func (p *gqlParser) value(constant bool) (any, error) {
+	t := p.peek()
+	switch {
+	case t.kind == 'p' && t.value == "$" && !constant:
+		p.next()
+		name, err := p.name()
+		return gqlVariable(name), err
+	case t.kind == 'i':
+		p.next()
+		return strconv.ParseInt(t.value, 10, 64)
+	case t.kind == 'f':
+		p.next()
+		return strconv.ParseFloat(t.value, 64)
+	case t.kind == 's':
+		p.next()
+		return t.value, nil
+	case t.kind == 'n':
+		p.next()
+		switch t.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		// Enum values are passed to resolvers as strings
+		return t.value, nil
+	case t.kind == 'p' && t.value == "[":
+		p.next()
+		list := []any{}
+		for !p.is("]") {
+			v, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		p.next()
+		return list, nil
+	case t.kind == 'p' && t.value == "{":
+		p.next()
+		object := map[string]any{}
+		for !p.is("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if object[name], err = p.value(constant); err != nil {
+				return nil, err
+			}
+		}
+		p.next()
+		return object, nil
+	}
+	return nil, p.unexpected()
+}
+
+// Execution
+
+// gqlExecution holds the state of one operation
+type gqlExecution struct {
+	schema    gqlSchema
+	request   *gqlRequest
+	fragments map[string][]gqlSelection
+	vars      map[string]any
+	errors    []gqlError
+}
+
+// operation picks the operation to run and resolves its variables
+func (d *gqlDocument) operation(name string, variables map[string]any) (*gqlOperation, map[string]any, error) {
+	var op *gqlOperation
+	if name == "" {
+		if len(d.Operations) > 1 {
+			return nil, nil, fmt.Errorf("operationName is required when the query has several operations")
+		}
+		op = d.Operations[0]
+	} else {
+		for _, o := range d.Operations {
+			if o.Name == name {
+				op = o
+			}
+		}
+		if op == nil {
+			return nil, nil, fmt.Errorf("unknown operation %q", name)
+		}
+	}
+
+	vars := map[string]any{}
+	for _, def := range op.Vars {
+		v, ok := variables[def.Name]
+		switch {
+		case ok:
+			vars[def.Name] = v
+		case def.Default != nil:
+			vars[def.Name] = def.Default
+		case def.Required:
+			return nil, nil, fmt.Errorf("variable $%s is required", def.Name)
+		}
+	}
+	return op, vars, nil
+}
+
+// argValue replaces variables in a parsed value
+func (e *gqlExecution) argValue(v any) any {
+	switch v := v.(type) {
+	case gqlVariable:
+		return e.vars[string(v)]
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = e.argValue(item)
+		}
+		return list
+	case map[string]any:
+		object := map[string]any{}
+		for k, item := range v {
+			object[k] = e.argValue(item)
+		}
+		return object
+	}
+	return v
+}
+
+func (e *gqlExecution) included(directives map[string]map[string]any) bool {
+	if args, ok := directives["skip"]; ok {
+		if skip, _ := e.argValue(args["if"]).(bool); skip {
+			return false
+		}
+	}
+	if args, ok := directives["include"]; ok {
+		if include, _ := e.argValue(args["if"]).(bool); !include {
+			return false
+		}
+	}
+	return true
+}
+
+// collect flattens fragments into the list of fields to resolve
+func (e *gqlExecution) collect(selections []gqlSelection, seen map[string]bool) ([]gqlSelection, error) {
+	fields := []gqlSelection{}
+	for _, sel := range selections {
+		if !e.included(sel.Directives) {
+			continue
+		}
+		inner := sel.Selections
+		switch {
+		case sel.Spread != "":
+			if seen[sel.Spread] {
+				return nil, fmt.Errorf("fragment %s spreads itself", sel.Spread)
+			}
+			var ok bool
+			if inner, ok = e.fragments[sel.Spread]; !ok {
+				return nil, fmt.Errorf("unknown fragment %s", sel.Spread)
+			}
+			seen[sel.Spread] = true
+		case !sel.Inline:
+			fields = append(fields, sel)
+			continue
+		}
+		collected, err := e.collect(inner, seen)
+		if err != nil {
+			return nil, err
+		}
+		delete(seen, sel.Spread)
+		fields = append(fields, collected...)
+	}
+	return fields, nil
+}
+
+// selectObject resolves the selected fields of one object
+func (e *gqlExecution) selectObject(typeName string, parent any, selections []gqlSelection, path []any) *gqlObject {
+	result := &gqlObject{values: map[string]any{}}
+	fields, err := e.collect(selections, map[string]bool{})
+	if err != nil {
+		e.errors = append(e.errors, gqlError{Message: err.Error(), Path: path})
+		return result
+	}
+	for _, sel := range fields {
+		fieldPath := append(append([]any{}, path...), sel.Alias)
+		if sel.Name == "__typename" {
+			result.set(sel.Alias, typeName)
+			continue
+		}
+		field, ok := e.schema[typeName][sel.Name]
+		if !ok || field.Resolve == nil {
+			e.errors = append(e.errors, gqlError{Message: fmt.Sprintf("Cannot query field %q on type %q", sel.Name, typeName), Path: fieldPath})
+			continue
+		}
+		args := map[string]any{}
+		for k, v := range sel.Args {
+			args[k] = e.argValue(v)
+		}
+		value, err := field.Resolve(e.request, parent, args)
+		if err != nil {
+			e.errors = append(e.errors, gqlError{Message: err.Error(), Path: fieldPath})
+			result.set(sel.Alias, nil)
+			continue
+		}
+		result.set(sel.Alias, e.complete(field.Type, value, sel, fieldPath))
+	}
+	return result
+}
+
+// complete shapes a resolved value according to its GraphQL type
+func (e *gqlExecution) complete(typ string, value any, sel gqlSelection, path []any) any {
+	typ = strings.TrimSuffix(typ, "!")
+	if value == nil || isNilValue(value) {
+		return nil
+	}
+	if strings.HasPrefix(typ, "[") {
+		inner := typ[1 : len(typ)-1]
+		items, ok := value.([]any)
+		if !ok {
+			e.errors = append(e.errors, gqlError{Message: "internal error: expected a list", Path: path})
+			return nil
+		}
+		list := make([]any, len(items))
+		for i, item := range items {
+			list[i] = e.complete(inner, item, sel, append(append([]any{}, path...), i))
+		}
+		return list
+	}
+	if gqlScalars[typ] {
+		if sel.Selections != nil {
+			e.errors = append(e.errors, gqlError{Message: fmt.Sprintf("Field %q of type %s can't have a selection of subfields", sel.Name, typ), Path: path})
+			return nil
+		}
+		return value
+	}
+	if sel.Selections == nil {
+		e.errors = append(e.errors, gqlError{Message: fmt.Sprintf("Field %q of type %s must have a selection of subfields", sel.Name, typ), Path: path})
+		return nil
+	}
+	return e.selectObject(typ, value, sel.Selections, path)
+}
+
+// isNilValue catches nil pointers and maps wrapped in a non-nil interface
+func isNilValue(v any) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// gqlList converts a typed slice for complete, which only walks []any
+func gqlList[T any](items []T) []any {
+	list := make([]any, len(items))
+	for i := range items {
+		list[i] = items[i]
+	}
+	return list
+}
+
+// gqlSDL prints the schema in GraphQL schema definition language
+func (s gqlSchema) SDL() string {
+	var buf strings.Builder
+	buf.WriteString("scalar JSON\n")
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "\ntype %s {\n", name)
+		fields := make([]string, 0, len(s[name]))
+		for field := range s[name] {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			f := s[name][field]
+			if f.Description != "" {
+				fmt.Fprintf(&buf, "  %q\n", f.Description)
+			}
+			fmt.Fprintf(&buf, "  %s%s: %s\n", field, f.Args, f.Type)
+		}
+		buf.WriteString("}\n")
+	}
+	return buf.String()
+}
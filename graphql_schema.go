@@ -0,0 +1,605 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/gin-gonic/gin"
+)
+
+// gqlRequest is shared by the resolvers of one GraphQL request. Lists are
+// loaded from Docker once, so nested fields like Image.containers don't
+// query the daemon for every parent.
+type gqlRequest struct {
+	ctx      context.Context
+	cli      *client.Client
+	store    *Store
+	listings *ListingCache
+
+	mu         sync.Mutex
+	containers []gqlContainer
+	images     []image.Summary
+	networks   []network.Summary
+	volumes    []*volume.Volume
+	usage      map[string]*ContainerUsage
+}
+
+// gqlContainer is a container list entry with its app metadata, as in /status
+type gqlContainer struct {
+	container.Summary
+	Name      string
+	Notes     string
+	Protected bool
+}
+
+func (r *gqlRequest) Containers() ([]gqlContainer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.containers != nil {
+		return r.containers, nil
+	}
+	containers, err := r.listings.Containers(r.ctx, r.cli)
+	if err != nil {
+		return nil, err
+	}
+	// Trashed containers are hidden like in /status
+	inTrash := map[string]bool{}
+	if trashed, err := r.store.ListTrashed(); err == nil {
+		for _, t := range trashed {
+			inTrash[t.ContainerID] = true
+		}
+	}
+	annotations, err := r.store.ListAnnotations("container")
+	if err != nil {
+		fmt.Printf("⚠️  Error loading container annotations: %v\n", err)
+	}
+	r.containers = []gqlContainer{}
+	for _, c := range containers {
+		if inTrash[c.ID] {
+			continue
+		}
+		item := gqlContainer{Summary: c, Name: summaryName(c)}
+		if a, ok := annotations[item.Name]; ok {
+			item.Notes = a.Notes
+		}
+		item.Protected = protectionReason(r.store, item.Name, c.Labels) != ""
+		r.containers = append(r.containers, item)
+	}
+	return r.containers, nil
+}
+
+func (r *gqlRequest) Images() ([]image.Summary, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.images != nil {
+		return r.images, nil
+	}
+	images, err := r.listings.Images(r.ctx, r.cli)
+	if err != nil {
+		return nil, err
+	}
+	r.images = images
+	return images, nil
+}
+
+func (r *gqlRequest) Networks() ([]network.Summary, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.networks != nil {
+		return r.networks, nil
+	}
+	networks, err := r.cli.NetworkList(r.ctx, network.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	r.networks = networks
+	return networks, nil
+}
+
+func (r *gqlRequest) Volumes() ([]*volume.Volume, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.volumes != nil {
+		return r.volumes, nil
+	}
+	resp, err := r.cli.VolumeList(r.ctx, volume.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	r.volumes = resp.Volumes
+	if r.volumes == nil {
+		r.volumes = []*volume.Volume{}
+	}
+	return r.volumes, nil
+}
+
+// Usage returns live CPU and memory usage of a container. The first call
+// samples every running container at once, a stats call takes a second.
+func (r *gqlRequest) Usage(containerID string) (*ContainerUsage, error) {
+	containers, err := r.Containers()
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.usage == nil {
+		running := []string{}
+		for _, c := range containers {
+			if c.State == "running" {
+				running = append(running, c.ID)
+			}
+		}
+		r.usage = containersUsage(r.ctx, r.cli, running)
+	}
+	return r.usage[containerID], nil
+}
+
+// containersByFilter returns the containers matching fn
+func (r *gqlRequest) containersByFilter(fn func(c gqlContainer) bool) ([]any, error) {
+	containers, err := r.Containers()
+	if err != nil {
+		return nil, err
+	}
+	matching := []gqlContainer{}
+	for _, c := range containers {
+		if fn(c) {
+			matching = append(matching, c)
+		}
+	}
+	return gqlList(matching), nil
+}
+
+func argString(args map[string]any, name string) string {
+	s, _ := args[name].(string)
+	return s
+}
+
+func argBool(args map[string]any, name string, def bool) bool {
+	if b, ok := args[name].(bool); ok {
+		return b
+	}
+	return def
+}
+
+func unixTime(sec int64) string {
+	return time.Unix(sec, 0).UTC().Format(time.RFC3339)
+}
+
+// dockerSchema exposes containers, images, networks, volumes and stats, with
+// nested fields between them, and Docker events as a subscription
+func dockerSchema() gqlSchema {
+	return gqlSchema{
+		"Query": {
+			"containers": {
+				Type: "[Container!]!", Args: "(all: Boolean = true, state: String, project: String)",
+				Description: "Containers without the trashed ones, optionally only one state or project",
+				Resolve: func(r *gqlRequest, _ any, args map[string]any) (any, error) {
+					all := argBool(args, "all", true)
+					state, project := argString(args, "state"), argString(args, "project")
+					return r.containersByFilter(func(c gqlContainer) bool {
+						return (all || c.State == "running") &&
+							(state == "" || c.State == state) &&
+							(project == "" || c.Labels[projectLabel] == project)
+					})
+				},
+			},
+			"container": {
+				Type: "Container", Args: "(id: String!)",
+				Description: "A container by ID, ID prefix or name",
+				Resolve: func(r *gqlRequest, _ any, args map[string]any) (any, error) {
+					id := argString(args, "id")
+					matching, err := r.containersByFilter(func(c gqlContainer) bool {
+						return c.ID == id || c.Name == id || (len(id) >= 4 && strings.HasPrefix(c.ID, id))
+					})
+					if err != nil || len(matching) == 0 {
+						return nil, err
+					}
+					return matching[0], nil
+				},
+			},
+			"images": {
+				Type: "[Image!]!",
+				Resolve: func(r *gqlRequest, _ any, _ map[string]any) (any, error) {
+					images, err := r.Images()
+					return gqlList(images), err
+				},
+			},
+			"image": {
+				Type: "Image", Args: "(id: String!)",
+				Description: "An image by ID, ID prefix or tag",
+				Resolve: func(r *gqlRequest, _ any, args map[string]any) (any, error) {
+					return r.findImage(argString(args, "id"))
+				},
+			},
+			"networks": {
+				Type: "[Network!]!",
+				Resolve: func(r *gqlRequest, _ any, _ map[string]any) (any, error) {
+					networks, err := r.Networks()
+					return gqlList(networks), err
+				},
+			},
+			"volumes": {
+				Type: "[Volume!]!",
+				Resolve: func(r *gqlRequest, _ any, _ map[string]any) (any, error) {
+					volumes, err := r.Volumes()
+					return gqlList(volumes), err
+				},
+			},
+			"stats": {
+				Type:        "Stats!",
+				Description: "Container and image counts, like GET /stats",
+				Resolve: func(r *gqlRequest, _ any, _ map[string]any) (any, error) {
+					return struct{}{}, nil
+				},
+			},
+		},
+
+		"Container": {
+			"id":        {Type: "ID!", Resolve: containerField(func(c gqlContainer) any { return c.ID })},
+			"name":      {Type: "String!", Resolve: containerField(func(c gqlContainer) any { return c.Name })},
+			"image":     {Type: "String!", Resolve: containerField(func(c gqlContainer) any { return c.Image })},
+			"imageId":   {Type: "String!", Resolve: containerField(func(c gqlContainer) any { return c.ImageID })},
+			"command":   {Type: "String!", Resolve: containerField(func(c gqlContainer) any { return c.Command })},
+			"state":     {Type: "String!", Resolve: containerField(func(c gqlContainer) any { return c.State })},
+			"status":    {Type: "String!", Resolve: containerField(func(c gqlContainer) any { return c.Status })},
+			"created":   {Type: "String!", Resolve: containerField(func(c gqlContainer) any { return unixTime(c.Created) })},
+			"labels":    {Type: "JSON!", Resolve: containerField(func(c gqlContainer) any { return c.Labels })},
+			"ports":     {Type: "JSON!", Resolve: containerField(func(c gqlContainer) any { return c.Ports })},
+			"mounts":    {Type: "JSON!", Resolve: containerField(func(c gqlContainer) any { return c.Mounts })},
+			"project":   {Type: "String", Resolve: containerField(func(c gqlContainer) any { return c.Labels[projectLabel] })},
+			"notes":     {Type: "String!", Resolve: containerField(func(c gqlContainer) any { return c.Notes })},
+			"protected": {Type: "Boolean!", Resolve: containerField(func(c gqlContainer) any { return c.Protected })},
+			"imageDetails": {
+				Type: "Image", Description: "The image the container runs",
+				Resolve: func(r *gqlRequest, parent any, _ map[string]any) (any, error) {
+					return r.findImage(parent.(gqlContainer).ImageID)
+				},
+			},
+			"networks": {
+				Type: "[Network!]!",
+				Resolve: func(r *gqlRequest, parent any, _ map[string]any) (any, error) {
+					c := parent.(gqlContainer)
+					networks, err := r.Networks()
+					if err != nil {
+						return nil, err
+					}
+					connected := []network.Summary{}
+					for _, n := range networks {
+						if c.NetworkSettings != nil && c.NetworkSettings.Networks[n.Name] != nil {
+							connected = append(connected, n)
+						}
+					}
+					return gqlList(connected), nil
+				},
+			},
+			"stats": {
+				Type: "ContainerStats", Description: "Live CPU and memory usage, null unless running",
+				Resolve: func(r *gqlRequest, parent any, _ map[string]any) (any, error) {
+					return r.Usage(parent.(gqlContainer).ID)
+				},
+			},
+		},
+
+		"ContainerStats": {
+			"cpuPercent":  {Type: "Float!", Resolve: usageField(func(u *ContainerUsage) any { return u.CPUPercent })},
+			"memoryUsage": {Type: "Float!", Resolve: usageField(func(u *ContainerUsage) any { return u.MemoryUsage })},
+			"memoryLimit": {Type: "Float!", Resolve: usageField(func(u *ContainerUsage) any { return u.MemoryLimit })},
+		},
+
+		"Image": {
+			"id":       {Type: "ID!", Resolve: imageField(func(i image.Summary) any { return i.ID })},
+			"tags":     {Type: "[String!]!", Resolve: imageField(func(i image.Summary) any { return gqlList(i.RepoTags) })},
+			"digests":  {Type: "[String!]!", Resolve: imageField(func(i image.Summary) any { return gqlList(i.RepoDigests) })},
+			"size":     {Type: "Float!", Resolve: imageField(func(i image.Summary) any { return i.Size })},
+			"created":  {Type: "String!", Resolve: imageField(func(i image.Summary) any { return unixTime(i.Created) })},
+			"labels":   {Type: "JSON!", Resolve: imageField(func(i image.Summary) any { return i.Labels })},
+			"dangling": {Type: "Boolean!", Resolve: imageField(func(i image.Summary) any { return len(i.RepoTags) == 0 })},
+			"containers": {
+				Type: "[Container!]!", Description: "Containers created from the image",
+				Resolve: func(r *gqlRequest, parent any, _ map[string]any) (any, error) {
+					id := parent.(image.Summary).ID
+					return r.containersByFilter(func(c gqlContainer) bool { return c.ImageID == id })
+				},
+			},
+		},
+
+		"Network": {
+			"id":       {Type: "ID!", Resolve: networkField(func(n network.Summary) any { return n.ID })},
+			"name":     {Type: "String!", Resolve: networkField(func(n network.Summary) any { return n.Name })},
+			"driver":   {Type: "String!", Resolve: networkField(func(n network.Summary) any { return n.Driver })},
+			"scope":    {Type: "String!", Resolve: networkField(func(n network.Summary) any { return n.Scope })},
+			"internal": {Type: "Boolean!", Resolve: networkField(func(n network.Summary) any { return n.Internal })},
+			"created":  {Type: "String!", Resolve: networkField(func(n network.Summary) any { return n.Created.UTC().Format(time.RFC3339) })},
+			"labels":   {Type: "JSON!", Resolve: networkField(func(n network.Summary) any { return n.Labels })},
+			"containers": {
+				Type: "[Container!]!", Description: "Containers connected to the network",
+				Resolve: func(r *gqlRequest, parent any, _ map[string]any) (any, error) {
+					name := parent.(network.Summary).Name
+					return r.containersByFilter(func(c gqlContainer) bool {
+						return c.NetworkSettings != nil && c.NetworkSettings.Networks[name] != nil
+					})
+				},
+			},
+		},
+
+		"Volume": {
+			"name":       {Type: "String!", Resolve: volumeField(func(v *volume.Volume) any { return v.Name })},
+			"driver":     {Type: "String!", Resolve: volumeField(func(v *volume.Volume) any { return v.Driver })},
+			"mountpoint": {Type: "String!", Resolve: volumeField(func(v *volume.Volume) any { return v.Mountpoint })},
+			"scope":      {Type: "String!", Resolve: volumeField(func(v *volume.Volume) any { return v.Scope })},
+			"created":    {Type: "String!", Resolve: volumeField(func(v *volume.Volume) any { return v.CreatedAt })},
+			"labels":     {Type: "JSON!", Resolve: volumeField(func(v *volume.Volume) any { return v.Labels })},
+			"containers": {
+				Type: "[Container!]!", Description: "Containers mounting the volume",
+				Resolve: func(r *gqlRequest, parent any, _ map[string]any) (any, error) {
+					name := parent.(*volume.Volume).Name
+					return r.containersByFilter(func(c gqlContainer) bool {
+						for _, m := range c.Mounts {
+							if m.Name == name {
+								return true
+							}
+						}
+						return false
+					})
+				},
+			},
+		},
+
+		"Stats": {
+			"containers": {
+				Type: "Int!",
+				Resolve: func(r *gqlRequest, _ any, _ map[string]any) (any, error) {
+					containers, err := r.Containers()
+					return len(containers), err
+				},
+			},
+			"running": {
+				Type: "Int!",
+				Resolve: func(r *gqlRequest, _ any, _ map[string]any) (any, error) {
+					running, err := r.containersByFilter(func(c gqlContainer) bool { return c.State == "running" })
+					return len(running), err
+				},
+			},
+			"images": {
+				Type: "Int!",
+				Resolve: func(r *gqlRequest, _ any, _ map[string]any) (any, error) {
+					images, err := r.Images()
+					return len(images), err
+				},
+			},
+			"lowDiskSpace": {
+				Type: "Boolean!", Description: "Free disk space is below MIN_FREE_DISK",
+				Resolve: func(r *gqlRequest, _ any, _ map[string]any) (any, error) {
+					return lowDiskSpace(r.ctx, r.cli) != nil, nil
+				},
+			},
+		},
+
+		"Subscription": {
+			"events": {
+				Type: "Event!", Args: "(type: String)",
+				Description: "Docker events as they happen, optionally of one type (container, image, network, volume)",
+				Subscribe: func(r *gqlRequest, args map[string]any, emit func(any) error) error {
+					options := events.ListOptions{}
+					if typ := argString(args, "type"); typ != "" {
+						options.Filters = filters.NewArgs(filters.Arg("type", typ))
+					}
+					messages, errs := r.cli.Events(r.ctx, options)
+					for {
+						select {
+						case msg := <-messages:
+							if err := emit(msg); err != nil {
+								return err
+							}
+						case err := <-errs:
+							return err
+						}
+					}
+				},
+			},
+		},
+
+		"Event": {
+			"type":       {Type: "String!", Resolve: eventField(func(e events.Message) any { return string(e.Type) })},
+			"action":     {Type: "String!", Resolve: eventField(func(e events.Message) any { return string(e.Action) })},
+			"id":         {Type: "String!", Resolve: eventField(func(e events.Message) any { return e.Actor.ID })},
+			"name":       {Type: "String", Resolve: eventField(func(e events.Message) any { return e.Actor.Attributes["name"] })},
+			"time":       {Type: "String!", Resolve: eventField(func(e events.Message) any { return time.Unix(0, e.TimeNano).UTC().Format(time.RFC3339Nano) })},
+			"attributes": {Type: "JSON!", Resolve: eventField(func(e events.Message) any { return e.Actor.Attributes })},
+			"container": {
+				Type: "Container", Description: "The container of a container event, null once it's removed",
+				Resolve: func(r *gqlRequest, parent any, _ map[string]any) (any, error) {
+					e := parent.(events.Message)
+					if e.Type != events.ContainerEventType {
+						return nil, nil
+					}
+					// Every event needs a fresh list, the cache may not have
+					// seen this event yet
+					r.listings.containers.invalidate()
+					r.mu.Lock()
+					r.containers, r.usage = nil, nil
+					r.mu.Unlock()
+					matching, err := r.containersByFilter(func(c gqlContainer) bool { return c.ID == e.Actor.ID })
+					if err != nil || len(matching) == 0 {
+						return nil, err
+					}
+					return matching[0], nil
+				},
+			},
+		},
+	}
+}
+
+func (r *gqlRequest) findImage(ref string) (any, error) {
+	images, err := r.Images()
+	if err != nil {
+		return nil, err
+	}
+	for _, img := range images {
+		if img.ID == ref || strings.TrimPrefix(img.ID, "sha256:") == ref ||
+			(len(ref) >= 4 && strings.HasPrefix(strings.TrimPrefix(img.ID, "sha256:"), ref)) {
+			return img, nil
+		}
+		for _, tag := range img.RepoTags {
+			if tag == ref || tag == ref+":latest" {
+				return img, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Resolvers for plain fields of each parent type
+
+func containerField(fn func(gqlContainer) any) func(*gqlRequest, any, map[string]any) (any, error) {
+	return func(_ *gqlRequest, parent any, _ map[string]any) (any, error) { return fn(parent.(gqlContainer)), nil }
+}
+
+func usageField(fn func(*ContainerUsage) any) func(*gqlRequest, any, map[string]any) (any, error) {
+	return func(_ *gqlRequest, parent any, _ map[string]any) (any, error) {
+		return fn(parent.(*ContainerUsage)), nil
+	}
+}
+
+func imageField(fn func(image.Summary) any) func(*gqlRequest, any, map[string]any) (any, error) {
+	return func(_ *gqlRequest, parent any, _ map[string]any) (any, error) { return fn(parent.(image.Summary)), nil }
+}
+
+func networkField(fn func(network.Summary) any) func(*gqlRequest, any, map[string]any) (any, error) {
+	return func(_ *gqlRequest, parent any, _ map[string]any) (any, error) {
+		return fn(parent.(network.Summary)), nil
+	}
+}
+
+func volumeField(fn func(*volume.Volume) any) func(*gqlRequest, any, map[string]any) (any, error) {
+	return func(_ *gqlRequest, parent any, _ map[string]any) (any, error) {
+		return fn(parent.(*volume.Volume)), nil
+	}
+}
+
+func eventField(fn func(events.Message) any) func(*gqlRequest, any, map[string]any) (any, error) {
+	return func(_ *gqlRequest, parent any, _ map[string]any) (any, error) {
+		return fn(parent.(events.Message)), nil
+	}
+}
+
+// graphqlHandler serves POST /graphql and GET /graphql?query=. Queries get a
+// JSON response, subscriptions a stream of server-sent "next" events with one
+// result per Docker event.
+func graphqlHandler(store *Store, listings *ListingCache, schema gqlSchema) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req struct {
+			Query         string         `json:"query"`
+			OperationName string         `json:"operationName"`
+			Variables     map[string]any `json:"variables"`
+		}
+		if ctx.Request.Method == http.MethodGet {
+			req.Query = ctx.Query("query")
+			req.OperationName = ctx.Query("operationName")
+			if v := ctx.Query("variables"); v != "" {
+				if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+					ctx.JSON(http.StatusBadRequest, gin.H{"errors": []gqlError{{Message: "Invalid variables: " + err.Error()}}})
+					return
+				}
+			}
+		} else if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"errors": []gqlError{{Message: "Invalid JSON: " + err.Error()}}})
+			return
+		}
+
+		doc, err := parseGraphQL(req.Query)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"errors": []gqlError{{Message: err.Error()}}})
+			return
+		}
+		op, vars, err := doc.operation(req.OperationName, req.Variables)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"errors": []gqlError{{Message: err.Error()}}})
+			return
+		}
+		if op.Kind == "mutation" {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"errors":     []gqlError{{Message: "Mutations are not supported"}},
+				"suggestion": "GraphQL chỉ dùng để đọc dữ liệu, hãy dùng REST API để thay đổi container",
+			})
+			return
+		}
+
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"errors": []gqlError{{Message: "Cannot connect to Docker daemon: " + err.Error()}}})
+			return
+		}
+		defer cli.Close()
+
+		r := &gqlRequest{ctx: ctx.Request.Context(), cli: cli, store: store, listings: listings}
+		exec := &gqlExecution{schema: schema, request: r, fragments: doc.Fragments, vars: vars}
+
+		if op.Kind == "subscription" {
+			subscribeGraphQL(ctx, exec, op)
+			return
+		}
+
+		data := exec.selectObject("Query", nil, op.Selections, nil)
+		response := gin.H{"data": data}
+		if len(exec.errors) > 0 {
+			response["errors"] = exec.errors
+		}
+		ctx.JSON(http.StatusOK, response)
+	}
+}
+
+// subscribeGraphQL runs a subscription with a single root field
+func subscribeGraphQL(ctx *gin.Context, exec *gqlExecution, op *gqlOperation) {
+	fields, err := exec.collect(op.Selections, map[string]bool{})
+	if err == nil && len(fields) != 1 {
+		err = fmt.Errorf("a subscription must select exactly one field")
+	}
+	var field gqlField
+	if err == nil {
+		var ok bool
+		if field, ok = exec.schema["Subscription"][fields[0].Name]; !ok || field.Subscribe == nil {
+			err = fmt.Errorf("Cannot query field %q on type \"Subscription\"", fields[0].Name)
+		}
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": []gqlError{{Message: err.Error()}}})
+		return
+	}
+
+	sel := fields[0]
+	args := map[string]any{}
+	for k, v := range sel.Args {
+		args[k] = exec.argValue(v)
+	}
+	startSSE(ctx)
+	err = field.Subscribe(exec.request, args, func(value any) error {
+		exec.errors = nil
+		data := &gqlObject{values: map[string]any{}}
+		data.set(sel.Alias, exec.complete(field.Type, value, sel, []any{sel.Alias}))
+		payload := gin.H{"data": data}
+		if len(exec.errors) > 0 {
+			payload["errors"] = exec.errors
+		}
+		ctx.SSEvent("next", payload)
+		ctx.Writer.Flush()
+		return ctx.Request.Context().Err()
+	})
+	if err != nil && ctx.Request.Context().Err() == nil {
+		ctx.SSEvent("error", gin.H{"errors": []gqlError{{Message: err.Error()}}})
+	}
+	ctx.SSEvent("complete", "")
+	ctx.Writer.Flush()
+}
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/gin-gonic/gin"
+)
+
+// What a heal rule reacts to
+const (
+	// The container exited with a non-zero code without being stopped
+	healTriggerDied = "died"
+	// Its health check reported unhealthy
+	healTriggerUnhealthy = "unhealthy"
+	// The kernel killed a process of the container for running out of memory
+	healTriggerOOM = "oom"
+	// The registry has a newer image for the container's tag, checked every
+	// IMAGE_UPDATE_INTERVAL
+	healTriggerImageUpdate = "image_update"
+)
+
+// What a heal rule does
+const (
+	healActionRestart  = "restart"
+	healActionRedeploy = "redeploy"
+	// Posts a message to HEAL_NOTIFY_URL, Slack-compatible
+	healActionNotify = "notify"
+	// Posts the event as JSON to the rule's webhook_url
+	healActionWebhook = "webhook"
+)
+
+// Job type heal rule runs are recorded under, see GET /jobs?type=autoheal
+const healJobType = "autoheal"
+
+const defaultHealCooldown = 5 * time.Minute
+
+// A die event within this long of a kill was a stop, not a crash
+const healKillGrace = time.Minute
+
+// HealRule runs an action when a trigger fires for a matching container.
+// Containers is a glob on the container name (empty for all) and Label a
+// "key" or "key=value" the container must have. A rule fires at most once
+// per Cooldown for the same container.
+type HealRule struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name" binding:"required,max=100"`
+	Trigger    string    `json:"trigger" binding:"required,oneof=died unhealthy oom image_update"`
+	Containers string    `json:"containers" binding:"max=255"`
+	Label      string    `json:"label" binding:"max=255"`
+	Action     string    `json:"action" binding:"required,oneof=restart redeploy notify webhook"`
+	WebhookURL string    `json:"webhook_url,omitempty" binding:"omitempty,url"`
+	Cooldown   string    `json:"cooldown" binding:"omitempty,ttl"`
+	Disabled   bool      `json:"disabled"`
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func validateHealRule(r *HealRule) error {
+	if _, err := path.Match(r.Containers, ""); err != nil {
+		return fmt.Errorf("invalid containers pattern %q: %v", r.Containers, err)
+	}
+	if r.Action == healActionWebhook && r.WebhookURL == "" {
+		return fmt.Errorf("webhook_url is required for the webhook action")
+	}
+	if r.Action != healActionWebhook && r.WebhookURL != "" {
+		return fmt.Errorf("webhook_url is only used by the webhook action")
+	}
+	if r.Trigger == healTriggerImageUpdate && r.Action == healActionRestart {
+		return fmt.Errorf("restarting doesn't pick up a new image, use the redeploy action")
+	}
+	if r.Cooldown == "" {
+		r.Cooldown = strings.TrimSuffix(defaultHealCooldown.String(), "0s")
+	}
+	return nil
+}
+
+func (r *HealRule) matches(name string, labels map[string]string) bool {
+	if r.Disabled {
+		return false
+	}
+	if r.Containers != "" {
+		if ok, _ := path.Match(r.Containers, name); !ok {
+			return false
+		}
+	}
+	if r.Label != "" {
+		key, value, hasValue := strings.Cut(r.Label, "=")
+		v, ok := labels[key]
+		if !ok || (hasValue && v != value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *HealRule) cooldown() time.Duration {
+	if d, err := parseTTL(r.Cooldown); err == nil {
+		return d
+	}
+	return defaultHealCooldown
+}
+
+func (s *Store) CreateHealRule(r *HealRule) error {
+	r.ID = newID()
+	r.CreatedAt = time.Now()
+	_, err := s.exec(`INSERT INTO heal_rules (id, name, trigger_type, containers, label, action, webhook_url, cooldown, disabled, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ID, r.Name, r.Trigger, r.Containers, r.Label, r.Action, r.WebhookURL, r.Cooldown, r.Disabled, r.CreatedBy, r.CreatedAt.Unix())
+	return err
+}
+
+func (s *Store) SetHealRuleDisabled(id string, disabled bool) (bool, error) {
+	res, err := s.exec(`UPDATE heal_rules SET disabled = ? WHERE id = ?`, disabled, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) DeleteHealRule(id string) (bool, error) {
+	res, err := s.exec(`DELETE FROM heal_rules WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) ListHealRules() ([]HealRule, error) {
+	rows, err := s.query(`SELECT id, name, trigger_type, containers, label, action, webhook_url, cooldown, disabled, created_by, created_at FROM heal_rules ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []HealRule{}
+	for rows.Next() {
+		var r HealRule
+		var createdAt int64
+		if err := rows.Scan(&r.ID, &r.Name, &r.Trigger, &r.Containers, &r.Label, &r.Action, &r.WebhookURL, &r.Cooldown, &r.Disabled, &r.CreatedBy, &createdAt); err != nil {
+			return nil, err
+		}
+		r.CreatedAt = time.Unix(createdAt, 0)
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// HealEvent is a trigger that fired for a container
+type HealEvent struct {
+	Trigger     string    `json:"trigger"`
+	ContainerID string    `json:"container_id"`
+	Container   string    `json:"container"`
+	Image       string    `json:"image"`
+	ExitCode    *int      `json:"exit_code,omitempty"`
+	Detail      string    `json:"detail,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// HealEngine evaluates heal rules against the Docker event stream and runs
+// their actions, recording each run as an autoheal job
+type HealEngine struct {
+	store *Store
+	box   *SecretBox
+	// Actions are skipped while paused returns true
+	paused func() bool
+
+	mu sync.Mutex
+	// Last run per rule and container, for the cooldown
+	fired map[string]time.Time
+	// Last kill event per container ID
+	killed map[string]time.Time
+	// Registry digest per container an image_update already fired for
+	updates map[string]string
+}
+
+func newHealEngine(store *Store, box *SecretBox, paused func() bool) *HealEngine {
+	return &HealEngine{
+		store:   store,
+		box:     box,
+		paused:  paused,
+		fired:   map[string]time.Time{},
+		killed:  map[string]time.Time{},
+		updates: map[string]string{},
+	}
+}
+
+// Watch follows container events for the life of the server, reconnecting
+// to the daemon when the event stream breaks
+func (e *HealEngine) Watch() {
+	go func() {
+		backoff := time.Second
+		for {
+			connected := time.Now()
+			err := e.watchEvents(context.Background())
+			if time.Since(connected) > time.Minute {
+				backoff = time.Second
+			}
+			fmt.Printf("⚠️  Docker event stream for heal rules ended, retrying in %s: %v\n", backoff, err)
+			time.Sleep(backoff)
+			backoff = min(backoff*2, time.Minute)
+		}
+	}()
+}
+
+func (e *HealEngine) watchEvents(ctx context.Context) error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	messages, errs := cli.Events(ctx, events.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", string(events.ContainerEventType)),
+			filters.Arg("event", string(events.ActionKill)),
+			filters.Arg("event", string(events.ActionDie)),
+			filters.Arg("event", string(events.ActionOOM)),
+			filters.Arg("event", string(events.ActionHealthStatus)),
+		),
+	})
+	for {
+		select {
+		case msg := <-messages:
+			e.handle(msg)
+		case err := <-errs:
+			return err
+		}
+	}
+}
+
+// handle turns a container event into a heal event and fires the rules for
+// it. Attributes carry the container's name, image and labels.
+func (e *HealEngine) handle(msg events.Message) {
+	attrs := msg.Actor.Attributes
+	event := HealEvent{
+		ContainerID: msg.Actor.ID,
+		Container:   attrs["name"],
+		Image:       attrs["image"],
+		Time:        time.Unix(0, msg.TimeNano),
+	}
+	switch msg.Action {
+	case events.ActionKill:
+		e.mu.Lock()
+		e.killed[msg.Actor.ID] = event.Time
+		e.mu.Unlock()
+		return
+	case events.ActionDie:
+		code, err := strconv.Atoi(attrs["exitCode"])
+		if err != nil || code == 0 {
+			return
+		}
+		e.mu.Lock()
+		killedAt, killed := e.killed[msg.Actor.ID]
+		delete(e.killed, msg.Actor.ID)
+		e.mu.Unlock()
+		if killed && event.Time.Sub(killedAt) < healKillGrace {
+			return
+		}
+		event.Trigger, event.ExitCode = healTriggerDied, &code
+		event.Detail = fmt.Sprintf("exited with code %d", code)
+	case events.ActionOOM:
+		event.Trigger, event.Detail = healTriggerOOM, "out of memory"
+	case events.ActionHealthStatusUnhealthy:
+		event.Trigger, event.Detail = healTriggerUnhealthy, "health check failing"
+	default:
+		return
+	}
+	e.fire(event, attrs)
+}
+
+// fire runs the action of every rule matching the event in the background
+func (e *HealEngine) fire(event HealEvent, labels map[string]string) {
+	rules, err := e.store.ListHealRules()
+	if err != nil {
+		fmt.Printf("⚠️  Error loading heal rules: %v\n", err)
+		return
+	}
+	for _, rule := range rules {
+		if rule.Trigger != event.Trigger || !rule.matches(event.Container, labels) {
+			continue
+		}
+		if e.paused != nil && e.paused() {
+			fmt.Printf("⏸️  Heal rule %q not run for %s during maintenance\n", rule.Name, event.Container)
+			continue
+		}
+		key := rule.ID + "/" + event.Container
+		e.mu.Lock()
+		last, ok := e.fired[key]
+		if ok && time.Since(last) < rule.cooldown() {
+			e.mu.Unlock()
+			continue
+		}
+		e.fired[key] = time.Now()
+		e.mu.Unlock()
+
+		fmt.Printf("🩺 Heal rule %q: %s %s, running %s\n", rule.Name, event.Container, event.Detail, rule.Action)
+		go func(rule HealRule) {
+			runJob(e.store, healJobType, func() (any, error) {
+				result := gin.H{"rule": rule.Name, "rule_id": rule.ID, "action": rule.Action, "event": event}
+				cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+				if err != nil {
+					return result, err
+				}
+				defer cli.Close()
+				outcome, err := e.run(withActor(context.Background(), "heal"), cli, rule, event)
+				if outcome != nil {
+					result["outcome"] = outcome
+				}
+				return result, err
+			})
+		}(rule)
+	}
+}
+
+// run executes the rule's action for the event
+func (e *HealEngine) run(ctx context.Context, cli *client.Client, rule HealRule, event HealEvent) (any, error) {
+	switch rule.Action {
+	case healActionRestart:
+		timeout := 30
+		if err := restartContainer(ctx, cli, event.ContainerID, container.StopOptions{Timeout: &timeout}); err != nil {
+			return nil, err
+		}
+		return gin.H{"restarted": event.Container}, nil
+	case healActionRedeploy:
+		return e.redeploy(ctx, cli, event.ContainerID)
+	case healActionNotify:
+		target := os.Getenv("HEAL_NOTIFY_URL")
+		text := fmt.Sprintf("🩺 %s: container %s (%s) %s", rule.Name, event.Container, event.Image, event.Detail)
+		if target == "" {
+			return gin.H{"message": text, "sent": false}, nil
+		}
+		return gin.H{"message": text, "sent": true}, postHealWebhook(ctx, target, gin.H{"text": text})
+	case healActionWebhook:
+		return gin.H{"url": rule.WebhookURL}, postHealWebhook(ctx, rule.WebhookURL, gin.H{"rule": rule.Name, "event": event})
+	}
+	return nil, fmt.Errorf("unknown action: %s", rule.Action)
+}
+
+// redeploy pulls the container's image and recreates it, like POST
+// /containers/:id/redeploy
+func (e *HealEngine) redeploy(ctx context.Context, cli *client.Client, containerID string) (any, error) {
+	info, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	spec := specFromInspect(info)
+	if err := resolveSecretEnv(e.store, e.box, spec.Config); err != nil {
+		return nil, fmt.Errorf("resolving secrets: %w", err)
+	}
+	if err := checkDiskSpace(ctx, cli); err != nil {
+		return nil, err
+	}
+	if err := pullImage(ctx, cli, spec.Config.Image); err != nil {
+		return nil, fmt.Errorf("pulling image: %w", err)
+	}
+	newID, err := recreateContainer(ctx, cli, info.ID, spec, true)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := recordDeployment(ctx, cli, e.store, newID, "redeploy", healJobType); err != nil {
+		fmt.Printf("⚠️  Error recording deployment history: %v\n", err)
+	}
+	return gin.H{"redeployed": strings.TrimPrefix(info.Name, "/"), "id": newID, "image": spec.Config.Image}, nil
+}
+
+// webhookHTTPClient calls heal rule webhooks and HTTP lifecycle hooks
+var webhookHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+func postHealWebhook(ctx context.Context, target string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// imageUpdateTask checks the registry for a newer image of every running
+// container an image_update rule covers. Each new digest fires once.
+func (e *HealEngine) imageUpdateTask() func(ctx context.Context, cli *client.Client) (any, error) {
+	return func(ctx context.Context, cli *client.Client) (any, error) {
+		if offlineMode {
+			return nil, nil
+		}
+		rules, err := e.store.ListHealRules()
+		if err != nil {
+			return nil, err
+		}
+		watched := []HealRule{}
+		for _, r := range rules {
+			if r.Trigger == healTriggerImageUpdate && !r.Disabled {
+				watched = append(watched, r)
+			}
+		}
+		if len(watched) == 0 {
+			return nil, nil
+		}
+		containers, err := cli.ContainerList(ctx, container.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		updates := []HealEvent{}
+		for _, c := range containers {
+			name := summaryName(c)
+			covered := false
+			for _, r := range watched {
+				covered = covered || r.matches(name, c.Labels)
+			}
+			if !covered {
+				continue
+			}
+			remote, err := remoteImageUpdate(ctx, cli, c.Image, c.ImageID)
+			if err != nil {
+				fmt.Printf("⚠️  Checking image update for %s: %v\n", name, err)
+				continue
+			}
+			e.mu.Lock()
+			seen := e.updates[c.ID] == remote
+			e.updates[c.ID] = remote
+			e.mu.Unlock()
+			if remote == "" || seen {
+				continue
+			}
+			event := HealEvent{
+				Trigger:     healTriggerImageUpdate,
+				ContainerID: c.ID,
+				Container:   name,
+				Image:       c.Image,
+				Detail:      "a newer image is available: " + remote,
+				Time:        time.Now(),
+			}
+			updates = append(updates, event)
+			e.fire(event, c.Labels)
+		}
+		if len(updates) == 0 {
+			return nil, nil
+		}
+		return gin.H{"updates": updates}, nil
+	}
+}
+
+// remoteImageUpdate returns the registry digest of ref when the local image
+// doesn't have it, or "" when the image is current. References pinned to a
+// digest, and images not from a registry, never have updates.
+func remoteImageUpdate(ctx context.Context, cli *client.Client, ref, imageID string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", nil
+	}
+	if _, pinned := named.(reference.Canonical); pinned {
+		return "", nil
+	}
+	img, err := cli.ImageInspect(ctx, imageID)
+	if err != nil {
+		return "", err
+	}
+	if len(img.RepoDigests) == 0 {
+		return "", nil
+	}
+	dist, err := cli.DistributionInspect(ctx, reference.TagNameOnly(named).String(), "")
+	if err != nil {
+		return "", err
+	}
+	remote := named.Name() + "@" + dist.Descriptor.Digest.String()
+	for _, d := range img.RepoDigests {
+		if local, err := reference.ParseNormalizedNamed(d); err == nil && local.String() == remote {
+			return "", nil
+		}
+	}
+	return remote, nil
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// Container operations hooks run around
+const (
+	hookCreate = "create"
+	hookStart  = "start"
+	hookStop   = "stop"
+	hookRemove = "remove"
+)
+
+const (
+	hookPre  = "pre"
+	hookPost = "post"
+)
+
+const defaultHookTimeout = 5 * time.Second
+
+// Hook is an external command or HTTP endpoint called with the operation as
+// JSON. A pre hook can veto the operation: a command by exiting non-zero, an
+// endpoint by answering 4xx or {"allow": false}. A pre hook that fails to
+// answer vetoes too, unless FailOpen is set. Post hooks only observe.
+type Hook struct {
+	Name  string `yaml:"name" json:"name"`
+	Phase string `yaml:"phase" json:"phase"`
+	// Empty for all operations
+	Operations []string `yaml:"operations" json:"operations"`
+	// Glob on the container name, empty for all
+	Containers string   `yaml:"containers" json:"containers,omitempty"`
+	Command    []string `yaml:"command" json:"command,omitempty"`
+	URL        string   `yaml:"url" json:"url,omitempty"`
+	Timeout    string   `yaml:"timeout" json:"timeout,omitempty"`
+	FailOpen   bool     `yaml:"fail_open" json:"fail_open"`
+
+	timeout time.Duration
+}
+
+// loadHooks reads HOOKS_FILE, a YAML (or JSON) file with a list of hooks
+// under "hooks", run in the order listed:
+//
+//	hooks:
+//	  - name: require-owner
+//	    phase: pre
+//	    operations: [create]
+//	    command: ["/etc/golang-docker/hooks/require-owner.sh"]
+func loadHooks() ([]Hook, error) {
+	file := os.Getenv("HOOKS_FILE")
+	if file == "" {
+		return []Hook{}, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Hooks []Hook `yaml:"hooks"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	names := map[string]bool{}
+	for i := range config.Hooks {
+		h := &config.Hooks[i]
+		if h.Name == "" {
+			return nil, fmt.Errorf("hook %d has no name", i+1)
+		}
+		if names[h.Name] {
+			return nil, fmt.Errorf("more than one hook named %s", h.Name)
+		}
+		names[h.Name] = true
+		if h.Phase != hookPre && h.Phase != hookPost {
+			return nil, fmt.Errorf("hook %s: phase must be pre or post", h.Name)
+		}
+		for _, op := range h.Operations {
+			if op != hookCreate && op != hookStart && op != hookStop && op != hookRemove {
+				return nil, fmt.Errorf("hook %s: unknown operation %q (use create, start, stop or remove)", h.Name, op)
+			}
+		}
+		if (len(h.Command) == 0) == (h.URL == "") {
+			return nil, fmt.Errorf("hook %s: set either command or url", h.Name)
+		}
+		if h.URL != "" {
+			if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("hook %s: invalid url %q", h.Name, h.URL)
+			}
+		}
+		if _, err := path.Match(h.Containers, ""); err != nil {
+			return nil, fmt.Errorf("hook %s: invalid containers pattern %q: %v", h.Name, h.Containers, err)
+		}
+		h.timeout = defaultHookTimeout
+		if h.Timeout != "" {
+			h.timeout, err = time.ParseDuration(h.Timeout)
+			if err != nil || h.timeout <= 0 {
+				return nil, fmt.Errorf("hook %s: invalid timeout %q", h.Name, h.Timeout)
+			}
+		}
+		if h.Operations == nil {
+			h.Operations = []string{}
+		}
+	}
+	return config.Hooks, nil
+}
+
+// HookContainer is a container an operation applies to. The ID is only
+// known after a create.
+type HookContainer struct {
+	ID     string            `json:"id,omitempty"`
+	Name   string            `json:"name"`
+	Image  string            `json:"image"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// HookPayload is the JSON a hook receives, on stdin for commands
+type HookPayload struct {
+	Hook       string          `json:"hook"`
+	Phase      string          `json:"phase"`
+	Operation  string          `json:"operation"`
+	Actor      string          `json:"actor"`
+	Containers []HookContainer `json:"containers"`
+	// Configuration of creates, env values left out since they can hold secrets
+	Config     *container.Config     `json:"config,omitempty"`
+	HostConfig *container.HostConfig `json:"host_config,omitempty"`
+	// Error of the operation for post hooks, empty when it succeeded
+	Error string    `json:"error,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// errHookVeto is a pre hook refusing the operation, as opposed to failing
+var errHookVeto = errors.New("vetoed")
+
+func (h *Hook) applies(operation string, containers []HookContainer) bool {
+	if len(h.Operations) > 0 && !containsString(h.Operations, operation) {
+		return false
+	}
+	if h.Containers == "" {
+		return true
+	}
+	for _, c := range containers {
+		if ok, _ := path.Match(h.Containers, c.Name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// call runs the hook. A veto is returned as errHookVeto wrapped with the
+// hook's reason.
+func (h *Hook) call(payload HookPayload) error {
+	payload.Hook = h.Name
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	if len(h.Command) > 0 {
+		return h.runCommand(ctx, body, payload)
+	}
+	return h.post(ctx, body)
+}
+
+func (h *Hook) runCommand(ctx context.Context, body []byte, payload HookPayload) error {
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(), "HOOK_NAME="+h.Name, "HOOK_PHASE="+payload.Phase, "HOOK_OPERATION="+payload.Operation)
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		return fmt.Errorf("%w: %s", errHookVeto, hookReason(output, exitErr.Error()))
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("timed out after %s", h.timeout)
+	}
+	return err
+}
+
+func (h *Hook) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Hook-Name", h.Name)
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var answer struct {
+		Allow  *bool  `json:"allow"`
+		Reason string `json:"reason"`
+	}
+	json.Unmarshal(data, &answer)
+	switch {
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("answered %s", resp.Status)
+	case resp.StatusCode >= 400, answer.Allow != nil && !*answer.Allow:
+		reason := answer.Reason
+		if reason == "" {
+			reason = hookReason(data, resp.Status)
+		}
+		return fmt.Errorf("%w: %s", errHookVeto, reason)
+	}
+	return nil
+}
+
+// hookReason is the first line of a hook's output, or def without output
+func hookReason(output []byte, def string) string {
+	reason, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	if reason == "" {
+		return def
+	}
+	if len(reason) > 500 {
+		reason = reason[:500]
+	}
+	return reason
+}
+
+// Hooks runs the configured hooks around container operations
+type Hooks struct {
+	hooks []Hook
+}
+
+func newHooks(hooks []Hook) *Hooks {
+	return &Hooks{hooks: hooks}
+}
+
+func (hs *Hooks) List() []Hook {
+	return hs.hooks
+}
+
+// containerHooks are the hooks from HOOKS_FILE, set up in main. The
+// container helpers below run them wherever the server creates, starts,
+// stops or removes a container, whatever the endpoint or background task.
+var containerHooks = newHooks(nil)
+
+// HookError is a pre hook vetoing an operation, or failing to answer
+type HookError struct {
+	Hook string
+	Err  error
+}
+
+func (e *HookError) Error() string {
+	if errors.Is(e.Err, errHookVeto) {
+		return "vetoed by hook " + e.Hook + ": " + strings.TrimPrefix(e.Err.Error(), errHookVeto.Error()+": ")
+	}
+	return "hook " + e.Hook + " failed: " + e.Err.Error()
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// hookErrorStatus is the status for an operation a pre hook refused: 403 for
+// a veto, 503 for a hook that failed to answer, and def for other errors
+func hookErrorStatus(err error, def int) int {
+	var hookErr *HookError
+	switch {
+	case !errors.As(err, &hookErr):
+		return def
+	case errors.Is(err, errHookVeto):
+		return http.StatusForbidden
+	}
+	return http.StatusServiceUnavailable
+}
+
+// respondHookError answers a request whose operation a pre hook refused,
+// and reports whether err was such a refusal
+func respondHookError(ctx *gin.Context, err error) bool {
+	var hookErr *HookError
+	if !errors.As(err, &hookErr) {
+		return false
+	}
+	if errors.Is(err, errHookVeto) {
+		ctx.JSON(http.StatusForbidden, gin.H{
+			"error":      "Vetoed by hook " + hookErr.Hook + ": " + strings.TrimPrefix(hookErr.Err.Error(), errHookVeto.Error()+": "),
+			"hook":       hookErr.Hook,
+			"suggestion": "Thao tác bị chặn bởi chính sách của hệ thống, liên hệ quản trị viên",
+		})
+		return true
+	}
+	ctx.JSON(http.StatusServiceUnavailable, gin.H{
+		"error":      "Hook " + hookErr.Hook + " failed: " + hookErr.Err.Error(),
+		"hook":       hookErr.Hook,
+		"suggestion": "Hook kiểm tra chính sách không phản hồi, thử lại sau hoặc liên hệ quản trị viên",
+	})
+	return true
+}
+
+type actorKey struct{}
+
+// withActor records who an operation is done for, for the hooks around it
+func withActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// hookActor is the actor recorded with withActor, "system" for background
+// tasks that didn't record one
+func hookActor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return "system"
+}
+
+type noHooksKey struct{}
+
+// withoutHooks marks operations undoing a failed change, which hooks must not
+// be able to block
+func withoutHooks(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noHooksKey{}, true)
+}
+
+// enabled tells whether any hook runs around operation, so that containers
+// are only inspected for the hooks when needed
+func (hs *Hooks) enabled(ctx context.Context, operation string) bool {
+	if ctx.Value(noHooksKey{}) != nil {
+		return false
+	}
+	for i := range hs.hooks {
+		if len(hs.hooks[i].Operations) == 0 || containsString(hs.hooks[i].Operations, operation) {
+			return true
+		}
+	}
+	return false
+}
+
+// around runs the pre hooks of an operation in order, stopping at the first
+// veto, then the operation, then the post hooks in the background
+func (hs *Hooks) around(payload HookPayload, operation func() error) error {
+	for i := range hs.hooks {
+		h := &hs.hooks[i]
+		if h.Phase != hookPre || !h.applies(payload.Operation, payload.Containers) {
+			continue
+		}
+		payload.Phase = hookPre
+		err := h.call(payload)
+		switch {
+		case errors.Is(err, errHookVeto):
+			fmt.Printf("🪝 Hook %s vetoed %s by %s: %v\n", h.Name, payload.Operation, payload.Actor, err)
+			return &HookError{Hook: h.Name, Err: err}
+		case err != nil && !h.FailOpen:
+			fmt.Printf("⚠️  Hook %s failed, refusing %s: %v\n", h.Name, payload.Operation, err)
+			return &HookError{Hook: h.Name, Err: err}
+		case err != nil:
+			fmt.Printf("⚠️  Hook %s failed, allowing %s (fail_open): %v\n", h.Name, payload.Operation, err)
+		}
+	}
+
+	err := operation()
+
+	payload.Phase = hookPost
+	if err != nil {
+		payload.Error = err.Error()
+	}
+	for i := range hs.hooks {
+		h := &hs.hooks[i]
+		if h.Phase != hookPost || !h.applies(payload.Operation, payload.Containers) {
+			continue
+		}
+		go func(h *Hook, payload HookPayload) {
+			if err := h.call(payload); err != nil {
+				fmt.Printf("⚠️  Post hook %s failed for %s: %v\n", h.Name, payload.Operation, err)
+			}
+		}(h, payload)
+	}
+	return err
+}
+
+// hookTarget describes an existing container for the hooks, by its
+// reference when it can't be inspected
+func hookTarget(ctx context.Context, cli *client.Client, ref string) HookContainer {
+	info, err := cli.ContainerInspect(ctx, ref)
+	if err != nil {
+		return HookContainer{Name: strings.TrimPrefix(ref, "/")}
+	}
+	target := HookContainer{ID: info.ID, Name: strings.TrimPrefix(info.Name, "/")}
+	if info.Config != nil {
+		target.Image, target.Labels = info.Config.Image, info.Config.Labels
+	}
+	return target
+}
+
+// onContainer runs operation on an existing container within its hooks
+func onContainer(ctx context.Context, cli *client.Client, operation, ref string, do func() error) error {
+	if !containerHooks.enabled(ctx, operation) {
+		return do()
+	}
+	return containerHooks.around(HookPayload{
+		Operation:  operation,
+		Actor:      hookActor(ctx),
+		Containers: []HookContainer{hookTarget(ctx, cli, ref)},
+		Time:       time.Now().UTC(),
+	}, do)
+}
+
+// createContainer is cli.ContainerCreate within the create hooks, which see
+// the configuration the container is created with
+func createContainer(ctx context.Context, cli *client.Client, config *container.Config, hostConfig *container.HostConfig, netConfig *network.NetworkingConfig, name string) (container.CreateResponse, error) {
+	var resp container.CreateResponse
+	do := func() (err error) {
+		resp, err = cli.ContainerCreate(ctx, config, hostConfig, netConfig, nil, name)
+		return err
+	}
+	if !containerHooks.enabled(ctx, hookCreate) {
+		return resp, do()
+	}
+
+	shown := *config
+	shown.Env = make([]string, 0, len(config.Env))
+	for _, env := range config.Env {
+		key, _, _ := strings.Cut(env, "=")
+		shown.Env = append(shown.Env, key)
+	}
+	targets := []HookContainer{{Name: name, Image: config.Image, Labels: config.Labels}}
+	err := containerHooks.around(HookPayload{
+		Operation:  hookCreate,
+		Actor:      hookActor(ctx),
+		Containers: targets,
+		Config:     &shown,
+		HostConfig: hostConfig,
+		Time:       time.Now().UTC(),
+	}, func() error {
+		if err := do(); err != nil {
+			return err
+		}
+		// Post hooks get the new container's ID
+		targets[0].ID = resp.ID
+		return nil
+	})
+	return resp, err
+}
+
+// startContainer is cli.ContainerStart within the start hooks
+func startContainer(ctx context.Context, cli *client.Client, containerID string, options container.StartOptions) error {
+	return onContainer(ctx, cli, hookStart, containerID, func() error {
+		return cli.ContainerStart(ctx, containerID, options)
+	})
+}
+
+// stopContainer is cli.ContainerStop within the stop hooks
+func stopContainer(ctx context.Context, cli *client.Client, containerID string, options container.StopOptions) error {
+	return onContainer(ctx, cli, hookStop, containerID, func() error {
+		return cli.ContainerStop(ctx, containerID, options)
+	})
+}
+
+// removeContainer is cli.ContainerRemove within the remove hooks
+func removeContainer(ctx context.Context, cli *client.Client, containerID string, options container.RemoveOptions) error {
+	return onContainer(ctx, cli, hookRemove, containerID, func() error {
+		return cli.ContainerRemove(ctx, containerID, options)
+	})
+}
+
+// restartContainer is cli.ContainerRestart within the stop hooks, then the
+// start hooks
+func restartContainer(ctx context.Context, cli *client.Client, containerID string, options container.StopOptions) error {
+	return onContainer(ctx, cli, hookStop, containerID, func() error {
+		return onContainer(ctx, cli, hookStart, containerID, func() error {
+			return cli.ContainerRestart(ctx, containerID, options)
+		})
+	})
+}
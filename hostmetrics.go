@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Host resource readings behind a platform-neutral API. diskUsage,
+// memoryUsage, cpuTimes and loadAverage are implemented per OS in the
+// hostmetrics_*.go files.
+
+var errMetricsUnsupported = errors.New("host metrics are not supported on this platform")
+
+// DiskUsage is the size and free space of the filesystem holding a path.
+// Free is what an unprivileged process can still use.
+type DiskUsage struct {
+	Total uint64
+	Free  uint64
+}
+
+func (d DiskUsage) Used() uint64 {
+	if d.Free > d.Total {
+		return 0
+	}
+	return d.Total - d.Free
+}
+
+func (d DiskUsage) Percent() float64 {
+	if d.Total == 0 {
+		return 0
+	}
+	return float64(d.Used()) / float64(d.Total) * 100
+}
+
+// MemoryUsage is the physical memory of the host. Available includes caches
+// the kernel can reclaim where the platform reports it.
+type MemoryUsage struct {
+	Total     uint64
+	Available uint64
+}
+
+func (m MemoryUsage) Used() uint64 {
+	if m.Available > m.Total {
+		return 0
+	}
+	return m.Total - m.Available
+}
+
+func (m MemoryUsage) Percent() float64 {
+	if m.Total == 0 {
+		return 0
+	}
+	return float64(m.Used()) / float64(m.Total) * 100
+}
+
+// LoadAverage is the run queue length over 1, 5 and 15 minutes
+type LoadAverage struct {
+	Load1  float64
+	Load5  float64
+	Load15 float64
+}
+
+// cpuTime is the cumulative busy and total time of a CPU, in whatever unit
+// the platform counts in. cpuTimes returns all CPUs combined first, then
+// one entry per core where the platform reports them.
+type cpuTime struct {
+	busy  uint64
+	total uint64
+}
+
+// CPUUsage is host CPU utilization in percent between two samples
+type CPUUsage struct {
+	Percent float64
+	PerCore []float64
+}
+
+// Shortest window to compute CPU usage over
+const cpuSampleWindow = 250 * time.Millisecond
+
+// The previous sample, so back-to-back requests measure the time between
+// them instead of sleeping. Samples older than a minute are too coarse.
+var cpuSampler struct {
+	mu   sync.Mutex
+	last []cpuTime
+	at   time.Time
+}
+
+func cpuUsage() (CPUUsage, error) {
+	cpuSampler.mu.Lock()
+	defer cpuSampler.mu.Unlock()
+
+	since := time.Since(cpuSampler.at)
+	if cpuSampler.last == nil || since > time.Minute {
+		first, err := cpuTimes()
+		if err != nil {
+			return CPUUsage{}, err
+		}
+		cpuSampler.last, cpuSampler.at = first, time.Now()
+		since = 0
+	}
+	if since < cpuSampleWindow {
+		time.Sleep(cpuSampleWindow - since)
+	}
+	current, err := cpuTimes()
+	if err != nil {
+		return CPUUsage{}, err
+	}
+	previous := cpuSampler.last
+	cpuSampler.last, cpuSampler.at = current, time.Now()
+
+	percent := func(i int) float64 {
+		if i >= len(previous) {
+			return 0
+		}
+		busy := float64(current[i].busy) - float64(previous[i].busy)
+		total := float64(current[i].total) - float64(previous[i].total)
+		if total <= 0 || busy < 0 {
+			return 0
+		}
+		return busy / total * 100
+	}
+	usage := CPUUsage{Percent: percent(0), PerCore: []float64{}}
+	for i := 1; i < len(current); i++ {
+		usage.PerCore = append(usage.PerCore, percent(i))
+	}
+	return usage, nil
+}
@@ -0,0 +1,31 @@
+//go:build darwin || freebsd
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// loadAverage decodes struct loadavg from sysctl: three fixed point values
+// and the scale, a long aligned to 8 bytes
+func loadAverage() (LoadAverage, error) {
+	raw, err := unix.SysctlRaw("vm.loadavg")
+	if err != nil {
+		return LoadAverage{}, err
+	}
+	if len(raw) < 24 {
+		return LoadAverage{}, fmt.Errorf("unexpected vm.loadavg size %d", len(raw))
+	}
+	scale := float64(binary.LittleEndian.Uint64(raw[16:24]))
+	if scale == 0 {
+		return LoadAverage{}, fmt.Errorf("vm.loadavg has no scale")
+	}
+	return LoadAverage{
+		Load1:  float64(binary.LittleEndian.Uint32(raw[0:4])) / scale,
+		Load5:  float64(binary.LittleEndian.Uint32(raw[4:8])) / scale,
+		Load15: float64(binary.LittleEndian.Uint32(raw[8:12])) / scale,
+	}, nil
+}
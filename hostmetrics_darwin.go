@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// memoryUsage reads sysctl. Only free pages count as available, macOS has no
+// cheap equivalent of Linux's MemAvailable.
+func memoryUsage() (MemoryUsage, error) {
+	total, err := unix.SysctlUint64("hw.memsize")
+	if err != nil {
+		return MemoryUsage{}, err
+	}
+	free, err := unix.SysctlUint32("vm.page_free_count")
+	if err != nil {
+		return MemoryUsage{}, err
+	}
+	return MemoryUsage{Total: total, Available: uint64(free) * uint64(os.Getpagesize())}, nil
+}
+
+// cpuTimes needs host_processor_info, which isn't reachable without cgo
+func cpuTimes() ([]cpuTime, error) {
+	return nil, errMetricsUnsupported
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func memoryUsage() (MemoryUsage, error) {
+	total, err := unix.SysctlUint64("hw.physmem")
+	if err != nil {
+		return MemoryUsage{}, err
+	}
+	free, err := unix.SysctlUint32("vm.stats.vm.v_free_count")
+	if err != nil {
+		return MemoryUsage{}, err
+	}
+	return MemoryUsage{Total: total, Available: uint64(free) * uint64(os.Getpagesize())}, nil
+}
+
+// cpuTimes reads kern.cp_time and kern.cp_times: user, nice, sys, intr and
+// idle ticks as longs, for all CPUs and then per CPU
+func cpuTimes() ([]cpuTime, error) {
+	total, err := unix.SysctlRaw("kern.cp_time")
+	if err != nil {
+		return nil, err
+	}
+	perCPU, err := unix.SysctlRaw("kern.cp_times")
+	if err != nil {
+		return nil, err
+	}
+	const states = 5
+	times := []cpuTime{}
+	for _, raw := range [][]byte{total, perCPU} {
+		for len(raw) >= states*8 {
+			var t cpuTime
+			for i := 0; i < states; i++ {
+				v := binary.LittleEndian.Uint64(raw[i*8:])
+				t.total += v
+				if i != states-1 {
+					t.busy += v
+				}
+			}
+			times = append(times, t)
+			raw = raw[states*8:]
+		}
+	}
+	return times, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// memoryUsage reads /proc/meminfo. MemAvailable counts reclaimable page
+// cache, unlike MemFree.
+func memoryUsage() (MemoryUsage, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return MemoryUsage{}, err
+	}
+	defer f.Close()
+
+	var m MemoryUsage
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Lines look like "MemTotal:       16318072 kB"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			m.Total = kb * 1024
+		case "MemAvailable:":
+			m.Available = kb * 1024
+		}
+	}
+	return m, scanner.Err()
+}
+
+// cpuTimes reads the "cpu" and "cpuN" lines of /proc/stat: user, nice,
+// system, idle, iowait, irq, softirq, steal in clock ticks. Guest time is
+// already part of user time.
+func cpuTimes() ([]cpuTime, error) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	times := []cpuTime{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		var t cpuTime
+		for i, field := range fields[1:min(len(fields), 9)] {
+			v, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parsing /proc/stat: %w", err)
+			}
+			t.total += v
+			// idle and iowait
+			if i != 3 && i != 4 {
+				t.busy += v
+			}
+		}
+		times = append(times, t)
+	}
+	if len(times) == 0 {
+		return nil, fmt.Errorf("no cpu lines in /proc/stat")
+	}
+	return times, scanner.Err()
+}
+
+func loadAverage() (LoadAverage, error) {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return LoadAverage{}, err
+	}
+	var l LoadAverage
+	if _, err := fmt.Sscanf(string(data), "%f %f %f", &l.Load1, &l.Load5, &l.Load15); err != nil {
+		return LoadAverage{}, fmt.Errorf("parsing /proc/loadavg: %w", err)
+	}
+	return l, nil
+}
@@ -0,0 +1,23 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package main
+
+func diskUsage(path string) (DiskUsage, error) {
+	return DiskUsage{}, errMetricsUnsupported
+}
+
+func memoryUsage() (MemoryUsage, error) {
+	return MemoryUsage{}, errMetricsUnsupported
+}
+
+func rootPath() string {
+	return "/"
+}
+
+func cpuTimes() ([]cpuTime, error) {
+	return nil, errMetricsUnsupported
+}
+
+func loadAverage() (LoadAverage, error) {
+	return LoadAverage{}, errMetricsUnsupported
+}
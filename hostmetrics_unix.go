@@ -0,0 +1,21 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import "golang.org/x/sys/unix"
+
+func diskUsage(path string) (DiskUsage, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return DiskUsage{}, err
+	}
+	return DiskUsage{
+		Total: uint64(stat.Blocks) * uint64(stat.Bsize),
+		Free:  uint64(stat.Bavail) * uint64(stat.Bsize),
+	}, nil
+}
+
+// rootPath is the filesystem /stats reports on
+func rootPath() string {
+	return "/"
+}
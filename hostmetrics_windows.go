@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// rootPath is the system drive, e.g. C:\
+func rootPath() string {
+	if drive := os.Getenv("SystemDrive"); drive != "" {
+		return drive + `\`
+	}
+	return `C:\`
+}
+
+func diskUsage(path string) (DiskUsage, error) {
+	dir, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return DiskUsage{}, err
+	}
+	var d DiskUsage
+	if err := windows.GetDiskFreeSpaceEx(dir, &d.Free, &d.Total, nil); err != nil {
+		return DiskUsage{}, err
+	}
+	return d, nil
+}
+
+// memoryStatusEx is MEMORYSTATUSEX, x/sys/windows doesn't wrap it
+type memoryStatusEx struct {
+	Length               uint32
+	MemoryLoad           uint32
+	TotalPhys            uint64
+	AvailPhys            uint64
+	TotalPageFile        uint64
+	AvailPageFile        uint64
+	TotalVirtual         uint64
+	AvailVirtual         uint64
+	AvailExtendedVirtual uint64
+}
+
+var procGlobalMemoryStatusEx = windows.NewLazySystemDLL("kernel32.dll").NewProc("GlobalMemoryStatusEx")
+
+func memoryUsage() (MemoryUsage, error) {
+	status := memoryStatusEx{Length: uint32(unsafe.Sizeof(memoryStatusEx{}))}
+	if ok, _, err := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&status))); ok == 0 {
+		return MemoryUsage{}, err
+	}
+	return MemoryUsage{Total: status.TotalPhys, Available: status.AvailPhys}, nil
+}
+
+var procGetSystemTimes = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetSystemTimes")
+
+// cpuTimes returns the combined time of all CPUs from GetSystemTimes, per
+// core times need NtQuerySystemInformation. Kernel time includes idle time.
+func cpuTimes() ([]cpuTime, error) {
+	var idle, kernel, user windows.Filetime
+	if ok, _, err := procGetSystemTimes.Call(uintptr(unsafe.Pointer(&idle)), uintptr(unsafe.Pointer(&kernel)), uintptr(unsafe.Pointer(&user))); ok == 0 {
+		return nil, err
+	}
+	ticks := func(f windows.Filetime) uint64 { return uint64(f.HighDateTime)<<32 | uint64(f.LowDateTime) }
+	total := ticks(kernel) + ticks(user)
+	return []cpuTime{{busy: total - ticks(idle), total: total}}, nil
+}
+
+// loadAverage isn't available, Windows has no run queue average
+func loadAverage() (LoadAverage, error) {
+	return LoadAverage{}, errMetricsUnsupported
+}
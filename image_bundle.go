@@ -0,0 +1,237 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// Format name and version of image bundles
+const (
+	imageBundleFormat  = "golang-docker-images"
+	imageBundleVersion = 1
+)
+
+// Entries of an image bundle, a plain tar holding the manifest first and
+// the "docker save" archive of every image after it
+const (
+	imageBundleManifestName = "manifest.json"
+	imageBundleArchiveName  = "images.tar"
+)
+
+// Content type image bundles are uploaded with, which gets the larger
+// MAX_IMAGE_BUNDLE_SIZE body limit
+const imageBundleContentType = "application/x-tar"
+
+const defaultMaxImageBundleSize = 20 << 30
+
+// ImageBundleManifest describes the images of a bundle and the archive
+// holding them, so an import can check it got exactly what was exported
+type ImageBundleManifest struct {
+	Format     string             `json:"format"`
+	Version    int                `json:"version"`
+	CreatedAt  time.Time          `json:"created_at"`
+	CreatedBy  string             `json:"created_by"`
+	Host       string             `json:"host"`
+	Images     []ImageBundleEntry `json:"images"`
+	ArchiveSHA string             `json:"archive_sha256"`
+	ArchiveLen int64              `json:"archive_size"`
+}
+
+type ImageBundleEntry struct {
+	Ref string `json:"ref"`
+	// Digest of the image config, which docker load keeps
+	ID string `json:"id"`
+	// Registry digests, which don't survive docker save, for reference
+	RepoDigests []string `json:"repo_digests,omitempty"`
+	Size        int64    `json:"size"`
+	Platform    string   `json:"platform"`
+}
+
+// ImageBundleResult is the verification of one image after an import
+type ImageBundleResult struct {
+	Ref    string `json:"ref"`
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// saveImageBundle saves the images into a temporary file and describes them.
+// The caller removes the file.
+func saveImageBundle(ctx context.Context, cli *client.Client, refs []string, actor string) (*ImageBundleManifest, *os.File, error) {
+	host, _ := os.Hostname()
+	manifest := &ImageBundleManifest{
+		Format:    imageBundleFormat,
+		Version:   imageBundleVersion,
+		CreatedAt: time.Now().UTC(),
+		CreatedBy: actor,
+		Host:      host,
+		Images:    []ImageBundleEntry{},
+	}
+	for _, ref := range refs {
+		info, err := cli.ImageInspect(ctx, ref)
+		if err != nil {
+			return nil, nil, fmt.Errorf("image %s: %w", ref, err)
+		}
+		manifest.Images = append(manifest.Images, ImageBundleEntry{
+			Ref:         ref,
+			ID:          info.ID,
+			RepoDigests: info.RepoDigests,
+			Size:        info.Size,
+			Platform:    info.Os + "/" + info.Architecture,
+		})
+	}
+
+	archive, err := cli.ImageSave(ctx, refs)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer archive.Close()
+	file, err := os.CreateTemp("", "image-bundle-*.tar")
+	if err != nil {
+		return nil, nil, err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), archive)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, nil, fmt.Errorf("saving images: %w", err)
+	}
+	manifest.ArchiveSHA = hex.EncodeToString(hash.Sum(nil))
+	manifest.ArchiveLen = size
+	return manifest, file, nil
+}
+
+// writeImageBundle writes the bundle tar: the manifest, then the archive
+func writeImageBundle(w io.Writer, manifest *ImageBundleManifest, archive io.Reader) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	header := &tar.Header{Name: imageBundleManifestName, Mode: 0o644, Size: int64(len(data)), ModTime: manifest.CreatedAt}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	header = &tar.Header{Name: imageBundleArchiveName, Mode: 0o644, Size: manifest.ArchiveLen, ModTime: manifest.CreatedAt}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, archive); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// readImageBundle reads a bundle's manifest and spools its archive to a
+// temporary file, checking the archive's size and checksum against the
+// manifest before anything is loaded. The caller removes the file.
+func readImageBundle(r io.Reader) (*ImageBundleManifest, *os.File, error) {
+	tr := tar.NewReader(r)
+	header, err := tr.Next()
+	if err != nil {
+		return nil, nil, fmt.Errorf("not an image bundle: %w", err)
+	}
+	if header.Name != imageBundleManifestName {
+		return nil, nil, fmt.Errorf("not an image bundle: it starts with %s instead of %s", header.Name, imageBundleManifestName)
+	}
+	var manifest ImageBundleManifest
+	if err := json.NewDecoder(io.LimitReader(tr, 1<<20)).Decode(&manifest); err != nil {
+		return nil, nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	if manifest.Format != imageBundleFormat || manifest.Version != imageBundleVersion {
+		return nil, nil, fmt.Errorf("unsupported image bundle (format %q version %d)", manifest.Format, manifest.Version)
+	}
+	if len(manifest.Images) == 0 {
+		return nil, nil, errors.New("the image bundle lists no images")
+	}
+
+	header, err = tr.Next()
+	if err != nil {
+		return nil, nil, fmt.Errorf("image bundle has no %s: %w", imageBundleArchiveName, err)
+	}
+	if header.Name != imageBundleArchiveName {
+		return nil, nil, fmt.Errorf("unexpected %s in image bundle", header.Name)
+	}
+	file, err := os.CreateTemp("", "image-bundle-*.tar")
+	if err != nil {
+		return nil, nil, err
+	}
+	fail := func(err error) (*ImageBundleManifest, *os.File, error) {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, nil, err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), tr)
+	if err != nil {
+		return fail(fmt.Errorf("reading %s: %w", imageBundleArchiveName, err))
+	}
+	if size != manifest.ArchiveLen {
+		return fail(fmt.Errorf("%s is %d bytes, the manifest says %d: the bundle is truncated or damaged", imageBundleArchiveName, size, manifest.ArchiveLen))
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != manifest.ArchiveSHA {
+		return fail(fmt.Errorf("checksum of %s is %s, the manifest says %s: the bundle is damaged", imageBundleArchiveName, sum, manifest.ArchiveSHA))
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+	return &manifest, file, nil
+}
+
+// loadImageBundle loads a verified archive and checks every image of the
+// manifest now exists under its reference with the exported ID
+func loadImageBundle(ctx context.Context, cli *client.Client, manifest *ImageBundleManifest, archive io.Reader) ([]ImageBundleResult, error) {
+	loaded, err := cli.ImageLoad(ctx, archive)
+	if err != nil {
+		return nil, err
+	}
+	// The daemon reports failures inside the stream
+	var loadErr error
+	decoder := json.NewDecoder(loaded.Body)
+	for {
+		var msg struct {
+			Error string `json:"error"`
+		}
+		if err := decoder.Decode(&msg); err != nil {
+			break
+		}
+		if msg.Error != "" {
+			loadErr = errors.New(msg.Error)
+		}
+	}
+	loaded.Body.Close()
+	if loadErr != nil {
+		return nil, loadErr
+	}
+
+	results := []ImageBundleResult{}
+	for _, entry := range manifest.Images {
+		result := ImageBundleResult{Ref: entry.Ref, ID: entry.ID, Status: "verified"}
+		info, err := cli.ImageInspect(ctx, entry.Ref)
+		switch {
+		case err != nil:
+			result.Status, result.Error = "missing", err.Error()
+		case info.ID != entry.ID:
+			result.Status, result.Error = "mismatch", fmt.Sprintf("%s is %s after loading", entry.Ref, info.ID)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
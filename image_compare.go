@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+)
+
+// ImageCompareSide is what is known of one of the compared images
+type ImageCompareSide struct {
+	Ref      string   `json:"ref"`
+	ID       string   `json:"id"`
+	Size     int64    `json:"size"`
+	Platform string   `json:"platform"`
+	Layers   int      `json:"layers"`
+	Tags     []string `json:"tags"`
+}
+
+// ValueChange is a setting of the image config that differs; a nil side
+// means the setting is absent from that image
+type ValueChange struct {
+	A any `json:"a"`
+	B any `json:"b"`
+}
+
+// ImageComparison is the difference from image A to image B
+type ImageComparison struct {
+	A ImageCompareSide `json:"a"`
+	B ImageCompareSide `json:"b"`
+	// Identical when both names point to the same image ID
+	Identical bool `json:"identical"`
+	// Layers of B's base that A has too, in order from the bottom
+	SharedLayers int      `json:"shared_layers"`
+	OnlyInA      []string `json:"only_in_a"`
+	OnlyInB      []string `json:"only_in_b"`
+	SizeDelta    int64    `json:"size_delta"`
+	// Environment variables, labels and ports by name
+	Env          map[string]ValueChange `json:"env"`
+	Labels       map[string]ValueChange `json:"labels"`
+	ExposedPorts map[string]ValueChange `json:"exposed_ports"`
+	// Other settings by config field: entrypoint, cmd, user, working_dir...
+	Config map[string]ValueChange `json:"config"`
+	// Changes likely to break containers created for A
+	Warnings []string `json:"warnings"`
+}
+
+// compareImages inspects both images and diffs their layers and config
+func compareImages(ctx context.Context, cli *client.Client, a, b string) (*ImageComparison, error) {
+	infoA, err := cli.ImageInspect(ctx, a)
+	if err != nil {
+		return nil, fmt.Errorf("image %s: %w", a, err)
+	}
+	infoB, err := cli.ImageInspect(ctx, b)
+	if err != nil {
+		return nil, fmt.Errorf("image %s: %w", b, err)
+	}
+
+	cmp := &ImageComparison{
+		A:            compareSide(a, infoA),
+		B:            compareSide(b, infoB),
+		Identical:    infoA.ID == infoB.ID,
+		OnlyInA:      []string{},
+		OnlyInB:      []string{},
+		SizeDelta:    infoB.Size - infoA.Size,
+		Env:          map[string]ValueChange{},
+		Labels:       map[string]ValueChange{},
+		ExposedPorts: map[string]ValueChange{},
+		Config:       map[string]ValueChange{},
+		Warnings:     []string{},
+	}
+
+	// Layers are shared as long as the stacks match from the bottom; a
+	// layer further up with the same diff ID is the same content too
+	layersA, layersB := infoA.RootFS.Layers, infoB.RootFS.Layers
+	for cmp.SharedLayers < len(layersA) && cmp.SharedLayers < len(layersB) && layersA[cmp.SharedLayers] == layersB[cmp.SharedLayers] {
+		cmp.SharedLayers++
+	}
+	for _, l := range layersA {
+		if !containsString(layersB, l) {
+			cmp.OnlyInA = append(cmp.OnlyInA, l)
+		}
+	}
+	for _, l := range layersB {
+		if !containsString(layersA, l) {
+			cmp.OnlyInB = append(cmp.OnlyInB, l)
+		}
+	}
+	if infoA.Os != infoB.Os || infoA.Architecture != infoB.Architecture {
+		cmp.Warnings = append(cmp.Warnings, fmt.Sprintf("the platform changes from %s to %s", cmp.A.Platform, cmp.B.Platform))
+	}
+
+	cfgA, cfgB := imageConfig(infoA), imageConfig(infoB)
+	diffMaps(cmp.Env, envMap(cfgA.Env), envMap(cfgB.Env))
+	diffMaps(cmp.Labels, cfgA.Labels, cfgB.Labels)
+
+	diffMaps(cmp.ExposedPorts, exposedPorts(infoA), exposedPorts(infoB))
+	for p, change := range cmp.ExposedPorts {
+		if change.B == nil {
+			cmp.Warnings = append(cmp.Warnings, "port "+p+" is no longer exposed")
+		}
+	}
+
+	settings := []struct {
+		name string
+		a, b []string
+	}{
+		{"entrypoint", cfgA.Entrypoint, cfgB.Entrypoint},
+		{"cmd", cfgA.Cmd, cfgB.Cmd},
+		{"user", []string{cfgA.User}, []string{cfgB.User}},
+		{"working_dir", []string{cfgA.WorkingDir}, []string{cfgB.WorkingDir}},
+		{"stop_signal", []string{cfgA.StopSignal}, []string{cfgB.StopSignal}},
+		{"volumes", sortedKeys(cfgA.Volumes), sortedKeys(cfgB.Volumes)},
+		{"healthcheck", healthcheckTest(cfgA), healthcheckTest(cfgB)},
+	}
+	for _, s := range settings {
+		if strings.Join(s.a, "\x00") == strings.Join(s.b, "\x00") {
+			continue
+		}
+		cmp.Config[s.name] = ValueChange{A: configValue(s.a), B: configValue(s.b)}
+	}
+	if _, ok := cmp.Config["entrypoint"]; ok {
+		cmp.Warnings = append(cmp.Warnings, "the entrypoint changes: containers passing their own command may behave differently")
+	}
+	if change, ok := cmp.Config["user"]; ok {
+		cmp.Warnings = append(cmp.Warnings, fmt.Sprintf("the user changes from %v to %v: check ownership of mounted volumes", valueOrRoot(change.A), valueOrRoot(change.B)))
+	}
+	if _, ok := cmp.Config["volumes"]; ok {
+		cmp.Warnings = append(cmp.Warnings, "the declared volumes change: data may no longer be kept in a volume")
+	}
+	for name, change := range cmp.Env {
+		if change.B == nil {
+			cmp.Warnings = append(cmp.Warnings, "environment variable "+name+" is no longer set by the image")
+		}
+	}
+	sort.Strings(cmp.Warnings)
+	return cmp, nil
+}
+
+func compareSide(ref string, info image.InspectResponse) ImageCompareSide {
+	tags := info.RepoTags
+	if tags == nil {
+		tags = []string{}
+	}
+	return ImageCompareSide{
+		Ref:      ref,
+		ID:       info.ID,
+		Size:     info.Size,
+		Platform: info.Os + "/" + info.Architecture,
+		Layers:   len(info.RootFS.Layers),
+		Tags:     tags,
+	}
+}
+
+// envMap splits KEY=value pairs
+func envMap(env []string) map[string]string {
+	m := map[string]string{}
+	for _, kv := range env {
+		key, value, _ := strings.Cut(kv, "=")
+		m[key] = value
+	}
+	return m
+}
+
+// diffMaps records in out every key whose value differs between a and b
+func diffMaps(out map[string]ValueChange, a, b map[string]string) {
+	for k, va := range a {
+		vb, ok := b[k]
+		switch {
+		case !ok:
+			out[k] = ValueChange{A: va}
+		case va != vb:
+			out[k] = ValueChange{A: va, B: vb}
+		}
+	}
+	for k, vb := range b {
+		if _, ok := a[k]; !ok {
+			out[k] = ValueChange{B: vb}
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// imageConfig copies the compared settings of an image's config
+func imageConfig(info image.InspectResponse) container.Config {
+	cfg := container.Config{}
+	if c := info.Config; c != nil {
+		cfg = container.Config{
+			Env:        c.Env,
+			Labels:     c.Labels,
+			Entrypoint: c.Entrypoint,
+			Cmd:        c.Cmd,
+			User:       c.User,
+			WorkingDir: c.WorkingDir,
+			StopSignal: c.StopSignal,
+			Volumes:    c.Volumes,
+		}
+		if h := c.Healthcheck; h != nil {
+			cfg.Healthcheck = &container.HealthConfig{Test: h.Test}
+		}
+	}
+	return cfg
+}
+
+func exposedPorts(info image.InspectResponse) map[string]string {
+	ports := map[string]string{}
+	if info.Config != nil {
+		for p := range info.Config.ExposedPorts {
+			ports[p] = "exposed"
+		}
+	}
+	return ports
+}
+
+func healthcheckTest(cfg container.Config) []string {
+	if cfg.Healthcheck == nil {
+		return nil
+	}
+	return cfg.Healthcheck.Test
+}
+
+// configValue shows single-valued settings as a string and unset ones as nil
+func configValue(v []string) any {
+	switch {
+	case len(v) == 0, len(v) == 1 && v[0] == "":
+		return nil
+	case len(v) == 1:
+		return v[0]
+	}
+	return v
+}
+
+func valueOrRoot(v any) any {
+	if v == nil {
+		return "root"
+	}
+	return v
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// savedImage is an image exported with "docker save" into a temporary
+// file, with the manifest and config read from it. The caller closes it.
+type savedImage struct {
+	file   *os.File
+	layers []string
+	// Size of each entry of the archive
+	sizes  map[string]int64
+	config struct {
+		History []struct {
+			Created    time.Time `json:"created"`
+			CreatedBy  string    `json:"created_by"`
+			Comment    string    `json:"comment"`
+			EmptyLayer bool      `json:"empty_layer"`
+		} `json:"history"`
+		RootFS struct {
+			DiffIDs []string `json:"diff_ids"`
+		} `json:"rootfs"`
+	}
+}
+
+// saveImage exports an image and reads its manifest and config. Both the
+// legacy layout (<id>/layer.tar) and the OCI layout (blobs/sha256/<digest>)
+// are described by manifest.json.
+func saveImage(ctx context.Context, cli *client.Client, ref string) (*savedImage, error) {
+	archive, err := cli.ImageSave(ctx, []string{ref})
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+	file, err := os.CreateTemp("", "image-layers-*.tar")
+	if err != nil {
+		return nil, err
+	}
+	img := &savedImage{file: file, sizes: map[string]int64{}}
+	if _, err := io.Copy(file, archive); err != nil {
+		img.Close()
+		return nil, fmt.Errorf("saving image: %w", err)
+	}
+
+	var manifest []struct {
+		Config string
+		Layers []string
+	}
+	if err := img.read("manifest.json", &manifest); err != nil {
+		img.Close()
+		return nil, err
+	}
+	if len(manifest) != 1 {
+		img.Close()
+		return nil, fmt.Errorf("saved image has %d manifests, expected 1", len(manifest))
+	}
+	img.layers = manifest[0].Layers
+	if err := img.read(manifest[0].Config, &img.config); err != nil {
+		img.Close()
+		return nil, err
+	}
+	return img, nil
+}
+
+func (img *savedImage) Close() {
+	img.file.Close()
+	os.Remove(img.file.Name())
+}
+
+// read decodes a JSON entry of the archive, recording entry sizes on the way
+func (img *savedImage) read(name string, out any) error {
+	if _, err := img.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	tr := tar.NewReader(img.file)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("saved image has no %s", name)
+		}
+		if err != nil {
+			return err
+		}
+		img.sizes[path.Clean(header.Name)] = header.Size
+		if path.Clean(header.Name) == path.Clean(name) {
+			return json.NewDecoder(tr).Decode(out)
+		}
+	}
+}
+
+// ImageLayer is one step of an image's history, and the layer it added
+// unless it only changed metadata
+type ImageLayer struct {
+	// Position among the layers, base first; nil for metadata-only steps
+	Index     *int      `json:"index"`
+	DiffID    string    `json:"diff_id,omitempty"`
+	Size      int64     `json:"size"`
+	Created   time.Time `json:"created"`
+	CreatedBy string    `json:"created_by"`
+	Comment   string    `json:"comment,omitempty"`
+}
+
+// Layers lists the history of the image, base first, with the size of the
+// layer each step added. Sizes are those of the layer tars as saved, which
+// the containerd image store keeps compressed.
+func (img *savedImage) Layers() []ImageLayer {
+	layers := []ImageLayer{}
+	next := 0
+	for _, h := range img.config.History {
+		layer := ImageLayer{Created: h.Created, CreatedBy: h.CreatedBy, Comment: h.Comment}
+		if !h.EmptyLayer && next < len(img.layers) {
+			index := next
+			layer.Index = &index
+			layer.Size = img.sizes[path.Clean(img.layers[next])]
+			if next < len(img.config.RootFS.DiffIDs) {
+				layer.DiffID = img.config.RootFS.DiffIDs[next]
+			}
+			next++
+		}
+		layers = append(layers, layer)
+	}
+	return layers
+}
+
+// LayerFile is an entry of a layer. Deleted files are the whiteouts a layer
+// uses to hide files of the layers below.
+type LayerFile struct {
+	Path     string `json:"path"`
+	Type     string `json:"type"`
+	Size     int64  `json:"size"`
+	Mode     string `json:"mode"`
+	LinkName string `json:"link_name,omitempty"`
+	Deleted  bool   `json:"deleted,omitempty"`
+}
+
+var errNoSuchLayer = errors.New("no such layer")
+
+// LayerFiles lists what the layer at index adds, changes and deletes
+func (img *savedImage) LayerFiles(index int) ([]LayerFile, error) {
+	if index < 0 || index >= len(img.layers) {
+		return nil, fmt.Errorf("%w: the image has layers 0 to %d", errNoSuchLayer, len(img.layers)-1)
+	}
+	name := path.Clean(img.layers[index])
+	if _, err := img.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(img.file)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("saved image has no %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if path.Clean(header.Name) == name {
+			return listLayerTar(tr)
+		}
+	}
+}
+
+// listLayerTar reads a layer, uncompressing it first when the daemon kept
+// it gzipped (the containerd image store does)
+func listLayerTar(r io.Reader) ([]LayerFile, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return nil, errors.New("the layer is zstd compressed, which can't be listed")
+	default:
+		r = br
+	}
+
+	files := []LayerFile{}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		file := LayerFile{
+			Path:     "/" + strings.TrimPrefix(path.Clean(header.Name), "./"),
+			Size:     header.Size,
+			Mode:     header.FileInfo().Mode().String(),
+			LinkName: header.Linkname,
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			file.Type = "dir"
+		case tar.TypeSymlink:
+			file.Type = "symlink"
+		case tar.TypeLink:
+			file.Type = "hardlink"
+		default:
+			file.Type = "file"
+		}
+		dir, base := path.Split(file.Path)
+		switch {
+		case base == ".wh..wh..opq":
+			// Opaque directory: everything below from lower layers is hidden
+			file.Path, file.Type, file.Deleted = path.Clean(dir)+"/*", "whiteout", true
+		case strings.HasPrefix(base, ".wh."):
+			file.Path, file.Type, file.Deleted = dir+strings.TrimPrefix(base, ".wh."), "whiteout", true
+		}
+		files = append(files, file)
+	}
+}
+
+// LayerFilesQuery filters and orders the files of a layer
+type LayerFilesQuery struct {
+	Sort string `json:"sort" form:"sort" binding:"omitempty,oneof=size path"`
+	// Smallest file listed, e.g. "1MB"
+	MinSize string `json:"min_size" form:"min_size" binding:"omitempty,bytesize"`
+	// Only files below this directory
+	Prefix string `json:"prefix" form:"prefix"`
+	Limit  int    `json:"limit" form:"limit" binding:"omitempty,min=1,max=100000"`
+}
+
+// filterLayerFiles applies q and returns the files left, largest first by
+// default, with the total size and count before the limit
+func filterLayerFiles(files []LayerFile, q LayerFilesQuery, minSize int64) ([]LayerFile, int64, int) {
+	filtered := []LayerFile{}
+	var total int64
+	for _, f := range files {
+		if q.Prefix != "" && !strings.HasPrefix(f.Path, q.Prefix) {
+			continue
+		}
+		if f.Size < minSize {
+			continue
+		}
+		filtered = append(filtered, f)
+		total += f.Size
+	}
+	if q.Sort == "path" {
+		sort.Slice(filtered, func(i, j int) bool { return filtered[i].Path < filtered[j].Path })
+	} else {
+		sort.SliceStable(filtered, func(i, j int) bool { return filtered[i].Size > filtered[j].Size })
+	}
+	count := len(filtered)
+	limit := q.Limit
+	if limit == 0 {
+		limit = 1000
+	}
+	if len(filtered) > limit {
+		filtered = filtered[:limit]
+	}
+	return filtered, total, count
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	units "github.com/docker/go-units"
+	"github.com/gin-gonic/gin"
+)
+
+// Newest tags of a repository the image report never calls stale
+const defaultKeepTags = 3
+
+// Sections of the image report, each with its own cleanup action
+const (
+	imageReportUnused     = "unused"
+	imageReportStaleTags  = "stale_tags"
+	imageReportDuplicates = "duplicates"
+)
+
+type ReportImage struct {
+	ID       string    `json:"id"`
+	Tags     []string  `json:"tags"`
+	Size     int64     `json:"size"`
+	Created  time.Time `json:"created"`
+	InUse    bool      `json:"in_use"`
+	Dangling bool      `json:"dangling"`
+}
+
+type ReportTag struct {
+	Tag     string    `json:"tag"`
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+}
+
+// StaleRepository is a repository with more tags than the report keeps
+type StaleRepository struct {
+	Repository string      `json:"repository"`
+	Tags       int         `json:"tags"`
+	Kept       []ReportTag `json:"kept"`
+	Stale      []ReportTag `json:"stale"`
+}
+
+// DuplicateGroup is images with the same layers under different IDs, which
+// happens when identical content is rebuilt or retagged through a registry
+type DuplicateGroup struct {
+	Layers int           `json:"layers"`
+	Images []ReportImage `json:"images"`
+	// Images of the group the duplicates cleanup removes: all but the
+	// newest, and never one a container uses
+	Removable []string `json:"removable"`
+}
+
+// ImageReport lists images worth cleaning up. Removable entries are what
+// POST /images/report/cleanup removes for each section.
+type ImageReport struct {
+	GeneratedAt time.Time         `json:"generated_at"`
+	Keep        int               `json:"keep"`
+	Unused      []ReportImage     `json:"unused"`
+	StaleTags   []StaleRepository `json:"stale_tags"`
+	Duplicates  []DuplicateGroup  `json:"duplicates"`
+	// Images tagged in several repositories, which costs nothing but
+	// makes the image list look fuller than it is
+	Aliases []ReportImage `json:"aliases"`
+	Summary gin.H         `json:"summary"`
+}
+
+// imageReport inspects every local image and the containers using them
+func imageReport(ctx context.Context, cli *client.Client, keep int) (*ImageReport, error) {
+	images, err := cli.ImageList(ctx, image.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	inUse := map[string]bool{}
+	for _, c := range containers {
+		inUse[c.ImageID] = true
+	}
+
+	report := &ImageReport{
+		GeneratedAt: time.Now().UTC(),
+		Keep:        keep,
+		Unused:      []ReportImage{},
+		StaleTags:   []StaleRepository{},
+		Duplicates:  []DuplicateGroup{},
+		Aliases:     []ReportImage{},
+	}
+	repositories := map[string][]ReportTag{}
+	byLayers := map[string][]ReportImage{}
+	layerCount := map[string]int{}
+	var unusedSize int64
+	for _, img := range images {
+		tags := []string{}
+		for _, tag := range img.RepoTags {
+			if tag != "<none>:<none>" {
+				tags = append(tags, tag)
+			}
+		}
+		entry := ReportImage{
+			ID:       img.ID,
+			Tags:     tags,
+			Size:     img.Size,
+			Created:  time.Unix(img.Created, 0).UTC(),
+			InUse:    inUse[img.ID],
+			Dangling: len(tags) == 0,
+		}
+		if !entry.InUse {
+			report.Unused = append(report.Unused, entry)
+			unusedSize += entry.Size
+		}
+
+		names := map[string]bool{}
+		for _, tag := range tags {
+			named, err := reference.ParseNormalizedNamed(tag)
+			if err != nil {
+				continue
+			}
+			name := reference.FamiliarName(named)
+			names[name] = true
+			repositories[name] = append(repositories[name], ReportTag{Tag: tag, ID: img.ID, Created: entry.Created})
+		}
+		if len(names) > 1 {
+			report.Aliases = append(report.Aliases, entry)
+		}
+
+		if info, err := cli.ImageInspect(ctx, img.ID); err == nil && len(info.RootFS.Layers) > 0 {
+			key := strings.Join(info.RootFS.Layers, ",")
+			byLayers[key] = append(byLayers[key], entry)
+			layerCount[key] = len(info.RootFS.Layers)
+		}
+	}
+
+	var staleCount int
+	for name, tags := range repositories {
+		if len(tags) <= keep {
+			continue
+		}
+		sort.SliceStable(tags, func(i, j int) bool { return tags[i].Created.After(tags[j].Created) })
+		repo := StaleRepository{Repository: name, Tags: len(tags), Kept: tags[:keep], Stale: []ReportTag{}}
+		for _, tag := range tags[keep:] {
+			// A tag a container runs from is never stale
+			if !inUse[tag.ID] {
+				repo.Stale = append(repo.Stale, tag)
+			}
+		}
+		if len(repo.Stale) > 0 {
+			report.StaleTags = append(report.StaleTags, repo)
+			staleCount += len(repo.Stale)
+		}
+	}
+	sort.Slice(report.StaleTags, func(i, j int) bool { return report.StaleTags[i].Repository < report.StaleTags[j].Repository })
+
+	for key, group := range byLayers {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool { return group[i].Created.After(group[j].Created) })
+		dup := DuplicateGroup{Layers: layerCount[key], Images: group, Removable: []string{}}
+		for _, img := range group[1:] {
+			if !img.InUse {
+				dup.Removable = append(dup.Removable, img.ID)
+			}
+		}
+		report.Duplicates = append(report.Duplicates, dup)
+	}
+	sort.Slice(report.Duplicates, func(i, j int) bool {
+		return report.Duplicates[i].Images[0].Created.After(report.Duplicates[j].Images[0].Created)
+	})
+	sort.Slice(report.Unused, func(i, j int) bool { return report.Unused[i].Size > report.Unused[j].Size })
+
+	report.Summary = gin.H{
+		"images":           len(images),
+		"unused":           len(report.Unused),
+		"stale_tags":       staleCount,
+		"duplicate_groups": len(report.Duplicates),
+		"aliases":          len(report.Aliases),
+		// Layers shared with other images are counted in every image
+		"unused_size_at_most": units.HumanSize(float64(unusedSize)),
+	}
+	return report, nil
+}
+
+// CleanupTargets returns what the cleanup action removes: image IDs for
+// unused images and duplicates, tags for stale tags
+func (r *ImageReport) CleanupTargets(action string) []string {
+	targets := []string{}
+	if action == imageReportUnused || action == "all" {
+		for _, img := range r.Unused {
+			targets = append(targets, img.ID)
+		}
+	}
+	if action == imageReportStaleTags || action == "all" {
+		for _, repo := range r.StaleTags {
+			for _, tag := range repo.Stale {
+				targets = append(targets, tag.Tag)
+			}
+		}
+	}
+	if action == imageReportDuplicates || action == "all" {
+		for _, dup := range r.Duplicates {
+			targets = append(targets, dup.Removable...)
+		}
+	}
+	// An unused image can also be a duplicate
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, t := range targets {
+		if !seen[t] {
+			seen[t] = true
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+// removeReportImages removes images by ID and untags tags, checking again
+// that no container uses them since the report was made. An image goes
+// once its last tag does.
+func removeReportImages(ctx context.Context, cli *client.Client, targets []string) (map[string]any, int64) {
+	results := map[string]any{}
+	var reclaimed int64
+	removed := 0
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		for _, t := range targets {
+			results[t] = gin.H{"status": "error", "message": err.Error()}
+		}
+		return results, 0
+	}
+	inUse := map[string]bool{}
+	for _, c := range containers {
+		inUse[c.ImageID] = true
+	}
+
+	for _, target := range targets {
+		info, err := cli.ImageInspect(ctx, target)
+		if err != nil {
+			if client.IsErrNotFound(err) {
+				results[target] = gin.H{"status": "not_found"}
+			} else {
+				results[target] = gin.H{"status": "error", "message": err.Error()}
+			}
+			continue
+		}
+		if inUse[info.ID] {
+			results[target] = gin.H{"status": "in_use", "message": "a container now uses this image"}
+			continue
+		}
+		// Removing an image by ID that has several tags must be forced; a
+		// tag is only untagged
+		byID := strings.HasPrefix(target, "sha256:")
+		deleted, err := cli.ImageRemove(ctx, target, image.RemoveOptions{Force: byID, PruneChildren: true})
+		if err != nil {
+			results[target] = gin.H{"status": "error", "message": err.Error()}
+			continue
+		}
+		status := "untagged"
+		for _, d := range deleted {
+			if d.Deleted == info.ID {
+				status = "deleted"
+				reclaimed += info.Size
+			}
+		}
+		results[target] = gin.H{"status": status}
+		removed++
+	}
+	fmt.Printf("🧹 Image cleanup removed %d of %d images and tags, about %s reclaimed\n", removed, len(targets), units.HumanSize(float64(reclaimed)))
+	return results, reclaimed
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	units "github.com/docker/go-units"
+)
+
+// Sections of the inventory report, a CSV export holds one of them
+const (
+	inventoryContainers = "containers"
+	inventoryImages     = "images"
+)
+
+type InventoryContainer struct {
+	Name    string `json:"name"`
+	ID      string `json:"id"`
+	Image   string `json:"image"`
+	ImageID string `json:"image_id"`
+	// Repo digest of the image when it came from a registry, else its ID
+	Digest  string    `json:"digest"`
+	Ports   []string  `json:"ports"`
+	State   string    `json:"state"`
+	Status  string    `json:"status"`
+	Created time.Time `json:"created"`
+	// User who created it through this API, from the owner label
+	Owner   string `json:"owner"`
+	Project string `json:"project"`
+}
+
+// InventoryImage is one tag of an image; untagged images have an empty
+// repository and tag
+type InventoryImage struct {
+	Repository string    `json:"repository"`
+	Tag        string    `json:"tag"`
+	ID         string    `json:"id"`
+	Digest     string    `json:"digest"`
+	Size       int64     `json:"size"`
+	Created    time.Time `json:"created"`
+	Age        string    `json:"age"`
+	Containers int       `json:"containers"`
+}
+
+// Inventory lists every container and image on the host, for asset
+// tracking and audits
+type Inventory struct {
+	GeneratedAt time.Time            `json:"generated_at"`
+	Containers  []InventoryContainer `json:"containers"`
+	Images      []InventoryImage     `json:"images"`
+}
+
+func buildInventory(ctx context.Context, cli *client.Client) (*Inventory, error) {
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	images, err := cli.ImageList(ctx, image.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	inventory := &Inventory{
+		GeneratedAt: time.Now().UTC(),
+		Containers:  []InventoryContainer{},
+		Images:      []InventoryImage{},
+	}
+	digests := map[string]string{}
+	for _, img := range images {
+		digests[img.ID] = img.ID
+		if len(img.RepoDigests) > 0 {
+			digests[img.ID] = img.RepoDigests[0]
+		}
+	}
+	usedBy := map[string]int{}
+	for _, c := range containers {
+		usedBy[c.ImageID]++
+		digest := digests[c.ImageID]
+		if digest == "" {
+			digest = c.ImageID
+		}
+		ports := []string{}
+		for _, p := range c.Ports {
+			if p.PublicPort == 0 {
+				ports = append(ports, fmt.Sprintf("%d/%s", p.PrivatePort, p.Type))
+				continue
+			}
+			ports = append(ports, fmt.Sprintf("%s:%d->%d/%s", p.IP, p.PublicPort, p.PrivatePort, p.Type))
+		}
+		sort.Strings(ports)
+		inventory.Containers = append(inventory.Containers, InventoryContainer{
+			Name:    summaryName(c),
+			ID:      c.ID,
+			Image:   c.Image,
+			ImageID: c.ImageID,
+			Digest:  digest,
+			Ports:   ports,
+			State:   c.State,
+			Status:  c.Status,
+			Created: time.Unix(c.Created, 0).UTC(),
+			Owner:   c.Labels[ownerLabel],
+			Project: c.Labels[projectLabel],
+		})
+	}
+	sort.Slice(inventory.Containers, func(i, j int) bool { return inventory.Containers[i].Name < inventory.Containers[j].Name })
+
+	for _, img := range images {
+		entry := InventoryImage{
+			ID:         img.ID,
+			Digest:     digests[img.ID],
+			Size:       img.Size,
+			Created:    time.Unix(img.Created, 0).UTC(),
+			Age:        units.HumanDuration(time.Since(time.Unix(img.Created, 0))),
+			Containers: usedBy[img.ID],
+		}
+		tagged := false
+		for _, tag := range img.RepoTags {
+			named, err := reference.ParseNormalizedNamed(tag)
+			if err != nil || tag == "<none>:<none>" {
+				continue
+			}
+			entry.Repository = reference.FamiliarName(named)
+			entry.Tag = ""
+			if t, ok := named.(reference.Tagged); ok {
+				entry.Tag = t.Tag()
+			}
+			inventory.Images = append(inventory.Images, entry)
+			tagged = true
+		}
+		if !tagged {
+			inventory.Images = append(inventory.Images, entry)
+		}
+	}
+	sort.SliceStable(inventory.Images, func(i, j int) bool {
+		a, b := inventory.Images[i], inventory.Images[j]
+		if a.Repository != b.Repository {
+			return a.Repository < b.Repository
+		}
+		return a.Tag < b.Tag
+	})
+	return inventory, nil
+}
+
+// WriteCSV writes one section of the inventory with a header row
+func (inv *Inventory) WriteCSV(w io.Writer, section string) error {
+	out := csv.NewWriter(w)
+	switch section {
+	case inventoryContainers:
+		out.Write([]string{"name", "id", "image", "image_id", "digest", "ports", "state", "status", "created", "owner", "project"})
+		for _, c := range inv.Containers {
+			out.Write([]string{c.Name, c.ID, c.Image, c.ImageID, c.Digest, strings.Join(c.Ports, " "), c.State, c.Status,
+				c.Created.Format(time.RFC3339), c.Owner, c.Project})
+		}
+	case inventoryImages:
+		out.Write([]string{"repository", "tag", "id", "digest", "size", "created", "age", "containers"})
+		for _, img := range inv.Images {
+			out.Write([]string{img.Repository, img.Tag, img.ID, img.Digest, strconv.FormatInt(img.Size, 10),
+				img.Created.Format(time.RFC3339), img.Age, strconv.Itoa(img.Containers)})
+		}
+	default:
+		return fmt.Errorf("unknown inventory section %q", section)
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"gopkg.in/yaml.v3"
+)
+
+// Minimal Kubernetes object shapes, in the field order kubectl prints them.
+// Only what a container's config can fill in is modeled.
+type k8sMeta struct {
+	Name      string            `yaml:"name,omitempty" json:"name,omitempty"`
+	Namespace string            `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Labels    map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+}
+
+type k8sDeployment struct {
+	APIVersion string  `yaml:"apiVersion" json:"apiVersion"`
+	Kind       string  `yaml:"kind" json:"kind"`
+	Metadata   k8sMeta `yaml:"metadata" json:"metadata"`
+	Spec       struct {
+		Replicas int `yaml:"replicas" json:"replicas"`
+		Selector struct {
+			MatchLabels map[string]string `yaml:"matchLabels" json:"matchLabels"`
+		} `yaml:"selector" json:"selector"`
+		Template struct {
+			Metadata k8sMeta `yaml:"metadata" json:"metadata"`
+			Spec     struct {
+				Hostname   string         `yaml:"hostname,omitempty" json:"hostname,omitempty"`
+				Containers []k8sContainer `yaml:"containers" json:"containers"`
+			} `yaml:"spec" json:"spec"`
+		} `yaml:"template" json:"template"`
+	} `yaml:"spec" json:"spec"`
+}
+
+type k8sContainer struct {
+	Name            string              `yaml:"name" json:"name"`
+	Image           string              `yaml:"image" json:"image"`
+	Command         []string            `yaml:"command,omitempty" json:"command,omitempty"`
+	Args            []string            `yaml:"args,omitempty" json:"args,omitempty"`
+	WorkingDir      string              `yaml:"workingDir,omitempty" json:"workingDir,omitempty"`
+	Ports           []k8sContainerPort  `yaml:"ports,omitempty" json:"ports,omitempty"`
+	Env             []k8sEnvVar         `yaml:"env,omitempty" json:"env,omitempty"`
+	Resources       *k8sResources       `yaml:"resources,omitempty" json:"resources,omitempty"`
+	LivenessProbe   *k8sProbe           `yaml:"livenessProbe,omitempty" json:"livenessProbe,omitempty"`
+	ReadinessProbe  *k8sProbe           `yaml:"readinessProbe,omitempty" json:"readinessProbe,omitempty"`
+	SecurityContext *k8sSecurityContext `yaml:"securityContext,omitempty" json:"securityContext,omitempty"`
+	Stdin           bool                `yaml:"stdin,omitempty" json:"stdin,omitempty"`
+	TTY             bool                `yaml:"tty,omitempty" json:"tty,omitempty"`
+}
+
+type k8sContainerPort struct {
+	Name          string `yaml:"name,omitempty" json:"name,omitempty"`
+	ContainerPort int    `yaml:"containerPort" json:"containerPort"`
+	Protocol      string `yaml:"protocol" json:"protocol"`
+}
+
+type k8sEnvVar struct {
+	Name      string        `yaml:"name" json:"name"`
+	Value     string        `yaml:"value,omitempty" json:"value,omitempty"`
+	ValueFrom *k8sEnvSource `yaml:"valueFrom,omitempty" json:"valueFrom,omitempty"`
+}
+
+type k8sEnvSource struct {
+	SecretKeyRef k8sKeyRef `yaml:"secretKeyRef" json:"secretKeyRef"`
+}
+
+type k8sKeyRef struct {
+	Name string `yaml:"name" json:"name"`
+	Key  string `yaml:"key" json:"key"`
+}
+
+type k8sResources struct {
+	Limits   map[string]string `yaml:"limits,omitempty" json:"limits,omitempty"`
+	Requests map[string]string `yaml:"requests,omitempty" json:"requests,omitempty"`
+}
+
+type k8sProbe struct {
+	Exec struct {
+		Command []string `yaml:"command" json:"command"`
+	} `yaml:"exec" json:"exec"`
+	InitialDelaySeconds int `yaml:"initialDelaySeconds,omitempty" json:"initialDelaySeconds,omitempty"`
+	PeriodSeconds       int `yaml:"periodSeconds,omitempty" json:"periodSeconds,omitempty"`
+	TimeoutSeconds      int `yaml:"timeoutSeconds,omitempty" json:"timeoutSeconds,omitempty"`
+	FailureThreshold    int `yaml:"failureThreshold,omitempty" json:"failureThreshold,omitempty"`
+}
+
+type k8sSecurityContext struct {
+	RunAsUser              *int64           `yaml:"runAsUser,omitempty" json:"runAsUser,omitempty"`
+	RunAsGroup             *int64           `yaml:"runAsGroup,omitempty" json:"runAsGroup,omitempty"`
+	Privileged             bool             `yaml:"privileged,omitempty" json:"privileged,omitempty"`
+	Capabilities           *k8sCapabilities `yaml:"capabilities,omitempty" json:"capabilities,omitempty"`
+	ReadOnlyRootFilesystem bool             `yaml:"readOnlyRootFilesystem,omitempty" json:"readOnlyRootFilesystem,omitempty"`
+}
+
+type k8sCapabilities struct {
+	Add  []string `yaml:"add,omitempty" json:"add,omitempty"`
+	Drop []string `yaml:"drop,omitempty" json:"drop,omitempty"`
+}
+
+type k8sService struct {
+	APIVersion string  `yaml:"apiVersion" json:"apiVersion"`
+	Kind       string  `yaml:"kind" json:"kind"`
+	Metadata   k8sMeta `yaml:"metadata" json:"metadata"`
+	Spec       struct {
+		Type     string            `yaml:"type" json:"type"`
+		Selector map[string]string `yaml:"selector" json:"selector"`
+		Ports    []k8sServicePort  `yaml:"ports" json:"ports"`
+	} `yaml:"spec" json:"spec"`
+}
+
+type k8sServicePort struct {
+	Name       string `yaml:"name" json:"name"`
+	Port       int    `yaml:"port" json:"port"`
+	TargetPort int    `yaml:"targetPort" json:"targetPort"`
+	Protocol   string `yaml:"protocol" json:"protocol"`
+}
+
+// K8sManifests is a container converted to Kubernetes objects, with what
+// couldn't be carried over
+type K8sManifests struct {
+	Deployment *k8sDeployment `json:"deployment"`
+	// Only when the container exposes ports
+	Service  *k8sService `json:"service,omitempty"`
+	Warnings []string    `json:"warnings"`
+}
+
+var nonDNSLabel = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// k8sName turns a container name into a DNS-1123 label, as object names
+// must be
+func k8sName(name string) string {
+	name = nonDNSLabel.ReplaceAllString(strings.ToLower(name), "-")
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	if name = strings.Trim(name, "-"); name == "" {
+		name = "app"
+	}
+	return name
+}
+
+// k8sManifests converts a container into a Deployment and, when it exposes
+// ports, a ClusterIP Service. Command, arguments and env vars the image
+// already sets are left out so the manifest keeps following the image.
+// Secret-backed env vars become secretKeyRefs to a Secret of the same name
+// holding the value under "value".
+func k8sManifests(ctx context.Context, cli *client.Client, info container.InspectResponse, namespace string) *K8sManifests {
+	name := k8sName(strings.TrimPrefix(info.Name, "/"))
+	labels := map[string]string{"app": name}
+	result := &K8sManifests{Warnings: []string{}}
+	warn := func(format string, args ...any) {
+		result.Warnings = append(result.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	// What the image sets, nil when it's gone
+	var imageCfg *container.Config
+	if img, err := cli.ImageInspect(ctx, info.Image); err == nil && img.Config != nil {
+		imageCfg = &container.Config{
+			Entrypoint: img.Config.Entrypoint,
+			Cmd:        img.Config.Cmd,
+			Env:        img.Config.Env,
+			WorkingDir: img.Config.WorkingDir,
+		}
+		if h := img.Config.Healthcheck; h != nil {
+			imageCfg.Healthcheck = &container.HealthConfig{Test: h.Test, Interval: h.Interval, Timeout: h.Timeout, StartPeriod: h.StartPeriod, Retries: h.Retries}
+		}
+	}
+	cfg, hc := info.Config, info.HostConfig
+
+	c := k8sContainer{
+		Name:       name,
+		Image:      cfg.Image,
+		WorkingDir: cfg.WorkingDir,
+		Stdin:      cfg.OpenStdin,
+		TTY:        cfg.Tty,
+	}
+	if imageCfg == nil || !slices.Equal(cfg.Entrypoint, imageCfg.Entrypoint) {
+		c.Command = cfg.Entrypoint
+	}
+	if imageCfg == nil || !slices.Equal(cfg.Cmd, imageCfg.Cmd) || c.Command != nil {
+		c.Args = cfg.Cmd
+	}
+	if imageCfg != nil && cfg.WorkingDir == imageCfg.WorkingDir {
+		c.WorkingDir = ""
+	}
+
+	// Ports
+	ports := make([]nat.Port, 0, len(cfg.ExposedPorts))
+	for port := range cfg.ExposedPorts {
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+	service := &k8sService{APIVersion: "v1", Kind: "Service", Metadata: k8sMeta{Name: name, Namespace: namespace, Labels: labels}}
+	service.Spec.Type = "ClusterIP"
+	service.Spec.Selector = labels
+	for _, p := range ports {
+		number, err := strconv.Atoi(p.Port())
+		if err != nil {
+			warn("port range %s is not supported, list its ports one by one", p)
+			continue
+		}
+		proto := strings.ToUpper(p.Proto())
+		portName := p.Proto() + "-" + p.Port()
+		c.Ports = append(c.Ports, k8sContainerPort{Name: portName, ContainerPort: number, Protocol: proto})
+		servicePort := number
+		if bindings := hc.PortBindings[p]; len(bindings) > 0 && bindings[0].HostPort != "" {
+			// Keep the port clients used on the Docker host
+			if hostPort, err := strconv.Atoi(bindings[0].HostPort); err == nil {
+				servicePort = hostPort
+			}
+		}
+		service.Spec.Ports = append(service.Spec.Ports, k8sServicePort{Name: portName, Port: servicePort, TargetPort: number, Protocol: proto})
+	}
+	if len(hc.PortBindings) > 0 {
+		warn("published ports become a ClusterIP Service, use a NodePort or LoadBalancer Service or an Ingress to reach them from outside the cluster")
+	}
+
+	// Env
+	refs := secretRefs(cfg)
+	for _, kv := range cfg.Env {
+		if imageCfg != nil && slices.Contains(imageCfg.Env, kv) {
+			continue
+		}
+		key, value, _ := strings.Cut(kv, "=")
+		env := k8sEnvVar{Name: key, Value: value}
+		if secret, ok := refs[key]; ok {
+			env.Value = ""
+			env.ValueFrom = &k8sEnvSource{SecretKeyRef: k8sKeyRef{Name: k8sName(secret), Key: "value"}}
+			warn("create Secret %s with the value of secret %s: kubectl create secret generic %s --from-literal=value=...", k8sName(secret), secret, k8sName(secret))
+		}
+		c.Env = append(c.Env, env)
+	}
+
+	// Resources
+	resources := &k8sResources{Limits: map[string]string{}, Requests: map[string]string{}}
+	if hc.Memory > 0 {
+		resources.Limits["memory"] = k8sQuantity(hc.Memory)
+	}
+	if hc.MemoryReservation > 0 {
+		resources.Requests["memory"] = k8sQuantity(hc.MemoryReservation)
+	}
+	switch {
+	case hc.NanoCPUs > 0:
+		resources.Limits["cpu"] = strconv.FormatInt(hc.NanoCPUs/1e6, 10) + "m"
+	case hc.CPUQuota > 0 && hc.CPUPeriod > 0:
+		resources.Limits["cpu"] = strconv.FormatInt(hc.CPUQuota*1000/hc.CPUPeriod, 10) + "m"
+	}
+	if hc.CPUShares > 0 {
+		// 1024 shares are one CPU's worth of weight
+		resources.Requests["cpu"] = strconv.FormatInt(hc.CPUShares*1000/1024, 10) + "m"
+	}
+	if len(resources.Limits)+len(resources.Requests) > 0 {
+		c.Resources = resources
+	}
+
+	// Probes
+	if probe, err := k8sProbeFromHealthcheck(cfg.Healthcheck, imageCfg); err != nil {
+		warn("%v", err)
+	} else if probe != nil {
+		c.LivenessProbe = probe
+		readiness := *probe
+		c.ReadinessProbe = &readiness
+	}
+
+	// Security
+	security := &k8sSecurityContext{Privileged: hc.Privileged, ReadOnlyRootFilesystem: hc.ReadonlyRootfs}
+	if cfg.User != "" {
+		user, group, _ := strings.Cut(cfg.User, ":")
+		if uid, err := strconv.ParseInt(user, 10, 64); err == nil {
+			security.RunAsUser = &uid
+		} else {
+			warn("user %q is a name, Kubernetes needs a numeric runAsUser", user)
+		}
+		if gid, err := strconv.ParseInt(group, 10, 64); err == nil {
+			security.RunAsGroup = &gid
+		}
+	}
+	if len(hc.CapAdd)+len(hc.CapDrop) > 0 {
+		security.Capabilities = &k8sCapabilities{Add: trimCapPrefix(hc.CapAdd), Drop: trimCapPrefix(hc.CapDrop)}
+	}
+	if security.RunAsUser != nil || security.RunAsGroup != nil || security.Privileged || security.ReadOnlyRootFilesystem || security.Capabilities != nil {
+		c.SecurityContext = security
+	}
+
+	// What Deployments have no equivalent for
+	for _, m := range info.Mounts {
+		switch m.Type {
+		case "volume":
+			warn("volume %s at %s is not converted, use a PersistentVolumeClaim (and a StatefulSet for one replica with its own data)", m.Name, m.Destination)
+		case "bind":
+			warn("bind mount %s at %s is not converted, use a ConfigMap, Secret or PersistentVolumeClaim", m.Source, m.Destination)
+		default:
+			warn("%s mount at %s is not converted", m.Type, m.Destination)
+		}
+	}
+	if hc.NetworkMode.IsHost() {
+		warn("host networking is not converted, set hostNetwork: true in the pod spec if it is really needed")
+	}
+	if hc.RestartPolicy.Name == container.RestartPolicyDisabled || hc.RestartPolicy.Name == container.RestartPolicyOnFailure {
+		warn("restart policy %q is not converted, Deployments always restart their pods: use a Job for run-to-completion workloads", hc.RestartPolicy.Name)
+	}
+	if len(hc.Devices) > 0 {
+		warn("devices are not converted, they need a device plugin in Kubernetes")
+	}
+	if deps := dependsOn(cfg.Labels); len(deps) > 0 {
+		warn("dependencies on %s are not converted, Kubernetes has no start order: reach them through their Services and retry until they answer", strings.Join(deps, ", "))
+	}
+
+	d := &k8sDeployment{APIVersion: "apps/v1", Kind: "Deployment", Metadata: k8sMeta{Name: name, Namespace: namespace, Labels: labels}}
+	d.Spec.Replicas = 1
+	d.Spec.Selector.MatchLabels = labels
+	d.Spec.Template.Metadata = k8sMeta{Labels: labels}
+	// Docker fills in the container ID, which means nothing in a pod
+	if !strings.HasPrefix(info.ID, cfg.Hostname) {
+		d.Spec.Template.Spec.Hostname = k8sName(cfg.Hostname)
+	}
+	d.Spec.Template.Spec.Containers = []k8sContainer{c}
+	result.Deployment = d
+	if len(service.Spec.Ports) > 0 {
+		result.Service = service
+	}
+	return result
+}
+
+// k8sProbeFromHealthcheck turns a health check, the container's own or the
+// image's, into an exec probe
+func k8sProbeFromHealthcheck(hc *container.HealthConfig, imageCfg *container.Config) (*k8sProbe, error) {
+	if hc == nil && imageCfg != nil {
+		hc = imageCfg.Healthcheck
+	}
+	if hc == nil || len(hc.Test) == 0 {
+		return nil, nil
+	}
+	probe := &k8sProbe{
+		InitialDelaySeconds: seconds(hc.StartPeriod),
+		PeriodSeconds:       seconds(hc.Interval),
+		TimeoutSeconds:      seconds(hc.Timeout),
+		FailureThreshold:    hc.Retries,
+	}
+	switch hc.Test[0] {
+	case "NONE":
+		return nil, nil
+	case "CMD":
+		probe.Exec.Command = hc.Test[1:]
+	case "CMD-SHELL":
+		probe.Exec.Command = []string{"/bin/sh", "-c", strings.Join(hc.Test[1:], " ")}
+	default:
+		return nil, fmt.Errorf("health check %q is not converted", strings.Join(hc.Test, " "))
+	}
+	return probe, nil
+}
+
+func seconds(d time.Duration) int {
+	return int(d.Round(time.Second) / time.Second)
+}
+
+// k8sQuantity formats bytes in the largest binary unit that divides them
+func k8sQuantity(bytes int64) string {
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"Gi", 1 << 30}, {"Mi", 1 << 20}, {"Ki", 1 << 10}} {
+		if bytes%unit.size == 0 {
+			return strconv.FormatInt(bytes/unit.size, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(bytes, 10)
+}
+
+// Docker accepts capabilities with the CAP_ prefix, Kubernetes without
+func trimCapPrefix(caps []string) []string {
+	trimmed := make([]string, len(caps))
+	for i, c := range caps {
+		trimmed[i] = strings.TrimPrefix(strings.ToUpper(c), "CAP_")
+	}
+	return trimmed
+}
+
+// YAML renders the manifests as one multi-document file, the warnings as
+// comments on top
+func (m *K8sManifests) YAML() ([]byte, error) {
+	var buf bytes.Buffer
+	for _, w := range m.Warnings {
+		fmt.Fprintf(&buf, "# WARNING: %s\n", w)
+	}
+	encoder := yaml.NewEncoder(&buf)
+	// Indented like kubectl prints
+	encoder.SetIndent(2)
+	if err := encoder.Encode(m.Deployment); err != nil {
+		return nil, err
+	}
+	if m.Service != nil {
+		if err := encoder.Encode(m.Service); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Default TCP address of the API
+const defaultListenAddr = ":8081"
+
+// How long shutdown waits for requests in flight
+const shutdownTimeout = 10 * time.Second
+
+// listenUnix creates a Unix domain socket with the given permissions,
+// replacing a stale socket file left by a previous run
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		// Refuse to steal the socket of a server that is still running
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// serve runs the API until SIGTERM or SIGINT, or until a listener fails.
+// Under systemd socket activation it uses the passed sockets; otherwise it
+// listens on TCP (LISTEN_ADDR, "off" to disable) and/or a Unix socket
+// (UNIX_SOCKET, permissions from UNIX_SOCKET_MODE, default 0660).
+func serve(handler http.Handler) error {
+	listeners, err := systemdListeners()
+	if err != nil {
+		return err
+	}
+	if len(listeners) > 0 {
+		for _, l := range listeners {
+			fmt.Printf("🔌 Listening on %s (socket activated)\n", l.Addr())
+		}
+	} else {
+		addr := os.Getenv("LISTEN_ADDR")
+		if addr == "" {
+			addr = defaultListenAddr
+		}
+		socketPath := os.Getenv("UNIX_SOCKET")
+		if addr == "off" && socketPath == "" {
+			return errors.New("LISTEN_ADDR is off and UNIX_SOCKET is not set, nothing to listen on")
+		}
+
+		if socketPath != "" {
+			mode := os.FileMode(0o660)
+			if v := os.Getenv("UNIX_SOCKET_MODE"); v != "" {
+				m, err := strconv.ParseUint(v, 8, 32)
+				if err != nil || m > 0o777 {
+					return fmt.Errorf("invalid UNIX_SOCKET_MODE %q, expected octal permissions like 0660", v)
+				}
+				mode = os.FileMode(m)
+			}
+			listener, err := listenUnix(socketPath, mode)
+			if err != nil {
+				return fmt.Errorf("cannot listen on unix socket: %w", err)
+			}
+			defer os.Remove(socketPath)
+			fmt.Printf("🔌 Listening on unix socket %s (mode %04o)\n", socketPath, mode)
+			listeners = append(listeners, listener)
+		}
+		if addr != "off" {
+			listener, err := net.Listen("tcp", addr)
+			if err != nil {
+				for _, l := range listeners {
+					l.Close()
+				}
+				return fmt.Errorf("cannot listen on %s: %w", addr, err)
+			}
+			fmt.Printf("🌐 Listening on %s\n", addr)
+			listeners = append(listeners, listener)
+		}
+	}
+
+	server := &http.Server{Handler: handler}
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) { errs <- server.Serve(l) }(l)
+	}
+	if err := sdNotify("READY=1\nSTATUS=Serving the API"); err != nil {
+		fmt.Printf("⚠️  Error notifying systemd: %v\n", err)
+	}
+	startWatchdog()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(stop)
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-stop:
+		fmt.Printf("🛑 Received %s, shutting down\n", sig)
+	}
+	sdNotify("STOPPING=1")
+	// Requests in flight get a few seconds, streams and terminals are cut
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		server.Close()
+	}
+	return nil
+}
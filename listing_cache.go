@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+)
+
+// Default lifetime of cached container and image lists
+const listingCacheTTL = 2 * time.Second
+
+// cachedList is one cached daemon listing. fetchMu makes concurrent misses
+// wait for a single daemon call; gen detects invalidations during a fetch.
+type cachedList[T any] struct {
+	fetchMu  sync.Mutex
+	mu       sync.Mutex
+	items    []T
+	cachedAt time.Time
+	gen      uint64
+}
+
+func (l *cachedList[T]) invalidate() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.items = nil
+	l.gen++
+}
+
+func (l *cachedList[T]) fresh(ttl time.Duration) ([]T, uint64, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.items != nil && time.Since(l.cachedAt) < ttl {
+		return slices.Clone(l.items), l.gen, true
+	}
+	return nil, l.gen, false
+}
+
+func (l *cachedList[T]) get(ttl time.Duration, fetch func() ([]T, error)) ([]T, error) {
+	if items, _, ok := l.fresh(ttl); ok {
+		return items, nil
+	}
+	l.fetchMu.Lock()
+	defer l.fetchMu.Unlock()
+	// Another request may have loaded it while we waited
+	items, gen, ok := l.fresh(ttl)
+	if ok {
+		return items, nil
+	}
+	items, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Don't cache a list that an event made stale while it was loading
+	if l.gen == gen {
+		l.items = slices.Clone(items)
+		l.cachedAt = time.Now()
+	}
+	return items, nil
+}
+
+// ListingCache keeps the full container list and the image list for a short
+// time so dashboards polling /status don't hit the daemon on every request.
+// Docker events and mutating API requests invalidate it right away, the TTL
+// only bounds staleness while the event stream is down. Set
+// LISTING_CACHE_TTL=0 to disable it.
+type ListingCache struct {
+	ttl        time.Duration
+	containers cachedList[container.Summary]
+	images     cachedList[image.Summary]
+}
+
+func newListingCache() *ListingCache {
+	c := &ListingCache{ttl: listingCacheTTL}
+	if v := os.Getenv("LISTING_CACHE_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl < 0 {
+			fmt.Printf("⚠️  Invalid LISTING_CACHE_TTL %q, using %s\n", v, listingCacheTTL)
+		} else {
+			c.ttl = ttl
+		}
+	}
+	return c
+}
+
+func (c *ListingCache) Enabled() bool {
+	return c.ttl > 0
+}
+
+// Containers lists all containers, stopped ones included
+func (c *ListingCache) Containers(ctx context.Context, cli *client.Client) ([]container.Summary, error) {
+	fetch := func() ([]container.Summary, error) {
+		return cli.ContainerList(ctx, container.ListOptions{All: true})
+	}
+	if !c.Enabled() {
+		return fetch()
+	}
+	return c.containers.get(c.ttl, fetch)
+}
+
+// Images lists top-level images
+func (c *ListingCache) Images(ctx context.Context, cli *client.Client) ([]image.Summary, error) {
+	fetch := func() ([]image.Summary, error) {
+		return cli.ImageList(ctx, image.ListOptions{})
+	}
+	if !c.Enabled() {
+		return fetch()
+	}
+	return c.images.get(c.ttl, fetch)
+}
+
+func (c *ListingCache) Invalidate() {
+	c.containers.invalidate()
+	c.images.invalidate()
+}
+
+// Watch invalidates the cache on container and image events for the life of
+// the server, reconnecting to the daemon when the event stream breaks
+func (c *ListingCache) Watch() {
+	if !c.Enabled() {
+		return
+	}
+	ctx := context.Background()
+	go func() {
+		backoff := time.Second
+		for {
+			connected := time.Now()
+			err := c.watchEvents(ctx)
+			// A long healthy stream resets the backoff
+			if time.Since(connected) > time.Minute {
+				backoff = time.Second
+			}
+			fmt.Printf("⚠️  Docker event stream for the listing cache ended, retrying in %s: %v\n", backoff, err)
+			c.Invalidate()
+			time.Sleep(backoff)
+			backoff = min(backoff*2, time.Minute)
+		}
+	}()
+}
+
+func (c *ListingCache) watchEvents(ctx context.Context) error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	messages, errs := cli.Events(ctx, events.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("type", string(events.ContainerEventType)), filters.Arg("type", string(events.ImageEventType))),
+	})
+	// Anything may have changed while we weren't listening
+	c.Invalidate()
+	for {
+		select {
+		case msg := <-messages:
+			switch msg.Type {
+			case events.ContainerEventType:
+				// Exec, copy and similar events don't change the list
+				if !isListingAction(msg.Action) {
+					continue
+				}
+				c.containers.invalidate()
+				// Image "containers" counts change with the container list
+				if msg.Action == events.ActionCreate || msg.Action == events.ActionDestroy {
+					c.images.invalidate()
+				}
+			case events.ImageEventType:
+				c.images.invalidate()
+				c.containers.invalidate()
+			}
+		case err := <-errs:
+			return err
+		}
+	}
+}
+
+// isListingAction reports whether a container event changes what
+// ContainerList returns
+func isListingAction(action events.Action) bool {
+	switch action {
+	case events.ActionExecCreate, events.ActionExecStart, events.ActionExecDie, events.ActionExecDetach,
+		events.ActionTop, events.ActionResize, events.ActionAttach, events.ActionDetach,
+		events.ActionArchivePath, events.ActionExtractToDir, events.ActionCommit, events.ActionExport, events.ActionCopy:
+		return false
+	}
+	// Health changes show up in Status, e.g. "Up 5 minutes (healthy)"
+	return true
+}
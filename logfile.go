@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	units "github.com/docker/go-units"
+	"github.com/gin-gonic/gin"
+)
+
+// Rotation defaults of the log files
+const (
+	defaultLogMaxSize    = 100 * units.MB
+	defaultLogMaxAge     = 24 * time.Hour
+	defaultLogMaxBackups = 7
+)
+
+// RotatingFile is an append-only file that is renamed with a timestamp and
+// started over once it grows past maxSize or gets older than maxAge. Only
+// the newest maxBackups rotated files are kept.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open appends to the existing file, which keeps its age across restarts
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, info.Size(), info.ModTime()
+	if info.Size() == 0 {
+		f.opened = time.Now()
+	}
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.size > 0 && (f.size+int64(len(p)) > f.maxSize || time.Since(f.opened) > f.maxAge) {
+		if err := f.rotate(); err != nil {
+			fmt.Printf("⚠️  Error rotating %s: %v\n", f.path, err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) rotate() error {
+	f.file.Close()
+	rotated := f.path + "." + time.Now().Format("20060102-150405.000")
+	if err := os.Rename(f.path, rotated); err != nil {
+		// Keep writing to the same file rather than losing entries
+		return fmt.Errorf("%w (%v)", err, f.open())
+	}
+	f.prune()
+	return f.open()
+}
+
+// prune removes the oldest rotated files beyond maxBackups. Timestamps sort
+// by name.
+func (f *RotatingFile) prune() {
+	rotated, err := filepath.Glob(f.path + ".*")
+	if err != nil || len(rotated) <= f.maxBackups {
+		return
+	}
+	sort.Strings(rotated)
+	for _, old := range rotated[:len(rotated)-f.maxBackups] {
+		if err := os.Remove(old); err != nil {
+			fmt.Printf("⚠️  Error removing old log %s: %v\n", old, err)
+		}
+	}
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// FileLogs writes JSON lines to access.log, one per request, and
+// operations.log, one per change and background job, in LOG_DIR
+type FileLogs struct {
+	access     *RotatingFile
+	operations *RotatingFile
+}
+
+// fileLogs is nil unless LOG_DIR is set; its methods do nothing then
+var fileLogs *FileLogs
+
+// openFileLogs opens the log files in LOG_DIR, rotated by LOG_MAX_SIZE and
+// LOG_MAX_AGE, keeping LOG_MAX_BACKUPS old files of each
+func openFileLogs() (*FileLogs, error) {
+	dir := os.Getenv("LOG_DIR")
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	maxSize := int64(defaultLogMaxSize)
+	if v := os.Getenv("LOG_MAX_SIZE"); v != "" {
+		size, err := units.FromHumanSize(v)
+		if err != nil || size <= 0 {
+			fmt.Printf("⚠️  Invalid LOG_MAX_SIZE %q, using %s\n", v, units.HumanSize(float64(maxSize)))
+		} else {
+			maxSize = size
+		}
+	}
+	maxAge := intervalFromEnv("LOG_MAX_AGE", defaultLogMaxAge)
+	maxBackups := defaultLogMaxBackups
+	if v := os.Getenv("LOG_MAX_BACKUPS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fmt.Printf("⚠️  Invalid LOG_MAX_BACKUPS %q, using %d\n", v, maxBackups)
+		} else {
+			maxBackups = n
+		}
+	}
+
+	access, err := openRotatingFile(filepath.Join(dir, "access.log"), maxSize, maxAge, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+	operations, err := openRotatingFile(filepath.Join(dir, "operations.log"), maxSize, maxAge, maxBackups)
+	if err != nil {
+		access.Close()
+		return nil, err
+	}
+	return &FileLogs{access: access, operations: operations}, nil
+}
+
+func writeJSONLine(f *RotatingFile, entry gin.H) {
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		fmt.Printf("⚠️  Error writing %s: %v\n", f.path, err)
+	}
+}
+
+// Operation logs a change or job outcome
+func (l *FileLogs) Operation(entry gin.H) {
+	if l == nil {
+		return
+	}
+	writeJSONLine(l.operations, entry)
+}
+
+// AccessMiddleware logs every request once it has been answered
+func (l *FileLogs) AccessMiddleware() gin.HandlerFunc {
+	if l == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		entry := gin.H{
+			"method":     c.Request.Method,
+			"path":       c.Request.URL.Path,
+			"route":      c.FullPath(),
+			"status":     c.Writer.Status(),
+			"bytes":      max(c.Writer.Size(), 0),
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"ip":         c.ClientIP(),
+			"actor":      c.GetString("actor"),
+			"user_agent": c.Request.UserAgent(),
+		}
+		if query := c.Request.URL.RawQuery; query != "" {
+			entry["query"] = query
+		}
+		if errs := c.Errors.ByType(gin.ErrorTypeAny); len(errs) > 0 {
+			entry["errors"] = strings.Join(errs.Errors(), "; ")
+		}
+		writeJSONLine(l.access, entry)
+	}
+}
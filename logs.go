@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/gin-gonic/gin"
+)
+
+// A followed log stream sends a ping this often so idle connections aren't
+// closed by proxies
+const logPingInterval = 30 * time.Second
+
+// logsOptions builds LogsOptions from the query: ?since and ?until (RFC 3339
+// time, unix timestamp or a duration like 15m relative to now), ?stdout,
+// ?stderr and ?timestamps (default true), ?tail (number of lines or "all")
+func logsOptions(ctx *gin.Context) (container.LogsOptions, error) {
+	options := container.LogsOptions{Tail: ctx.Query("tail")}
+
+	var err error
+	if options.ShowStdout, err = queryBool(ctx, "stdout", true); err != nil {
+		return options, err
+	}
+	if options.ShowStderr, err = queryBool(ctx, "stderr", true); err != nil {
+		return options, err
+	}
+	if options.Timestamps, err = queryBool(ctx, "timestamps", true); err != nil {
+		return options, err
+	}
+	if !options.ShowStdout && !options.ShowStderr {
+		return options, fmt.Errorf("at least one of stdout and stderr must be enabled")
+	}
+
+	if options.Since, err = logTime(ctx.Query("since")); err != nil {
+		return options, fmt.Errorf("invalid since: %v", err)
+	}
+	if options.Until, err = logTime(ctx.Query("until")); err != nil {
+		return options, fmt.Errorf("invalid until: %v", err)
+	}
+	if options.Tail != "" && options.Tail != "all" {
+		if n, err := strconv.Atoi(options.Tail); err != nil || n < 0 {
+			return options, fmt.Errorf("invalid tail: %s", options.Tail)
+		}
+	}
+	return options, nil
+}
+
+func queryBool(ctx *gin.Context, name string, def bool) (bool, error) {
+	value := ctx.Query(name)
+	if value == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %s", name, value)
+	}
+	return b, nil
+}
+
+// logTime normalizes a since/until value to a unix timestamp for the daemon
+func logTime(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return strconv.FormatInt(time.Now().Add(-d).Unix(), 10), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return "", fmt.Errorf("use RFC 3339 (2025-01-02T15:04:05Z), a unix timestamp or a duration like 15m")
+	}
+	return strconv.FormatInt(t.Unix(), 10), nil
+}
+
+// copyLogs writes a container log stream to w, demultiplexing the stdout and
+// stderr frames of non-TTY containers
+func copyLogs(w io.Writer, logs io.Reader, tty bool) error {
+	if tty {
+		_, err := io.Copy(w, logs)
+		return err
+	}
+	_, err := stdcopy.StdCopy(w, w, logs)
+	return err
+}
+
+// LogLine is one line of a container log with the stream it came from
+type LogLine struct {
+	Stream    string `json:"stream"`
+	Timestamp string `json:"timestamp,omitempty"`
+	Text      string `json:"text"`
+}
+
+// logLineCollector splits demultiplexed log frames into lines, keeping the
+// order in which frames of both streams arrived
+type logLineCollector struct {
+	lines      []LogLine
+	partial    map[string]string
+	timestamps bool
+	// Receives each line instead of lines when set
+	emit func(LogLine)
+}
+
+func (c *logLineCollector) writer(stream string) io.Writer {
+	return logStreamWriter{c, stream}
+}
+
+type logStreamWriter struct {
+	c      *logLineCollector
+	stream string
+}
+
+func (w logStreamWriter) Write(p []byte) (int, error) {
+	data := w.c.partial[w.stream] + string(p)
+	for {
+		i := strings.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		w.c.add(w.stream, data[:i])
+		data = data[i+1:]
+	}
+	w.c.partial[w.stream] = data
+	return len(p), nil
+}
+
+func (c *logLineCollector) add(stream, text string) {
+	line := LogLine{Stream: stream, Text: strings.TrimSuffix(text, "\r")}
+	if c.timestamps {
+		if ts, rest, ok := strings.Cut(line.Text, " "); ok {
+			line.Timestamp, line.Text = ts, rest
+		}
+	}
+	if c.emit != nil {
+		c.emit(line)
+		return
+	}
+	c.lines = append(c.lines, line)
+}
+
+// collectLogLines reads a log stream into lines. TTY containers have a single
+// combined stream, reported as stdout.
+func collectLogLines(logs io.Reader, tty, timestamps bool) ([]LogLine, error) {
+	c := &logLineCollector{partial: map[string]string{}, timestamps: timestamps}
+	err := c.read(logs, tty)
+	if c.lines == nil {
+		c.lines = []LogLine{}
+	}
+	return c.lines, err
+}
+
+// streamLogLines reads a followed log stream, calling emit for every line
+// as soon as it's complete
+func streamLogLines(logs io.Reader, tty, timestamps bool, emit func(LogLine)) error {
+	c := &logLineCollector{partial: map[string]string{}, timestamps: timestamps, emit: emit}
+	return c.read(logs, tty)
+}
+
+func (c *logLineCollector) read(logs io.Reader, tty bool) error {
+	var err error
+	if tty {
+		_, err = io.Copy(c.writer("stdout"), logs)
+	} else {
+		_, err = stdcopy.StdCopy(c.writer("stdout"), c.writer("stderr"), logs)
+	}
+	for _, stream := range []string{"stdout", "stderr"} {
+		if rest := c.partial[stream]; rest != "" {
+			c.add(stream, rest)
+		}
+	}
+	return err
+}
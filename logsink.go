@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Syslog priorities used for server output
+const (
+	priorityErr     = 3
+	priorityWarning = 4
+	priorityInfo    = 6
+)
+
+// Socket of journald's native protocol
+const journaldSocket = "/run/systemd/journal/socket"
+
+// logSink receives the server's output line by line
+type logSink interface {
+	Log(priority int, line string) error
+	Close() error
+}
+
+// journaldSink sends entries over the journald native protocol, which keeps
+// the priority and identifier without a syslog daemon in between
+type journaldSink struct {
+	conn       *net.UnixConn
+	identifier string
+}
+
+func openJournald(identifier string) (*journaldSink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journaldSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journaldSink{conn: conn, identifier: identifier}, nil
+}
+
+func (j *journaldSink) Log(priority int, line string) error {
+	// Lines never contain newlines, so the simple KEY=value form is enough
+	_, err := fmt.Fprintf(j.conn, "PRIORITY=%d\nSYSLOG_IDENTIFIER=%s\nMESSAGE=%s\n", priority, j.identifier, line)
+	return err
+}
+
+func (j *journaldSink) Close() error {
+	return j.conn.Close()
+}
+
+// linePriority guesses the priority of an output line from the emoji the
+// server starts errors and warnings with
+func linePriority(line string) int {
+	switch {
+	case strings.HasPrefix(line, "❌"):
+		return priorityErr
+	case strings.HasPrefix(line, "⚠️"):
+		return priorityWarning
+	}
+	return priorityInfo
+}
+
+// logSinks copies stdout and stderr to the sinks chosen by LOG_OUTPUT
+var logSinks struct {
+	writers []*os.File
+	done    sync.WaitGroup
+	sinks   []logSink
+}
+
+// startLogSinks sends the server's output to syslog and/or journald as
+// LOG_OUTPUT lists them (comma-separated "stdout", "syslog", "journald",
+// default "stdout"). Everything prints to os.Stdout, so it is replaced with
+// a pipe whose lines are passed on to the sinks, and to the original stdout
+// when "stdout" is listed too.
+func startLogSinks() {
+	outputs := os.Getenv("LOG_OUTPUT")
+	if outputs == "" {
+		return
+	}
+	identifier := filepath.Base(os.Args[0])
+	console := false
+	for _, output := range strings.Split(outputs, ",") {
+		switch output = strings.TrimSpace(output); output {
+		case "stdout":
+			console = true
+		case "syslog":
+			sink, err := openSyslog(os.Getenv("SYSLOG_ADDR"), identifier)
+			if err != nil {
+				fmt.Printf("⚠️  Cannot connect to syslog, logging to stdout: %v\n", err)
+				console = true
+				continue
+			}
+			logSinks.sinks = append(logSinks.sinks, sink)
+		case "journald":
+			sink, err := openJournald(identifier)
+			if err != nil {
+				fmt.Printf("⚠️  Cannot connect to journald, logging to stdout: %v\n", err)
+				console = true
+				continue
+			}
+			logSinks.sinks = append(logSinks.sinks, sink)
+		default:
+			fmt.Printf("⚠️  Unknown LOG_OUTPUT %q, expected stdout, syslog or journald\n", output)
+			console = true
+		}
+	}
+	if len(logSinks.sinks) == 0 {
+		return
+	}
+
+	os.Stdout = teeToSinks(os.Stdout, console, linePriority)
+	os.Stderr = teeToSinks(os.Stderr, console, func(string) int { return priorityErr })
+	// gin captured the original files when it was loaded
+	gin.DefaultWriter, gin.DefaultErrorWriter = os.Stdout, os.Stderr
+}
+
+// teeToSinks returns a pipe whose lines go to every sink, and to original
+// too when console is set
+func teeToSinks(original *os.File, console bool, priority func(string) int) *os.File {
+	r, w, err := os.Pipe()
+	if err != nil {
+		fmt.Fprintf(original, "⚠️  Cannot redirect output to log sinks: %v\n", err)
+		return original
+	}
+	var copyTo io.Writer = io.Discard
+	if console {
+		copyTo = original
+	}
+	logSinks.writers = append(logSinks.writers, w)
+	logSinks.done.Add(1)
+	go func() {
+		defer logSinks.done.Done()
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			fmt.Fprintln(copyTo, line)
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			for _, sink := range logSinks.sinks {
+				// Nowhere left to report a failing sink
+				sink.Log(priority(line), line)
+			}
+		}
+	}()
+	return w
+}
+
+// flushLogSinks waits until everything printed so far reached the sinks and
+// closes them
+func flushLogSinks() {
+	for _, w := range logSinks.writers {
+		w.Close()
+	}
+	logSinks.done.Wait()
+	for _, sink := range logSinks.sinks {
+		sink.Close()
+	}
+}
+
+// exit flushes the log sinks before leaving, so the reason of a failed
+// start isn't lost
+func exit(code int) {
+	flushLogSinks()
+	os.Exit(code)
+}
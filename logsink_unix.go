@@ -0,0 +1,45 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"log/syslog"
+	"strings"
+)
+
+// syslogSink writes to the local syslog daemon, or a remote one at
+// "udp://host:514" or "tcp://host:514"
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func openSyslog(addr, tag string) (logSink, error) {
+	network, raddr := "", ""
+	if addr != "" {
+		var ok bool
+		network, raddr, ok = strings.Cut(addr, "://")
+		if !ok || (network != "udp" && network != "tcp") {
+			return nil, fmt.Errorf("invalid SYSLOG_ADDR %q, expected udp://host:port or tcp://host:port", addr)
+		}
+	}
+	w, err := syslog.Dial(network, raddr, syslog.LOG_DAEMON|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{w: w}, nil
+}
+
+func (s *syslogSink) Log(priority int, line string) error {
+	switch priority {
+	case priorityErr:
+		return s.w.Err(line)
+	case priorityWarning:
+		return s.w.Warning(line)
+	}
+	return s.w.Info(line)
+}
+
+func (s *syslogSink) Close() error {
+	return s.w.Close()
+}
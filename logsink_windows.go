@@ -0,0 +1,9 @@
+package main
+
+import "errors"
+
+// openSyslog fails: Go has no syslog client on Windows, use the log files
+// of LOG_DIR instead
+func openSyslog(addr, tag string) (logSink, error) {
+	return nil, errors.New("syslog is not supported on Windows")
+}
@@ -10,41 +10,237 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
-	"os/exec"
+	"os"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
+	"github.com/docker/docker/api/types/checkpoint"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
+	units "github.com/docker/go-units"
 	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
 )
 
+// Image /create uses when the request names none
+const defaultImage = "nginx:latest"
+
 type CreateContainerRequest struct {
-	Name  string `json:"name"`
-	Image string `json:"image"`
-	Port  string `json:"port"`
+	Name string `json:"name" form:"name" binding:"omitempty,containername"`
+	// Defaults to defaultImage
+	Image   string `json:"image" form:"image" binding:"omitempty,imageref"`
+	Port    string `json:"port" form:"port"`
+	Project string `json:"project" form:"project"`
+	// Environment variables, applied on top of EnvFile
+	Env map[string]string `json:"env" binding:"dive,keys,envname,endkeys"`
+	// Inline .env file content; may also be uploaded as the env_file form file
+	EnvFile string `json:"env_file"`
+	// Env var name -> secret name, injected from the secrets store
+	Secrets map[string]string `json:"secrets" binding:"dive,keys,envname,endkeys"`
+	// Container path -> managed config name, mounted read-only
+	Configs map[string]string `json:"configs"`
+	// GPUs for the NVIDIA runtime: "all", a count, or "device=0,1"
+	GPUs string `json:"gpus" form:"gpus"`
+	// Host devices as /dev/host[:/dev/container[:rwm]]
+	Devices []string `json:"devices"`
+
+	// Privileged mode, cap_add and devices need ALLOW_PRIVILEGED and an admin caller
+	Privileged bool     `json:"privileged"`
+	CapAdd     []string `json:"cap_add"`
+	CapDrop    []string `json:"cap_drop"`
+	// Read-only root filesystem, with tmpfs mounts (path -> options) for
+	// the paths that need to stay writable
+	ReadOnly bool              `json:"read_only"`
+	Tmpfs    map[string]string `json:"tmpfs"`
+	// Size of /dev/shm, e.g. "1g" (docker defaults to 64m)
+	ShmSize string `json:"shm_size" form:"shm_size" binding:"omitempty,bytesize"`
+	// Graceful shutdown: signal sent on stop and seconds to wait before SIGKILL
+	StopSignal  string `json:"stop_signal"`
+	StopTimeout *int   `json:"stop_timeout" binding:"omitempty,min=0"`
+	ResourceOptions
+	// Name resolution: extra /etc/hosts entries as host:IP (IP may be
+	// host-gateway) and DNS servers, search domains and resolv.conf options
+	ExtraHosts []string `json:"extra_hosts"`
+	DNS        []string `json:"dns"`
+	DNSSearch  []string `json:"dns_search"`
+	DNSOptions []string `json:"dns_options"`
+	// Network to attach to, optionally with a static address. Static IPs
+	// need a user-defined network with a configured subnet.
+	Network     string `json:"network" form:"network"`
+	IPv4Address string `json:"ipv4_address"`
+	IPv6Address string `json:"ipv6_address"`
+	MacAddress  string `json:"mac_address"`
+	Hostname    string `json:"hostname" form:"hostname"`
+	Domainname  string `json:"domainname" form:"domainname"`
+	// User to run as, "user", "uid" or "uid:gid"
+	User    string `json:"user" form:"user"`
+	Workdir string `json:"workdir" form:"workdir"`
+	// Remove the container when it exits, for one-off tasks
+	AutoRemove bool `json:"auto_remove"`
+	// Run an init process as PID 1 to forward signals and reap zombies
+	Init *bool `json:"init"`
+
+	// Keep stdin open for POST /containers/:id/attach; with stdin_once it's
+	// closed after the first attach session ends
+	StdinOpen bool `json:"stdin_open"`
+	StdinOnce bool `json:"stdin_once"`
+
+	// Stop and remove the container after this long, e.g. "2h" or "7d"
+	TTL string `json:"ttl" form:"ttl" binding:"omitempty,ttl"`
+	// Refuse stop and remove without override_protection=true
+	Protected bool `json:"protected"`
+	// Replica group for canary rollouts, see POST /replica-groups/:name/canary
+	ReplicaGroup string `json:"replica_group" form:"replica_group" binding:"omitempty,resourcename"`
+	// Automatic proxy route under PROXY_DOMAIN: subdomain instead of the
+	// name, the container port when several are exposed, or opt out
+	Subdomain string `json:"subdomain" form:"subdomain" binding:"omitempty,subdomain"`
+	ProxyPort int    `json:"proxy_port" form:"proxy_port" binding:"omitempty,min=1,max=65535"`
+	NoProxy   bool   `json:"no_proxy" form:"no_proxy"`
+	// Containers that must be running (and healthy) first when the project
+	// is started with POST /projects/:id/start
+	DependsOn []string `json:"depends_on" binding:"dive,containerref"`
+	// Wait until the container is running or healthy before answering
+	WaitOptions
 }
 
 type ImageRequest struct {
-	Name string `json:"name"`
+	Name string `json:"name" binding:"required"`
 	Tag  string `json:"tag"`
 }
 
 func main() {
+	tui := flag.Bool("tui", false, "show the terminal UI instead of starting the API server")
+	flag.Parse()
+	// The terminal UI draws on stdout itself
+	if !*tui {
+		startLogSinks()
+	}
+
+	store, err := openStore()
+	if err != nil {
+		fmt.Printf("❌ Cannot open application database: %v\n", err)
+		exit(1)
+	}
+	defer store.Close()
+	configStore = store
+
+	registerValidators()
+
+	if *tui {
+		if err := runTUI(store); err != nil {
+			fmt.Printf("❌ Terminal UI error: %v\n", err)
+			exit(1)
+		}
+		return
+	}
+
+	masterKey, err := loadMasterKey()
+	if err != nil {
+		fmt.Printf("❌ Cannot load secrets master key: %v\n", err)
+		exit(1)
+	}
+	secretBox, err := newSecretBox(masterKey)
+	if err != nil {
+		fmt.Printf("❌ Cannot initialize secrets encryption: %v\n", err)
+		exit(1)
+	}
+
+	fileLogs, err = openFileLogs()
+	if err != nil {
+		fmt.Printf("❌ Cannot open log files: %v\n", err)
+		exit(1)
+	}
+
+	registryMirrors, err = loadRegistryMirrors()
+	if err != nil {
+		fmt.Printf("❌ Invalid REGISTRY_MIRRORS: %v\n", err)
+		exit(1)
+	}
+	// Air-gapped hosts: only local images, no pulls or searches
+	offlineMode, _ = strconv.ParseBool(os.Getenv("OFFLINE_MODE"))
+	if offlineMode {
+		fmt.Println("✈️  Offline mode: registry access is disabled")
+	}
+
+	hookList, err := loadHooks()
+	if err != nil {
+		fmt.Printf("❌ Invalid HOOKS_FILE: %v\n", err)
+		exit(1)
+	}
+	containerHooks = newHooks(hookList)
+
+	registryProxy, err := loadRegistryProxy()
+	if err != nil {
+		fmt.Printf("❌ Invalid registry proxy settings: %v\n", err)
+		exit(1)
+	}
+	registryProxy.Install()
+
+	adminKey, err := store.EnsureAdmin()
+	if err != nil {
+		fmt.Printf("⚠️  Error creating admin user: %v\n", err)
+	} else if adminKey != "" {
+		fmt.Printf("🔑 Created admin user, API key (shown only once): %s\n", adminKey)
+	}
+
+	// Policy flag for privileged containers and added capabilities
+	allowPrivileged, _ := strconv.ParseBool(os.Getenv("ALLOW_PRIVILEGED"))
+	// Remove, prune and bulk remove by non-admins wait for an admin's approval
+	requireApproval, _ := strconv.ParseBool(os.Getenv("REQUIRE_APPROVAL"))
+
+	if err := store.SeedTemplates(); err != nil {
+		fmt.Printf("⚠️  Error seeding application templates: %v\n", err)
+	}
+
+	// Background maintenance, each run is recorded in GET /jobs
+	maintenance := newMaintenanceMode()
+	trash := newTrash(store)
+	confirmations := newConfirmations()
+	listings := newListingCache()
+	runtimes := newRuntimeCache()
+	listings.Watch()
+	scheduler := newScheduler(store)
+	scheduler.PauseWhen(maintenance.Enabled)
+	scheduler.Add("image_retention", intervalFromEnv("CLEANUP_INTERVAL", time.Hour), retentionTask(store))
+	scheduler.Add("container_expiry", intervalFromEnv("EXPIRY_INTERVAL", time.Minute), expiryTask())
+	scheduler.Add("trash_purge", intervalFromEnv("EXPIRY_INTERVAL", time.Minute), trash.purgeTask())
+	// Recreating missing containers in the background is opt-in
+	if os.Getenv("RECONCILE_INTERVAL") != "" {
+		scheduler.Add("reconcile", intervalFromEnv("RECONCILE_INTERVAL", 5*time.Minute), reconcileTask(store, secretBox))
+	}
+	heal := newHealEngine(store, secretBox, maintenance.Enabled)
+	heal.Watch()
+	scheduler.Add("image_update_check", intervalFromEnv("IMAGE_UPDATE_INTERVAL", time.Hour), heal.imageUpdateTask())
+	scheduler.Start()
+	proxy := newReverseProxy(store, listings)
+	tunnels := newTunnels()
+	startProxy(proxy)
+	startNetworkSampler()
+
 	r := gin.Default()
 	r.LoadHTMLGlob("templates/*")
 
+	r.Use(fileLogs.AccessMiddleware())
+
 	// Add CORS middleware for better API compatibility
 	r.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
@@ -57,6 +253,67 @@ func main() {
 		c.Next()
 	})
 
+	r.Use(gzipMiddleware())
+	r.Use(bodyLimitMiddleware())
+	r.Use(nameValidationMiddleware())
+
+	r.Use(resolveUser(store))
+
+	// Record every mutating request in the audit log
+	r.Use(func(c *gin.Context) {
+		c.Next()
+		if !isMutating(c) {
+			return
+		}
+		if err := store.RecordAudit(c.GetString("actor"), c.Request.Method+" "+c.FullPath(), c.Request.URL.Path, c.Writer.Status(), c.ClientIP()); err != nil {
+			fmt.Printf("⚠️  Error writing audit log: %v\n", err)
+		}
+		fileLogs.Operation(gin.H{
+			"kind":   "request",
+			"actor":  c.GetString("actor"),
+			"action": c.Request.Method + " " + c.FullPath(),
+			"target": c.Request.URL.Path,
+			"status": c.Writer.Status(),
+			"ip":     c.ClientIP(),
+		})
+	})
+
+	// Drop cached listings after changes so the next /status is accurate even
+	// before the Docker event arrives
+	r.Use(func(c *gin.Context) {
+		c.Next()
+		if isMutating(c) {
+			listings.Invalidate()
+		}
+	})
+
+	r.Use(maintenance.Middleware())
+
+	registerDebugRoutes(r)
+	registerRuntimeRoutes(r, store)
+
+	r.GET("/maintenance", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, maintenance.Status())
+	})
+
+	// Switch maintenance mode; background tasks are paused while it's on
+	r.PUT("/maintenance", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change maintenance mode"})
+			return
+		}
+		var req struct {
+			Enabled bool   `json:"enabled"`
+			Message string `json:"message" binding:"max=500"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+		maintenance.Set(req.Enabled, req.Message, actorName(ctx))
+		fmt.Printf("🔧 Maintenance mode set to %t by %s\n", req.Enabled, actorName(ctx))
+		ctx.JSON(http.StatusOK, maintenance.Status())
+	})
+
 	r.GET("/", func(ctx *gin.Context) {
 		ctx.HTML(http.StatusOK, "index.html", gin.H{
 			"message": "Docker management system",
@@ -65,14 +322,159 @@ func main() {
 
 	r.POST("/create", func(ctx *gin.Context) {
 		var req CreateContainerRequest
-		if err := ctx.ShouldBindJSON(&req); err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format: " + err.Error()})
+		// JSON body, or multipart form with an uploaded .env file
+		bind := ctx.ShouldBindJSON
+		if ctx.ContentType() == "multipart/form-data" {
+			bind = ctx.ShouldBind
+		}
+		if err := bind(&req); err != nil {
+			respondBindError(ctx, err)
+			return
+		}
+		if file, err := ctx.FormFile("env_file"); err == nil {
+			content, err := readEnvUpload(file)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Error reading env file: " + err.Error()})
+				return
+			}
+			req.EnvFile = content
+		} else if content, ok := ctx.GetPostForm("env_file"); ok {
+			req.EnvFile = content
+		}
+		// Host devices give the same raw access to the host as privileged mode
+		if req.Privileged || len(req.CapAdd) > 0 || len(req.Devices) > 0 {
+			if !allowPrivileged {
+				ctx.JSON(http.StatusForbidden, gin.H{
+					"error":      "Privileged containers, cap_add and devices are disabled by policy",
+					"suggestion": "Đặt ALLOW_PRIVILEGED=true khi khởi động server để cho phép",
+				})
+				return
+			}
+			if !isAdmin(ctx) {
+				ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can create privileged containers, add capabilities or map devices"})
+				return
+			}
+		}
+		if err := validateTmpfs(req.Tmpfs); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      "Invalid tmpfs: " + err.Error(),
+				"suggestion": "Ví dụ: {\"/tmp\": \"rw,noexec,size=64m\"}",
+			})
+			return
+		}
+		var shmSize int64
+		if req.ShmSize != "" {
+			shmSize, err = units.RAMInBytes(req.ShmSize)
+			if err != nil || shmSize <= 0 {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error":      "Invalid shm_size: " + req.ShmSize,
+					"suggestion": "Ví dụ: \"256m\", \"1g\"",
+				})
+				return
+			}
+		}
+		if err := req.ResourceOptions.validate(); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for _, entry := range req.ExtraHosts {
+			if err := validateExtraHost(entry); err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error":      err.Error(),
+					"suggestion": "Ví dụ: \"db.local:10.0.0.5\", \"host.docker.internal:host-gateway\"",
+				})
+				return
+			}
+		}
+		for _, server := range req.DNS {
+			if net.ParseIP(server) == nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid DNS server: " + server})
+				return
+			}
+		}
+		if req.Hostname != "" && !validHostname(req.Hostname) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hostname: " + req.Hostname})
+			return
+		}
+		if req.Domainname != "" && !validHostname(req.Domainname) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domainname: " + req.Domainname})
+			return
+		}
+		if req.User != "" && !validUser(req.User) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      "Invalid user: " + req.User,
+				"suggestion": "Dùng tên user, uid hoặc uid:gid, ví dụ \"1000:1000\"",
+			})
+			return
+		}
+		if req.Workdir != "" && !strings.HasPrefix(req.Workdir, "/") {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "workdir must be an absolute path"})
+			return
+		}
+		networkingConfig, err := endpointConfig(req.Network, req.IPv4Address, req.IPv6Address, req.MacAddress)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      err.Error(),
+				"suggestion": "Tạo network với subnet trước: docker network create --subnet 172.30.0.0/24 mynet",
+			})
+			return
+		}
+		var ttl time.Duration
+		if req.TTL != "" {
+			if ttl, err = parseTTL(req.TTL); err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error":      err.Error(),
+					"suggestion": "Ví dụ: \"30m\", \"2h\" hoặc \"7d\"",
+				})
+				return
+			}
+		}
+		if req.StopTimeout != nil && *req.StopTimeout < 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "stop_timeout must not be negative"})
+			return
+		}
+		if req.StopSignal != "" && !validStopSignal(req.StopSignal) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      "Invalid stop_signal: " + req.StopSignal,
+				"suggestion": "Ví dụ: \"SIGTERM\", \"SIGQUIT\", \"SIGINT\" hoặc số hiệu signal như \"15\"",
+			})
+			return
+		}
+		capAdd, err := normalizeCapabilities(req.CapAdd)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cap_add: " + err.Error()})
+			return
+		}
+		capDrop, err := normalizeCapabilities(req.CapDrop)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cap_drop: " + err.Error()})
+			return
+		}
+
+		env, err := buildEnv(req.EnvFile, req.Env)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      err.Error(),
+				"suggestion": "Mỗi dòng phải có dạng KEY=VALUE, dòng bắt đầu bằng # là comment",
+			})
 			return
 		}
 
 		// Log the request for debugging
 		fmt.Printf("Creating container: name=%s, image=%s, port=%s\n", req.Name, req.Image, req.Port)
 
+		if req.Project != "" {
+			project, err := store.GetProject(req.Project)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error":      "Project not found: " + req.Project,
+					"suggestion": "Tạo project trước bằng POST /projects",
+				})
+				return
+			}
+			req.Project = project.Name
+		}
+
 		context := ctx.Request.Context()
 		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 		if err != nil {
@@ -90,9 +492,15 @@ func main() {
 			return
 		}
 
+		memory, _ := req.ResourceOptions.memoryBytes()
+		if err := checkQuotas(context, cli, store, actorName(ctx), req.Project, memory, nil); err != nil {
+			respondQuotaError(ctx, err)
+			return
+		}
+
 		imageName := req.Image
 		if imageName == "" {
-			imageName = "nginx:latest"
+			imageName = defaultImage
 		}
 
 		fmt.Printf("Pulling image: %s\n", imageName)
@@ -119,19 +527,16 @@ func main() {
 			// Only pull if image doesn't exist locally
 			if !imageExists {
 				fmt.Printf("Image %s not found locally, pulling from registry\n", imageName)
-				reader, err := cli.ImagePull(context, imageName, image.PullOptions{})
-				if err != nil {
-					fmt.Printf("Error pulling image: %v\n", err)
-					ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error pulling image: " + err.Error()})
+				if err := checkDiskSpace(context, cli); err != nil {
+					ctx.JSON(http.StatusInsufficientStorage, gin.H{
+						"error":      "Not enough disk space to pull image: " + err.Error(),
+						"suggestion": "Chạy POST /cleanup để giải phóng dung lượng",
+					})
 					return
 				}
-				defer reader.Close()
-
-				// Read the pull output to complete the operation
-				_, err = io.Copy(io.Discard, reader)
-				if err != nil {
-					fmt.Printf("Error reading pull output: %v\n", err)
-					ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading pull output: " + err.Error()})
+				if err := pullImage(context, cli, imageName); err != nil {
+					fmt.Printf("Error pulling image: %v\n", err)
+					ctx.JSON(pullErrorStatus(err), gin.H{"error": "Error pulling image: " + err.Error()})
 					return
 				}
 				fmt.Printf("Successfully pulled image: %s\n", imageName)
@@ -161,12 +566,69 @@ func main() {
 
 		// Configure container
 		containerConfig := &container.Config{
-			Image: imageName,
-			Tty:   true,
+			Image:       imageName,
+			Tty:         true,
+			Env:         env,
+			Labels:      map[string]string{},
+			StopSignal:  req.StopSignal,
+			StopTimeout: req.StopTimeout,
+			Hostname:    req.Hostname,
+			Domainname:  req.Domainname,
+			User:        req.User,
+			WorkingDir:  req.Workdir,
+			OpenStdin:   req.StdinOpen,
+			StdinOnce:   req.StdinOnce,
+		}
+		containerConfig.Labels[ownerLabel] = actorName(ctx)
+		if req.Protected {
+			containerConfig.Labels[protectedLabel] = "true"
+		}
+		if req.Project != "" {
+			containerConfig.Labels[projectLabel] = req.Project
+		}
+		if req.ReplicaGroup != "" {
+			containerConfig.Labels[replicaGroupLabel] = req.ReplicaGroup
+		}
+		if req.NoProxy {
+			containerConfig.Labels[proxyLabel] = "false"
+		}
+		if req.Subdomain != "" {
+			containerConfig.Labels[proxySubdomainLabel] = req.Subdomain
+		}
+		if req.ProxyPort != 0 {
+			containerConfig.Labels[proxyPortLabel] = strconv.Itoa(req.ProxyPort)
+		}
+		if len(req.DependsOn) > 0 {
+			containerConfig.Labels[dependsOnLabel] = strings.Join(req.DependsOn, ",")
+		}
+		var expiresAt time.Time
+		if ttl > 0 {
+			expiresAt = setExpiry(containerConfig, ttl)
+		}
+		if err := injectSecrets(store, secretBox, containerConfig, req.Secrets, actorName(ctx)); err != nil {
+			respondSecretError(ctx, err)
+			return
 		}
 
 		// Configure host (port mapping)
-		hostConfig := &container.HostConfig{}
+		hostConfig := &container.HostConfig{
+			Privileged:     req.Privileged,
+			CapAdd:         capAdd,
+			CapDrop:        capDrop,
+			ReadonlyRootfs: req.ReadOnly,
+			Tmpfs:          req.Tmpfs,
+			ShmSize:        shmSize,
+			ExtraHosts:     req.ExtraHosts,
+			DNS:            req.DNS,
+			DNSSearch:      req.DNSSearch,
+			DNSOptions:     req.DNSOptions,
+			AutoRemove:     req.AutoRemove,
+			Init:           req.Init,
+		}
+		req.ResourceOptions.apply(hostConfig)
+		if req.Network != "" {
+			hostConfig.NetworkMode = container.NetworkMode(req.Network)
+		}
 		actualPortMapping := "none"
 		if req.Port != "" {
 			portParts := strings.Split(req.Port, ":")
@@ -273,9 +735,40 @@ func main() {
 			}
 		}
 
+		gpuRequest, err := parseGPURequest(req.GPUs)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      err.Error(),
+				"suggestion": "Dùng \"all\", số lượng GPU (ví dụ \"2\") hoặc \"device=0,1\"",
+			})
+			return
+		}
+		if gpuRequest != nil {
+			hostConfig.DeviceRequests = append(hostConfig.DeviceRequests, *gpuRequest)
+		}
+		for _, device := range req.Devices {
+			mapping, err := parseDeviceMapping(device)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error":      err.Error(),
+					"suggestion": "Ví dụ: \"/dev/ttyUSB0\", \"/dev/dri:/dev/dri:rw\"",
+				})
+				return
+			}
+			hostConfig.Devices = append(hostConfig.Devices, mapping)
+		}
+
+		if err := attachConfigs(store, containerConfig, req.Configs); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      "Error attaching configs: " + err.Error(),
+				"suggestion": "Kiểm tra tên config trong GET /configs",
+			})
+			return
+		}
+
 		fmt.Printf("Creating container with name: %s\n", containerName)
 
-		resp, err := cli.ContainerCreate(context, containerConfig, hostConfig, nil, nil, containerName)
+		resp, err := createContainer(context, cli, containerConfig, hostConfig, networkingConfig, containerName)
 		if err != nil {
 			fmt.Printf("❌ Error creating container: %v\n", err)
 
@@ -284,7 +777,7 @@ func main() {
 				if strings.Contains(err.Error(), "container name") {
 					containerName = containerName + "-" + strconv.FormatInt(time.Now().UnixNano(), 10)
 					fmt.Printf("🔄 Retrying with unique name: %s\n", containerName)
-					resp, err = cli.ContainerCreate(context, containerConfig, hostConfig, nil, nil, containerName)
+					resp, err = createContainer(context, cli, containerConfig, hostConfig, networkingConfig, containerName)
 				} else if strings.Contains(err.Error(), "bind host port") {
 					// Extract port from error message
 					portFromError := "unknown"
@@ -314,16 +807,28 @@ func main() {
 				}
 			}
 
+			if respondHookError(ctx, err) {
+				return
+			}
 			if err != nil {
 				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating container: " + err.Error()})
 				return
 			}
 		}
 
+		if err := copyConfigs(context, cli, resp.ID, containerConfig.Labels); err != nil {
+			cli.ContainerRemove(context, resp.ID, container.RemoveOptions{Force: true})
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error copying configs: " + err.Error()})
+			return
+		}
+
 		fmt.Printf("✅ Container created with ID: %s, starting...\n", resp.ID)
 
-		if err := cli.ContainerStart(context, resp.ID, container.StartOptions{}); err != nil {
+		if err := startContainer(context, cli, resp.ID, container.StartOptions{}); err != nil {
 			fmt.Printf("❌ Error starting container: %v\n", err)
+			if respondHookError(ctx, err) {
+				return
+			}
 
 			// Parse error for more specific information
 			errorDetails := err.Error()
@@ -363,6 +868,26 @@ func main() {
 				return
 			}
 
+			if strings.Contains(errorDetails, "error gathering device information") {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error":        "Device không tồn tại trên Docker host",
+					"details":      errorDetails,
+					"container_id": resp.ID,
+					"suggestion":   "Kiểm tra device bằng ls -l /dev trên Docker host",
+				})
+				return
+			}
+
+			if strings.Contains(errorDetails, "could not select device driver") {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error":        "Docker host không hỗ trợ GPU",
+					"details":      errorDetails,
+					"container_id": resp.ID,
+					"suggestion":   "Cài NVIDIA driver và nvidia-container-toolkit trên Docker host, sau đó restart Docker",
+				})
+				return
+			}
+
 			// Generic error for other cases
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"error":        "Lỗi khởi động container",
@@ -375,6 +900,10 @@ func main() {
 
 		fmt.Printf("🎉 Container %s started successfully on port %s\n", containerName, actualPortMapping)
 
+		if _, err := recordDeployment(context, cli, store, resp.ID, "create", actorName(ctx)); err != nil {
+			fmt.Printf("⚠️  Error recording deployment history: %v\n", err)
+		}
+
 		// Return detailed response
 		response := gin.H{
 			"message": "Container created and started successfully! 🎉",
@@ -384,12 +913,19 @@ func main() {
 			"port":    actualPortMapping,
 		}
 
+		if !expiresAt.IsZero() {
+			response["expires_at"] = expiresAt
+		}
+		if url := proxyURL(containerName, containerConfig.Labels); url != "" {
+			response["url"] = url
+		}
+
 		if actualPortMapping != req.Port && req.Port != "" {
 			response["note"] = fmt.Sprintf("⚠️ Port was automatically changed from %s to %s due to conflict", req.Port, actualPortMapping)
 			response["original_port"] = req.Port
 		}
 
-		ctx.JSON(http.StatusOK, response)
+		respondAfterWait(ctx, store, cli, resp.ID, req.WaitOptions, response)
 	})
 
 	r.GET("/status", func(ctx *gin.Context) {
@@ -409,18 +945,103 @@ func main() {
 		}
 
 		// Get ALL containers (running and stopped) by setting All: true
-		containers, err := cli.ContainerList(context, container.ListOptions{All: true})
+		containers, err := listings.Containers(context, cli)
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing containers: " + err.Error()})
 			return
 		}
 
 		if len(containers) == 0 {
-			ctx.JSON(http.StatusOK, gin.H{"message": "No containers found", "containers": []interface{}{}})
+			jsonWithETag(ctx, gin.H{"message": "No containers found", "containers": []interface{}{}})
+			return
+		}
+
+		annotations, err := store.ListAnnotations("container")
+		if err != nil {
+			fmt.Printf("⚠️  Error loading container annotations: %v\n", err)
+		}
+
+		favorites, err := store.FavoritesByResource(actorName(ctx), "container")
+		if err != nil {
+			fmt.Printf("⚠️  Error loading favorites: %v\n", err)
+		}
+
+		// Trashed containers are listed by GET /trash instead
+		trashed, err := store.ListTrashed()
+		if err != nil {
+			fmt.Printf("⚠️  Error loading trash: %v\n", err)
+		}
+		inTrash := map[string]bool{}
+		for _, t := range trashed {
+			inTrash[t.ContainerID] = true
+		}
+
+		protected, err := store.ProtectedNames()
+		if err != nil {
+			fmt.Printf("⚠️  Error loading protected containers: %v\n", err)
+		}
+
+		containerRuntimes := runtimes.Runtimes(context, cli, containers)
+
+		result := make([]ContainerWithMeta, 0, len(containers))
+		for _, c := range containers {
+			if inTrash[c.ID] {
+				continue
+			}
+			item := ContainerWithMeta{Summary: c, Runtime: containerRuntimes[c.ID]}
+			if len(c.Names) > 0 {
+				name := strings.TrimPrefix(c.Names[0], "/")
+				if a, ok := annotations[name]; ok {
+					item.Notes = a.Notes
+					item.Annotations = a.Annotations
+				}
+				if f, ok := favorites[name]; ok {
+					item.Favorite = true
+					item.Pinned = f.Pinned
+				}
+				labelProtected, _ := strconv.ParseBool(c.Labels[protectedLabel])
+				item.Protected = protected[name] || labelProtected
+			}
+			result = append(result, item)
+		}
+
+		// Pinned first, then favorites, otherwise keep Docker's order
+		sort.SliceStable(result, func(i, j int) bool {
+			return favoriteRank(result[i].Favorite, result[i].Pinned) > favoriteRank(result[j].Favorite, result[j].Pinned)
+		})
+
+		jsonWithETag(ctx, result)
+	})
+
+	// Add container inspect endpoint
+	r.GET("/inspect/:id", func(ctx *gin.Context) {
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		info, err := cli.ContainerInspect(context, ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + ctx.Param("id")})
 			return
 		}
 
-		ctx.JSON(http.StatusOK, containers)
+		annotation, err := store.GetAnnotation("container", strings.TrimPrefix(info.Name, "/"))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading annotations: " + err.Error()})
+			return
+		}
+		redactSecretEnv(info.Config)
+
+		ctx.JSON(http.StatusOK, struct {
+			container.InspectResponse
+			Notes       string            `json:"Notes"`
+			Annotations map[string]string `json:"Annotations"`
+			Runtime     *ContainerRuntime `json:"Runtime"`
+		}{info, annotation.Notes, annotation.Annotations, containerRuntime(info)})
 	})
 
 	r.GET("/stop/:id", func(ctx *gin.Context) {
@@ -441,6 +1062,17 @@ func main() {
 
 		containerID := ctx.Param("id")
 
+		// Optional ?timeout=<seconds> overrides the container's stop timeout
+		stopOptions := container.StopOptions{}
+		if t := ctx.Query("timeout"); t != "" {
+			timeout, err := strconv.Atoi(t)
+			if err != nil || timeout < 0 {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timeout: " + t})
+				return
+			}
+			stopOptions.Timeout = &timeout
+		}
+
 		// Try to find container by name or ID
 		containers, err := cli.ContainerList(context, container.ListOptions{All: true})
 		if err != nil {
@@ -467,7 +1099,14 @@ func main() {
 			return
 		}
 
-		if err := cli.ContainerStop(context, targetContainer, container.StopOptions{}); err != nil {
+		if !allowUnprotected(ctx, cli, store, targetContainer) {
+			return
+		}
+
+		if err := stopContainer(context, cli, targetContainer, stopOptions); err != nil {
+			if respondHookError(ctx, err) {
+				return
+			}
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error stopping container: " + err.Error()})
 			return
 		}
@@ -476,6 +1115,11 @@ func main() {
 
 	r.GET("/start/:id", func(ctx *gin.Context) {
 		context := ctx.Request.Context()
+		var wait WaitOptions
+		if err := ctx.ShouldBindQuery(&wait); err != nil {
+			respondBindError(ctx, err)
+			return
+		}
 		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
@@ -544,8 +1188,11 @@ func main() {
 		}
 
 		// Start the container
-		if err := cli.ContainerStart(context, targetContainer, container.StartOptions{}); err != nil {
+		if err := startContainer(context, cli, targetContainer, container.StartOptions{}); err != nil {
 			fmt.Printf("Error starting container: %v\n", err)
+			if respondHookError(ctx, err) {
+				return
+			}
 
 			// Handle specific errors
 			errorDetails := err.Error()
@@ -584,7 +1231,7 @@ func main() {
 		}
 
 		fmt.Printf("✅ Container %s started successfully\n", targetContainerName)
-		ctx.JSON(http.StatusOK, gin.H{
+		respondAfterWait(ctx, store, cli, targetContainer, wait, gin.H{
 			"message":        fmt.Sprintf("🚀 Container '%s' started successfully!", targetContainerName),
 			"container_id":   targetContainer[:12],
 			"container_name": targetContainerName,
@@ -635,95 +1282,185 @@ func main() {
 			return
 		}
 
-		if err := cli.ContainerRemove(context, targetContainer, container.RemoveOptions{Force: true}); err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing container: " + err.Error()})
+		if !allowUnprotected(ctx, cli, store, targetContainer) {
 			return
 		}
-		ctx.JSON(http.StatusOK, gin.H{"message": "Container " + containerID + " removed successfully"})
-	})
 
-	// Add image management endpoints
-	r.GET("/images", func(ctx *gin.Context) {
-		context := ctx.Request.Context()
-		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		// Force-removing a running container needs a confirmation token
+		info, err := cli.ContainerInspect(context, targetContainer)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error inspecting container: " + err.Error()})
+			return
+		}
+		if info.State != nil && info.State.Running && !confirmations.Confirmed(ctx, "remove", info.ID, containerImpact(info)) {
 			return
 		}
-		defer cli.Close()
 
-		_, err = cli.Ping(context)
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Docker daemon is not accessible: " + err.Error()})
+		if requireApproval && !isAdmin(ctx) {
+			requestApproval(ctx, store, approvalRemove, []string{targetContainer})
 			return
 		}
 
-		images, err := cli.ImageList(context, image.ListOptions{})
+		permanent, _ := strconv.ParseBool(ctx.Query("permanent"))
+		trashed, err := trash.Remove(context, cli, targetContainer, actorName(ctx), permanent)
+		if respondHookError(ctx, err) {
+			return
+		}
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing images: " + err.Error()})
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing container: " + err.Error()})
 			return
 		}
-
-		if len(images) == 0 {
-			ctx.JSON(http.StatusOK, gin.H{"message": "No images found", "images": []interface{}{}})
+		if trashed {
+			ctx.JSON(http.StatusOK, gin.H{
+				"message":    "Container " + containerID + " moved to trash",
+				"trashed":    true,
+				"suggestion": "Khôi phục qua POST /trash/" + containerID + "/restore trước khi hết thời gian lưu",
+			})
 			return
 		}
-
-		ctx.JSON(http.StatusOK, images)
+		ctx.JSON(http.StatusOK, gin.H{"message": "Container " + containerID + " removed successfully"})
 	})
 
-	r.POST("/images/pull", func(ctx *gin.Context) {
-		var req ImageRequest
-		if err := ctx.ShouldBindJSON(&req); err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format: " + err.Error()})
+	// Add deployment history endpoints
+	r.GET("/containers/:id/size", func(ctx *gin.Context) {
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		size, err := containerSize(ctx.Request.Context(), cli, ctx.Param("id"))
+		if err != nil {
+			if client.IsErrNotFound(err) {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + ctx.Param("id")})
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error computing container size: " + err.Error()})
 			return
 		}
+		ctx.JSON(http.StatusOK, size)
+	})
 
+	r.GET("/containers/:id/network", func(ctx *gin.Context) {
 		context := ctx.Request.Context()
 		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
 			return
 		}
 		defer cli.Close()
 
-		_, err = cli.Ping(context)
+		info, err := cli.ContainerInspect(context, ctx.Param("id"))
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Docker daemon is not accessible: " + err.Error()})
+			if client.IsErrNotFound(err) {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + ctx.Param("id")})
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error inspecting container: " + err.Error()})
 			return
 		}
-
-		imageName := req.Name
-		if req.Tag != "" {
-			imageName = req.Name + ":" + req.Tag
+		if info.State == nil || !info.State.Running {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":      "Container is not running: " + ctx.Param("id"),
+				"suggestion": "Chỉ container đang chạy mới có thống kê mạng",
+			})
+			return
 		}
 
-		if imageName == "" {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Image name is required"})
+		// Reading the stats adds a sample, so the rate covers up to now
+		usage, err := containerUsage(context, cli, info.ID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading container stats: " + err.Error()})
+			return
+		}
+		response := gin.H{
+			"container":  strings.TrimPrefix(info.Name, "/"),
+			"counters":   usage.Network,
+			"interfaces": usage.Interfaces,
+			"rate":       nil,
+			"history":    networkHistory.Deltas(info.ID),
+		}
+		if latest, ok := networkHistory.Latest(info.ID); ok {
+			response["rate"] = latest
+		}
+		ctx.JSON(http.StatusOK, response)
+	})
+
+	// Deployment and Service manifests for moving a container to Kubernetes
+	r.GET("/containers/:id/k8s", func(ctx *gin.Context) {
+		var query struct {
+			Format    string `json:"format" form:"format" binding:"omitempty,oneof=yaml json"`
+			Namespace string `json:"namespace" form:"namespace" binding:"omitempty,max=63"`
+		}
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			respondBindError(ctx, err)
+			return
+		}
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		info, err := cli.ContainerInspect(context, ctx.Param("id"))
+		if err != nil {
+			if client.IsErrNotFound(err) {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + ctx.Param("id")})
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error inspecting container: " + err.Error()})
 			return
 		}
 
-		reader, err := cli.ImagePull(context, imageName, image.PullOptions{})
+		manifests := k8sManifests(context, cli, info, query.Namespace)
+		if query.Format == "json" {
+			ctx.JSON(http.StatusOK, manifests)
+			return
+		}
+		data, err := manifests.YAML()
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error pulling image: " + err.Error()})
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error encoding manifests: " + err.Error()})
 			return
 		}
-		defer reader.Close()
+		ctx.Data(http.StatusOK, "application/yaml", data)
+	})
+
+	r.GET("/containers/:id/history", func(ctx *gin.Context) {
+		containerName := strings.TrimPrefix(ctx.Param("id"), "/")
+
+		// Resolve IDs to names, history outlives container IDs
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err == nil {
+			defer cli.Close()
+			if info, err := cli.ContainerInspect(ctx.Request.Context(), containerName); err == nil {
+				containerName = strings.TrimPrefix(info.Name, "/")
+			}
+		}
 
-		// Read the pull output (optional - for logging)
-		_, err = io.Copy(io.Discard, reader)
+		history, err := store.ListDeployments(containerName)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading pull output: " + err.Error()})
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading deployment history: " + err.Error()})
 			return
 		}
 
 		ctx.JSON(http.StatusOK, gin.H{
-			"message": "Image pulled successfully",
-			"image":   imageName,
+			"container": containerName,
+			"history":   history,
 		})
 	})
 
-	r.DELETE("/images/:id", func(ctx *gin.Context) {
+	r.POST("/containers/:id/redeploy", func(ctx *gin.Context) {
+		var req struct {
+			Image string `json:"image" binding:"omitempty,imageref"`
+			Pull  *bool  `json:"pull"`
+		}
+		if !bindOptionalJSON(ctx, &req) {
+			return
+		}
+
 		context := ctx.Request.Context()
 		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 		if err != nil {
@@ -732,85 +1469,84 @@ func main() {
 		}
 		defer cli.Close()
 
-		_, err = cli.Ping(context)
+		info, err := cli.ContainerInspect(context, ctx.Param("id"))
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Docker daemon is not accessible: " + err.Error()})
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + ctx.Param("id")})
 			return
 		}
 
-		imageID := ctx.Param("id")
-
-		// Try to remove the image directly first (handles full image names like nginx:latest)
-		_, err = cli.ImageRemove(context, imageID, image.RemoveOptions{Force: true})
-		if err == nil {
-			ctx.JSON(http.StatusOK, gin.H{"message": "Image " + imageID + " removed successfully"})
-			return
+		spec := specFromInspect(info)
+		if req.Image != "" {
+			spec.Config.Image = req.Image
 		}
-
-		// If direct removal fails, try to find image by ID or tag
-		images, err := cli.ImageList(context, image.ListOptions{})
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing images: " + err.Error()})
+		// Pick up rotated secret values
+		if err := resolveSecretEnv(store, secretBox, spec.Config); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error resolving secrets: " + err.Error()})
 			return
 		}
 
-		var targetImage string
-		for _, img := range images {
-			// Check full ID match
-			if img.ID == imageID || img.ID == "sha256:"+imageID {
-				targetImage = img.ID
-				break
-			}
-			// Check truncated ID match
-			if strings.HasPrefix(img.ID, "sha256:"+imageID) || strings.HasPrefix(img.ID, imageID) {
-				targetImage = img.ID
-				break
-			}
-			// Check RepoTags
-			for _, tag := range img.RepoTags {
-				if tag == imageID {
-					targetImage = img.ID
-					break
-				}
-				// Also check if imageID matches repository part
-				if strings.Contains(tag, imageID) {
-					targetImage = img.ID
-					break
-				}
+		// Pull by default so redeploying a tag picks up its latest version
+		if req.Pull == nil || *req.Pull {
+			if err := checkDiskSpace(context, cli); err != nil {
+				ctx.JSON(http.StatusInsufficientStorage, gin.H{
+					"error":      "Not enough disk space to pull image: " + err.Error(),
+					"suggestion": "Chạy POST /cleanup để giải phóng dung lượng",
+				})
+				return
 			}
-			if targetImage != "" {
-				break
+			if err := pullImage(context, cli, spec.Config.Image); err != nil {
+				ctx.JSON(pullErrorStatus(err), gin.H{"error": "Error pulling image: " + err.Error()})
+				return
 			}
 		}
 
-		if targetImage == "" {
-			// List available images for debugging
-			var availableImages []string
-			for _, img := range images {
-				for _, tag := range img.RepoTags {
-					availableImages = append(availableImages, tag)
-				}
-				availableImages = append(availableImages, img.ID[:12])
+		newContainerID, err := recreateContainer(context, cli, info.ID, spec, true)
+		if err != nil {
+			if !errors.Is(err, errNotRestored) && respondHookError(ctx, err) {
+				return
 			}
-			ctx.JSON(http.StatusNotFound, gin.H{
-				"error":            "Image not found: " + imageID,
-				"available_images": availableImages,
-				"suggestion":       "Try using the exact image name from the list or the image ID",
+			suggestion := "Container cũ đã được khôi phục, kiểm tra image và cấu hình rồi thử lại"
+			if errors.Is(err, errNotRestored) {
+				suggestion = "Không khôi phục được container cũ, kiểm tra GET /status và đổi tên/khởi động lại nó thủ công"
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error":      "Error redeploying container: " + err.Error(),
+				"suggestion": suggestion,
 			})
 			return
 		}
 
-		_, err = cli.ImageRemove(context, targetImage, image.RemoveOptions{Force: true})
+		deployment, err := recordDeployment(context, cli, store, newContainerID, "redeploy", actorName(ctx))
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing image: " + err.Error()})
-			return
+			fmt.Printf("⚠️  Error recording deployment history: %v\n", err)
 		}
 
-		ctx.JSON(http.StatusOK, gin.H{"message": "Image " + imageID + " removed successfully"})
+		fmt.Printf("🔄 Container %s redeployed with image %s\n", strings.TrimPrefix(info.Name, "/"), spec.Config.Image)
+		ctx.JSON(http.StatusOK, gin.H{
+			"message":    "Container redeployed successfully",
+			"id":         newContainerID,
+			"name":       strings.TrimPrefix(info.Name, "/"),
+			"image":      spec.Config.Image,
+			"deployment": deployment,
+		})
 	})
 
-	// Add image search endpoint
-	r.GET("/images/search/:term", func(ctx *gin.Context) {
+	// Definitions of all managed containers as one JSON or YAML bundle
+	r.GET("/containers/export", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can export container definitions"})
+			return
+		}
+		var query struct {
+			Format string `json:"format" form:"format" binding:"omitempty,oneof=json yaml"`
+			// Include containers not created through this API
+			All bool `json:"all" form:"all"`
+		}
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			respondBindError(ctx, err)
+			return
+		}
+
 		context := ctx.Request.Context()
 		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 		if err != nil {
@@ -819,35 +1555,50 @@ func main() {
 		}
 		defer cli.Close()
 
-		_, err = cli.Ping(context)
+		bundle, err := exportBundle(context, cli, query.All, actorName(ctx))
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Docker daemon is not accessible: " + err.Error()})
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error exporting containers: " + err.Error()})
 			return
 		}
-
-		searchTerm := ctx.Param("term")
-		if searchTerm == "" {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Search term is required"})
+		filename := "containers-" + bundle.ExportedAt.Format("20060102-150405")
+		if query.Format == "yaml" {
+			data, err := marshalBundleYAML(bundle)
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error encoding bundle: " + err.Error()})
+				return
+			}
+			ctx.Header("Content-Disposition", `attachment; filename="`+filename+`.yaml"`)
+			ctx.Data(http.StatusOK, "application/yaml", data)
 			return
 		}
+		ctx.Header("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		ctx.JSON(http.StatusOK, bundle)
+	})
 
-		// Search for images on Docker Hub
-		searchResults, err := cli.ImageSearch(context, searchTerm, registry.SearchOptions{Limit: 25})
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error searching images: " + err.Error()})
+	// Inventory of containers and images for asset tracking, as a JSON or
+	// CSV download
+	r.GET("/reports/inventory", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can export the inventory"})
 			return
 		}
-
-		if len(searchResults) == 0 {
-			ctx.JSON(http.StatusOK, gin.H{"message": "No images found", "results": []interface{}{}})
+		var query struct {
+			Format string `json:"format" form:"format" binding:"omitempty,oneof=json csv"`
+			// One section only; a CSV holds one section
+			Type string `json:"type" form:"type" binding:"omitempty,oneof=containers images"`
+		}
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			respondBindError(ctx, err)
+			return
+		}
+		if query.Format == "csv" && query.Type == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      "type is required for CSV reports",
+				"suggestion": "Thêm ?type=containers hoặc ?type=images, hoặc dùng ?format=json để lấy cả hai",
+			})
 			return
 		}
 
-		ctx.JSON(http.StatusOK, gin.H{"results": searchResults})
-	})
-
-	// Add system statistics endpoint with system info
-	r.GET("/stats", func(ctx *gin.Context) {
 		context := ctx.Request.Context()
 		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 		if err != nil {
@@ -856,252 +1607,4325 @@ func main() {
 		}
 		defer cli.Close()
 
-		_, err = cli.Ping(context)
+		inventory, err := buildInventory(context, cli)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Docker daemon is not accessible: " + err.Error()})
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error building inventory: " + err.Error()})
 			return
 		}
-
-		// Get containers
-		containers, err := cli.ContainerList(context, container.ListOptions{All: true})
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing containers: " + err.Error()})
+		filename := "inventory-" + inventory.GeneratedAt.Format("20060102-150405")
+		if query.Type != "" {
+			filename = "inventory-" + query.Type + "-" + inventory.GeneratedAt.Format("20060102-150405")
+		}
+		if query.Format == "csv" {
+			ctx.Header("Content-Disposition", `attachment; filename="`+filename+`.csv"`)
+			ctx.Header("Content-Type", "text/csv; charset=utf-8")
+			ctx.Status(http.StatusOK)
+			if err := inventory.WriteCSV(ctx.Writer, query.Type); err != nil {
+				fmt.Printf("⚠️  Error writing inventory: %v\n", err)
+			}
 			return
 		}
+		ctx.Header("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		switch query.Type {
+		case inventoryContainers:
+			ctx.JSON(http.StatusOK, gin.H{"generated_at": inventory.GeneratedAt, "containers": inventory.Containers})
+		case inventoryImages:
+			ctx.JSON(http.StatusOK, gin.H{"generated_at": inventory.GeneratedAt, "images": inventory.Images})
+		default:
+			ctx.JSON(http.StatusOK, inventory)
+		}
+	})
 
-		// Get images
-		images, err := cli.ImageList(context, image.ListOptions{})
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing images: " + err.Error()})
+	// Create the containers of an exported bundle on this host
+	r.POST("/containers/import", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can import container definitions"})
 			return
 		}
-
-		// Get system info
-		var memStats runtime.MemStats
-		runtime.ReadMemStats(&memStats)
-
-		// Get disk usage
-		var diskStats syscall.Statfs_t
-		syscall.Statfs("/", &diskStats)
-		diskTotal := diskStats.Blocks * uint64(diskStats.Bsize)
-		diskFree := diskStats.Bavail * uint64(diskStats.Bsize)
-		diskUsed := diskTotal - diskFree
-
-		// Get CPU count
-		cpuCount := runtime.NumCPU()
-
-		// Calculate statistics
-		stats := gin.H{
-			"containers": gin.H{
-				"total":   len(containers),
-				"running": 0,
-				"stopped": 0,
-				"paused":  0,
-			},
-			"images": gin.H{
-				"total": len(images),
-			},
-			"system": gin.H{
-				"timestamp": time.Now(),
-				"memory": gin.H{
-					"total":   memStats.Sys,
-					"used":    memStats.Alloc,
-					"free":    memStats.Sys - memStats.Alloc,
-					"percent": float64(memStats.Alloc) / float64(memStats.Sys) * 100,
-				},
-				"disk": gin.H{
-					"total":   diskTotal,
-					"used":    diskUsed,
-					"free":    diskFree,
-					"percent": float64(diskUsed) / float64(diskTotal) * 100,
-				},
-				"cpu": gin.H{
-					"cores": cpuCount,
-				},
-			},
+		var opts ImportOptions
+		if err := ctx.ShouldBindQuery(&opts); err != nil {
+			respondBindError(ctx, err)
+			return
 		}
-
-		// Count container states
-		for _, c := range containers {
-			switch c.State {
-			case "running":
-				stats["containers"].(gin.H)["running"] = stats["containers"].(gin.H)["running"].(int) + 1
-			case "exited", "created":
-				stats["containers"].(gin.H)["stopped"] = stats["containers"].(gin.H)["stopped"].(int) + 1
-			case "paused":
-				stats["containers"].(gin.H)["paused"] = stats["containers"].(gin.H)["paused"].(int) + 1
-			}
+		data, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			respondBindError(ctx, err)
+			return
+		}
+		isYAML := strings.Contains(ctx.ContentType(), "yaml")
+		bundle, err := parseBundle(data, isYAML)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      "Invalid bundle: " + err.Error(),
+				"suggestion": "Dùng file từ GET /containers/export, gửi YAML với Content-Type: application/yaml",
+			})
+			return
 		}
 
-		ctx.JSON(http.StatusOK, stats)
-	})
-
-	// Add container logs endpoint
-	r.GET("/logs/:id", func(ctx *gin.Context) {
 		context := ctx.Request.Context()
 		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
 			return
 		}
 		defer cli.Close()
 
-		containerID := ctx.Param("id")
-		tailLines := ctx.DefaultQuery("tail", "100")
-
-		logs, err := cli.ContainerLogs(context, containerID, container.LogsOptions{
-			ShowStdout: true,
-			ShowStderr: true,
-			Tail:       tailLines,
-			Timestamps: true,
-		})
+		results, err := importBundle(context, cli, store, secretBox, bundle, opts)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting logs: " + err.Error()})
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":      "Import stopped: " + err.Error(),
+				"results":    results,
+				"suggestion": "Các container đã tạo vẫn được giữ lại; dùng ?skip_existing=true để tiếp tục",
+			})
 			return
 		}
-		defer logs.Close()
+		fmt.Printf("📦 Imported %d containers from %s by %s\n", len(bundle.Containers), bundle.Host, actorName(ctx))
+		ctx.JSON(http.StatusOK, gin.H{
+			"message": "Bundle imported",
+			"source":  bundle.Host,
+			"results": results,
+		})
+	})
 
-		logContent, err := io.ReadAll(logs)
+	// Desired state: containers the reconciler recreates when they're gone
+	r.GET("/desired-state", func(ctx *gin.Context) {
+		desired, err := store.ListDesired()
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading logs: " + err.Error()})
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading desired state: " + err.Error()})
 			return
 		}
-
-		ctx.JSON(http.StatusOK, gin.H{
-			"logs":      string(logContent),
-			"container": containerID,
-		})
+		ctx.JSON(http.StatusOK, gin.H{"containers": desired, "count": len(desired)})
 	})
 
-	// Add container exec endpoint
-	r.POST("/exec/:id", func(ctx *gin.Context) {
+	// Record the current definition of containers as their desired state
+	r.POST("/desired-state", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change the desired state"})
+			return
+		}
 		var req struct {
-			Command string `json:"command"`
+			// Defaults to every container created through the API
+			Containers []string `json:"containers" binding:"dive,containername"`
+			All        bool     `json:"all"`
 		}
-		if err := ctx.ShouldBindJSON(&req); err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+		if !bindOptionalJSON(ctx, &req) {
 			return
 		}
 
 		context := ctx.Request.Context()
 		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
 			return
 		}
 		defer cli.Close()
 
-		containerID := ctx.Param("id")
-
-		execConfig := container.ExecOptions{
-			Cmd:          []string{"sh", "-c", req.Command},
-			AttachStdout: true,
-			AttachStderr: true,
-		}
-
-		execResp, err := cli.ContainerExecCreate(context, containerID, execConfig)
+		bundle, err := exportBundle(context, cli, req.All || len(req.Containers) > 0, actorName(ctx))
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating exec: " + err.Error()})
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading containers: " + err.Error()})
 			return
 		}
+		containers := bundle.Containers
+		if len(req.Containers) > 0 {
+			byName := map[string]BundleContainer{}
+			for _, c := range bundle.Containers {
+				byName[c.Name] = c
+			}
+			containers = []BundleContainer{}
+			missing := []string{}
+			for _, name := range req.Containers {
+				if c, ok := byName[name]; ok {
+					containers = append(containers, c)
+				} else {
+					missing = append(missing, name)
+				}
+			}
+			if len(missing) > 0 {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "Containers not found: " + strings.Join(missing, ", ")})
+				return
+			}
+		}
 
-		resp, err := cli.ContainerExecAttach(context, execResp.ID, container.ExecStartOptions{})
+		tracked, skipped, err := snapshotDesired(store, containers, actorName(ctx))
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting exec: " + err.Error()})
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving desired state: " + err.Error(), "tracked": tracked})
 			return
 		}
-		defer resp.Close()
+		ctx.JSON(http.StatusOK, gin.H{"tracked": tracked, "skipped": skipped})
+	})
 
-		output, err := io.ReadAll(resp.Reader)
+	r.DELETE("/desired-state/:name", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change the desired state"})
+			return
+		}
+		removed, err := store.DeleteDesired(ctx.Param("name"))
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading output: " + err.Error()})
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating desired state: " + err.Error()})
 			return
 		}
-
-		ctx.JSON(http.StatusOK, gin.H{
-			"output":    string(output),
-			"command":   req.Command,
-			"container": containerID,
-		})
+		if !removed {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container is not in the desired state: " + ctx.Param("name")})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Container " + ctx.Param("name") + " removed from the desired state"})
 	})
 
-	// Add bulk operations endpoint
+	// Recreate the desired containers that are missing on the host
+	r.POST("/reconcile", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can reconcile the desired state"})
+			return
+		}
+		var query struct {
+			ImportOptions
+			DryRun bool `json:"dry_run" form:"dry_run"`
+		}
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			respondBindError(ctx, err)
+			return
+		}
+
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		var result *ReconcileResult
+		job, err := runJob(store, "reconcile", func() (any, error) {
+			var err error
+			result, err = reconcile(context, cli, store, secretBox, query.DryRun, query.ImportOptions)
+			return result, err
+		})
+		if err != nil {
+			body := gin.H{"error": "Reconcile failed: " + err.Error(), "result": result}
+			if job != nil {
+				body["job_id"] = job.ID
+			}
+			ctx.JSON(http.StatusInternalServerError, body)
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"job_id": job.ID, "result": result})
+	})
+
+	// Blue/green: verify the new version next to the old one before swapping
+	r.POST("/containers/:id/bluegreen", func(ctx *gin.Context) {
+		var req struct {
+			Image       string `json:"image" binding:"omitempty,imageref"`
+			Pull        *bool  `json:"pull"`
+			WaitFor     string `json:"wait_for" binding:"omitempty,oneof=healthy running"`
+			WaitTimeout int    `json:"wait_timeout" binding:"omitempty,min=1,max=3600"`
+			// Keep the old container, stopped, instead of removing it
+			KeepOld bool `json:"keep_old"`
+		}
+		if !bindOptionalJSON(ctx, &req) {
+			return
+		}
+		wait := WaitOptions{WaitFor: req.WaitFor, WaitTimeout: req.WaitTimeout}
+		if wait.WaitFor == "" {
+			wait.WaitFor = waitForHealthy
+		}
+
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		info, err := cli.ContainerInspect(context, ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + ctx.Param("id")})
+			return
+		}
+
+		spec := specFromInspect(info)
+		if req.Image != "" {
+			spec.Config.Image = req.Image
+		}
+		if err := resolveSecretEnv(store, secretBox, spec.Config); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error resolving secrets: " + err.Error()})
+			return
+		}
+		if req.Pull == nil || *req.Pull {
+			if err := checkDiskSpace(context, cli); err != nil {
+				ctx.JSON(http.StatusInsufficientStorage, gin.H{
+					"error":      "Not enough disk space to pull image: " + err.Error(),
+					"suggestion": "Chạy POST /cleanup để giải phóng dung lượng",
+				})
+				return
+			}
+			if err := pullImage(context, cli, spec.Config.Image); err != nil {
+				ctx.JSON(pullErrorStatus(err), gin.H{"error": "Error pulling image: " + err.Error()})
+				return
+			}
+		}
+
+		result, err := blueGreenDeploy(context, cli, info.ID, spec, wait.WaitFor, wait.timeout(), req.KeepOld)
+		if err != nil {
+			suggestion := "Container cũ vẫn đang chạy, kiểm tra logs và healthcheck của phiên bản mới"
+			if result != nil && result.RolledBack {
+				suggestion = "Đã khôi phục container cũ, kiểm tra logs và healthcheck của phiên bản mới"
+			}
+			ctx.JSON(hookErrorStatus(err, http.StatusInternalServerError), gin.H{
+				"error":      "Blue/green deployment failed: " + err.Error(),
+				"result":     result,
+				"suggestion": suggestion,
+			})
+			return
+		}
+
+		deployment, err := recordDeployment(context, cli, store, result.NewID, "bluegreen", actorName(ctx))
+		if err != nil {
+			fmt.Printf("⚠️  Error recording deployment history: %v\n", err)
+		}
+
+		fmt.Printf("🔵🟢 Container %s deployed blue/green with image %s\n", result.Container, spec.Config.Image)
+		ctx.JSON(http.StatusOK, gin.H{
+			"message":    "Container deployed successfully",
+			"id":         result.NewID,
+			"name":       result.Container,
+			"image":      spec.Config.Image,
+			"result":     result,
+			"deployment": deployment,
+		})
+	})
+
+	// Change resource limits of a running container without recreating it
+	r.POST("/containers/:id/update", func(ctx *gin.Context) {
+		var req ResourceOptions
+		if !bindJSON(ctx, &req) {
+			return
+		}
+		if err := req.validate(); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		info, err := cli.ContainerInspect(context, ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + ctx.Param("id")})
+			return
+		}
+
+		containerID := info.ID
+		var warnings []string
+		if req.needsRecreate() {
+			// Not changeable in place, recreate with the same spec
+			spec := specFromInspect(info)
+			req.apply(spec.HostConfig)
+			if err := resolveSecretEnv(store, secretBox, spec.Config); err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error resolving secrets: " + err.Error()})
+				return
+			}
+			containerID, err = recreateContainer(context, cli, info.ID, spec, false)
+			if !errors.Is(err, errNotRestored) && respondHookError(ctx, err) {
+				return
+			}
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error recreating container: " + err.Error()})
+				return
+			}
+		} else {
+			var hostConfig container.HostConfig
+			req.apply(&hostConfig)
+			result, err := cli.ContainerUpdate(context, info.ID, container.UpdateConfig{Resources: hostConfig.Resources})
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Error updating container: " + err.Error()})
+				return
+			}
+			warnings = result.Warnings
+		}
+
+		if _, err := recordDeployment(context, cli, store, containerID, "update", actorName(ctx)); err != nil {
+			fmt.Printf("⚠️  Error recording deployment history: %v\n", err)
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"message":      "Container " + strings.TrimPrefix(info.Name, "/") + " updated successfully",
+			"container_id": containerID,
+			"recreated":    containerID != info.ID,
+			"warnings":     warnings,
+		})
+	})
+
+	r.POST("/containers/:id/rollback", func(ctx *gin.Context) {
+		var req struct {
+			DeploymentID string `json:"deployment_id"`
+		}
+		if !bindOptionalJSON(ctx, &req) {
+			return
+		}
+
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		info, err := cli.ContainerInspect(context, ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + ctx.Param("id")})
+			return
+		}
+		containerName := strings.TrimPrefix(info.Name, "/")
+
+		var target *Deployment
+		if req.DeploymentID != "" {
+			target, err = store.GetDeployment(req.DeploymentID)
+			if err != nil || target.ContainerName != containerName {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "Deployment not found for container " + containerName + ": " + req.DeploymentID})
+				return
+			}
+		} else {
+			// Default to the deployment before the current one
+			history, err := store.ListDeployments(containerName)
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading deployment history: " + err.Error()})
+				return
+			}
+			if len(history) < 2 {
+				ctx.JSON(http.StatusConflict, gin.H{
+					"error":      "No previous deployment to roll back to",
+					"suggestion": "Xem GET /containers/" + containerName + "/history để chọn deployment_id",
+				})
+				return
+			}
+			target = &history[1]
+		}
+
+		// Pin the image to the recorded digest so the rollback restores the
+		// exact image, not whatever the tag points to today
+		spec := target.Spec
+		if err := resolveSecretEnv(store, secretBox, spec.Config); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error resolving secrets: " + err.Error()})
+			return
+		}
+		if strings.Contains(target.ImageDigest, "@") {
+			spec.Config.Image = target.ImageDigest
+			if _, err := cli.ImageInspect(context, spec.Config.Image); err != nil {
+				if err := checkDiskSpace(context, cli); err != nil {
+					ctx.JSON(http.StatusInsufficientStorage, gin.H{
+						"error":      "Not enough disk space to pull image: " + err.Error(),
+						"suggestion": "Chạy POST /cleanup để giải phóng dung lượng",
+					})
+					return
+				}
+				if err := pullImage(context, cli, spec.Config.Image); err != nil {
+					ctx.JSON(pullErrorStatus(err), gin.H{"error": "Error pulling image: " + err.Error()})
+					return
+				}
+			}
+		}
+
+		newContainerID, err := recreateContainer(context, cli, info.ID, spec, true)
+		if err != nil {
+			if !errors.Is(err, errNotRestored) && respondHookError(ctx, err) {
+				return
+			}
+			suggestion := "Container hiện tại đã được khôi phục"
+			if errors.Is(err, errNotRestored) {
+				suggestion = "Không khôi phục được container hiện tại, kiểm tra GET /status và đổi tên/khởi động lại nó thủ công"
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error":      "Error rolling back container: " + err.Error(),
+				"suggestion": suggestion,
+			})
+			return
+		}
+
+		deployment, err := recordDeployment(context, cli, store, newContainerID, "rollback", actorName(ctx))
+		if err != nil {
+			fmt.Printf("⚠️  Error recording deployment history: %v\n", err)
+		}
+
+		fmt.Printf("⏪ Container %s rolled back to deployment %s\n", containerName, target.ID)
+		ctx.JSON(http.StatusOK, gin.H{
+			"message":     "Container rolled back successfully",
+			"id":          newContainerID,
+			"name":        containerName,
+			"image":       spec.Config.Image,
+			"rolled_back": target.ID,
+			"deployment":  deployment,
+		})
+	})
+
+	// Add notes and annotations endpoints. Containers are keyed by name and
+	// images by ID, resolved through the daemon when it's reachable.
+	resolveResource := func(ctx *gin.Context, resourceType, resourceID string) (string, bool) {
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			return resourceID, true
+		}
+		defer cli.Close()
+
+		if resourceType == "image" {
+			img, err := cli.ImageInspect(ctx.Request.Context(), resourceID)
+			if err != nil {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "Image not found: " + resourceID})
+				return "", false
+			}
+			return img.ID, true
+		}
+
+		info, err := cli.ContainerInspect(ctx.Request.Context(), resourceID)
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + resourceID})
+			return "", false
+		}
+		return strings.TrimPrefix(info.Name, "/"), true
+	}
+
+	resolveAnnotationTarget := func(ctx *gin.Context) (string, string, bool) {
+		resourceType := "container"
+		if strings.HasPrefix(ctx.FullPath(), "/images/") {
+			resourceType = "image"
+		}
+		resourceID, ok := resolveResource(ctx, resourceType, ctx.Param("id"))
+		return resourceType, resourceID, ok
+	}
+
+	getAnnotations := func(ctx *gin.Context) {
+		resourceType, resourceID, ok := resolveAnnotationTarget(ctx)
+		if !ok {
+			return
+		}
+
+		annotation, err := store.GetAnnotation(resourceType, resourceID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading annotations: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, annotation)
+	}
+
+	putAnnotations := func(ctx *gin.Context) {
+		var req struct {
+			Notes       string            `json:"notes"`
+			Annotations map[string]string `json:"annotations"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+
+		resourceType, resourceID, ok := resolveAnnotationTarget(ctx)
+		if !ok {
+			return
+		}
+
+		if req.Annotations == nil {
+			req.Annotations = map[string]string{}
+		}
+		annotation := &Annotation{
+			ResourceType: resourceType,
+			ResourceID:   resourceID,
+			Notes:        req.Notes,
+			Annotations:  req.Annotations,
+			UpdatedBy:    actorName(ctx),
+		}
+		if err := store.SaveAnnotation(annotation); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving annotations: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, annotation)
+	}
+
+	deleteAnnotations := func(ctx *gin.Context) {
+		resourceType, resourceID, ok := resolveAnnotationTarget(ctx)
+		if !ok {
+			return
+		}
+
+		if err := store.DeleteAnnotation(resourceType, resourceID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting annotations: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Annotations removed from " + resourceType + " " + resourceID})
+	}
+
+	r.GET("/containers/:id/annotations", getAnnotations)
+	r.PUT("/containers/:id/annotations", putAnnotations)
+	r.DELETE("/containers/:id/annotations", deleteAnnotations)
+	r.GET("/images/:id/annotations", getAnnotations)
+	r.PUT("/images/:id/annotations", putAnnotations)
+	r.DELETE("/images/:id/annotations", deleteAnnotations)
+
+	r.GET("/images/compare", func(ctx *gin.Context) {
+		var query struct {
+			A string `json:"a" form:"a" binding:"required"`
+			B string `json:"b" form:"b" binding:"required"`
+		}
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			respondBindError(ctx, err)
+			return
+		}
+		for _, ref := range []string{query.A, query.B} {
+			if err := validateImageTarget(ref); err != nil {
+				respondInvalidName(ctx, err)
+				return
+			}
+		}
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		comparison, err := compareImages(ctx.Request.Context(), cli, query.A, query.B)
+		if err != nil {
+			if client.IsErrNotFound(err) {
+				ctx.JSON(http.StatusNotFound, gin.H{
+					"error":      err.Error(),
+					"suggestion": "Kéo image về trước bằng POST /images/pull rồi so sánh lại",
+				})
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error comparing images: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, comparison)
+	})
+
+	// Unused images, stale tags and duplicates, see image_report.go
+	r.GET("/images/report", func(ctx *gin.Context) {
+		var query struct {
+			Keep int `json:"keep" form:"keep" binding:"omitempty,min=1,max=1000"`
+		}
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			respondBindError(ctx, err)
+			return
+		}
+		if query.Keep == 0 {
+			query.Keep = defaultKeepTags
+		}
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		report, err := imageReport(ctx.Request.Context(), cli, query.Keep)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error building image report: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, report)
+	})
+
+	r.POST("/images/report/cleanup", func(ctx *gin.Context) {
+		var req struct {
+			Action string `json:"action" binding:"required,oneof=unused stale_tags duplicates all"`
+			Keep   int    `json:"keep" binding:"omitempty,min=1,max=1000"`
+			// Only these images or tags of the section, for cleaning up one
+			// entry of the report
+			Targets []string `json:"targets" binding:"omitempty,max=1000"`
+			DryRun  bool     `json:"dry_run"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+		if req.Keep == 0 {
+			req.Keep = defaultKeepTags
+		}
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		// The report is made again so only what it still lists is removed
+		report, err := imageReport(context, cli, req.Keep)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error building image report: " + err.Error()})
+			return
+		}
+		targets := report.CleanupTargets(req.Action)
+		if len(req.Targets) > 0 {
+			selected := []string{}
+			for _, t := range req.Targets {
+				if !containsString(targets, t) {
+					ctx.JSON(http.StatusConflict, gin.H{
+						"error":      t + " is not listed under " + req.Action + " in the image report",
+						"suggestion": "Tải lại báo cáo bằng GET /images/report, image có thể đã được dùng hoặc xóa",
+					})
+					return
+				}
+				selected = append(selected, t)
+			}
+			targets = selected
+		}
+		if req.DryRun || len(targets) == 0 {
+			ctx.JSON(http.StatusOK, gin.H{"action": req.Action, "dry_run": req.DryRun, "targets": targets})
+			return
+		}
+		if requireApproval && !isAdmin(ctx) {
+			requestApproval(ctx, store, approvalImageCleanup, targets)
+			return
+		}
+
+		results, reclaimed := removeReportImages(context, cli, targets)
+		ctx.JSON(http.StatusOK, gin.H{"action": req.Action, "results": results, "space_reclaimed": reclaimed})
+	})
+
+	// Export an image to look inside its layers, see image_layers.go
+	openImageLayers := func(ctx *gin.Context, cli *client.Client) (*savedImage, bool) {
+		context := ctx.Request.Context()
+		info, err := cli.ImageInspect(context, ctx.Param("id"))
+		if err != nil {
+			if client.IsErrNotFound(err) {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "Image not found: " + ctx.Param("id")})
+				return nil, false
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error inspecting image: " + err.Error()})
+			return nil, false
+		}
+		img, err := saveImage(context, cli, info.ID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error":      "Error reading image layers: " + err.Error(),
+				"suggestion": "Kiểm tra dung lượng thư mục tạm của server, ảnh được xuất ra đó trước khi đọc",
+			})
+			return nil, false
+		}
+		return img, true
+	}
+
+	r.GET("/images/:id/layers", func(ctx *gin.Context) {
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		img, ok := openImageLayers(ctx, cli)
+		if !ok {
+			return
+		}
+		defer img.Close()
+		layers := img.Layers()
+		var total int64
+		for _, l := range layers {
+			total += l.Size
+		}
+		ctx.JSON(http.StatusOK, gin.H{"image": ctx.Param("id"), "layers": layers, "layer_count": len(img.layers), "total_size": total})
+	})
+
+	r.GET("/images/:id/layers/:index/files", func(ctx *gin.Context) {
+		index, err := strconv.Atoi(ctx.Param("index"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      "Invalid layer index: " + ctx.Param("index"),
+				"suggestion": "Dùng trường index của GET /images/:id/layers",
+			})
+			return
+		}
+		var query LayerFilesQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			respondBindError(ctx, err)
+			return
+		}
+		var minSize int64
+		if query.MinSize != "" {
+			minSize, _ = units.RAMInBytes(query.MinSize)
+		}
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		img, ok := openImageLayers(ctx, cli)
+		if !ok {
+			return
+		}
+		defer img.Close()
+		files, err := img.LayerFiles(index)
+		if err != nil {
+			if errors.Is(err, errNoSuchLayer) {
+				ctx.JSON(http.StatusNotFound, gin.H{
+					"error":      err.Error(),
+					"suggestion": "Dùng trường index của GET /images/:id/layers",
+				})
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading layer: " + err.Error()})
+			return
+		}
+		listed, total, count := filterLayerFiles(files, query, minSize)
+		ctx.JSON(http.StatusOK, gin.H{
+			"image":      ctx.Param("id"),
+			"index":      index,
+			"files":      listed,
+			"count":      count,
+			"total_size": total,
+			"truncated":  len(listed) < count,
+		})
+	})
+
+	// Protect a container from stop, remove and bulk operations
+	r.PUT("/containers/:id/protect", func(ctx *gin.Context) {
+		var req struct {
+			Reason string `json:"reason" binding:"max=500"`
+		}
+		if !bindOptionalJSON(ctx, &req) {
+			return
+		}
+		name, ok := resolveResource(ctx, "container", ctx.Param("id"))
+		if !ok {
+			return
+		}
+
+		protection := &ProtectedContainer{ContainerName: name, Reason: req.Reason, ProtectedBy: actorName(ctx)}
+		if err := store.ProtectContainer(protection); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error protecting container: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Container " + name + " is now protected", "protection": protection})
+	})
+
+	r.DELETE("/containers/:id/protect", func(ctx *gin.Context) {
+		name, ok := resolveResource(ctx, "container", ctx.Param("id"))
+		if !ok {
+			return
+		}
+		removed, err := store.UnprotectContainer(name)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing protection: " + err.Error()})
+			return
+		}
+		if !removed {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"error":      "Container " + name + " is not protected in the database",
+				"suggestion": "Container được bảo vệ bằng label " + protectedLabel + " chỉ có thể bỏ bảo vệ bằng cách tạo lại container",
+			})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Protection removed from container " + name})
+	})
+
+	// Add favorites endpoints, per user so everyone can surface the
+	// services they manage most at the top of large lists
+	r.GET("/favorites", func(ctx *gin.Context) {
+		favorites, err := store.ListFavorites(actorName(ctx))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading favorites: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"favorites": favorites})
+	})
+
+	r.PUT("/favorites/:type/:id", func(ctx *gin.Context) {
+		var req struct {
+			Pinned bool `json:"pinned"`
+		}
+		if !bindOptionalJSON(ctx, &req) {
+			return
+		}
+
+		resourceType := ctx.Param("type")
+		if !validFavoriteType(resourceType) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid resource type: " + resourceType + " (use container or image)"})
+			return
+		}
+		resourceID, ok := resolveResource(ctx, resourceType, ctx.Param("id"))
+		if !ok {
+			return
+		}
+
+		favorite := &Favorite{
+			User:         actorName(ctx),
+			ResourceType: resourceType,
+			ResourceID:   resourceID,
+			Pinned:       req.Pinned,
+		}
+		if err := store.SaveFavorite(favorite); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving favorite: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, favorite)
+	})
+
+	r.DELETE("/favorites/:type/:id", func(ctx *gin.Context) {
+		resourceType := ctx.Param("type")
+		if !validFavoriteType(resourceType) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid resource type: " + resourceType + " (use container or image)"})
+			return
+		}
+		resourceID, ok := resolveResource(ctx, resourceType, ctx.Param("id"))
+		if !ok {
+			return
+		}
+
+		if err := store.DeleteFavorite(actorName(ctx), resourceType, resourceID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing favorite: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Removed " + resourceType + " " + resourceID + " from favorites"})
+	})
+
+	// Add project endpoints for grouping containers
+	r.GET("/replica-groups", func(ctx *gin.Context) {
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		containers, err := cli.ContainerList(ctx.Request.Context(), container.ListOptions{
+			All:     true,
+			Filters: filters.NewArgs(filters.Arg("label", replicaGroupLabel)),
+		})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing containers: " + err.Error()})
+			return
+		}
+		type groupSummary struct {
+			Name     string   `json:"name"`
+			Replicas int      `json:"replicas"`
+			Running  int      `json:"running"`
+			Images   []string `json:"images"`
+		}
+		byName := map[string]*groupSummary{}
+		for _, c := range containers {
+			name := c.Labels[replicaGroupLabel]
+			g, ok := byName[name]
+			if !ok {
+				g = &groupSummary{Name: name, Images: []string{}}
+				byName[name] = g
+			}
+			g.Replicas++
+			if c.State == "running" {
+				g.Running++
+			}
+			if !containsString(g.Images, c.Image) {
+				g.Images = append(g.Images, c.Image)
+			}
+		}
+		groups := make([]*groupSummary, 0, len(byName))
+		for _, g := range byName {
+			groups = append(groups, g)
+		}
+		sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+		ctx.JSON(http.StatusOK, gin.H{"groups": groups})
+	})
+
+	r.GET("/replica-groups/:name", func(ctx *gin.Context) {
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		replicas, err := listReplicaGroup(ctx.Request.Context(), cli, ctx.Param("name"))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing containers: " + err.Error()})
+			return
+		}
+		if len(replicas) == 0 {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Replica group not found: " + ctx.Param("name")})
+			return
+		}
+		list := []gin.H{}
+		for _, c := range replicas {
+			list = append(list, gin.H{"id": c.ID[:12], "name": summaryName(c), "image": c.Image, "state": c.State, "status": c.Status})
+		}
+		ctx.JSON(http.StatusOK, gin.H{"name": ctx.Param("name"), "replicas": list})
+	})
+
+	// Update one replica, watch it, then roll the new image out to the rest.
+	// Runs in the background, follow it with GET /jobs/:id.
+	r.POST("/replica-groups/:name/canary", func(ctx *gin.Context) {
+		var req CanaryRequest
+		if !bindJSON(ctx, &req) {
+			return
+		}
+		group := ctx.Param("name")
+
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		replicas, err := listReplicaGroup(context, cli, group)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing containers: " + err.Error()})
+			return
+		}
+		if len(replicas) == 0 {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"error":      "Replica group not found: " + group,
+				"suggestion": "Tạo các replica bằng POST /create với \"replica_group\": \"" + group + "\"",
+			})
+			return
+		}
+
+		// Pull before starting so a missing image fails the request itself
+		if req.Pull == nil || *req.Pull {
+			if err := checkDiskSpace(context, cli); err != nil {
+				ctx.JSON(http.StatusInsufficientStorage, gin.H{
+					"error":      "Not enough disk space to pull image: " + err.Error(),
+					"suggestion": "Chạy POST /cleanup để giải phóng dung lượng",
+				})
+				return
+			}
+			if err := pullImage(context, cli, req.Image); err != nil {
+				ctx.JSON(pullErrorStatus(err), gin.H{"error": "Error pulling image: " + err.Error()})
+				return
+			}
+		}
+
+		if !claimRollout(group) {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":      "A rollout of " + group + " is already running",
+				"suggestion": "Chờ rollout hiện tại kết thúc, xem GET /jobs?type=canary",
+			})
+			return
+		}
+		jobID, err := startCanaryRollout(store, secretBox, group, replicas, req, actorName(ctx))
+		if err != nil {
+			releaseRollout(group)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting rollout: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusAccepted, gin.H{
+			"message":  "Canary rollout of " + group + " started",
+			"job_id":   jobID,
+			"canary":   summaryName(replicas[0]),
+			"replicas": len(replicas),
+		})
+	})
+
+	r.GET("/projects", func(ctx *gin.Context) {
+		projects, err := store.ListProjects()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing projects: " + err.Error()})
+			return
+		}
+
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		result := make([]gin.H, 0, len(projects))
+		for _, p := range projects {
+			containers, err := listProjectContainers(context, cli, p.Name)
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing containers: " + err.Error()})
+				return
+			}
+			result = append(result, gin.H{"project": p, "status": projectStatus(containers)})
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{"projects": result})
+	})
+
+	r.POST("/projects", func(ctx *gin.Context) {
+		var req struct {
+			Name        string `json:"name" binding:"required,resourcename"`
+			Description string `json:"description"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+
+		if _, err := store.GetProject(req.Name); err == nil {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Project already exists: " + req.Name})
+			return
+		}
+
+		project := &Project{Name: req.Name, Description: req.Description, CreatedBy: actorName(ctx)}
+		if err := store.CreateProject(project); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating project: " + err.Error()})
+			return
+		}
+
+		fmt.Printf("📁 Project %s created\n", project.Name)
+		ctx.JSON(http.StatusOK, gin.H{"message": "Project created successfully", "project": project})
+	})
+
+	r.GET("/projects/:id", func(ctx *gin.Context) {
+		project, err := store.GetProject(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Project not found: " + ctx.Param("id")})
+			return
+		}
+
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		containers, err := listProjectContainers(ctx.Request.Context(), cli, project.Name)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing containers: " + err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"project":    project,
+			"status":     projectStatus(containers),
+			"containers": containers,
+		})
+	})
+
+	r.DELETE("/projects/:id", func(ctx *gin.Context) {
+		project, err := store.GetProject(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Project not found: " + ctx.Param("id")})
+			return
+		}
+
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		containers, err := listProjectContainers(ctx.Request.Context(), cli, project.Name)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing containers: " + err.Error()})
+			return
+		}
+		if len(containers) > 0 {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":      fmt.Sprintf("Project %s still has %d containers", project.Name, len(containers)),
+				"suggestion": "Gỡ các container khỏi project trước khi xóa",
+			})
+			return
+		}
+
+		if err := store.DeleteProject(project.ID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting project: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Project " + project.Name + " deleted successfully"})
+	})
+
+	// Replace the depends_on list of a container, used to order project
+	// start and stop. The container is recreated to update its label.
+	r.PUT("/containers/:id/dependencies", func(ctx *gin.Context) {
+		var req struct {
+			DependsOn []string `json:"depends_on" binding:"dive,containerref"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		info, err := cli.ContainerInspect(ctx.Request.Context(), ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + ctx.Param("id")})
+			return
+		}
+		name := strings.TrimPrefix(info.Name, "/")
+		for _, dep := range req.DependsOn {
+			if strings.TrimPrefix(dep, "/") == name {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "A container can't depend on itself"})
+				return
+			}
+		}
+
+		newContainerID, err := setContainerDependencies(ctx.Request.Context(), cli, info.ID, req.DependsOn)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating dependencies: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"message":    "Dependencies of " + name + " updated",
+			"id":         newContainerID,
+			"depends_on": req.DependsOn,
+			"note":       "Container đã được tạo lại để cập nhật label depends-on",
+		})
+	})
+
+	r.POST("/projects/:id/containers", func(ctx *gin.Context) {
+		var req struct {
+			Container string `json:"container" binding:"required,containerref"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+
+		project, err := store.GetProject(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Project not found: " + ctx.Param("id")})
+			return
+		}
+
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		newContainerID, err := setContainerProject(ctx.Request.Context(), cli, req.Container, project.Name)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error assigning container to project: " + err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"message": "Container " + req.Container + " added to project " + project.Name,
+			"id":      newContainerID,
+			"note":    "Container đã được tạo lại để cập nhật label project",
+		})
+	})
+
+	r.DELETE("/projects/:id/containers/:container", func(ctx *gin.Context) {
+		project, err := store.GetProject(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Project not found: " + ctx.Param("id")})
+			return
+		}
+
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		info, err := cli.ContainerInspect(ctx.Request.Context(), ctx.Param("container"))
+		if err != nil || info.Config.Labels[projectLabel] != project.Name {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container " + ctx.Param("container") + " is not in project " + project.Name})
+			return
+		}
+
+		newContainerID, err := setContainerProject(ctx.Request.Context(), cli, info.ID, "")
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing container from project: " + err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"message": "Container " + ctx.Param("container") + " removed from project " + project.Name,
+			"id":      newContainerID,
+		})
+	})
+
+	// Start or stop every container of a project
+	r.POST("/projects/:id/:action", func(ctx *gin.Context) {
+		action := ctx.Param("action")
+		if action != "start" && action != "stop" && action != "restart" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unknown project action: " + action + " (use start, stop or restart)"})
+			return
+		}
+
+		project, err := store.GetProject(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Project not found: " + ctx.Param("id")})
+			return
+		}
+
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		containers, err := listProjectContainers(context, cli, project.Name)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing containers: " + err.Error()})
+			return
+		}
+
+		// Containers start in dependency order and stop in reverse
+		stages, err := dependencyStages(containers)
+		if err != nil {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":      "Cannot order project containers: " + err.Error(),
+				"suggestion": "Sửa depends_on qua PUT /containers/:id/dependencies để bỏ vòng lặp phụ thuộc",
+			})
+			return
+		}
+		timeout := defaultHealthWait
+		if t := ctx.Query("timeout"); t != "" {
+			seconds, err := strconv.Atoi(t)
+			if err != nil || seconds < 1 || seconds > 3600 {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timeout: must be between 1 and 3600 seconds"})
+				return
+			}
+			timeout = time.Duration(seconds) * time.Second
+		}
+
+		results := make(map[string]interface{})
+		successCount := 0
+		errorCount := 0
+		override := overrideProtection(ctx)
+		if action == "stop" || action == "restart" {
+			for i := len(stages) - 1; i >= 0; i-- {
+				for _, c := range stages[i] {
+					if !override {
+						if reason := protectionReason(store, summaryName(c), c.Labels); reason != "" {
+							results[summaryName(c)] = gin.H{"status": "skipped", "message": reason}
+							continue
+						}
+					}
+					if c.State != "running" {
+						if action == "stop" {
+							results[summaryName(c)] = gin.H{"status": "skipped", "message": "not running"}
+						}
+						continue
+					}
+					if err := stopContainer(context, cli, c.ID, container.StopOptions{}); err != nil {
+						results[summaryName(c)] = gin.H{"status": "error", "message": err.Error()}
+						errorCount++
+						continue
+					}
+					if action == "stop" {
+						results[summaryName(c)] = gin.H{"status": "success"}
+						successCount++
+					}
+				}
+			}
+		}
+		if action == "start" || action == "restart" {
+			if action == "restart" {
+				// Start again what was stopped above, protected containers
+				// that were skipped keep running
+				containers, err = listProjectContainers(context, cli, project.Name)
+				if err != nil {
+					ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing containers: " + err.Error()})
+					return
+				}
+				if stages, err = dependencyStages(containers); err != nil {
+					ctx.JSON(http.StatusConflict, gin.H{"error": "Cannot order project containers: " + err.Error()})
+					return
+				}
+			}
+			started, failed := startInOrder(context, cli, stages, timeout, results)
+			successCount += started
+			errorCount += failed
+		}
+
+		fmt.Printf("📁 Project %s %s completed: %d success, %d errors\n", project.Name, action, successCount, errorCount)
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"project": project.Name,
+			"action":  action,
+			"stages":  stageNames(stages),
+			"results": results,
+			"summary": gin.H{
+				"total":   len(containers),
+				"success": successCount,
+				"errors":  errorCount,
+			},
+		})
+	})
+
+	// Add application template endpoints
+	r.GET("/templates", func(ctx *gin.Context) {
+		templates, err := store.ListTemplates()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing templates: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"templates": templates})
+	})
+
+	r.GET("/templates/:id", func(ctx *gin.Context) {
+		template, err := store.GetTemplate(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Template not found: " + ctx.Param("id")})
+			return
+		}
+		ctx.JSON(http.StatusOK, template)
+	})
+
+	r.POST("/templates", func(ctx *gin.Context) {
+		var template AppTemplate
+		if !bindJSON(ctx, &template) {
+			return
+		}
+		if err := validateTemplate(&template); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template: " + err.Error()})
+			return
+		}
+		if _, err := store.GetTemplate(template.Name); err == nil {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Template already exists: " + template.Name})
+			return
+		}
+
+		if err := store.CreateTemplate(&template); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating template: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Template created successfully", "template": template})
+	})
+
+	r.PUT("/templates/:id", func(ctx *gin.Context) {
+		existing, err := store.GetTemplate(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Template not found: " + ctx.Param("id")})
+			return
+		}
+
+		var template AppTemplate
+		if !bindJSON(ctx, &template) {
+			return
+		}
+		if err := validateTemplate(&template); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template: " + err.Error()})
+			return
+		}
+
+		template.ID = existing.ID
+		template.CreatedAt = existing.CreatedAt
+		if err := store.UpdateTemplate(&template); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating template: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Template updated successfully", "template": template})
+	})
+
+	r.DELETE("/templates/:id", func(ctx *gin.Context) {
+		template, err := store.GetTemplate(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Template not found: " + ctx.Param("id")})
+			return
+		}
+		if err := store.DeleteTemplate(template.ID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting template: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Template " + template.Name + " deleted successfully"})
+	})
+
+	r.POST("/templates/:id/deploy", func(ctx *gin.Context) {
+		var req DeployTemplateRequest
+		if !bindOptionalJSON(ctx, &req) {
+			return
+		}
+
+		template, err := store.GetTemplate(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Template not found: " + ctx.Param("id")})
+			return
+		}
+
+		if req.Name == "" {
+			req.Name = template.Name + "-" + strconv.FormatInt(time.Now().Unix(), 10)
+		}
+		if req.Project != "" {
+			project, err := store.GetProject(req.Project)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Project not found: " + req.Project})
+				return
+			}
+			req.Project = project.Name
+		}
+
+		var ttl time.Duration
+		if req.TTL != "" {
+			if ttl, err = parseTTL(req.TTL); err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error":      err.Error(),
+					"suggestion": "Ví dụ: \"30m\", \"2h\" hoặc \"7d\"",
+				})
+				return
+			}
+		}
+
+		spec, values, secretEnv, err := buildTemplateSpec(template, req)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":    "Invalid deploy values: " + err.Error(),
+				"template": template,
+			})
+			return
+		}
+		// Secret variable values reach the container as managed secrets, so
+		// the deployment history only holds them redacted
+		for env := range req.Secrets {
+			delete(secretEnv, env)
+		}
+		generated, err := storeTemplateSecrets(store, secretBox, template.Name, req.Name, actorName(ctx), secretEnv)
+		if errors.Is(err, errSecretExists) {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":      "Error storing template secrets: " + err.Error(),
+				"suggestion": "Chọn tên container khác hoặc xóa secret cũ qua DELETE /secrets/:name",
+			})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error storing template secrets: " + err.Error()})
+			return
+		}
+		if len(generated) > 0 {
+			refs := map[string]string{}
+			for env, name := range req.Secrets {
+				refs[env] = name
+			}
+			for env, name := range generated {
+				refs[env] = name
+			}
+			req.Secrets = refs
+		}
+		if err := injectSecrets(store, secretBox, spec.Config, req.Secrets, actorName(ctx)); err != nil {
+			respondSecretError(ctx, err)
+			return
+		}
+		if err := attachConfigs(store, spec.Config, req.Configs); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Error attaching configs: " + err.Error()})
+			return
+		}
+		var expiresAt time.Time
+		if ttl > 0 {
+			expiresAt = setExpiry(spec.Config, ttl)
+		}
+
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		if req.Memory != "" {
+			memory, err := ResourceOptions{Memory: &req.Memory}.memoryBytes()
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			spec.HostConfig.Memory = memory
+		}
+		spec.Config.Labels[ownerLabel] = actorName(ctx)
+		if err := checkQuotas(context, cli, store, actorName(ctx), req.Project, spec.HostConfig.Memory, namedVolumes(spec.HostConfig)); err != nil {
+			respondQuotaError(ctx, err)
+			return
+		}
+
+		if err := ensureImage(context, cli, spec.Config.Image); err != nil {
+			ctx.JSON(pullErrorStatus(err), gin.H{"error": "Error pulling image: " + err.Error()})
+			return
+		}
+
+		resp, err := createContainer(context, cli, spec.Config, spec.HostConfig, nil, req.Name)
+		if respondHookError(ctx, err) {
+			return
+		}
+		if err != nil {
+			status := http.StatusInternalServerError
+			if strings.Contains(err.Error(), "already in use") {
+				status = http.StatusConflict
+			}
+			ctx.JSON(status, gin.H{"error": "Error creating container: " + err.Error()})
+			return
+		}
+		if err := copyConfigs(context, cli, resp.ID, spec.Config.Labels); err != nil {
+			cli.ContainerRemove(context, resp.ID, container.RemoveOptions{Force: true})
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error copying configs: " + err.Error()})
+			return
+		}
+
+		if err := startContainer(context, cli, resp.ID, container.StartOptions{}); err != nil {
+			if respondHookError(ctx, err) {
+				return
+			}
+			errorDetails := err.Error()
+			if strings.Contains(errorDetails, "port is already allocated") || strings.Contains(errorDetails, "address already in use") {
+				ctx.JSON(http.StatusConflict, gin.H{
+					"error":        "Không thể khởi động container do xung đột port",
+					"details":      errorDetails,
+					"container_id": resp.ID,
+					"suggestion":   "Chọn host port khác qua trường \"ports\" (ví dụ: {\"80\": \"9001\"})",
+				})
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error":        "Lỗi khởi động container",
+				"details":      errorDetails,
+				"container_id": resp.ID,
+			})
+			return
+		}
+
+		if _, err := recordDeployment(context, cli, store, resp.ID, "create", actorName(ctx)); err != nil {
+			fmt.Printf("⚠️  Error recording deployment history: %v\n", err)
+		}
+
+		ports := []string{}
+		for port, bindings := range spec.HostConfig.PortBindings {
+			for _, b := range bindings {
+				ports = append(ports, b.HostPort+":"+port.Port())
+			}
+		}
+
+		fmt.Printf("🎉 Template %s deployed as %s\n", template.Name, req.Name)
+		response := gin.H{
+			"message":   "Template deployed successfully! 🎉",
+			"id":        resp.ID,
+			"name":      req.Name,
+			"image":     spec.Config.Image,
+			"template":  template.Name,
+			"ports":     ports,
+			"variables": publicTemplateVars(template.Variables, values, req.Variables),
+		}
+		if !expiresAt.IsZero() {
+			response["expires_at"] = expiresAt
+		}
+		ctx.JSON(http.StatusOK, response)
+	})
+
+	// Add secrets endpoints. Values are write-only: they are stored encrypted
+	// and only ever decrypted to inject them into containers.
+	r.GET("/secrets", func(ctx *gin.Context) {
+		secrets, err := store.ListSecrets()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing secrets: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"secrets": secrets})
+	})
+
+	r.GET("/secrets/:name", func(ctx *gin.Context) {
+		secret, err := store.GetSecret(ctx.Param("name"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Secret not found: " + ctx.Param("name")})
+			return
+		}
+		ctx.JSON(http.StatusOK, secret)
+	})
+
+	r.POST("/secrets", func(ctx *gin.Context) {
+		var req struct {
+			Name        string `json:"name" binding:"required"`
+			Value       string `json:"value" binding:"required"`
+			Description string `json:"description"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+		if strings.ContainsAny(req.Name, ",= ") {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Secret name must not contain commas, '=' or spaces"})
+			return
+		}
+		if _, err := store.GetSecret(req.Name); err == nil {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":      "Secret already exists: " + req.Name,
+				"suggestion": "Dùng PUT /secrets/" + req.Name + " để cập nhật giá trị",
+			})
+			return
+		}
+
+		secret := &Secret{Name: req.Name, Description: req.Description, CreatedBy: actorName(ctx)}
+		if err := store.CreateSecret(secretBox, secret, req.Value); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating secret: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Secret created successfully", "secret": secret})
+	})
+
+	r.PUT("/secrets/:name", func(ctx *gin.Context) {
+		var req struct {
+			Value       string  `json:"value" binding:"required"`
+			Description *string `json:"description"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+
+		secret, err := store.GetSecret(ctx.Param("name"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Secret not found: " + ctx.Param("name")})
+			return
+		}
+		if req.Description != nil {
+			secret.Description = *req.Description
+		}
+		if err := store.UpdateSecret(secretBox, secret, req.Value); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating secret: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"message": "Secret updated successfully",
+			"secret":  secret,
+			"note":    "Container đang chạy sẽ nhận giá trị mới khi được redeploy",
+		})
+	})
+
+	r.DELETE("/secrets/:name", func(ctx *gin.Context) {
+		secret, err := store.GetSecret(ctx.Param("name"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Secret not found: " + ctx.Param("name")})
+			return
+		}
+		if err := store.DeleteSecret(secret.ID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting secret: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Secret " + secret.Name + " deleted successfully"})
+	})
+
+	// Add managed config file endpoints
+	r.GET("/configs", func(ctx *gin.Context) {
+		configs, err := store.ListConfigFiles()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing configs: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"configs": configs})
+	})
+
+	r.GET("/configs/:name", func(ctx *gin.Context) {
+		cfg, err := store.GetConfigFile(ctx.Param("name"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Config not found: " + ctx.Param("name")})
+			return
+		}
+		ctx.JSON(http.StatusOK, cfg)
+	})
+
+	r.POST("/configs", func(ctx *gin.Context) {
+		var cfg ConfigFile
+		if !bindJSON(ctx, &cfg) {
+			return
+		}
+		if err := validateConfigFile(&cfg); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if _, err := store.GetConfigFile(cfg.Name); err == nil {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":      "Config already exists: " + cfg.Name,
+				"suggestion": "Dùng PUT /configs/" + cfg.Name + " để cập nhật nội dung",
+			})
+			return
+		}
+
+		cfg.CreatedBy = actorName(ctx)
+		if err := store.CreateConfigFile(&cfg); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating config: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Config created successfully", "config": cfg})
+	})
+
+	r.PUT("/configs/:name", func(ctx *gin.Context) {
+		var req struct {
+			Content     *string `json:"content"`
+			Description *string `json:"description"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+
+		cfg, err := store.GetConfigFile(ctx.Param("name"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Config not found: " + ctx.Param("name")})
+			return
+		}
+		if req.Content != nil {
+			cfg.Content = *req.Content
+		}
+		if req.Description != nil {
+			cfg.Description = *req.Description
+		}
+		if err := validateConfigFile(cfg); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := store.UpdateConfigFile(cfg); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating config: " + err.Error()})
+			return
+		}
+		response := gin.H{"message": "Config updated successfully", "config": cfg}
+		if req.Content != nil {
+			updated, failed, err := refreshConfigUsers(ctx.Request.Context(), cfg.Name)
+			if err != nil {
+				response["warning"] = "Config saved but containers were not updated: " + err.Error()
+				response["suggestion"] = "Redeploy các container dùng config để nhận nội dung mới"
+			} else {
+				response["updated"] = updated
+				if len(failed) > 0 {
+					response["failed"] = failed
+				}
+				response["note"] = "Nội dung mới đã được chép vào các container dùng config, có thể cần restart để ứng dụng đọc lại"
+			}
+		}
+		ctx.JSON(http.StatusOK, response)
+	})
+
+	r.DELETE("/configs/:name", func(ctx *gin.Context) {
+		cfg, err := store.GetConfigFile(ctx.Param("name"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Config not found: " + ctx.Param("name")})
+			return
+		}
+
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		users, err := configUsers(ctx.Request.Context(), cli, cfg.Name)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking config usage: " + err.Error()})
+			return
+		}
+		if len(users) > 0 {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":      "Config is used by containers",
+				"containers": users,
+				"suggestion": "Xóa các container đang dùng config trước",
+			})
+			return
+		}
+
+		if err := store.DeleteConfigFile(cfg.ID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting config: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Config " + cfg.Name + " deleted successfully"})
+	})
+
+	// Add image management endpoints
+	r.GET("/images", func(ctx *gin.Context) {
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		_, err = cli.Ping(context)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Docker daemon is not accessible: " + err.Error()})
+			return
+		}
+
+		images, err := listings.Images(context, cli)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing images: " + err.Error()})
+			return
+		}
+
+		if len(images) == 0 {
+			jsonWithETag(ctx, gin.H{"message": "No images found", "images": []interface{}{}})
+			return
+		}
+
+		annotations, err := store.ListAnnotations("image")
+		if err != nil {
+			fmt.Printf("⚠️  Error loading image annotations: %v\n", err)
+		}
+
+		favorites, err := store.FavoritesByResource(actorName(ctx), "image")
+		if err != nil {
+			fmt.Printf("⚠️  Error loading favorites: %v\n", err)
+		}
+
+		result := make([]ImageWithMeta, 0, len(images))
+		for _, img := range images {
+			item := ImageWithMeta{Summary: img}
+			if a, ok := annotations[img.ID]; ok {
+				item.Notes = a.Notes
+				item.Annotations = a.Annotations
+			}
+			if f, ok := favorites[img.ID]; ok {
+				item.Favorite = true
+				item.Pinned = f.Pinned
+			}
+			result = append(result, item)
+		}
+
+		sort.SliceStable(result, func(i, j int) bool {
+			return favoriteRank(result[i].Favorite, result[i].Pinned) > favoriteRank(result[j].Favorite, result[j].Pinned)
+		})
+
+		jsonWithETag(ctx, result)
+	})
+
+	r.POST("/images/pull", func(ctx *gin.Context) {
+		if offlineGuard(ctx) {
+			return
+		}
+		var req ImageRequest
+		if !bindJSON(ctx, &req) {
+			return
+		}
+		imageName := req.Name
+		if req.Tag != "" {
+			imageName = req.Name + ":" + req.Tag
+		}
+		if err := validateImageRef(imageName); err != nil {
+			respondInvalidName(ctx, err)
+			return
+		}
+
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		_, err = cli.Ping(context)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Docker daemon is not accessible: " + err.Error()})
+			return
+		}
+
+		if err := checkDiskSpace(context, cli); err != nil {
+			ctx.JSON(http.StatusInsufficientStorage, gin.H{
+				"error":      "Not enough disk space to pull image: " + err.Error(),
+				"suggestion": "Chạy POST /cleanup để giải phóng dung lượng",
+			})
+			return
+		}
+		if err := pullImage(context, cli, imageName); err != nil {
+			ctx.JSON(pullErrorStatus(err), gin.H{"error": "Error pulling image: " + err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"message": "Image pulled successfully",
+			"image":   imageName,
+		})
+	})
+
+	// Several images in one tar with a manifest, for hosts without registry
+	// access
+	r.POST("/images/bundle", func(ctx *gin.Context) {
+		var req struct {
+			Images []string `json:"images" binding:"required,min=1,max=100"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+		for _, ref := range req.Images {
+			if err := validateImageTarget(ref); err != nil {
+				respondInvalidName(ctx, err)
+				return
+			}
+		}
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating Docker client: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		manifest, archive, err := saveImageBundle(context, cli, req.Images, actorName(ctx))
+		if err != nil {
+			status := http.StatusInternalServerError
+			if client.IsErrNotFound(err) {
+				status = http.StatusNotFound
+			}
+			ctx.JSON(status, gin.H{
+				"error":      "Error exporting images: " + err.Error(),
+				"suggestion": "Kiểm tra các image có tồn tại trên host bằng GET /images",
+			})
+			return
+		}
+		defer os.Remove(archive.Name())
+		defer archive.Close()
+		fmt.Printf("📦 Exporting %d images as a bundle (%s)\n", len(manifest.Images), units.HumanSize(float64(manifest.ArchiveLen)))
+
+		filename := "images-" + manifest.CreatedAt.Format("20060102-150405") + ".tar"
+		ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		ctx.Header("Content-Type", imageBundleContentType)
+		ctx.Status(http.StatusOK)
+		// Headers are out, a failure can only cut the download short
+		if err := writeImageBundle(ctx.Writer, manifest, archive); err != nil {
+			fmt.Printf("⚠️  Error writing image bundle: %v\n", err)
+		}
+	})
+
+	// Load a bundle from POST /images/bundle, sent as the raw request body
+	r.POST("/images/bundle/import", func(ctx *gin.Context) {
+		if ctx.ContentType() != imageBundleContentType {
+			ctx.JSON(http.StatusUnsupportedMediaType, gin.H{
+				"error":      "Image bundles must be sent with Content-Type: " + imageBundleContentType,
+				"suggestion": "curl --data-binary @images.tar -H 'Content-Type: application/x-tar' ...",
+			})
+			return
+		}
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating Docker client: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		manifest, archive, err := readImageBundle(ctx.Request.Body)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				respondBindError(ctx, err)
+				return
+			}
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      "Invalid image bundle: " + err.Error(),
+				"suggestion": "Tạo lại bundle bằng POST /images/bundle và gửi nguyên file",
+			})
+			return
+		}
+		defer os.Remove(archive.Name())
+		defer archive.Close()
+
+		results, err := loadImageBundle(context, cli, manifest, archive)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading images: " + err.Error()})
+			return
+		}
+		failed := 0
+		for _, r := range results {
+			if r.Status != "verified" {
+				failed++
+			}
+		}
+		fmt.Printf("📦 Imported image bundle from %s: %d images, %d failed verification\n", manifest.Host, len(results), failed)
+		if failed > 0 {
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":      fmt.Sprintf("%d of %d images failed verification", failed, len(results)),
+				"images":     results,
+				"suggestion": "Image trên host không khớp với manifest, kiểm tra lại bundle",
+			})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"manifest": manifest, "images": results})
+	})
+
+	r.DELETE("/images/:id", func(ctx *gin.Context) {
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		_, err = cli.Ping(context)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Docker daemon is not accessible: " + err.Error()})
+			return
+		}
+
+		imageID := ctx.Param("id")
+
+		// Force-removing an image that containers use needs a confirmation token
+		confirmed := func(ref string) bool {
+			impact, users, err := imageImpact(context, cli, ref)
+			if err != nil || users == 0 {
+				return true
+			}
+			return confirmations.Confirmed(ctx, "remove_image", impact["image"].(string), impact)
+		}
+
+		// Try to remove the image directly first (handles full image names like nginx:latest)
+		if _, err := cli.ImageInspect(context, imageID); err == nil {
+			if !confirmed(imageID) {
+				return
+			}
+			if _, err := cli.ImageRemove(context, imageID, image.RemoveOptions{Force: true}); err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing image: " + err.Error()})
+				return
+			}
+			ctx.JSON(http.StatusOK, gin.H{"message": "Image " + imageID + " removed successfully"})
+			return
+		}
+
+		// If direct removal fails, try to find image by ID or tag
+		images, err := cli.ImageList(context, image.ListOptions{})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing images: " + err.Error()})
+			return
+		}
+
+		var targetImage string
+		for _, img := range images {
+			// Check full ID match
+			if img.ID == imageID || img.ID == "sha256:"+imageID {
+				targetImage = img.ID
+				break
+			}
+			// Check truncated ID match
+			if strings.HasPrefix(img.ID, "sha256:"+imageID) || strings.HasPrefix(img.ID, imageID) {
+				targetImage = img.ID
+				break
+			}
+			// Check RepoTags
+			for _, tag := range img.RepoTags {
+				if tag == imageID {
+					targetImage = img.ID
+					break
+				}
+				// Also check if imageID matches repository part
+				if strings.Contains(tag, imageID) {
+					targetImage = img.ID
+					break
+				}
+			}
+			if targetImage != "" {
+				break
+			}
+		}
+
+		if targetImage == "" {
+			// List available images for debugging
+			var availableImages []string
+			for _, img := range images {
+				for _, tag := range img.RepoTags {
+					availableImages = append(availableImages, tag)
+				}
+				availableImages = append(availableImages, img.ID[:12])
+			}
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"error":            "Image not found: " + imageID,
+				"available_images": availableImages,
+				"suggestion":       "Try using the exact image name from the list or the image ID",
+			})
+			return
+		}
+
+		if !confirmed(targetImage) {
+			return
+		}
+		_, err = cli.ImageRemove(context, targetImage, image.RemoveOptions{Force: true})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing image: " + err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{"message": "Image " + imageID + " removed successfully"})
+	})
+
+	// Add image search endpoint
+	imageSearchCache := newSearchCache(searchCacheTTL)
+	r.GET("/images/search/:term", func(ctx *gin.Context) {
+		if offlineGuard(ctx) {
+			return
+		}
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		_, err = cli.Ping(context)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Docker daemon is not accessible: " + err.Error()})
+			return
+		}
+
+		searchTerm := ctx.Param("term")
+		if searchTerm == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Search term is required"})
+			return
+		}
+
+		limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "25"))
+		if err != nil || limit < 1 || limit > 100 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit: must be a number between 1 and 100"})
+			return
+		}
+		refresh := ctx.Query("refresh") == "true"
+
+		officialOnly := ctx.Query("official") == "true"
+		minStars := 0
+		if stars := ctx.Query("min_stars"); stars != "" {
+			minStars, err = strconv.Atoi(stars)
+			if err != nil || minStars < 0 {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid min_stars: " + stars})
+				return
+			}
+		}
+
+		searchFilters := filters.NewArgs()
+		if officialOnly {
+			searchFilters.Add("is-official", "true")
+		}
+		if minStars > 0 {
+			searchFilters.Add("stars", strconv.Itoa(minStars))
+		}
+
+		// Serve from cache unless the caller asked for fresh results
+		cacheKey := searchCacheKey(searchTerm, limit, officialOnly, minStars)
+		searchResults, cachedAt, cached := imageSearchCache.get(cacheKey)
+		if !cached || refresh {
+			// Search for images on Docker Hub
+			searchResults, err = cli.ImageSearch(context, searchTerm, registry.SearchOptions{Limit: limit, Filters: searchFilters})
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error searching images: " + err.Error()})
+				return
+			}
+			cachedAt = imageSearchCache.set(cacheKey, searchResults)
+			cached = false
+		}
+
+		cacheInfo := gin.H{
+			"cached":      cached,
+			"cached_at":   cachedAt,
+			"age_seconds": int(time.Since(cachedAt).Seconds()),
+			"ttl_seconds": int(searchCacheTTL.Seconds()),
+		}
+
+		if len(searchResults) == 0 {
+			ctx.JSON(http.StatusOK, gin.H{"message": "No images found", "results": []interface{}{}, "cache": cacheInfo})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{"results": searchResults, "cache": cacheInfo})
+	})
+
+	// Outbound proxies of the server and the daemon for registry access
+	r.GET("/registry/proxy", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can view proxy settings"})
+			return
+		}
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating Docker client: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+		ctx.JSON(http.StatusOK, registryProxy.Status(ctx.Request.Context(), cli))
+	})
+
+	// Add image tag listing endpoint
+	r.GET("/images/tags/*name", func(ctx *gin.Context) {
+		if offlineGuard(ctx) {
+			return
+		}
+		repository := strings.Trim(ctx.Param("name"), "/")
+		if repository == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Repository name is required"})
+			return
+		}
+		// Also keeps '..' and other odd path segments out of the registry URL
+		if err := validateImageRef(repository); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "50"))
+		if err != nil || limit < 1 || limit > 500 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit: must be a number between 1 and 500"})
+			return
+		}
+
+		tags, err := listRepositoryTags(ctx.Request.Context(), repository, limit)
+		if err != nil {
+			ctx.JSON(http.StatusBadGateway, gin.H{
+				"error":      "Error listing tags for " + repository + ": " + err.Error(),
+				"suggestion": "Kiểm tra lại tên repository (ví dụ: nginx, bitnami/redis, ghcr.io/owner/app)",
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"repository": repository,
+			"tags":       tags,
+			"count":      len(tags),
+		})
+	})
+
+	// Add system statistics endpoint with system info
+	r.GET("/stats", func(ctx *gin.Context) {
+		// Number of heaviest containers to list by CPU and memory, 0 skips sampling
+		top, err := strconv.Atoi(ctx.DefaultQuery("top", "5"))
+		if err != nil || top < 0 || top > 50 {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      "Invalid top: must be a number between 0 and 50",
+				"suggestion": "Dùng ?top=0 để bỏ qua việc lấy số liệu từng container",
+			})
+			return
+		}
+
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		_, err = cli.Ping(context)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Docker daemon is not accessible: " + err.Error()})
+			return
+		}
+
+		// Get containers
+		containers, err := listings.Containers(context, cli)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing containers: " + err.Error()})
+			return
+		}
+
+		// Sampling containers takes about a second, overlap it with the rest
+		topUsage := make(chan gin.H, 1)
+		if top > 0 {
+			go func() { topUsage <- topContainers(context, cli, containers, top) }()
+		}
+
+		// Get images
+		images, err := listings.Images(context, cli)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing images: " + err.Error()})
+			return
+		}
+
+		// Host memory and disk, zero when the platform can't report them
+		memory, err := memoryUsage()
+		if err != nil {
+			fmt.Printf("⚠️  Error reading host memory: %v\n", err)
+		}
+		disk, err := diskUsage(rootPath())
+		if err != nil {
+			fmt.Printf("⚠️  Error reading disk usage: %v\n", err)
+		}
+
+		// Get CPU count, host utilization and load
+		cpuCount := runtime.NumCPU()
+		cpuStats := gin.H{"cores": cpuCount}
+		if usage, err := cpuUsage(); err == nil {
+			cpuStats["percent"] = usage.Percent
+			cpuStats["per_core"] = usage.PerCore
+		} else if err != errMetricsUnsupported {
+			fmt.Printf("⚠️  Error reading CPU usage: %v\n", err)
+		}
+		if load, err := loadAverage(); err == nil {
+			cpuStats["load"] = gin.H{"1m": load.Load1, "5m": load.Load5, "15m": load.Load15}
+		} else if err != errMetricsUnsupported {
+			fmt.Printf("⚠️  Error reading load average: %v\n", err)
+		}
+
+		// Calculate statistics
+		stats := gin.H{
+			"containers": gin.H{
+				"total":   len(containers),
+				"running": 0,
+				"stopped": 0,
+				"paused":  0,
+			},
+			"images": gin.H{
+				"total": len(images),
+			},
+			"system": gin.H{
+				"timestamp": time.Now(),
+				"memory": gin.H{
+					"total":   memory.Total,
+					"used":    memory.Used(),
+					"free":    memory.Available,
+					"percent": memory.Percent(),
+				},
+				"disk": gin.H{
+					"total":   disk.Total,
+					"used":    disk.Used(),
+					"free":    disk.Free,
+					"percent": disk.Percent(),
+					// Below MIN_FREE_DISK, image pulls are refused or warned about
+					"low_space": lowDiskSpace(context, cli) != nil,
+				},
+				"cpu":      cpuStats,
+				"platform": runtime.GOOS,
+			},
+		}
+
+		// Count container states
+		for _, c := range containers {
+			switch c.State {
+			case "running":
+				stats["containers"].(gin.H)["running"] = stats["containers"].(gin.H)["running"].(int) + 1
+			case "exited", "created":
+				stats["containers"].(gin.H)["stopped"] = stats["containers"].(gin.H)["stopped"].(int) + 1
+			case "paused":
+				stats["containers"].(gin.H)["paused"] = stats["containers"].(gin.H)["paused"].(int) + 1
+			}
+		}
+
+		if top > 0 {
+			stats["top_containers"] = <-topUsage
+		}
+
+		ctx.JSON(http.StatusOK, stats)
+	})
+
+	// Processes of all running containers, to trace a busy host process back
+	// to its container
+	r.GET("/processes", func(ctx *gin.Context) {
+		var query struct {
+			Sort string `json:"sort" form:"sort" binding:"omitempty,oneof=cpu memory"`
+			// Heaviest processes listed across containers
+			Top int `json:"top" form:"top,default=20" binding:"min=0,max=500"`
+			// Host PID to find the container of
+			PID int `json:"pid" form:"pid" binding:"omitempty,min=1"`
+		}
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			respondBindError(ctx, err)
+			return
+		}
+
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		containers, err := listings.Containers(context, cli)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing containers: " + err.Error()})
+			return
+		}
+		byContainer := hostProcesses(context, cli, containers)
+
+		if query.PID > 0 {
+			for _, c := range byContainer {
+				for _, p := range c.Processes {
+					if p.PID == query.PID {
+						ctx.JSON(http.StatusOK, gin.H{"process": p, "container": c})
+						return
+					}
+				}
+			}
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"error":      "No running container has process " + strconv.Itoa(query.PID),
+				"suggestion": "Tiến trình này có thể chạy trực tiếp trên host hoặc đã kết thúc",
+			})
+			return
+		}
+
+		sortContainerProcesses(byContainer, query.Sort)
+		all := []*HostProcess{}
+		for _, c := range byContainer {
+			all = append(all, c.Processes...)
+		}
+		sortProcesses(all, query.Sort)
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"containers": byContainer,
+			"top":        all[:min(query.Top, len(all))],
+			"total":      len(all),
+		})
+	})
+
+	// Add container logs endpoint
+	r.GET("/logs/:id", func(ctx *gin.Context) {
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		containerID := ctx.Param("id")
+		options, err := logsOptions(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if options.Tail == "" {
+			options.Tail = "100"
+		}
+
+		info, err := cli.ContainerInspect(context, containerID)
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + containerID})
+			return
+		}
+		tty := info.Config != nil && info.Config.Tty
+
+		logs, err := cli.ContainerLogs(context, info.ID, options)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting logs: " + err.Error()})
+			return
+		}
+		defer logs.Close()
+
+		// ?format=lines returns structured lines labelled with their stream
+		if ctx.Query("format") == "lines" {
+			lines, err := collectLogLines(logs, tty, options.Timestamps)
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading logs: " + err.Error()})
+				return
+			}
+			ctx.JSON(http.StatusOK, gin.H{
+				"lines":     lines,
+				"container": containerID,
+			})
+			return
+		}
+
+		var logContent bytes.Buffer
+		if err := copyLogs(&logContent, logs, tty); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading logs: " + err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"logs":      logContent.String(),
+			"container": containerID,
+		})
+	})
+
+	// Follow logs in real time as server-sent events: "log" events with one
+	// line each (stream, timestamp, text), "ping" every logPingInterval so
+	// proxies keep the connection open, and "end" when the container stops.
+	// Same filters as /logs/:id; without ?since or ?tail it starts with the
+	// last 100 lines.
+	r.GET("/logs/:id/stream", func(ctx *gin.Context) {
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		containerID := ctx.Param("id")
+		options, err := logsOptions(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if options.Until != "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      "until can't be used when following logs",
+				"suggestion": "Dùng GET /logs/:id?until=... để xem log trong một khoảng thời gian",
+			})
+			return
+		}
+		if options.Tail == "" && options.Since == "" {
+			options.Tail = "100"
+		}
+		options.Follow = true
+
+		info, err := cli.ContainerInspect(context, containerID)
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + containerID})
+			return
+		}
+		tty := info.Config != nil && info.Config.Tty
+
+		logs, err := cli.ContainerLogs(context, info.ID, options)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting logs: " + err.Error()})
+			return
+		}
+		defer logs.Close()
+
+		// Lines are read in the background so pings go out between them;
+		// only this goroutine writes to the response
+		lines := make(chan LogLine, 64)
+		done := make(chan error, 1)
+		go func() {
+			done <- streamLogLines(logs, tty, options.Timestamps, func(line LogLine) {
+				select {
+				case lines <- line:
+				case <-context.Done():
+				}
+			})
+		}()
+
+		startSSE(ctx)
+		ping := time.NewTicker(logPingInterval)
+		defer ping.Stop()
+		for {
+			select {
+			case line := <-lines:
+				ctx.SSEvent("log", line)
+				ctx.Writer.Flush()
+			case <-ping.C:
+				ctx.SSEvent("ping", gin.H{"time": time.Now().UTC()})
+				ctx.Writer.Flush()
+			case err := <-done:
+				// Lines read before the stream ended are still queued
+				for len(lines) > 0 {
+					ctx.SSEvent("log", <-lines)
+				}
+				if err != nil && context.Err() == nil {
+					ctx.SSEvent("error", err.Error())
+				} else {
+					ctx.SSEvent("end", gin.H{"reason": "container stopped"})
+				}
+				ctx.Writer.Flush()
+				return
+			case <-context.Done():
+				return
+			}
+		}
+	})
+
+	// Run a one-shot container to completion and return its output
+	r.POST("/run", func(ctx *gin.Context) {
+		var req struct {
+			Image   string            `json:"image" binding:"required,imageref"`
+			Command []string          `json:"command"`
+			Shell   string            `json:"shell"`
+			Env     map[string]string `json:"env" binding:"dive,keys,envname,endkeys"`
+			EnvFile string            `json:"env_file"`
+			User    string            `json:"user"`
+			Workdir string            `json:"workdir"`
+			// Seconds before the container is killed, default 60
+			Timeout int `json:"timeout" binding:"min=0,max=3600"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+		if req.Shell != "" && len(req.Command) > 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Use either 'command' or 'shell', not both"})
+			return
+		}
+		if req.User != "" && !validUser(req.User) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user: " + req.User})
+			return
+		}
+		timeout := defaultRunTimeout
+		if req.Timeout > 0 {
+			timeout = time.Duration(req.Timeout) * time.Second
+		}
+		if timeout > maxRunTimeout {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("timeout must not exceed %d seconds", int(maxRunTimeout.Seconds()))})
+			return
+		}
+		env, err := buildEnv(req.EnvFile, req.Env)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		config := &container.Config{
+			Image:      req.Image,
+			Cmd:        req.Command,
+			Env:        env,
+			User:       req.User,
+			WorkingDir: req.Workdir,
+		}
+		if req.Shell != "" {
+			config.Cmd = []string{"sh", "-c", req.Shell}
+		}
+
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		if err := ensureImage(context, cli, req.Image); err != nil {
+			ctx.JSON(pullErrorStatus(err), gin.H{"error": "Error pulling image: " + err.Error()})
+			return
+		}
+
+		result, err := runTask(context, cli, config, &container.HostConfig{}, timeout)
+		if respondHookError(ctx, err) {
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error running container: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	// Send input to a container's stdin and return the output it produces
+	r.POST("/containers/:id/attach", func(ctx *gin.Context) {
+		var req struct {
+			Input string `json:"input"`
+			// Milliseconds of silence after which the output is returned
+			IdleMs     int  `json:"idle_ms" binding:"min=0,max=60000"`
+			CloseStdin bool `json:"close_stdin"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+		idle := 500 * time.Millisecond
+		if req.IdleMs > 0 {
+			idle = time.Duration(req.IdleMs) * time.Millisecond
+		}
+
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		info, err := cli.ContainerInspect(ctx.Request.Context(), ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + ctx.Param("id")})
+			return
+		}
+		if info.Config == nil || !info.Config.OpenStdin {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      "Container was not created with stdin open",
+				"suggestion": "Tạo container với \"stdin_open\": true",
+			})
+			return
+		}
+		if info.State == nil || !info.State.Running {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Container is not running"})
+			return
+		}
+
+		rec := newSessionRecorder(store, recordingKindAttach, info.ID, info.Name, "", actorName(ctx), 0, 0)
+		output, err := attachAndSend(ctx.Request.Context(), cli, info.ID, req.Input, idle, req.CloseStdin, rec)
+		rec.Close(nil)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error attaching to container: " + err.Error()})
+			return
+		}
+		response := gin.H{
+			"output":    output,
+			"container": ctx.Param("id"),
+		}
+		if rec != nil {
+			response["recording_id"] = rec.ID()
+		}
+		ctx.JSON(http.StatusOK, response)
+	})
+
+	// Download the complete log as a text or gzip file
+	r.GET("/logs/:id/download", func(ctx *gin.Context) {
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		options, err := logsOptions(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if options.Tail == "" {
+			options.Tail = "all"
+		}
+		compress := ctx.Query("format") == "gzip"
+
+		info, err := cli.ContainerInspect(context, ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + ctx.Param("id")})
+			return
+		}
+		logs, err := cli.ContainerLogs(context, info.ID, options)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting logs: " + err.Error()})
+			return
+		}
+		defer logs.Close()
+
+		filename := fmt.Sprintf("%s-%s.log", strings.TrimPrefix(info.Name, "/"), time.Now().Format("20060102-150405"))
+		contentType := "text/plain; charset=utf-8"
+		if compress {
+			filename += ".gz"
+			contentType = "application/gzip"
+		}
+		ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		ctx.Header("Content-Type", contentType)
+		ctx.Status(http.StatusOK)
+
+		var w io.Writer = ctx.Writer
+		if compress {
+			gz := gzip.NewWriter(ctx.Writer)
+			defer gz.Close()
+			w = gz
+		}
+		tty := info.Config != nil && info.Config.Tty
+		if err := copyLogs(w, logs, tty); err != nil {
+			fmt.Printf("⚠️  Error streaming logs of %s: %v\n", info.Name, err)
+		}
+	})
+
+	// Add container exec endpoint
+	r.POST("/exec/:id", func(ctx *gin.Context) {
+		var req struct {
+			Command string            `json:"command" binding:"required"`
+			User    string            `json:"user"`
+			Workdir string            `json:"workdir"`
+			Env     map[string]string `json:"env" binding:"dive,keys,envname,endkeys"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+		if req.User != "" && !validUser(req.User) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user: " + req.User})
+			return
+		}
+		env, err := buildEnv("", req.Env)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		containerID := ctx.Param("id")
+		info, err := cli.ContainerInspect(context, containerID)
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + containerID})
+			return
+		}
+		if !enforceExecPolicy(ctx, store, info.Name, req.Command) {
+			return
+		}
+
+		execConfig := container.ExecOptions{
+			Cmd:          []string{"sh", "-c", req.Command},
+			User:         req.User,
+			WorkingDir:   req.Workdir,
+			Env:          env,
+			AttachStdout: true,
+			AttachStderr: true,
+		}
+
+		execResp, err := cli.ContainerExecCreate(context, containerID, execConfig)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating exec: " + err.Error()})
+			return
+		}
+
+		resp, err := cli.ContainerExecAttach(context, execResp.ID, container.ExecStartOptions{})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting exec: " + err.Error()})
+			return
+		}
+		defer resp.Close()
+
+		// ?stream=true sends output as server-sent events while the command
+		// runs: "stdout" and "stderr" chunks, then "exit" with the exit code
+		if ctx.Query("stream") == "true" {
+			startSSE(ctx)
+			if _, err := stdcopy.StdCopy(sseWriter{ctx, "stdout"}, sseWriter{ctx, "stderr"}, resp.Reader); err != nil {
+				ctx.SSEvent("error", err.Error())
+				return
+			}
+			inspect, err := cli.ContainerExecInspect(context, execResp.ID)
+			if err != nil {
+				ctx.SSEvent("error", err.Error())
+				return
+			}
+			ctx.SSEvent("exit", gin.H{"exit_code": inspect.ExitCode})
+			return
+		}
+
+		// Split the multiplexed stream, keeping a combined copy in order
+		var output, stdout, stderr bytes.Buffer
+		if _, err := stdcopy.StdCopy(io.MultiWriter(&output, &stdout), io.MultiWriter(&output, &stderr), resp.Reader); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading output: " + err.Error()})
+			return
+		}
+
+		inspect, err := cli.ContainerExecInspect(context, execResp.ID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error inspecting exec: " + err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"output":    output.String(),
+			"stdout":    stdout.String(),
+			"stderr":    stderr.String(),
+			"exit_code": inspect.ExitCode,
+			"command":   req.Command,
+			"container": containerID,
+		})
+	})
+
+	// Interactive exec terminal over WebSocket, see terminalMessage for the
+	// protocol. Served at /terminal/:id as well for browser shells.
+	execTerminalHandler := func(ctx *gin.Context) {
+		cmd := ctx.QueryArray("cmd")
+		if len(cmd) == 0 {
+			cmd = []string{"/bin/sh"}
+		}
+		cols, _ := strconv.ParseUint(ctx.Query("cols"), 10, 16)
+		rows, _ := strconv.ParseUint(ctx.Query("rows"), 10, 16)
+
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		info, err := cli.ContainerInspect(ctx.Request.Context(), ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + ctx.Param("id")})
+			return
+		}
+		if info.State == nil || !info.State.Running {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Container is not running"})
+			return
+		}
+		if !enforceExecPolicy(ctx, store, info.Name, strings.Join(cmd, " ")) {
+			return
+		}
+
+		// websocket.Server rather than websocket.Handler: non-browser clients
+		// don't send an Origin header
+		websocket.Server{Handshake: terminalHandshake, Handler: func(ws *websocket.Conn) {
+			rec := newSessionRecorder(store, recordingKindExec, info.ID, info.Name, strings.Join(cmd, " "), actorName(ctx), uint(cols), uint(rows))
+			execTerminal(ws, cli, info.ID, cmd, uint(cols), uint(rows), rec)
+		}}.ServeHTTP(ctx.Writer, ctx.Request)
+	}
+	r.GET("/exec/:id/terminal", execTerminalHandler)
+	r.GET("/terminal/:id", execTerminalHandler)
+
+	// Checkpoint and restore with CRIU, needs an experimental daemon
+	r.GET("/containers/:id/checkpoints", func(ctx *gin.Context) {
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+		if !requireExperimental(ctx, cli) {
+			return
+		}
+
+		checkpoints, err := cli.CheckpointList(ctx.Request.Context(), ctx.Param("id"), checkpoint.ListOptions{})
+		if err != nil {
+			ctx.JSON(checkpointErrorStatus(err), gin.H{"error": "Error listing checkpoints: " + err.Error()})
+			return
+		}
+		names := make([]string, 0, len(checkpoints))
+		for _, c := range checkpoints {
+			names = append(names, c.Name)
+		}
+		ctx.JSON(http.StatusOK, gin.H{"container": ctx.Param("id"), "checkpoints": names})
+	})
+
+	r.POST("/containers/:id/checkpoints", func(ctx *gin.Context) {
+		var req struct {
+			Name string `json:"name" binding:"required,resourcename"`
+			// Keep the container running after the checkpoint, by default
+			// it is stopped like "docker checkpoint create" does
+			LeaveRunning bool `json:"leave_running"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+		if !requireExperimental(ctx, cli) {
+			return
+		}
+
+		info, err := cli.ContainerInspect(ctx.Request.Context(), ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + ctx.Param("id")})
+			return
+		}
+		if info.State == nil || !info.State.Running {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Only running containers can be checkpointed"})
+			return
+		}
+		// Checkpointing without leave_running stops the container
+		if !req.LeaveRunning && !allowUnprotected(ctx, cli, store, info.ID) {
+			return
+		}
+
+		err = cli.CheckpointCreate(ctx.Request.Context(), info.ID, checkpoint.CreateOptions{
+			CheckpointID: req.Name,
+			Exit:         !req.LeaveRunning,
+		})
+		if err != nil {
+			ctx.JSON(checkpointErrorStatus(err), gin.H{
+				"error":      "Error creating checkpoint: " + err.Error(),
+				"suggestion": "Kiểm tra CRIU đã được cài trên máy chủ Docker (criu check)",
+			})
+			return
+		}
+		fmt.Printf("❄️  Checkpoint %s of %s created by %s\n", req.Name, strings.TrimPrefix(info.Name, "/"), actorName(ctx))
+		ctx.JSON(http.StatusOK, gin.H{
+			"message":    "Checkpoint " + req.Name + " created successfully",
+			"checkpoint": req.Name,
+			"running":    req.LeaveRunning,
+		})
+	})
+
+	r.DELETE("/containers/:id/checkpoints/:name", func(ctx *gin.Context) {
+		if !configName.MatchString(ctx.Param("name")) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid checkpoint name: " + ctx.Param("name")})
+			return
+		}
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+		if !requireExperimental(ctx, cli) {
+			return
+		}
+
+		err = cli.CheckpointDelete(ctx.Request.Context(), ctx.Param("id"), checkpoint.DeleteOptions{CheckpointID: ctx.Param("name")})
+		if err != nil {
+			ctx.JSON(checkpointErrorStatus(err), gin.H{"error": "Error deleting checkpoint: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Checkpoint " + ctx.Param("name") + " deleted successfully"})
+	})
+
+	// Experimental: move a running container to another Docker host from
+	// MIGRATION_HOSTS through a checkpoint
+	r.POST("/containers/:id/migrate", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can migrate containers"})
+			return
+		}
+		var req struct {
+			Target string `json:"target" binding:"required"`
+			// Remove the stopped source container once the target runs
+			RemoveSource bool `json:"remove_source"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+		target, err := migrationClient(req.Target)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      err.Error(),
+				"available":  migrationHostNames(),
+				"suggestion": "Khai báo máy đích trong MIGRATION_HOSTS, ví dụ: node2=tcp://10.0.0.2:2376",
+			})
+			return
+		}
+		defer target.Close()
+
+		// The source container is stopped during the migration
+		if !allowUnprotected(ctx, cli, store, ctx.Param("id")) {
+			return
+		}
+
+		var result *MigrationResult
+		job, err := runJob(store, "migrate", func() (any, error) {
+			var err error
+			result, err = migrateContainer(ctx.Request.Context(), cli, target, ctx.Param("id"), req.Target, req.RemoveSource)
+			return result, err
+		})
+		if err != nil {
+			status := http.StatusInternalServerError
+			if client.IsErrNotFound(err) {
+				status = http.StatusNotFound
+			}
+			body := gin.H{"error": "Migration failed: " + err.Error(), "result": result}
+			if job != nil {
+				body["job_id"] = job.ID
+			}
+			ctx.JSON(status, body)
+			return
+		}
+		fmt.Printf("🚚 %s migrated to %s by %s\n", result.Container, req.Target, actorName(ctx))
+		// It lives on the target host now
+		if result.SourceRemoved {
+			untrackDesired(store, result.Container)
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Container " + result.Container + " migrated to " + req.Target, "job_id": job.ID, "result": result})
+	})
+
+	r.GET("/migration/hosts", func(ctx *gin.Context) {
+		hosts := []gin.H{}
+		for _, name := range migrationHostNames() {
+			host := gin.H{"name": name, "reachable": false, "experimental": false}
+			if cli, err := migrationClient(name); err == nil {
+				if ping, err := cli.Ping(ctx.Request.Context()); err == nil {
+					host["reachable"] = true
+					host["experimental"] = ping.Experimental
+				} else {
+					host["error"] = err.Error()
+				}
+				cli.Close()
+			}
+			hosts = append(hosts, host)
+		}
+		ctx.JSON(http.StatusOK, gin.H{"hosts": hosts, "checkpoint_dir": migrationCheckpointDir()})
+	})
+
+	// Start a stopped container from a checkpoint
+	r.POST("/containers/:id/restore", func(ctx *gin.Context) {
+		var req struct {
+			Checkpoint string `json:"checkpoint" binding:"required,resourcename"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+		if !requireExperimental(ctx, cli) {
+			return
+		}
+
+		info, err := cli.ContainerInspect(ctx.Request.Context(), ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + ctx.Param("id")})
+			return
+		}
+		if info.State != nil && info.State.Running {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":      "Container is running, restoring needs a stopped container",
+				"suggestion": "Dừng container trước, hoặc tạo checkpoint không có leave_running",
+			})
+			return
+		}
+
+		if err := startContainer(ctx.Request.Context(), cli, info.ID, container.StartOptions{CheckpointID: req.Checkpoint}); err != nil {
+			if respondHookError(ctx, err) {
+				return
+			}
+			ctx.JSON(checkpointErrorStatus(err), gin.H{"error": "Error restoring checkpoint: " + err.Error()})
+			return
+		}
+		fmt.Printf("🔥 %s restored from checkpoint %s by %s\n", strings.TrimPrefix(info.Name, "/"), req.Checkpoint, actorName(ctx))
+		ctx.JSON(http.StatusOK, gin.H{"message": "Container " + ctx.Param("id") + " restored from checkpoint " + req.Checkpoint})
+	})
+
+	// Attach to the main process of a container over WebSocket, for apps that
+	// interact on their primary TTY. Same protocol as the exec terminal.
+	r.GET("/ws/attach/:id", func(ctx *gin.Context) {
+		logs, _ := strconv.ParseBool(ctx.Query("logs"))
+		cols, _ := strconv.ParseUint(ctx.Query("cols"), 10, 16)
+		rows, _ := strconv.ParseUint(ctx.Query("rows"), 10, 16)
+
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		info, err := cli.ContainerInspect(ctx.Request.Context(), ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + ctx.Param("id")})
+			return
+		}
+		if info.State == nil || !info.State.Running {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":      "Container is not running",
+				"suggestion": "Khởi động container trước khi attach",
+			})
+			return
+		}
+
+		websocket.Server{Handshake: terminalHandshake, Handler: func(ws *websocket.Conn) {
+			rec := newSessionRecorder(store, recordingKindAttach, info.ID, info.Name, "", actorName(ctx), uint(cols), uint(rows))
+			attachTerminal(ws, cli, info, logs, uint(cols), uint(rows), rec)
+		}}.ServeHTTP(ctx.Writer, ctx.Request)
+	})
+
+	// Temporary TCP tunnel to a port inside a container
+	r.POST("/containers/:id/tunnels", func(ctx *gin.Context) {
+		var req struct {
+			Port int    `json:"port" binding:"required,min=1,max=65535"`
+			TTL  string `json:"ttl" binding:"omitempty,ttl"`
+			// Addresses or networks allowed to connect, the caller's by default
+			AllowFrom []string `json:"allow_from" binding:"dive,cidr|ip"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+		ttl := defaultTunnelTTL
+		if req.TTL != "" {
+			ttl, _ = parseTTL(req.TTL)
+		}
+		if ttl > maxTunnelTTL {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      "Tunnel ttl can be at most " + maxTunnelTTL.String(),
+				"suggestion": "Tunnel chỉ dùng để debug tạm thời, hãy mở lại tunnel mới khi cần",
+			})
+			return
+		}
+		if len(req.AllowFrom) == 0 {
+			req.AllowFrom = []string{ctx.ClientIP()}
+		}
+
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		info, err := cli.ContainerInspect(ctx.Request.Context(), ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + ctx.Param("id")})
+			return
+		}
+		if info.State == nil || !info.State.Running {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":      "Container is not running",
+				"suggestion": "Khởi động container trước khi mở tunnel",
+			})
+			return
+		}
+
+		tunnel, err := tunnels.Open(info, req.Port, ttl, actorName(ctx), req.AllowFrom)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error opening tunnel: " + err.Error()})
+			return
+		}
+		fmt.Printf("🚇 Tunnel %s on %s to %s:%d opened by %s\n", tunnel.ID, tunnel.Address, tunnel.ContainerName, req.Port, actorName(ctx))
+		ctx.JSON(http.StatusCreated, gin.H{
+			"tunnel":    tunnel.Snapshot(),
+			"websocket": "/tunnels/" + tunnel.ID + "/ws",
+		})
+	})
+
+	r.GET("/tunnels", func(ctx *gin.Context) {
+		list := []Tunnel{}
+		for _, tunnel := range tunnels.List() {
+			if isAdmin(ctx) || (currentUser(ctx) != nil && tunnel.CreatedBy == actorName(ctx)) {
+				list = append(list, tunnel.Snapshot())
+			}
+		}
+		ctx.JSON(http.StatusOK, gin.H{"tunnels": list})
+	})
+
+	r.DELETE("/tunnels/:id", func(ctx *gin.Context) {
+		tunnel, ok := tunnelForCaller(ctx, tunnels)
+		if !ok {
+			return
+		}
+		tunnels.Close(tunnel.ID)
+		ctx.JSON(http.StatusOK, gin.H{"message": "Tunnel closed"})
+	})
+
+	// The tunnel over a WebSocket, authenticated like any API request
+	r.GET("/tunnels/:id/ws", func(ctx *gin.Context) {
+		tunnel, ok := tunnelForCaller(ctx, tunnels)
+		if !ok {
+			return
+		}
+		serveTunnelWebSocket(ctx, tunnel)
+	})
+
+	// Add bulk operations endpoint
 	r.POST("/bulk/:action", func(ctx *gin.Context) {
 		var req struct {
-			Containers []string `json:"containers"`
+			Containers []string `json:"containers" binding:"required,min=1,dive,required,containerref"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+
+		action := ctx.Param("action")
+		permanent, _ := strconv.ParseBool(ctx.Query("permanent"))
+		context := ctx.Request.Context()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		if action == "remove" {
+			running := []gin.H{}
+			for _, containerID := range req.Containers {
+				if info, err := cli.ContainerInspect(context, containerID); err == nil && info.State != nil && info.State.Running {
+					running = append(running, containerImpact(info))
+				}
+			}
+			targets := append([]string(nil), req.Containers...)
+			sort.Strings(targets)
+			if len(running) > 0 && !confirmations.Confirmed(ctx, "bulk_remove", strings.Join(targets, ","), gin.H{"running": running}) {
+				return
+			}
+		}
+
+		if action == "remove" && requireApproval && !isAdmin(ctx) {
+			if len(req.Containers) == 0 {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "No containers given"})
+				return
+			}
+			// Approval runs without the request's parameters, check protection now
+			for _, containerID := range req.Containers {
+				if !allowUnprotected(ctx, cli, store, containerID) {
+					return
+				}
+			}
+			requestApproval(ctx, store, approvalBulkRemove, req.Containers)
+			return
+		}
+
+		results := make(map[string]interface{})
+		successCount := 0
+		errorCount := 0
+
+		override := overrideProtection(ctx)
+		for _, containerID := range req.Containers {
+			var err error
+			if (action == "stop" || action == "remove" || action == "restart") && !override {
+				if err := checkProtected(context, cli, store, containerID); err != nil {
+					results[containerID] = gin.H{"status": "error", "message": err.Error()}
+					errorCount++
+					continue
+				}
+			}
+
+			switch action {
+			case "start":
+				err = startContainer(context, cli, containerID, container.StartOptions{})
+			case "stop":
+				timeout := 30 // 30 seconds timeout
+				err = stopContainer(context, cli, containerID, container.StopOptions{Timeout: &timeout})
+			case "remove":
+				_, err = trash.Remove(context, cli, containerID, actorName(ctx), permanent)
+			case "restart":
+				timeout := 30 // 30 seconds timeout
+				err = restartContainer(context, cli, containerID, container.StopOptions{Timeout: &timeout})
+			default:
+				err = fmt.Errorf("unknown action: %s", action)
+			}
+
+			if err != nil {
+				results[containerID] = gin.H{"status": "error", "message": err.Error()}
+				errorCount++
+				fmt.Printf("❌ Bulk %s failed for container %s: %v\n", action, containerID, err)
+			} else {
+				results[containerID] = gin.H{"status": "success"}
+				successCount++
+				fmt.Printf("✅ Bulk %s succeeded for container %s\n", action, containerID)
+			}
+		}
+
+		fmt.Printf("📦 Bulk %s completed: %d success, %d errors\n", action, successCount, errorCount)
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"action":  action,
+			"results": results,
+			"summary": gin.H{
+				"total":   len(req.Containers),
+				"success": successCount,
+				"errors":  errorCount,
+			},
+		})
+	})
+
+	// Add system cleanup endpoint
+	// With ?volumes=true, unused anonymous volumes go too
+	r.POST("/cleanup", func(ctx *gin.Context) {
+		volumes := ctx.Query("volumes") == "true"
+		if requireApproval && !isAdmin(ctx) {
+			var targets []string
+			if volumes {
+				targets = []string{"volumes"}
+			}
+			requestApproval(ctx, store, approvalPrune, targets)
+			return
+		}
+
+		output, err := systemPrune(volumes)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error running cleanup: " + err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"message": "System cleanup completed",
+			"output":  output,
+		})
+	})
+
+	// Check a Dockerfile for common mistakes before building it
+	r.POST("/dockerfile/lint", func(ctx *gin.Context) {
+		var req struct {
+			Dockerfile string `json:"dockerfile" binding:"required"`
+			// Codes to skip, e.g. ["DL3008"]
+			Ignore []string `json:"ignore"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+		findings := lintDockerfile(req.Dockerfile, req.Ignore)
+		summary := lintSummary(findings)
+		ctx.JSON(http.StatusOK, gin.H{
+			"passed":   summary["error"] == 0,
+			"summary":  summary,
+			"findings": findings,
+		})
+	})
+
+	// Build cache entries, for deleting some rather than pruning all
+	r.GET("/build-cache", func(ctx *gin.Context) {
+		var query BuildCacheQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			respondBindError(ctx, err)
+			return
+		}
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating Docker client: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		entries, total, err := listBuildCache(ctx.Request.Context(), cli, query)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading build cache: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"entries": entries, "count": len(entries), "total_size": total})
+	})
+
+	r.POST("/build-cache/delete", func(ctx *gin.Context) {
+		var req struct {
+			IDs []string `json:"ids" binding:"required,min=1,max=1000"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating Docker client: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		results, reclaimed, err := deleteBuildCache(ctx.Request.Context(), cli, req.IDs)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error":      "Error deleting build cache entries: " + err.Error(),
+				"suggestion": "Kiểm tra Docker daemon có đang chạy không",
+			})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"results": results, "space_reclaimed": reclaimed})
+	})
+
+	// What POST /cleanup would remove and the space it would free
+	r.GET("/cleanup/preview", func(ctx *gin.Context) {
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating Docker client: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		preview, err := previewCleanup(ctx, cli, ctx.Query("volumes") == "true")
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error":      "Error previewing cleanup: " + err.Error(),
+				"suggestion": "Kiểm tra Docker daemon có đang chạy không",
+			})
+			return
+		}
+		ctx.JSON(http.StatusOK, preview)
+	})
+
+	// Soft-deleted containers, see TRASH_GRACE_PERIOD
+	r.GET("/trash", func(ctx *gin.Context) {
+		trashed, err := store.ListTrashed()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing trash: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"enabled": trash.Enabled(), "containers": trashed})
+	})
+
+	r.POST("/trash/:id/restore", func(ctx *gin.Context) {
+		trashed, err := store.GetTrashed(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found in trash: " + ctx.Param("id")})
+			return
+		}
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		if err := trash.Restore(ctx.Request.Context(), cli, trashed); err != nil {
+			if respondHookError(ctx, err) {
+				return
+			}
+			if strings.Contains(err.Error(), "already in use") {
+				ctx.JSON(http.StatusConflict, gin.H{
+					"error":      "Error restoring container: " + err.Error(),
+					"suggestion": "Tên " + trashed.OriginalName + " đã được dùng bởi container khác, đổi tên hoặc xóa container đó trước",
+				})
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error restoring container: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Container " + trashed.OriginalName + " restored successfully", "container": trashed})
+	})
+
+	// Empty one container from the trash before its grace period ends
+	r.DELETE("/trash/:id", func(ctx *gin.Context) {
+		trashed, err := store.GetTrashed(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found in trash: " + ctx.Param("id")})
+			return
+		}
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		if _, err := trash.Remove(ctx.Request.Context(), cli, trashed.ContainerID, actorName(ctx), true); err != nil && !client.IsErrNotFound(err) {
+			if respondHookError(ctx, err) {
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing container: " + err.Error()})
+			return
+		}
+		store.DeleteTrashed(trashed.ContainerID)
+		ctx.JSON(http.StatusOK, gin.H{"message": "Container " + trashed.OriginalName + " removed permanently"})
+	})
+
+	// Approval queue for destructive actions, see REQUIRE_APPROVAL
+	r.GET("/approvals", func(ctx *gin.Context) {
+		approvals, err := store.ListApprovals(ctx.Query("status"))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing approvals: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"approvals": approvals})
+	})
+
+	r.GET("/approvals/:id", func(ctx *gin.Context) {
+		approval, err := store.GetApproval(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Approval not found: " + ctx.Param("id")})
+			return
+		}
+		ctx.JSON(http.StatusOK, approval)
+	})
+
+	r.POST("/approvals/:id/approve", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can approve actions"})
+			return
+		}
+		approval, err := store.GetApproval(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Approval not found: " + ctx.Param("id")})
+			return
+		}
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		claimed, err := store.ClaimApproval(approval.ID, approvalRunning, actorName(ctx), "")
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating approval: " + err.Error()})
+			return
+		}
+		if !claimed {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Approval was already decided", "approval": approval})
+			return
+		}
+
+		approval.DecidedBy = actorName(ctx)
+		result, err := executeApproval(ctx.Request.Context(), cli, trash, approval)
+		approval.Status = approvalApproved
+		if err != nil {
+			approval.Status = approvalFailed
+			approval.Error = err.Error()
+		}
+		if result != nil {
+			approval.Result, _ = json.Marshal(result)
+		}
+		if err := store.FinishApproval(approval); err != nil {
+			fmt.Printf("⚠️  Error saving approval result: %v\n", err)
+		}
+		approval, _ = store.GetApproval(approval.ID)
+
+		if approval.Status == approvalFailed {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Approved action failed: " + approval.Error, "approval": approval})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Action approved and executed", "approval": approval})
+	})
+
+	r.POST("/approvals/:id/reject", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can reject actions"})
+			return
+		}
+		var req struct {
+			Reason string `json:"reason" binding:"max=500"`
+		}
+		// The reason is optional, an empty body is fine
+		if !bindOptionalJSON(ctx, &req) {
+			return
+		}
+
+		claimed, err := store.ClaimApproval(ctx.Param("id"), approvalRejected, actorName(ctx), req.Reason)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating approval: " + err.Error()})
+			return
+		}
+		approval, err := store.GetApproval(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Approval not found: " + ctx.Param("id")})
+			return
+		}
+		if !claimed {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Approval was already decided", "approval": approval})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Action rejected", "approval": approval})
+	})
+
+	// Quotas per user or project, enforced when containers are created
+	r.GET("/quotas", func(ctx *gin.Context) {
+		quotas, err := store.ListQuotas()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing quotas: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"quotas": quotas})
+	})
+
+	r.GET("/quotas/:scope/:subject", func(ctx *gin.Context) {
+		quota, err := store.GetQuota(ctx.Param("scope"), ctx.Param("subject"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Quota not found: " + ctx.Param("scope") + "/" + ctx.Param("subject")})
+			return
+		}
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		usage, _, err := quotaUsage(ctx.Request.Context(), cli, quota.label(), quota.Subject)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error computing quota usage: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"quota": quota, "usage": usage})
+	})
+
+	r.PUT("/quotas/:scope/:subject", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change quotas"})
+			return
+		}
+		var quota Quota
+		if !bindJSON(ctx, &quota) {
+			return
+		}
+		quota.Scope = ctx.Param("scope")
+		quota.Subject = ctx.Param("subject")
+		if err := validateQuota(&quota); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      err.Error(),
+				"suggestion": "Ví dụ: PUT /quotas/user/alice {\"max_containers\": 10, \"max_memory\": \"8g\", \"max_volumes\": 5}",
+			})
+			return
+		}
+		if quota.Scope == quotaScopeProject {
+			if _, err := store.GetProject(quota.Subject); err != nil {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "Project not found: " + quota.Subject})
+				return
+			}
+		}
+		quota.UpdatedBy = actorName(ctx)
+		if err := store.SaveQuota(&quota); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving quota: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Quota saved successfully", "quota": quota})
+	})
+
+	r.DELETE("/quotas/:scope/:subject", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change quotas"})
+			return
+		}
+		deleted, err := store.DeleteQuota(ctx.Param("scope"), ctx.Param("subject"))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting quota: " + err.Error()})
+			return
+		}
+		if !deleted {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Quota not found: " + ctx.Param("scope") + "/" + ctx.Param("subject")})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Quota deleted successfully"})
+	})
+
+	r.GET("/jobs/:id", func(ctx *gin.Context) {
+		job, err := store.GetJob(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Job not found: " + ctx.Param("id")})
+			return
+		}
+		ctx.JSON(http.StatusOK, job)
+	})
+
+	r.GET("/jobs", func(ctx *gin.Context) {
+		limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "50"))
+		if err != nil || limit <= 0 || limit > 500 {
+			limit = 50
+		}
+		jobs, err := store.ListJobs(ctx.Query("type"), limit)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing jobs: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"jobs": jobs})
+	})
+
+	// Image retention rules, enforced by the cleanup scheduler
+	r.GET("/retention", func(ctx *gin.Context) {
+		rules, err := store.ListRetentionRules()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing retention rules: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"rules": rules})
+	})
+
+	r.POST("/retention", func(ctx *gin.Context) {
+		var rule RetentionRule
+		if !bindJSON(ctx, &rule) {
+			return
+		}
+		if err := validateRetentionRule(&rule); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      err.Error(),
+				"suggestion": "Ví dụ: {\"repository\": \"registry.local:5000/app\", \"keep_last\": 10, \"max_age_days\": 30}",
+			})
+			return
+		}
+		rule.CreatedBy = actorName(ctx)
+		if err := store.CreateRetentionRule(&rule); err != nil {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":      "Error creating retention rule: " + err.Error(),
+				"suggestion": "Mỗi repository chỉ có một quy tắc, xóa quy tắc cũ trước khi tạo lại",
+			})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Retention rule created successfully", "rule": rule})
+	})
+
+	r.DELETE("/retention/:id", func(ctx *gin.Context) {
+		deleted, err := store.DeleteRetentionRule(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting retention rule: " + err.Error()})
+			return
+		}
+		if !deleted {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Retention rule not found: " + ctx.Param("id")})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Retention rule deleted successfully"})
+	})
+
+	// Enforce the rules now instead of waiting for the scheduler,
+	// ?dry_run=true only reports what would be removed
+	r.POST("/retention/apply", func(ctx *gin.Context) {
+		dryRun, _ := strconv.ParseBool(ctx.Query("dry_run"))
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			return
+		}
+		defer cli.Close()
+
+		if dryRun {
+			results, err := applyRetention(ctx.Request.Context(), cli, store, true)
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error applying retention rules: " + err.Error()})
+				return
+			}
+			ctx.JSON(http.StatusOK, gin.H{"dry_run": true, "results": results})
+			return
+		}
+
+		var results []RetentionResult
+		job, err := runJob(store, "image_retention", func() (any, error) {
+			var err error
+			results, err = applyRetention(ctx.Request.Context(), cli, store, false)
+			return results, err
+		})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error applying retention rules: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"dry_run": false, "job_id": job.ID, "results": results})
+	})
+
+	// Recorded exec terminal and attach sessions
+	r.GET("/recordings", func(ctx *gin.Context) {
+		limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "100"))
+		if err != nil || limit < 1 || limit > 1000 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit: must be a number between 1 and 1000"})
+			return
+		}
+		// Users only see their own sessions
+		recordedBy := ""
+		if !isAdmin(ctx) {
+			if currentUser(ctx) == nil {
+				ctx.JSON(http.StatusOK, gin.H{"recordings": []Recording{}})
+				return
+			}
+			recordedBy = actorName(ctx)
+		}
+		recordings, err := store.ListRecordings(ctx.Query("container"), recordedBy, limit)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing recordings: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"recordings": recordings})
+	})
+
+	r.GET("/recordings/:id", func(ctx *gin.Context) {
+		if rec, ok := recordingForCaller(ctx, store); ok {
+			ctx.JSON(http.StatusOK, rec)
+		}
+	})
+
+	// Download as an asciicast v2 file, playable with "asciinema play"
+	r.GET("/recordings/:id/cast", func(ctx *gin.Context) {
+		rec, ok := recordingForCaller(ctx, store)
+		if !ok {
+			return
 		}
-		if err := ctx.ShouldBindJSON(&req); err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+		data, err := store.RecordingData(rec.ID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading recording: " + err.Error()})
+			return
+		}
+		ctx.Header("Content-Disposition", "attachment; filename="+rec.ID+".cast")
+		ctx.Data(http.StatusOK, "application/x-asciicast", []byte(data))
+	})
+
+	// Replay with the original timing as server-sent events: "header", then
+	// "output", "input" and "resize", and "end". ?speed=2 plays twice as
+	// fast, pauses are capped at ?max_idle seconds (default 2).
+	r.GET("/recordings/:id/play", func(ctx *gin.Context) {
+		speed, err := strconv.ParseFloat(ctx.DefaultQuery("speed", "1"), 64)
+		if err != nil || speed < 0.1 || speed > 100 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid speed: must be a number between 0.1 and 100"})
+			return
+		}
+		maxIdle, err := strconv.ParseFloat(ctx.DefaultQuery("max_idle", "2"), 64)
+		if err != nil || maxIdle <= 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid max_idle: must be a positive number of seconds"})
+			return
+		}
+		rec, ok := recordingForCaller(ctx, store)
+		if !ok {
+			return
+		}
+		data, err := store.RecordingData(rec.ID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading recording: " + err.Error()})
+			return
+		}
+		header, events, err := parseCast(data)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading recording: " + err.Error()})
+			return
+		}
+
+		startSSE(ctx)
+		ctx.SSEvent("header", header)
+		ctx.Writer.Flush()
+		names := map[string]string{"o": "output", "i": "input", "r": "resize"}
+		last := 0.0
+		for _, e := range events {
+			name, ok := names[e.Code]
+			if !ok {
+				continue
+			}
+			wait := min(e.Time-last, maxIdle) / speed
+			last = e.Time
+			select {
+			case <-time.After(time.Duration(wait * float64(time.Second))):
+			case <-ctx.Request.Context().Done():
+				return
+			}
+			ctx.SSEvent(name, e.Data)
+			ctx.Writer.Flush()
+		}
+		ctx.SSEvent("end", gin.H{"exit_code": rec.ExitCode, "truncated": rec.Truncated})
+		ctx.Writer.Flush()
+	})
+
+	r.DELETE("/recordings/:id", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can delete recordings"})
+			return
+		}
+		deleted, err := store.DeleteRecording(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting recording: " + err.Error()})
+			return
+		}
+		if !deleted {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Recording not found: " + ctx.Param("id")})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Recording deleted successfully"})
+	})
+
+	// Allow/deny rules for /exec and the exec terminal
+	// Routes of the built-in reverse proxy, with where they currently point
+	r.GET("/proxy/routes", func(ctx *gin.Context) {
+		routes, err := store.ListProxyRoutes()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing proxy routes: " + err.Error()})
 			return
 		}
-
-		action := ctx.Param("action")
-		context := ctx.Request.Context()
 		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon: " + err.Error()})
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot connect to Docker daemon. Is Docker running? " + err.Error()})
 			return
 		}
 		defer cli.Close()
 
-		results := make(map[string]interface{})
-		successCount := 0
-		errorCount := 0
-
-		for _, containerID := range req.Containers {
-			var err error
+		withUpstream := func(routes []ProxyRoute) []gin.H {
+			list := []gin.H{}
+			for i := range routes {
+				entry := gin.H{"route": routes[i]}
+				if target, err := proxy.Upstream(ctx.Request.Context(), cli, &routes[i]); err != nil {
+					entry["error"] = err.Error()
+				} else {
+					entry["upstream"] = target.Host
+				}
+				list = append(list, entry)
+			}
+			return list
+		}
+		autoRoutes, err := proxy.AutoRoutes(ctx.Request.Context(), cli)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing containers: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"enabled":     os.Getenv("PROXY_ADDR") != "",
+			"addr":        os.Getenv("PROXY_ADDR"),
+			"domain":      proxyDomain(),
+			"routes":      withUpstream(routes),
+			"auto_routes": withUpstream(autoRoutes),
+		})
+	})
 
-			switch action {
-			case "start":
-				err = cli.ContainerStart(context, containerID, container.StartOptions{})
-			case "stop":
-				timeout := 30 // 30 seconds timeout
-				err = cli.ContainerStop(context, containerID, container.StopOptions{Timeout: &timeout})
-			case "remove":
-				err = cli.ContainerRemove(context, containerID, container.RemoveOptions{Force: true})
-			case "restart":
-				timeout := 30 // 30 seconds timeout
-				err = cli.ContainerRestart(context, containerID, container.StopOptions{Timeout: &timeout})
-			default:
-				err = fmt.Errorf("unknown action: %s", action)
+	r.POST("/proxy/routes", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can manage proxy routes"})
+			return
+		}
+		var route ProxyRoute
+		if !bindJSON(ctx, &route) {
+			return
+		}
+		if err := validateProxyRoute(&route); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      err.Error(),
+				"suggestion": "Ví dụ: {\"host\": \"app.example.com\", \"path\": \"/api\", \"container\": \"api\", \"port\": 8080}",
+			})
+			return
+		}
+		existing, err := store.ListProxyRoutes()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing proxy routes: " + err.Error()})
+			return
+		}
+		for _, e := range existing {
+			if e.Host == route.Host && e.Path == route.Path {
+				ctx.JSON(http.StatusConflict, gin.H{
+					"error":      "A route for " + route.Host + route.Path + " already exists: " + e.ID,
+					"suggestion": "Xóa route cũ bằng DELETE /proxy/routes/" + e.ID + " trước khi tạo lại",
+				})
+				return
 			}
+		}
+		route.CreatedBy = actorName(ctx)
+		if err := store.CreateProxyRoute(&route); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating proxy route: " + err.Error()})
+			return
+		}
+		if err := proxy.Reload(); err != nil {
+			fmt.Printf("⚠️  Error reloading proxy routes: %v\n", err)
+		}
+		ctx.JSON(http.StatusCreated, route)
+	})
+
+	r.DELETE("/proxy/routes/:id", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can manage proxy routes"})
+			return
+		}
+		deleted, err := store.DeleteProxyRoute(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting proxy route: " + err.Error()})
+			return
+		}
+		if !deleted {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Proxy route not found: " + ctx.Param("id")})
+			return
+		}
+		if err := proxy.Reload(); err != nil {
+			fmt.Printf("⚠️  Error reloading proxy routes: %v\n", err)
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Proxy route deleted successfully"})
+	})
+
+	r.GET("/exec-policy", func(ctx *gin.Context) {
+		rules, err := store.ListExecRules()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing exec rules: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"default": execDefaultEffect(), "rules": rules})
+	})
+
+	r.POST("/exec-policy", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change exec rules"})
+			return
+		}
+		var rule ExecRule
+		if !bindJSON(ctx, &rule) {
+			return
+		}
+		if err := validateExecRule(&rule); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      err.Error(),
+				"suggestion": "Ví dụ: {\"effect\": \"deny\", \"command\": \"^(apt|apt-get|apk|yum|pip) \", \"roles\": [\"user\"]}",
+			})
+			return
+		}
+		rule.CreatedBy = actorName(ctx)
+		if err := store.CreateExecRule(&rule); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating exec rule: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Exec rule created successfully", "rule": rule})
+	})
+
+	r.DELETE("/exec-policy/:id", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change exec rules"})
+			return
+		}
+		deleted, err := store.DeleteExecRule(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting exec rule: " + err.Error()})
+			return
+		}
+		if !deleted {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Exec rule not found: " + ctx.Param("id")})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Exec rule deleted successfully"})
+	})
+
+	// Lifecycle hooks from HOOKS_FILE, see hooks.go
+	r.GET("/hooks", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can view hooks"})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"hooks": containerHooks.List()})
+	})
+
+	// Auto-heal rules, see heal_rules.go. Runs are listed in GET /jobs?type=autoheal
+	r.GET("/heal-rules", func(ctx *gin.Context) {
+		rules, err := store.ListHealRules()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing heal rules: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"rules": rules})
+	})
+
+	r.POST("/heal-rules", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change heal rules"})
+			return
+		}
+		var rule HealRule
+		if !bindJSON(ctx, &rule) {
+			return
+		}
+		if err := validateHealRule(&rule); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      err.Error(),
+				"suggestion": "Ví dụ: {\"name\": \"restart crashed web\", \"trigger\": \"died\", \"containers\": \"web-*\", \"action\": \"restart\"}",
+			})
+			return
+		}
+		rule.CreatedBy = actorName(ctx)
+		if err := store.CreateHealRule(&rule); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating heal rule: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Heal rule created successfully", "rule": rule})
+	})
 
+	setHealRuleDisabled := func(disabled bool) gin.HandlerFunc {
+		return func(ctx *gin.Context) {
+			if !isAdmin(ctx) {
+				ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change heal rules"})
+				return
+			}
+			found, err := store.SetHealRuleDisabled(ctx.Param("id"), disabled)
 			if err != nil {
-				results[containerID] = gin.H{"status": "error", "message": err.Error()}
-				errorCount++
-				fmt.Printf("❌ Bulk %s failed for container %s: %v\n", action, containerID, err)
-			} else {
-				results[containerID] = gin.H{"status": "success"}
-				successCount++
-				fmt.Printf("✅ Bulk %s succeeded for container %s\n", action, containerID)
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating heal rule: " + err.Error()})
+				return
+			}
+			if !found {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "Heal rule not found: " + ctx.Param("id")})
+				return
 			}
+			ctx.JSON(http.StatusOK, gin.H{"message": "Heal rule updated successfully", "disabled": disabled})
 		}
+	}
+	r.POST("/heal-rules/:id/enable", setHealRuleDisabled(false))
+	r.POST("/heal-rules/:id/disable", setHealRuleDisabled(true))
 
-		fmt.Printf("📦 Bulk %s completed: %d success, %d errors\n", action, successCount, errorCount)
+	r.DELETE("/heal-rules/:id", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change heal rules"})
+			return
+		}
+		deleted, err := store.DeleteHealRule(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting heal rule: " + err.Error()})
+			return
+		}
+		if !deleted {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Heal rule not found: " + ctx.Param("id")})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Heal rule deleted successfully"})
+	})
 
-		ctx.JSON(http.StatusOK, gin.H{
-			"action":  action,
-			"results": results,
-			"summary": gin.H{
-				"total":   len(req.Containers),
-				"success": successCount,
-				"errors":  errorCount,
-			},
-		})
+	// Recipes, see recipes.go. Runs are listed in GET /jobs?type=recipe
+	r.GET("/recipes", func(ctx *gin.Context) {
+		recipes, err := store.ListRecipes()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing recipes: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"recipes": recipes})
 	})
 
-	// Add system cleanup endpoint
-	r.POST("/cleanup", func(ctx *gin.Context) {
-		cmd := exec.Command("docker", "system", "prune", "-f")
-		output, err := cmd.CombinedOutput()
+	r.GET("/recipes/:id", func(ctx *gin.Context) {
+		recipe, err := store.GetRecipe(ctx.Param("id"))
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error running cleanup: " + err.Error()})
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found: " + ctx.Param("id")})
+			return
+		}
+		ctx.JSON(http.StatusOK, recipe)
+	})
+
+	bindRecipe := func(ctx *gin.Context, recipe *Recipe) bool {
+		if !bindJSON(ctx, recipe) {
+			return false
+		}
+		if err := validateRecipe(recipe); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      "Invalid recipe: " + err.Error(),
+				"suggestion": "Ví dụ: {\"name\": \"web\", \"steps\": [{\"action\": \"pull\", \"image\": \"nginx:latest\"}, {\"action\": \"create\", \"container\": \"web\", \"image\": \"nginx:latest\", \"port\": \"8081:80\"}, {\"action\": \"start\", \"container\": \"web\"}, {\"action\": \"wait\", \"container\": \"web\"}]}",
+			})
+			return false
+		}
+		return true
+	}
+
+	r.POST("/recipes", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change recipes"})
+			return
+		}
+		var recipe Recipe
+		if !bindRecipe(ctx, &recipe) {
+			return
+		}
+		if _, err := store.GetRecipe(recipe.Name); err == nil {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Recipe already exists: " + recipe.Name})
+			return
+		}
+		recipe.CreatedBy = actorName(ctx)
+		if err := store.CreateRecipe(&recipe); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating recipe: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Recipe created successfully", "recipe": recipe})
+	})
+
+	r.PUT("/recipes/:id", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change recipes"})
+			return
+		}
+		existing, err := store.GetRecipe(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found: " + ctx.Param("id")})
+			return
+		}
+		var recipe Recipe
+		if !bindRecipe(ctx, &recipe) {
+			return
+		}
+		if other, err := store.GetRecipe(recipe.Name); err == nil && other.ID != existing.ID {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Recipe already exists: " + recipe.Name})
+			return
+		}
+		recipe.ID, recipe.CreatedBy, recipe.CreatedAt = existing.ID, existing.CreatedBy, existing.CreatedAt
+		if err := store.UpdateRecipe(&recipe); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating recipe: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Recipe updated successfully", "recipe": recipe})
+	})
+
+	r.DELETE("/recipes/:id", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change recipes"})
+			return
+		}
+		recipe, err := store.GetRecipe(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found: " + ctx.Param("id")})
+			return
+		}
+		if _, err := store.DeleteRecipe(recipe.ID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting recipe: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Recipe deleted successfully"})
+	})
+
+	// Runs a recipe as a background job; follow it in GET /jobs/:id
+	r.POST("/recipes/:id/run", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can run recipes"})
+			return
+		}
+		var req struct {
+			// Leave the containers a failed run created for debugging
+			KeepOnFailure bool `json:"keep_on_failure"`
+		}
+		if !bindOptionalJSON(ctx, &req) {
+			return
+		}
+		recipe, err := store.GetRecipe(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found: " + ctx.Param("id")})
 			return
 		}
+		jobID, err := startRecipe(store, recipe, actorName(ctx), callerRole(ctx), req.KeepOnFailure)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting recipe: " + err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusAccepted, gin.H{
+			"message": "Recipe " + recipe.Name + " started",
+			"job_id":  jobID,
+		})
+	})
 
+	// Dry run: how the rules would treat a command, without auditing it
+	r.POST("/exec-policy/check", func(ctx *gin.Context) {
+		var req struct {
+			Container string `json:"container"`
+			Command   string `json:"command" binding:"required"`
+			// Defaults to the caller's role
+			Role string `json:"role" binding:"omitempty,oneof=admin user anonymous"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+		if req.Role == "" {
+			req.Role = callerRole(ctx)
+		}
+		rules, err := store.ListExecRules()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing exec rules: " + err.Error()})
+			return
+		}
 		ctx.JSON(http.StatusOK, gin.H{
-			"message": "System cleanup completed",
-			"output":  string(output),
+			"parts":    commandParts(req.Command),
+			"decision": evaluateExecPolicy(rules, req.Role, strings.TrimPrefix(req.Container, "/"), req.Command),
 		})
 	})
 
@@ -1143,10 +5967,128 @@ func main() {
 		ctx.JSON(http.StatusOK, volumes)
 	})
 
+	// GraphQL API for the dashboard, read-only; subscriptions stream Docker events
+	graphQLSchema := dockerSchema()
+	r.GET("/graphql", graphqlHandler(store, listings, graphQLSchema))
+	r.POST("/graphql", graphqlHandler(store, listings, graphQLSchema))
+	r.GET("/graphql/schema", func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, graphQLSchema.SDL())
+	})
+
+	// Add audit log endpoint
+	r.GET("/audit", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can read the audit log"})
+			return
+		}
+		limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "100"))
+		if err != nil || limit < 1 || limit > 1000 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit: must be a number between 1 and 1000"})
+			return
+		}
+
+		logs, err := store.ListAudit(limit)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading audit log: " + err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{"logs": logs})
+	})
+
+	// Encrypted archive of the application state, to rebuild a server
+	r.POST("/admin/backup", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can back up the server"})
+			return
+		}
+		var req struct {
+			Passphrase string `json:"passphrase" binding:"required,min=12,max=1024"`
+		}
+		if !bindJSON(ctx, &req) {
+			return
+		}
+
+		backup, err := store.ExportBackup(secretBox, actorName(ctx))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading application state: " + err.Error()})
+			return
+		}
+		archive, err := sealBackup(backup, req.Passphrase)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error encrypting backup: " + err.Error()})
+			return
+		}
+		fmt.Printf("💾 Backup taken by %s (%d bytes)\n", actorName(ctx), len(archive))
+
+		filename := "backup-" + backup.CreatedAt.Format("20060102-150405") + ".gdbackup"
+		ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		ctx.Data(http.StatusOK, "application/octet-stream", archive)
+	})
+
+	// Replace the application state with an archive from /admin/backup
+	r.POST("/admin/restore", func(ctx *gin.Context) {
+		if !isAdmin(ctx) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only admins can restore the server"})
+			return
+		}
+		passphrase := ctx.PostForm("passphrase")
+		upload, err := ctx.FormFile("archive")
+		if err != nil || passphrase == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      "An archive file and a passphrase are required",
+				"suggestion": "Gửi multipart form với file 'archive' và trường 'passphrase'",
+			})
+			return
+		}
+		file, err := upload.Open()
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Error reading archive: " + err.Error()})
+			return
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Error reading archive: " + err.Error()})
+			return
+		}
+
+		backup, err := openBackup(data, passphrase)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":      err.Error(),
+				"suggestion": "Kiểm tra lại passphrase và file backup",
+			})
+			return
+		}
+		if err := store.RestoreBackup(secretBox, backup); err != nil {
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":      "Error restoring backup: " + err.Error(),
+				"suggestion": "Dữ liệu hiện tại không bị thay đổi",
+			})
+			return
+		}
+		if err := proxy.Reload(); err != nil {
+			fmt.Printf("⚠️  Error reloading proxy routes: %v\n", err)
+		}
+		fmt.Printf("💾 Backup from %s restored by %s\n", backup.CreatedAt.Format(time.RFC3339), actorName(ctx))
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"message":    "Backup restored, users and API keys are now those of the backup",
+			"created_at": backup.CreatedAt,
+			"created_by": backup.CreatedBy,
+			"tables":     backup.Summary(),
+			"secrets":    len(backup.Secrets),
+		})
+	})
+
 	// Serve static files
 	r.Static("/static", "./static")
 	// Serve HTML templates
 	r.StaticFile("/favicon.ico", "./static/favicon.ico")
-	// Listen and serve on port 8080
-	r.Run(":8081")
+	// Listen on TCP port 8081 and/or a Unix socket, see serve
+	if err := serve(r); err != nil {
+		fmt.Printf("❌ Server error: %v\n", err)
+		exit(1)
+	}
 }
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Routes that change state despite being GET requests
+var mutatingGetRoutes = map[string]bool{
+	"/stop/:id":          true,
+	"/start/:id":         true,
+	"/remove/:id":        true,
+	"/exec/:id/terminal": true,
+	"/terminal/:id":      true,
+	"/ws/attach/:id":     true,
+	"/tunnels/:id/ws":    true,
+}
+
+// Routes that only read state despite being POST requests
+var readOnlyPostRoutes = map[string]bool{
+	"/graphql":           true,
+	"/exec-policy/check": true,
+	"/dockerfile/lint":   true,
+}
+
+// MaintenanceMode is a runtime switch that makes the API read-only while the
+// host is being serviced
+type MaintenanceMode struct {
+	mu      sync.RWMutex
+	enabled bool
+	message string
+	since   time.Time
+	by      string
+}
+
+// newMaintenanceMode starts enabled when MAINTENANCE_MODE is set, so a
+// restart in the middle of maintenance doesn't reopen the API
+func newMaintenanceMode() *MaintenanceMode {
+	m := &MaintenanceMode{}
+	if enabled, _ := strconv.ParseBool(os.Getenv("MAINTENANCE_MODE")); enabled {
+		m.Set(true, "", "environment")
+	}
+	return m
+}
+
+func (m *MaintenanceMode) Set(enabled bool, message, by string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enabled = enabled
+	m.message = message
+	m.since = time.Now()
+	m.by = by
+}
+
+func (m *MaintenanceMode) Enabled() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.enabled
+}
+
+func (m *MaintenanceMode) Status() gin.H {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	status := gin.H{"enabled": m.enabled}
+	if !m.since.IsZero() {
+		status["message"] = m.message
+		status["since"] = m.since
+		status["changed_by"] = m.by
+	}
+	return status
+}
+
+// isMutating reports whether a request changes state
+func isMutating(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return mutatingGetRoutes[c.FullPath()]
+	case http.MethodPost:
+		return !readOnlyPostRoutes[c.FullPath()]
+	}
+	return true
+}
+
+// Middleware rejects mutating requests with 503 while maintenance is on.
+// The maintenance endpoint itself stays usable so admins can switch it off.
+func (m *MaintenanceMode) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !m.Enabled() {
+			c.Next()
+			return
+		}
+		c.Header("X-Maintenance-Mode", "true")
+		if !isMutating(c) || c.FullPath() == "/maintenance" {
+			c.Next()
+			return
+		}
+		m.mu.RLock()
+		message := m.message
+		m.mu.RUnlock()
+		c.Header("Retry-After", "300")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error":      "Server is in maintenance mode, changes are disabled",
+			"message":    message,
+			"suggestion": "Hệ thống đang bảo trì, chỉ có thể xem trạng thái và logs. Vui lòng thử lại sau",
+		})
+	}
+}
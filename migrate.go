@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/checkpoint"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+// Directory on both Docker hosts where migration checkpoints are written.
+// It is reached through bind mounts of short-lived helper containers, the
+// Docker API has no other way to move checkpoint files.
+const defaultMigrationCheckpointDir = "/var/lib/docker-manager/checkpoints"
+
+// Mount point of the checkpoint directory in helper containers
+const migrationHelperPath = "/checkpoints"
+
+// migrationHosts returns the Docker hosts containers can be migrated to,
+// from MIGRATION_HOSTS="name=tcp://10.0.0.2:2376,name2=unix:///other.sock".
+// TLS settings come from DOCKER_CERT_PATH and DOCKER_TLS_VERIFY as for the
+// local daemon.
+func migrationHosts() (map[string]string, error) {
+	hosts := map[string]string{}
+	v := strings.TrimSpace(os.Getenv("MIGRATION_HOSTS"))
+	if v == "" {
+		return hosts, nil
+	}
+	for _, entry := range strings.Split(v, ",") {
+		name, url, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || name == "" || url == "" {
+			return nil, fmt.Errorf("invalid MIGRATION_HOSTS entry %q, expected name=tcp://host:port", entry)
+		}
+		hosts[name] = url
+	}
+	return hosts, nil
+}
+
+func migrationHostNames() []string {
+	hosts, _ := migrationHosts()
+	names := make([]string, 0, len(hosts))
+	for name := range hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// migrationClient connects to a host from MIGRATION_HOSTS
+func migrationClient(name string) (*client.Client, error) {
+	hosts, err := migrationHosts()
+	if err != nil {
+		return nil, err
+	}
+	url, ok := hosts[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown migration host %q", name)
+	}
+	return client.NewClientWithOpts(client.FromEnv, client.WithHost(url), client.WithAPIVersionNegotiation())
+}
+
+func migrationCheckpointDir() string {
+	if dir := os.Getenv("MIGRATION_CHECKPOINT_DIR"); dir != "" {
+		return dir
+	}
+	return defaultMigrationCheckpointDir
+}
+
+// MigrationResult reports a migration step by step
+type MigrationResult struct {
+	Container     string   `json:"container"`
+	Target        string   `json:"target"`
+	TargetID      string   `json:"target_id,omitempty"`
+	Checkpoint    string   `json:"checkpoint"`
+	ImageCopied   bool     `json:"image_copied"`
+	SourceRemoved bool     `json:"source_removed"`
+	Steps         []string `json:"steps"`
+	Warnings      []string `json:"warnings"`
+}
+
+func (r *MigrationResult) step(format string, args ...any) {
+	r.Steps = append(r.Steps, fmt.Sprintf(format, args...))
+}
+
+// migrationHelper creates a stopped container that only exists to reach dir
+// on its host through a bind mount
+func migrationHelper(ctx context.Context, cli *client.Client, image, dir string) (string, error) {
+	resp, err := cli.ContainerCreate(ctx,
+		// Never started, the entrypoint only satisfies images without a command
+		&container.Config{Image: image, Entrypoint: []string{"/migration-helper"}, Labels: map[string]string{labelPrefix + "migration-helper": "true"}},
+		&container.HostConfig{Binds: []string{dir + ":" + migrationHelperPath}},
+		nil, nil, "")
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// migrationWarnings lists what doesn't move with the container
+func migrationWarnings(info container.InspectResponse) []string {
+	warnings := []string{}
+	for _, m := range info.Mounts {
+		switch m.Type {
+		case "volume":
+			warnings = append(warnings, fmt.Sprintf("volume %s (%s) is not copied, the target uses its own volume of that name", m.Name, m.Destination))
+		case "bind":
+			warnings = append(warnings, fmt.Sprintf("bind mount %s must exist on the target host", m.Source))
+		}
+	}
+	return warnings
+}
+
+// migrateContainer moves a running container from src to dst: it checkpoints
+// and stops the container, copies its image and checkpoint, and starts the
+// container on dst from the checkpoint. If the restore fails the source
+// container is restored from the same checkpoint.
+func migrateContainer(ctx context.Context, src, dst *client.Client, containerID, targetHost string, removeSource bool) (*MigrationResult, error) {
+	info, err := src.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimPrefix(info.Name, "/")
+	result := &MigrationResult{Container: name, Target: targetHost, Steps: []string{}, Warnings: migrationWarnings(info)}
+	if info.State == nil || !info.State.Running {
+		return result, errors.New("only running containers can be migrated")
+	}
+	if info.HostConfig != nil && info.HostConfig.NetworkMode.IsContainer() {
+		return result, errors.New("containers sharing another container's network can't be migrated")
+	}
+	for label, cli := range map[string]*client.Client{"source": src, "target": dst} {
+		ping, err := cli.Ping(ctx)
+		if err != nil {
+			return result, fmt.Errorf("%s host: %w", label, err)
+		}
+		if !ping.Experimental {
+			return result, fmt.Errorf("%s host doesn't have experimental features enabled", label)
+		}
+	}
+	if _, err := dst.ContainerInspect(ctx, name); err == nil {
+		return result, fmt.Errorf("a container named %s already exists on %s", name, targetHost)
+	}
+
+	// The image goes first, it's needed for the helper on the target too
+	if _, err := dst.ImageInspect(ctx, info.Image); err == nil {
+		result.step("image %s already on %s", info.Config.Image, targetHost)
+	} else {
+		refs := []string{info.Image}
+		if info.Config.Image != "" && !strings.HasPrefix(info.Config.Image, "sha256:") {
+			refs = []string{info.Config.Image}
+		}
+		archive, err := src.ImageSave(ctx, refs)
+		if err != nil {
+			return result, fmt.Errorf("saving image: %w", err)
+		}
+		loaded, err := dst.ImageLoad(ctx, archive)
+		archive.Close()
+		if err != nil {
+			return result, fmt.Errorf("loading image on %s: %w", targetHost, err)
+		}
+		io.Copy(io.Discard, loaded.Body)
+		loaded.Body.Close()
+		result.ImageCopied = true
+		result.step("copied image %s to %s", info.Config.Image, targetHost)
+	}
+
+	result.Checkpoint = "migrate-" + strconv.FormatInt(time.Now().Unix(), 10)
+	dir := path.Join(migrationCheckpointDir(), info.ID)
+	if err := src.CheckpointCreate(ctx, info.ID, checkpoint.CreateOptions{CheckpointID: result.Checkpoint, CheckpointDir: dir, Exit: true}); err != nil {
+		return result, fmt.Errorf("creating checkpoint: %w", err)
+	}
+	result.step("checkpointed and stopped %s", name)
+	defer src.CheckpointDelete(context.Background(), info.ID, checkpoint.DeleteOptions{CheckpointID: result.Checkpoint, CheckpointDir: dir})
+
+	// From here on a failure restores the source container
+	rollback := func(cause error) (*MigrationResult, error) {
+		err := src.ContainerStart(context.Background(), info.ID, container.StartOptions{CheckpointID: result.Checkpoint, CheckpointDir: dir})
+		if err != nil {
+			err = src.ContainerStart(context.Background(), info.ID, container.StartOptions{})
+			if err != nil {
+				return result, fmt.Errorf("%w; restarting the source container also failed: %v", cause, err)
+			}
+			result.step("restarted %s without its checkpoint", name)
+			return result, cause
+		}
+		result.step("restored %s on the source host", name)
+		return result, cause
+	}
+
+	if err := copyCheckpoint(ctx, src, dst, info.Image, dir, result.Checkpoint); err != nil {
+		return rollback(fmt.Errorf("copying checkpoint: %w", err))
+	}
+	result.step("copied checkpoint %s to %s", result.Checkpoint, targetHost)
+
+	var networking *network.NetworkingConfig
+	if info.NetworkSettings != nil && len(info.NetworkSettings.Networks) > 0 {
+		// Addresses and IDs are local to the source host, keep only the names
+		networking = &network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{}}
+		for net, endpoint := range info.NetworkSettings.Networks {
+			networking.EndpointsConfig[net] = &network.EndpointSettings{Aliases: endpoint.Aliases}
+		}
+	}
+	created, err := createContainer(ctx, dst, info.Config, info.HostConfig, networking, name)
+	if err != nil {
+		return rollback(fmt.Errorf("creating container on %s: %w", targetHost, err))
+	}
+	if err := copyConfigs(ctx, dst, created.ID, info.Config.Labels); err != nil {
+		dst.ContainerRemove(context.Background(), created.ID, container.RemoveOptions{Force: true})
+		return rollback(fmt.Errorf("copying configs to %s: %w", targetHost, err))
+	}
+	result.TargetID = created.ID
+	result.step("created %s on %s", name, targetHost)
+
+	if err := startContainer(ctx, dst, created.ID, container.StartOptions{CheckpointID: result.Checkpoint, CheckpointDir: dir}); err != nil {
+		dst.ContainerRemove(context.Background(), created.ID, container.RemoveOptions{Force: true})
+		result.TargetID = ""
+		return rollback(fmt.Errorf("restoring on %s: %w", targetHost, err))
+	}
+	result.step("restored %s on %s", name, targetHost)
+	dst.CheckpointDelete(context.Background(), created.ID, checkpoint.DeleteOptions{CheckpointID: result.Checkpoint, CheckpointDir: dir})
+
+	if removeSource {
+		if err := removeContainer(ctx, src, info.ID, container.RemoveOptions{}); err != nil {
+			result.Warnings = append(result.Warnings, "removing the source container failed: "+err.Error())
+		} else {
+			result.SourceRemoved = true
+			result.step("removed %s from the source host", name)
+		}
+	}
+	return result, nil
+}
+
+// copyCheckpoint streams a checkpoint directory from src to dst through
+// helper containers bind mounting dir on each host
+func copyCheckpoint(ctx context.Context, src, dst *client.Client, image, dir, name string) error {
+	srcHelper, err := migrationHelper(ctx, src, image, dir)
+	if err != nil {
+		return err
+	}
+	defer src.ContainerRemove(context.Background(), srcHelper, container.RemoveOptions{Force: true})
+	dstHelper, err := migrationHelper(ctx, dst, image, dir)
+	if err != nil {
+		return err
+	}
+	defer dst.ContainerRemove(context.Background(), dstHelper, container.RemoveOptions{Force: true})
+
+	archive, _, err := src.CopyFromContainer(ctx, srcHelper, path.Join(migrationHelperPath, name))
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	// The archive holds the checkpoint directory itself
+	return dst.CopyToContainer(ctx, dstHelper, migrationHelperPath, archive, container.CopyToContainerOptions{})
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/gin-gonic/gin"
+)
+
+// Docker has no hard limit on container names, anything longer than this is
+// a mistake
+const maxContainerNameLength = 255
+
+// Short or full image IDs, optionally with the digest algorithm
+var imageIDPattern = regexp.MustCompile(`^(sha256:)?[a-f0-9]{12,64}$`)
+
+// validateContainerName checks a name for a new container against the
+// pattern the daemon enforces
+func validateContainerName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("container name is empty")
+	case len(name) > maxContainerNameLength:
+		return fmt.Errorf("container name is longer than %d characters", maxContainerNameLength)
+	case !containerNamePattern.MatchString(name):
+		return fmt.Errorf("invalid container name %q: it must start with a letter or digit and may only contain letters, digits, '_', '.' and '-'", name)
+	}
+	return nil
+}
+
+// validateContainerRef checks a reference to an existing container: a name,
+// optionally with the leading slash docker reports, or a (short) ID
+func validateContainerRef(ref string) error {
+	if err := validateContainerName(strings.TrimPrefix(ref, "/")); err != nil {
+		return fmt.Errorf("invalid container reference %q: use a container name or ID", ref)
+	}
+	return nil
+}
+
+// validateImageRef checks an image reference such as "nginx", "nginx:1.27"
+// or "ghcr.io/org/app@sha256:..." against docker's reference grammar,
+// explaining the common mistakes
+func validateImageRef(ref string) error {
+	if ref == "" {
+		return errors.New("image name is empty")
+	}
+	if strings.TrimSpace(ref) != ref || strings.ContainsAny(ref, " \t\n") {
+		return fmt.Errorf("invalid image reference %q: it must not contain whitespace", ref)
+	}
+	_, err := reference.ParseNormalizedNamed(ref)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, reference.ErrNameContainsUppercase), isLowercaseRef(ref):
+		return fmt.Errorf("invalid image reference %q: repository names must be lowercase", ref)
+	case errors.Is(err, reference.ErrNameTooLong):
+		return fmt.Errorf("invalid image reference %q: the repository name is longer than %d characters", ref, reference.RepositoryNameTotalLengthMax)
+	case errors.Is(err, reference.ErrTagInvalidFormat):
+		return fmt.Errorf("invalid image reference %q: tags may only contain letters, digits, '_', '.' and '-' and are at most 128 characters", ref)
+	case errors.Is(err, reference.ErrDigestInvalidFormat):
+		return fmt.Errorf("invalid image reference %q: digests look like sha256:<64 hex characters>", ref)
+	case imageIDPattern.MatchString(ref):
+		return fmt.Errorf("invalid image reference %q: use a repository name, not an image ID", ref)
+	}
+	return fmt.Errorf("invalid image reference %q: expected [registry/]repository[:tag][@digest]", ref)
+}
+
+// isLowercaseRef reports whether ref only fails to parse because of capitals.
+// The parser doesn't use ErrNameContainsUppercase for every such case.
+func isLowercaseRef(ref string) bool {
+	_, err := reference.ParseNormalizedNamed(strings.ToLower(ref))
+	return err == nil
+}
+
+// validateImageTarget checks a reference to a local image, which may also be
+// given by ID
+func validateImageTarget(ref string) error {
+	if imageIDPattern.MatchString(ref) {
+		return nil
+	}
+	return validateImageRef(ref)
+}
+
+// respondInvalidName answers a request with a malformed container or image
+// reference
+func respondInvalidName(ctx *gin.Context, err error) {
+	ctx.JSON(http.StatusBadRequest, gin.H{
+		"error":      err.Error(),
+		"suggestion": "Kiểm tra lại tên container hoặc image, ví dụ: \"web-1\", \"nginx:1.27\" hoặc \"ghcr.io/org/app:v2\"",
+	})
+}
+
+// Routes whose :id parameter is a container or an image reference
+var (
+	containerParamRoutes = []string{
+		"/inspect/:id", "/stop/:id", "/start/:id", "/remove/:id", "/containers/:id",
+		"/logs/:id", "/exec/:id", "/trash/:id", "/ws/attach/:id",
+		"/terminal/:id",
+	}
+	imageParamRoutes = []string{"/images/:id"}
+)
+
+func routeHasPrefix(path string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// nameValidationMiddleware rejects malformed container and image references
+// in the URL before the handler talks to the daemon, which would answer with
+// a less helpful error
+func nameValidationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if id == "" {
+			c.Next()
+			return
+		}
+		var err error
+		switch path := c.FullPath(); {
+		case routeHasPrefix(path, containerParamRoutes):
+			err = validateContainerRef(id)
+		case routeHasPrefix(path, imageParamRoutes):
+			err = validateImageTarget(id)
+		}
+		if err != nil {
+			respondInvalidName(c, err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
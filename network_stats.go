@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// Samples kept per container, an hour at the default interval
+const networkHistorySize = 120
+
+// Default interval of the background network sampler
+const defaultNetworkStatsInterval = 30 * time.Second
+
+// NetworkCounters are the cumulative counters of a container's interfaces
+type NetworkCounters struct {
+	RxBytes   uint64 `json:"rx_bytes"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	TxPackets uint64 `json:"tx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	TxErrors  uint64 `json:"tx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
+func (c *NetworkCounters) add(s container.NetworkStats) {
+	c.RxBytes += s.RxBytes
+	c.TxBytes += s.TxBytes
+	c.RxPackets += s.RxPackets
+	c.TxPackets += s.TxPackets
+	c.RxErrors += s.RxErrors
+	c.TxErrors += s.TxErrors
+	c.RxDropped += s.RxDropped
+	c.TxDropped += s.TxDropped
+}
+
+// networkCounters sums the interfaces of a stats sample and returns them by
+// interface too
+func networkCounters(stats container.StatsResponse) (NetworkCounters, map[string]NetworkCounters) {
+	var total NetworkCounters
+	byInterface := map[string]NetworkCounters{}
+	for name, s := range stats.Networks {
+		var c NetworkCounters
+		c.add(s)
+		byInterface[name] = c
+		total.add(s)
+	}
+	return total, byInterface
+}
+
+// NetworkSample is the counters of a container at one time
+type NetworkSample struct {
+	Time time.Time `json:"time"`
+	NetworkCounters
+}
+
+// NetworkDelta is the traffic of a container between two samples
+type NetworkDelta struct {
+	From            time.Time `json:"from"`
+	To              time.Time `json:"to"`
+	RxBytes         uint64    `json:"rx_bytes"`
+	TxBytes         uint64    `json:"tx_bytes"`
+	RxPackets       uint64    `json:"rx_packets"`
+	TxPackets       uint64    `json:"tx_packets"`
+	RxBytesPerSec   float64   `json:"rx_bytes_per_sec"`
+	TxBytesPerSec   float64   `json:"tx_bytes_per_sec"`
+	RxPacketsPerSec float64   `json:"rx_packets_per_sec"`
+	TxPacketsPerSec float64   `json:"tx_packets_per_sec"`
+}
+
+// delta returns the traffic from a to b, false when the counters went back
+// because the container restarted in between
+func delta(a, b NetworkSample) (NetworkDelta, bool) {
+	seconds := b.Time.Sub(a.Time).Seconds()
+	if seconds <= 0 || b.RxBytes < a.RxBytes || b.TxBytes < a.TxBytes || b.RxPackets < a.RxPackets || b.TxPackets < a.TxPackets {
+		return NetworkDelta{}, false
+	}
+	d := NetworkDelta{
+		From:      a.Time,
+		To:        b.Time,
+		RxBytes:   b.RxBytes - a.RxBytes,
+		TxBytes:   b.TxBytes - a.TxBytes,
+		RxPackets: b.RxPackets - a.RxPackets,
+		TxPackets: b.TxPackets - a.TxPackets,
+	}
+	d.RxBytesPerSec = float64(d.RxBytes) / seconds
+	d.TxBytesPerSec = float64(d.TxBytes) / seconds
+	d.RxPacketsPerSec = float64(d.RxPackets) / seconds
+	d.TxPacketsPerSec = float64(d.TxPackets) / seconds
+	return d, true
+}
+
+// NetworkHistory keeps recent network samples of every container. Every
+// stats read adds to it, wherever it comes from, and the background sampler
+// keeps it going between requests.
+type NetworkHistory struct {
+	mu      sync.Mutex
+	samples map[string][]NetworkSample
+}
+
+var networkHistory = &NetworkHistory{samples: map[string][]NetworkSample{}}
+
+func (h *NetworkHistory) Record(containerID string, sample NetworkSample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	samples := h.samples[containerID]
+	// Stats read concurrently may arrive out of order
+	if n := len(samples); n > 0 && !sample.Time.After(samples[n-1].Time) {
+		return
+	}
+	samples = append(samples, sample)
+	if len(samples) > networkHistorySize {
+		samples = samples[len(samples)-networkHistorySize:]
+	}
+	h.samples[containerID] = samples
+}
+
+// Deltas returns the traffic between consecutive samples, oldest first
+func (h *NetworkHistory) Deltas(containerID string) []NetworkDelta {
+	h.mu.Lock()
+	samples := h.samples[containerID]
+	h.mu.Unlock()
+	deltas := []NetworkDelta{}
+	for i := 1; i < len(samples); i++ {
+		if d, ok := delta(samples[i-1], samples[i]); ok {
+			deltas = append(deltas, d)
+		}
+	}
+	return deltas
+}
+
+// Latest returns the traffic between the last two samples
+func (h *NetworkHistory) Latest(containerID string) (NetworkDelta, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	samples := h.samples[containerID]
+	if len(samples) < 2 {
+		return NetworkDelta{}, false
+	}
+	return delta(samples[len(samples)-2], samples[len(samples)-1])
+}
+
+// Forget drops the history of containers not in keep
+func (h *NetworkHistory) Forget(keep map[string]bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for id := range h.samples {
+		if !keep[id] {
+			delete(h.samples, id)
+		}
+	}
+}
+
+// NetworkTalker is one entry of the top talkers in /stats
+type NetworkTalker struct {
+	ID            string  `json:"id"`
+	Name          string  `json:"name"`
+	RxBytesPerSec float64 `json:"rx_bytes_per_sec"`
+	TxBytesPerSec float64 `json:"tx_bytes_per_sec"`
+	RxBytes       uint64  `json:"rx_bytes"`
+	TxBytes       uint64  `json:"tx_bytes"`
+}
+
+// topTalkers returns the n containers with the most traffic over their
+// last two samples
+func topTalkers(containers []container.Summary, n int) []NetworkTalker {
+	talkers := []NetworkTalker{}
+	for _, c := range containers {
+		d, ok := networkHistory.Latest(c.ID)
+		if !ok {
+			continue
+		}
+		talkers = append(talkers, NetworkTalker{
+			ID:            c.ID[:12],
+			Name:          summaryName(c),
+			RxBytesPerSec: d.RxBytesPerSec,
+			TxBytesPerSec: d.TxBytesPerSec,
+			RxBytes:       d.RxBytes,
+			TxBytes:       d.TxBytes,
+		})
+	}
+	sort.SliceStable(talkers, func(i, j int) bool {
+		return talkers[i].RxBytesPerSec+talkers[i].TxBytesPerSec > talkers[j].RxBytesPerSec+talkers[j].TxBytesPerSec
+	})
+	return talkers[:min(n, len(talkers))]
+}
+
+// startNetworkSampler samples the running containers every
+// NETWORK_STATS_INTERVAL so rates are known before anyone asks
+func startNetworkSampler() {
+	interval := intervalFromEnv("NETWORK_STATS_INTERVAL", defaultNetworkStatsInterval)
+	go func() {
+		for range time.Tick(interval) {
+			if err := sampleNetworks(context.Background()); err != nil {
+				fmt.Printf("⚠️  Error sampling container networks: %v\n", err)
+			}
+		}
+	}()
+}
+
+func sampleNetworks(ctx context.Context) error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	containers, err := cli.ContainerList(ctx, container.ListOptions{})
+	if err != nil {
+		return err
+	}
+	running := map[string]bool{}
+	ids := make([]string, 0, len(containers))
+	for _, c := range containers {
+		running[c.ID] = true
+		ids = append(ids, c.ID)
+	}
+	// Recording happens in containerUsage
+	containersUsage(ctx, cli, ids)
+	networkHistory.Forget(running)
+	return nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// offlineMode disables everything that talks to a registry, for air-gapped
+// hosts, see OFFLINE_MODE
+var offlineMode bool
+
+var errOffline = errors.New("registry access is disabled by OFFLINE_MODE")
+
+// offlineGuard answers 503 for endpoints that only make sense with a
+// registry, and reports whether it did
+func offlineGuard(ctx *gin.Context) bool {
+	if !offlineMode {
+		return false
+	}
+	ctx.JSON(http.StatusServiceUnavailable, gin.H{
+		"error":      errOffline.Error(),
+		"suggestion": "Server đang ở chế độ offline, nạp image bằng docker load trên host",
+	})
+	return true
+}
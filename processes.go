@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// ps arguments for ContainerTop. BSD-style "aux" lists CPU and memory and
+// works with both procps and busybox ps on the host.
+var topPsArgs = []string{"aux"}
+
+// HostProcess is a host process running in a container. PIDs are host PIDs,
+// as seen by ps on the Docker host, not inside the container.
+type HostProcess struct {
+	PID           int     `json:"pid"`
+	User          string  `json:"user"`
+	CPUPercent    float64 `json:"cpu_percent"`
+	MemoryPercent float64 `json:"memory_percent"`
+	RSS           uint64  `json:"rss"`
+	Command       string  `json:"command"`
+	ContainerID   string  `json:"container_id"`
+	ContainerName string  `json:"container_name"`
+}
+
+// ContainerProcesses is a container with its processes and their totals
+type ContainerProcesses struct {
+	ID            string         `json:"id"`
+	Name          string         `json:"name"`
+	Image         string         `json:"image"`
+	CPUPercent    float64        `json:"cpu_percent"`
+	MemoryPercent float64        `json:"memory_percent"`
+	RSS           uint64         `json:"rss"`
+	Processes     []*HostProcess `json:"processes"`
+	Error         string         `json:"error,omitempty"`
+}
+
+// parseTop turns a ContainerTop response into processes, finding columns by
+// their title since ps implementations differ
+func parseTop(top container.TopResponse) []*HostProcess {
+	column := map[string]int{}
+	for i, title := range top.Titles {
+		column[strings.ToUpper(strings.TrimSpace(title))] = i
+	}
+	field := func(row []string, titles ...string) string {
+		for _, title := range titles {
+			if i, ok := column[title]; ok && i < len(row) {
+				return row[i]
+			}
+		}
+		return ""
+	}
+	processes := []*HostProcess{}
+	for _, row := range top.Processes {
+		p := &HostProcess{
+			User:    field(row, "USER", "UID"),
+			Command: field(row, "COMMAND", "CMD", "ARGS"),
+		}
+		p.PID, _ = strconv.Atoi(field(row, "PID"))
+		p.CPUPercent, _ = strconv.ParseFloat(field(row, "%CPU"), 64)
+		p.MemoryPercent, _ = strconv.ParseFloat(field(row, "%MEM"), 64)
+		// ps reports RSS in KiB
+		if rss, err := strconv.ParseUint(field(row, "RSS"), 10, 64); err == nil {
+			p.RSS = rss * 1024
+		}
+		processes = append(processes, p)
+	}
+	return processes
+}
+
+// hostProcesses lists the processes of the running containers in parallel.
+// A container that fails, usually because it stopped meanwhile, keeps its
+// entry with the error.
+func hostProcesses(ctx context.Context, cli *client.Client, containers []container.Summary) []*ContainerProcesses {
+	result := []*ContainerProcesses{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range containers {
+		if c.State != "running" {
+			continue
+		}
+		wg.Add(1)
+		go func(c container.Summary) {
+			defer wg.Done()
+			entry := &ContainerProcesses{ID: c.ID[:12], Name: summaryName(c), Image: c.Image, Processes: []*HostProcess{}}
+			top, err := cli.ContainerTop(ctx, c.ID, topPsArgs)
+			if err != nil {
+				entry.Error = err.Error()
+			} else {
+				entry.Processes = parseTop(top)
+			}
+			for _, p := range entry.Processes {
+				p.ContainerID, p.ContainerName = entry.ID, entry.Name
+				entry.CPUPercent += p.CPUPercent
+				entry.MemoryPercent += p.MemoryPercent
+				entry.RSS += p.RSS
+			}
+			mu.Lock()
+			result = append(result, entry)
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+	return result
+}
+
+// sortProcesses orders by CPU, or by memory when by is "memory", heaviest
+// first
+func sortProcesses(processes []*HostProcess, by string) {
+	sort.SliceStable(processes, func(i, j int) bool {
+		if by == "memory" {
+			return processes[i].RSS > processes[j].RSS
+		}
+		return processes[i].CPUPercent > processes[j].CPUPercent
+	})
+}
+
+func sortContainerProcesses(containers []*ContainerProcesses, by string) {
+	sort.SliceStable(containers, func(i, j int) bool {
+		if by == "memory" {
+			return containers[i].RSS > containers[j].RSS
+		}
+		if containers[i].CPUPercent != containers[j].CPUPercent {
+			return containers[i].CPUPercent > containers[j].CPUPercent
+		}
+		return containers[i].Name < containers[j].Name
+	})
+	for _, c := range containers {
+		sortProcesses(c.Processes, by)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// Labels set by this application on the containers it manages
+const (
+	labelPrefix  = "docker-manager."
+	projectLabel = labelPrefix + "project"
+)
+
+// Project is a logical group of containers, independent of compose. Membership
+// is the projectLabel on the container so it's visible to plain docker too.
+type Project struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type ProjectStatus struct {
+	Total   int `json:"total"`
+	Running int `json:"running"`
+	Stopped int `json:"stopped"`
+	Paused  int `json:"paused"`
+	Other   int `json:"other"`
+}
+
+func (s *Store) CreateProject(p *Project) error {
+	p.ID = newID()
+	p.CreatedAt = time.Now()
+	_, err := s.exec(`INSERT INTO projects (id, name, description, created_by, created_at) VALUES (?, ?, ?, ?, ?)`,
+		p.ID, p.Name, p.Description, p.CreatedBy, p.CreatedAt.Unix())
+	return err
+}
+
+// GetProject looks a project up by ID or name
+func (s *Store) GetProject(idOrName string) (*Project, error) {
+	var p Project
+	var createdAt int64
+	err := s.queryRow(`SELECT id, name, description, created_by, created_at FROM projects WHERE id = ? OR name = ?`,
+		idOrName, idOrName).Scan(&p.ID, &p.Name, &p.Description, &p.CreatedBy, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	p.CreatedAt = time.Unix(createdAt, 0)
+	return &p, nil
+}
+
+func (s *Store) ListProjects() ([]Project, error) {
+	rows, err := s.query(`SELECT id, name, description, created_by, created_at FROM projects ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := []Project{}
+	for rows.Next() {
+		var p Project
+		var createdAt int64
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.CreatedBy, &createdAt); err != nil {
+			return nil, err
+		}
+		p.CreatedAt = time.Unix(createdAt, 0)
+		projects = append(projects, p)
+	}
+	return projects, rows.Err()
+}
+
+func (s *Store) DeleteProject(id string) error {
+	_, err := s.exec(`DELETE FROM projects WHERE id = ?`, id)
+	return err
+}
+
+func listProjectContainers(ctx context.Context, cli *client.Client, project string) ([]container.Summary, error) {
+	return cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", projectLabel+"="+project)),
+	})
+}
+
+func projectStatus(containers []container.Summary) ProjectStatus {
+	status := ProjectStatus{Total: len(containers)}
+	for _, c := range containers {
+		switch c.State {
+		case "running":
+			status.Running++
+		case "exited", "created":
+			status.Stopped++
+		case "paused":
+			status.Paused++
+		default:
+			status.Other++
+		}
+	}
+	return status
+}
+
+// setContainerProject moves a container in or out of a project. Labels can't
+// be changed on an existing container, so it's recreated with the same spec
+// and volumes; a container already in the project is left alone.
+func setContainerProject(ctx context.Context, cli *client.Client, containerID, project string) (string, error) {
+	info, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return "", err
+	}
+	if info.Config != nil && info.Config.Labels[projectLabel] == project {
+		return info.ID, nil
+	}
+
+	spec := specFromInspect(info)
+	keepAnonymousVolumes(spec, info)
+	if spec.Config.Labels == nil {
+		spec.Config.Labels = map[string]string{}
+	}
+	if project == "" {
+		delete(spec.Config.Labels, projectLabel)
+	} else {
+		spec.Config.Labels[projectLabel] = project
+	}
+	return recreateContainer(ctx, cli, info.ID, spec, false)
+}
+
+// summaryName returns the display name of a listed container
+func summaryName(c container.Summary) string {
+	if len(c.Names) > 0 {
+		return strings.TrimPrefix(c.Names[0], "/")
+	}
+	return c.ID[:12]
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/gin-gonic/gin"
+)
+
+// protectedLabel marks a container as protected from the start, for the
+// management stack and services defined outside this API
+const protectedLabel = labelPrefix + "protected"
+
+// ProtectedContainer is a container that stop, remove and bulk operations
+// refuse to touch without override_protection=true. Like annotations it is
+// keyed by name so protection survives redeploys.
+type ProtectedContainer struct {
+	ContainerName string    `json:"container_name"`
+	Reason        string    `json:"reason"`
+	ProtectedBy   string    `json:"protected_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (s *Store) ProtectContainer(p *ProtectedContainer) error {
+	p.CreatedAt = time.Now()
+	if _, err := s.exec(`DELETE FROM protected_containers WHERE container_name = ?`, p.ContainerName); err != nil {
+		return err
+	}
+	_, err := s.exec(`INSERT INTO protected_containers (container_name, reason, protected_by, created_at) VALUES (?, ?, ?, ?)`,
+		p.ContainerName, p.Reason, p.ProtectedBy, p.CreatedAt.Unix())
+	return err
+}
+
+func (s *Store) UnprotectContainer(name string) (bool, error) {
+	res, err := s.exec(`DELETE FROM protected_containers WHERE container_name = ?`, name)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) GetProtection(name string) (*ProtectedContainer, error) {
+	var p ProtectedContainer
+	var createdAt int64
+	err := s.queryRow(`SELECT container_name, reason, protected_by, created_at FROM protected_containers WHERE container_name = ?`, name).
+		Scan(&p.ContainerName, &p.Reason, &p.ProtectedBy, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	p.CreatedAt = time.Unix(createdAt, 0)
+	return &p, nil
+}
+
+// ProtectedNames returns the names of containers protected in the database
+func (s *Store) ProtectedNames() (map[string]bool, error) {
+	rows, err := s.query(`SELECT container_name FROM protected_containers`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names[name] = true
+	}
+	return names, rows.Err()
+}
+
+// protectionReason explains why a container is protected, "" if it isn't
+func protectionReason(store *Store, name string, labels map[string]string) string {
+	if protected, _ := strconv.ParseBool(labels[protectedLabel]); protected {
+		return "protected by the " + protectedLabel + " label"
+	}
+	if p, err := store.GetProtection(name); err == nil {
+		if p.Reason != "" {
+			return "protected by " + p.ProtectedBy + ": " + p.Reason
+		}
+		return "protected by " + p.ProtectedBy
+	}
+	return ""
+}
+
+// ProtectedError is returned for operations on protected containers
+type ProtectedError struct {
+	Name   string
+	Reason string
+}
+
+func (e *ProtectedError) Error() string {
+	return fmt.Sprintf("container %s is %s", e.Name, e.Reason)
+}
+
+// checkProtected fails with a *ProtectedError if the container is protected
+func checkProtected(ctx context.Context, cli *client.Client, store *Store, containerID string) error {
+	info, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimPrefix(info.Name, "/")
+	var labels map[string]string
+	if info.Config != nil {
+		labels = info.Config.Labels
+	}
+	if reason := protectionReason(store, name, labels); reason != "" {
+		return &ProtectedError{Name: name, Reason: reason}
+	}
+	return nil
+}
+
+// overrideProtection reports whether the request asks to act on protected
+// containers anyway
+func overrideProtection(ctx *gin.Context) bool {
+	override, _ := strconv.ParseBool(ctx.Query("override_protection"))
+	return override
+}
+
+func respondProtected(ctx *gin.Context, err *ProtectedError) {
+	ctx.JSON(http.StatusForbidden, gin.H{
+		"error":      "Refusing to touch protected container: " + err.Error(),
+		"suggestion": "Thêm ?override_protection=true nếu thực sự muốn thao tác, hoặc bỏ bảo vệ qua DELETE /containers/" + err.Name + "/protect",
+	})
+}
+
+// allowUnprotected answers the request and returns false when the container
+// is protected and the request doesn't override the protection
+func allowUnprotected(ctx *gin.Context, cli *client.Client, store *Store, containerID string) bool {
+	if overrideProtection(ctx) {
+		return true
+	}
+	err := checkProtected(ctx.Request.Context(), cli, store, containerID)
+	if err == nil {
+		return true
+	}
+	var protectedErr *ProtectedError
+	if errors.As(err, &protectedErr) {
+		respondProtected(ctx, protectedErr)
+	} else if client.IsErrNotFound(err) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + containerID})
+	} else {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error inspecting container: " + err.Error()})
+	}
+	return false
+}
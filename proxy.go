@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// Host published ports are reached on, when the proxy runs on the Docker
+// host. PROXY_UPSTREAM_HOST overrides it, e.g. host.docker.internal.
+const defaultProxyUpstreamHost = "127.0.0.1"
+
+// Hostnames, optionally with a leading "*." wildcard label
+var proxyHostPattern = regexp.MustCompile(`^(\*\.)?([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// One DNS label, used for automatic subdomains
+var subdomainPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Labels controlling the automatic route of a container under PROXY_DOMAIN:
+// "false" in proxyLabel opts out, proxySubdomainLabel replaces the name and
+// proxyPortLabel picks the port when the container exposes several
+const (
+	proxyLabel          = labelPrefix + "proxy"
+	proxySubdomainLabel = labelPrefix + "proxy.subdomain"
+	proxyPortLabel      = labelPrefix + "proxy.port"
+)
+
+// ProxyRoute sends requests for a hostname and path prefix to a container
+// port. Host is empty for any host; Port is the port inside the container,
+// 0 for the container's only exposed port. The upstream address is looked
+// up on every request, so routes follow containers that are recreated or
+// restarted on other ports.
+type ProxyRoute struct {
+	ID        string `json:"id"`
+	Host      string `json:"host" binding:"max=253"`
+	Path      string `json:"path"`
+	Container string `json:"container" binding:"required,containerref"`
+	Port      int    `json:"port" binding:"omitempty,min=1,max=65535"`
+	StripPath bool   `json:"strip_path"`
+	// Serve over HTTPS with an ACME certificate, redirecting plain HTTP
+	TLS       bool      `json:"tls"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func validateProxyRoute(r *ProxyRoute) error {
+	r.Host = strings.ToLower(strings.TrimSpace(r.Host))
+	if r.Host != "" && !proxyHostPattern.MatchString(r.Host) {
+		return fmt.Errorf("invalid host %q, expected a hostname such as app.example.com or *.example.com", r.Host)
+	}
+	if r.Path == "" {
+		r.Path = "/"
+	}
+	if !strings.HasPrefix(r.Path, "/") {
+		return fmt.Errorf("path must start with /: %q", r.Path)
+	}
+	if len(r.Path) > 1 {
+		r.Path = strings.TrimSuffix(r.Path, "/")
+	}
+	r.Container = strings.TrimPrefix(r.Container, "/")
+	return nil
+}
+
+// matches reports whether a request host and path fall under the route
+func (r *ProxyRoute) matches(host, path string) bool {
+	switch {
+	case r.Host == "":
+	case strings.HasPrefix(r.Host, "*."):
+		if !strings.HasSuffix(host, r.Host[1:]) {
+			return false
+		}
+	case r.Host != host:
+		return false
+	}
+	return r.Path == "/" || path == r.Path || strings.HasPrefix(path, r.Path+"/")
+}
+
+// specificity orders routes: exact hosts before wildcards before any host,
+// then longer paths first
+func (r *ProxyRoute) specificity() (int, int) {
+	host := 0
+	switch {
+	case r.Host == "":
+	case strings.HasPrefix(r.Host, "*."):
+		host = 1
+	default:
+		host = 2
+	}
+	return host, len(r.Path)
+}
+
+// errUpstreamDown is returned for routes to containers that aren't running
+var errUpstreamDown = errors.New("container is not running")
+
+// ReverseProxy serves PROXY_ADDR, forwarding requests to containers by the
+// routes in the store
+type ReverseProxy struct {
+	store    *Store
+	listings *ListingCache
+
+	mu     sync.RWMutex
+	routes []ProxyRoute
+}
+
+func newReverseProxy(store *Store, listings *ListingCache) *ReverseProxy {
+	return &ReverseProxy{store: store, listings: listings}
+}
+
+// Reload reads the routes again after they changed
+func (p *ReverseProxy) Reload() error {
+	routes, err := p.store.ListProxyRoutes()
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		hi, pi := routes[i].specificity()
+		hj, pj := routes[j].specificity()
+		if hi != hj {
+			return hi > hj
+		}
+		return pi > pj
+	})
+	p.mu.Lock()
+	p.routes = routes
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *ReverseProxy) match(host, path string) *ProxyRoute {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for i := range p.routes {
+		if p.routes[i].matches(host, path) {
+			route := p.routes[i]
+			return &route
+		}
+	}
+	return nil
+}
+
+// Upstream finds where a route's container currently listens: its published
+// port when there is one, otherwise its address on a Docker network. The
+// container list comes from the listing cache, which Docker events refresh.
+func (p *ReverseProxy) Upstream(ctx context.Context, cli *client.Client, route *ProxyRoute) (*url.URL, error) {
+	containers, err := p.listings.Containers(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	var target *container.Summary
+	for i, c := range containers {
+		if summaryName(c) == route.Container || strings.HasPrefix(c.ID, route.Container) {
+			target = &containers[i]
+			break
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("container %s not found", route.Container)
+	}
+	if target.State != "running" {
+		return nil, fmt.Errorf("%s: %w", route.Container, errUpstreamDown)
+	}
+
+	port := route.Port
+	if port == 0 {
+		private := map[uint16]bool{}
+		for _, p := range target.Ports {
+			private[p.PrivatePort] = true
+		}
+		if len(private) != 1 {
+			return nil, fmt.Errorf("container %s exposes %d ports, set the route's port", route.Container, len(private))
+		}
+		for p := range private {
+			port = int(p)
+		}
+	}
+
+	for _, p := range target.Ports {
+		if int(p.PrivatePort) == port && p.PublicPort != 0 && p.Type == "tcp" {
+			host := os.Getenv("PROXY_UPSTREAM_HOST")
+			if host == "" {
+				host = defaultProxyUpstreamHost
+			}
+			return &url.URL{Scheme: "http", Host: net.JoinHostPort(host, strconv.Itoa(int(p.PublicPort)))}, nil
+		}
+	}
+	if target.NetworkSettings != nil {
+		names := make([]string, 0, len(target.NetworkSettings.Networks))
+		for name := range target.NetworkSettings.Networks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if ip := target.NetworkSettings.Networks[name].IPAddress; ip != "" {
+				return &url.URL{Scheme: "http", Host: net.JoinHostPort(ip, strconv.Itoa(port))}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("container %s has no published port %d and no network address", route.Container, port)
+}
+
+// proxyDomain is the wildcard domain containers get automatic routes under,
+// from PROXY_DOMAIN, e.g. apps.example.com
+func proxyDomain() string {
+	return strings.Trim(strings.ToLower(os.Getenv("PROXY_DOMAIN")), ".")
+}
+
+// proxySubdomain is the subdomain of a container's automatic route: the
+// proxy.subdomain label, or the name made DNS-safe. Empty when the container
+// opted out or its name can't be made into a label.
+func proxySubdomain(name string, labels map[string]string) string {
+	if enabled, err := strconv.ParseBool(labels[proxyLabel]); err == nil && !enabled {
+		return ""
+	}
+	if sub := labels[proxySubdomainLabel]; sub != "" {
+		return sub
+	}
+	sub := strings.Trim(strings.NewReplacer("_", "-", ".", "-").Replace(strings.ToLower(name)), "-")
+	if !subdomainPattern.MatchString(sub) {
+		return ""
+	}
+	return sub
+}
+
+// proxyURL is the address a container is reachable at through its automatic
+// route, or "" when there is none
+func proxyURL(name string, labels map[string]string) string {
+	domain, sub := proxyDomain(), proxySubdomain(name, labels)
+	if domain == "" || sub == "" {
+		return ""
+	}
+	return "http://" + sub + "." + domain
+}
+
+// autoRoute returns the automatic route for a host under PROXY_DOMAIN
+func (p *ReverseProxy) autoRoute(ctx context.Context, cli *client.Client, host string) *ProxyRoute {
+	domain := proxyDomain()
+	sub, ok := strings.CutSuffix(host, "."+domain)
+	if domain == "" || !ok || strings.Contains(sub, ".") {
+		return nil
+	}
+	containers, err := p.listings.Containers(ctx, cli)
+	if err != nil {
+		return nil
+	}
+	for _, c := range containers {
+		if proxySubdomain(summaryName(c), c.Labels) == sub {
+			port, _ := strconv.Atoi(c.Labels[proxyPortLabel])
+			return &ProxyRoute{Host: host, Path: "/", Container: summaryName(c), Port: port, TLS: autoRoutesTLS()}
+		}
+	}
+	return nil
+}
+
+// AutoRoutes lists the automatic routes of all containers
+func (p *ReverseProxy) AutoRoutes(ctx context.Context, cli *client.Client) ([]ProxyRoute, error) {
+	routes := []ProxyRoute{}
+	domain := proxyDomain()
+	if domain == "" {
+		return routes, nil
+	}
+	containers, err := p.listings.Containers(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range containers {
+		// Containers without ports have nothing to route to
+		if len(c.Ports) == 0 && c.Labels[proxyPortLabel] == "" {
+			continue
+		}
+		if sub := proxySubdomain(summaryName(c), c.Labels); sub != "" {
+			port, _ := strconv.Atoi(c.Labels[proxyPortLabel])
+			routes = append(routes, ProxyRoute{Host: sub + "." + domain, Path: "/", Container: summaryName(c), Port: port, TLS: autoRoutesTLS()})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Host < routes[j].Host })
+	return routes, nil
+}
+
+func (p *ReverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := strings.ToLower(r.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		http.Error(w, "Cannot connect to Docker daemon", http.StatusBadGateway)
+		return
+	}
+	defer cli.Close()
+
+	// Routes for this exact host come first, then the container's automatic
+	// route, then wildcard and catch-all routes
+	route := p.match(host, r.URL.Path)
+	if route == nil || route.Host != host {
+		if auto := p.autoRoute(r.Context(), cli, host); auto != nil {
+			route = auto
+		}
+	}
+	if route == nil {
+		http.Error(w, "No route for "+host+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	if redirectToHTTPS(w, r, host, route) {
+		return
+	}
+	target, err := p.Upstream(r.Context(), cli, route)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, errUpstreamDown) {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			if route.StripPath && route.Path != "/" {
+				pr.Out.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(pr.In.URL.Path, route.Path), "/")
+				pr.Out.URL.RawPath = ""
+			}
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			// Apps usually build links from the Host header
+			pr.Out.Host = pr.In.Host
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			fmt.Printf("⚠️  Proxy error for %s%s -> %s: %v\n", host, r.URL.Path, target.Host, err)
+			http.Error(w, "Upstream "+route.Container+" is not responding", http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// startProxy serves the proxy on PROXY_ADDR in the background; the proxy is
+// off when it isn't set
+func startProxy(p *ReverseProxy) {
+	addr := os.Getenv("PROXY_ADDR")
+	if addr == "" {
+		return
+	}
+	if err := p.Reload(); err != nil {
+		fmt.Printf("⚠️  Error loading proxy routes: %v\n", err)
+	}
+	handler := startProxyTLS(p)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Printf("❌ Cannot start reverse proxy on %s: %v\n", addr, err)
+		return
+	}
+	fmt.Printf("🔀 Reverse proxy listening on %s\n", addr)
+	go func() {
+		server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+		if err := server.Serve(listener); err != nil {
+			fmt.Printf("❌ Reverse proxy stopped: %v\n", err)
+		}
+	}()
+}
+
+func (s *Store) CreateProxyRoute(r *ProxyRoute) error {
+	r.ID = newID()
+	r.CreatedAt = time.Now()
+	_, err := s.exec(`INSERT INTO proxy_routes (id, host, path, container, port, strip_path, tls, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ID, r.Host, r.Path, r.Container, r.Port, r.StripPath, r.TLS, r.CreatedBy, r.CreatedAt.Unix())
+	return err
+}
+
+func (s *Store) DeleteProxyRoute(id string) (bool, error) {
+	res, err := s.exec(`DELETE FROM proxy_routes WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) ListProxyRoutes() ([]ProxyRoute, error) {
+	rows, err := s.query(`SELECT id, host, path, container, port, strip_path, tls, created_by, created_at FROM proxy_routes ORDER BY host, path`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	routes := []ProxyRoute{}
+	for rows.Next() {
+		var r ProxyRoute
+		var createdAt int64
+		if err := rows.Scan(&r.ID, &r.Host, &r.Path, &r.Container, &r.Port, &r.StripPath, &r.TLS, &r.CreatedBy, &createdAt); err != nil {
+			return nil, err
+		}
+		r.CreatedAt = time.Unix(createdAt, 0)
+		routes = append(routes, r)
+	}
+	return routes, rows.Err()
+}
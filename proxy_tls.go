@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/client"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Where ACME account keys and issued certificates are kept
+const defaultProxyCertDir = "data/certs"
+
+// proxyTLSAddr is the HTTPS address of the proxy, from PROXY_TLS_ADDR;
+// TLS is off when it's empty
+func proxyTLSAddr() string {
+	return os.Getenv("PROXY_TLS_ADDR")
+}
+
+// autoRoutesTLS reports whether automatic subdomain routes get certificates
+// too: PROXY_AUTO_TLS, off by default
+func autoRoutesTLS() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("PROXY_AUTO_TLS"))
+	return enabled
+}
+
+// certManager obtains and renews certificates from Let's Encrypt, or the
+// ACME directory in ACME_DIRECTORY_URL (e.g. the staging environment), for
+// hostnames of TLS routes only
+func (p *ReverseProxy) certManager() *autocert.Manager {
+	dir := os.Getenv("PROXY_CERT_DIR")
+	if dir == "" {
+		dir = defaultProxyCertDir
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(dir),
+		HostPolicy: p.hostPolicy,
+		Email:      os.Getenv("ACME_EMAIL"),
+	}
+	if url := os.Getenv("ACME_DIRECTORY_URL"); url != "" {
+		m.Client = &acme.Client{DirectoryURL: url}
+	}
+	return m
+}
+
+// hostPolicy only lets the ACME client ask for certificates for hosts a TLS
+// route serves, so random SNI names can't use up the rate limits
+func (p *ReverseProxy) hostPolicy(ctx context.Context, host string) error {
+	p.mu.RLock()
+	for _, route := range p.routes {
+		// Any path: a route for /api alone still needs the host's certificate
+		if route.TLS && route.Host != "" && route.matches(host, route.Path) {
+			p.mu.RUnlock()
+			return nil
+		}
+	}
+	p.mu.RUnlock()
+	if !autoRoutesTLS() {
+		return fmt.Errorf("no TLS route for %s", host)
+	}
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	if p.autoRoute(ctx, cli, host) == nil {
+		return fmt.Errorf("no TLS route for %s", host)
+	}
+	return nil
+}
+
+// redirectToHTTPS sends plain HTTP requests for TLS routes to HTTPS and
+// reports whether it did
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request, host string, route *ProxyRoute) bool {
+	if r.TLS != nil || !route.TLS || proxyTLSAddr() == "" {
+		return false
+	}
+	target := host
+	if _, port, err := net.SplitHostPort(proxyTLSAddr()); err == nil && port != "443" {
+		target = net.JoinHostPort(host, port)
+	}
+	// 308 keeps the method and body of non-GET requests
+	http.Redirect(w, r, "https://"+target+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	return true
+}
+
+// startProxyTLS serves HTTPS on PROXY_TLS_ADDR and returns the handler for
+// the plain HTTP listener, which must answer ACME HTTP-01 challenges
+func startProxyTLS(p *ReverseProxy) http.Handler {
+	addr := proxyTLSAddr()
+	if addr == "" {
+		return p
+	}
+	m := p.certManager()
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Printf("❌ Cannot start reverse proxy TLS on %s: %v\n", addr, err)
+		return p
+	}
+	fmt.Printf("🔒 Reverse proxy TLS listening on %s\n", addr)
+	go func() {
+		server := &http.Server{Handler: p, TLSConfig: m.TLSConfig(), ReadHeaderTimeout: 10 * time.Second}
+		if err := server.Serve(tls.NewListener(listener, server.TLSConfig)); err != nil {
+			fmt.Printf("❌ Reverse proxy TLS stopped: %v\n", err)
+		}
+	}()
+	return m.HTTPHandler(p)
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-units"
+	"github.com/gin-gonic/gin"
+)
+
+// ownerLabel records the user who created a container, per-user quotas
+// count containers by it
+const ownerLabel = labelPrefix + "owner"
+
+const (
+	quotaScopeUser    = "user"
+	quotaScopeProject = "project"
+)
+
+// Quota caps what a user or a project may run. Zero or empty limits are
+// unlimited.
+type Quota struct {
+	ID            string    `json:"id"`
+	Scope         string    `json:"scope"`
+	Subject       string    `json:"subject"`
+	MaxContainers int       `json:"max_containers" binding:"min=0"`
+	MaxMemory     string    `json:"max_memory" binding:"omitempty,bytesize"`
+	MaxVolumes    int       `json:"max_volumes" binding:"min=0"`
+	UpdatedBy     string    `json:"updated_by"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func validateQuota(q *Quota) error {
+	if q.Scope != quotaScopeUser && q.Scope != quotaScopeProject {
+		return fmt.Errorf("invalid scope %q: use user or project", q.Scope)
+	}
+	if q.MaxContainers < 0 || q.MaxVolumes < 0 {
+		return fmt.Errorf("max_containers and max_volumes must not be negative")
+	}
+	if q.MaxMemory != "" {
+		if bytes, err := units.RAMInBytes(q.MaxMemory); err != nil || bytes <= 0 {
+			return fmt.Errorf("invalid max_memory %q, use e.g. \"8g\"", q.MaxMemory)
+		}
+	}
+	return nil
+}
+
+// maxMemoryBytes is the memory limit of a validated quota, 0 when unlimited
+func (q *Quota) maxMemoryBytes() int64 {
+	if q.MaxMemory == "" {
+		return 0
+	}
+	bytes, _ := units.RAMInBytes(q.MaxMemory)
+	return bytes
+}
+
+// label is the container label the quota's subject is matched on
+func (q *Quota) label() string {
+	if q.Scope == quotaScopeProject {
+		return projectLabel
+	}
+	return ownerLabel
+}
+
+// SaveQuota creates or replaces the quota of a user or project
+func (s *Store) SaveQuota(q *Quota) error {
+	q.UpdatedAt = time.Now()
+	if existing, err := s.GetQuota(q.Scope, q.Subject); err == nil {
+		q.ID = existing.ID
+		_, err := s.exec(`UPDATE quotas SET max_containers = ?, max_memory = ?, max_volumes = ?, updated_by = ?, updated_at = ? WHERE id = ?`,
+			q.MaxContainers, q.MaxMemory, q.MaxVolumes, q.UpdatedBy, q.UpdatedAt.Unix(), q.ID)
+		return err
+	}
+	q.ID = newID()
+	_, err := s.exec(`INSERT INTO quotas (id, scope, subject, max_containers, max_memory, max_volumes, updated_by, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		q.ID, q.Scope, q.Subject, q.MaxContainers, q.MaxMemory, q.MaxVolumes, q.UpdatedBy, q.UpdatedAt.Unix())
+	return err
+}
+
+func (s *Store) DeleteQuota(scope, subject string) (bool, error) {
+	res, err := s.exec(`DELETE FROM quotas WHERE scope = ? AND subject = ?`, scope, subject)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) GetQuota(scope, subject string) (*Quota, error) {
+	var q Quota
+	var updatedAt int64
+	err := s.queryRow(`SELECT id, scope, subject, max_containers, max_memory, max_volumes, updated_by, updated_at FROM quotas WHERE scope = ? AND subject = ?`, scope, subject).
+		Scan(&q.ID, &q.Scope, &q.Subject, &q.MaxContainers, &q.MaxMemory, &q.MaxVolumes, &q.UpdatedBy, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	q.UpdatedAt = time.Unix(updatedAt, 0)
+	return &q, nil
+}
+
+func (s *Store) ListQuotas() ([]Quota, error) {
+	rows, err := s.query(`SELECT id, scope, subject, max_containers, max_memory, max_volumes, updated_by, updated_at FROM quotas ORDER BY scope, subject`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quotas := []Quota{}
+	for rows.Next() {
+		var q Quota
+		var updatedAt int64
+		if err := rows.Scan(&q.ID, &q.Scope, &q.Subject, &q.MaxContainers, &q.MaxMemory, &q.MaxVolumes, &q.UpdatedBy, &updatedAt); err != nil {
+			return nil, err
+		}
+		q.UpdatedAt = time.Unix(updatedAt, 0)
+		quotas = append(quotas, q)
+	}
+	return quotas, rows.Err()
+}
+
+// QuotaUsage is what a user or project currently holds. Stopped containers
+// count too, they can be started again at any time.
+type QuotaUsage struct {
+	Containers int   `json:"containers"`
+	Memory     int64 `json:"memory_bytes"`
+	Volumes    int   `json:"volumes"`
+	// Containers without a memory limit, not included in Memory
+	Unlimited int `json:"unlimited_memory_containers"`
+}
+
+func quotaUsage(ctx context.Context, cli *client.Client, label, subject string) (*QuotaUsage, map[string]bool, error) {
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", label+"="+subject)),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	usage := &QuotaUsage{Containers: len(containers)}
+	volumes := map[string]bool{}
+	for _, c := range containers {
+		for _, m := range c.Mounts {
+			if m.Type == mount.TypeVolume && m.Name != "" {
+				volumes[m.Name] = true
+			}
+		}
+		// The list summary doesn't carry resource limits
+		info, err := cli.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if info.HostConfig.Memory > 0 {
+			usage.Memory += info.HostConfig.Memory
+		} else {
+			usage.Unlimited++
+		}
+	}
+	usage.Volumes = len(volumes)
+	return usage, volumes, nil
+}
+
+// QuotaError describes which limit a create request would exceed
+type QuotaError struct {
+	Quota   *Quota      `json:"quota"`
+	Usage   *QuotaUsage `json:"usage"`
+	Reasons []string    `json:"reasons"`
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s quota of %s exceeded: %s", e.Quota.Scope, e.Quota.Subject, strings.Join(e.Reasons, "; "))
+}
+
+// checkQuotas verifies that one more container with the given memory limit
+// and named volumes fits in the quotas of its owner and project. It returns
+// a *QuotaError when a limit would be exceeded.
+func checkQuotas(ctx context.Context, cli *client.Client, store *Store, owner, project string, memory int64, volumes []string) error {
+	subjects := [][2]string{{quotaScopeUser, owner}}
+	if project != "" {
+		subjects = append(subjects, [2]string{quotaScopeProject, project})
+	}
+
+	for _, subject := range subjects {
+		quota, err := store.GetQuota(subject[0], subject[1])
+		if err != nil {
+			// No quota for this user or project
+			continue
+		}
+		usage, held, err := quotaUsage(ctx, cli, quota.label(), quota.Subject)
+		if err != nil {
+			return err
+		}
+
+		var reasons []string
+		if quota.MaxContainers > 0 && usage.Containers+1 > quota.MaxContainers {
+			reasons = append(reasons, fmt.Sprintf("%d of %d containers in use", usage.Containers, quota.MaxContainers))
+		}
+		if maxMemory := quota.maxMemoryBytes(); maxMemory > 0 {
+			switch {
+			case memory == 0:
+				reasons = append(reasons, "a memory limit is required")
+			case usage.Memory+memory > maxMemory:
+				reasons = append(reasons, fmt.Sprintf("%s of %s memory in use, %s requested",
+					units.BytesSize(float64(usage.Memory)), quota.MaxMemory, units.BytesSize(float64(memory))))
+			}
+		}
+		if quota.MaxVolumes > 0 {
+			added := 0
+			for _, v := range volumes {
+				if !held[v] {
+					added++
+				}
+			}
+			if added > 0 && usage.Volumes+added > quota.MaxVolumes {
+				reasons = append(reasons, fmt.Sprintf("%d of %d volumes in use, %d more requested", usage.Volumes, quota.MaxVolumes, added))
+			}
+		}
+		if len(reasons) > 0 {
+			return &QuotaError{Quota: quota, Usage: usage, Reasons: reasons}
+		}
+	}
+	return nil
+}
+
+// namedVolumes lists the named volumes a host config mounts
+func namedVolumes(hostConfig *container.HostConfig) []string {
+	var names []string
+	for _, m := range hostConfig.Mounts {
+		if m.Type == mount.TypeVolume && m.Source != "" {
+			names = append(names, m.Source)
+		}
+	}
+	for _, bind := range hostConfig.Binds {
+		source, _, _ := strings.Cut(bind, ":")
+		if source != "" && !strings.HasPrefix(source, "/") {
+			names = append(names, source)
+		}
+	}
+	return names
+}
+
+// respondQuotaError answers a create request rejected by checkQuotas
+func respondQuotaError(ctx *gin.Context, err error) {
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking quotas: " + err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusForbidden, gin.H{
+		"error":      "Quota exceeded: " + quotaErr.Error(),
+		"quota":      quotaErr.Quota,
+		"usage":      quotaErr.Usage,
+		"reasons":    quotaErr.Reasons,
+		"suggestion": "Xóa bớt container/volume không dùng, đặt giới hạn \"memory\" nhỏ hơn hoặc nhờ admin tăng quota",
+	})
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+)
+
+// Step actions of a recipe
+const (
+	recipeStepPull   = "pull"
+	recipeStepCreate = "create"
+	recipeStepStart  = "start"
+	recipeStepWait   = "wait"
+	recipeStepExec   = "exec"
+	recipeStepStop   = "stop"
+	recipeStepRemove = "remove"
+)
+
+// Job type recipe runs are recorded under, see GET /jobs?type=recipe
+const recipeJobType = "recipe"
+
+// An exec step running longer than this fails unless it sets its own timeout
+const defaultRecipeExecTimeout = 5 * time.Minute
+
+// Recipe is a named sequence of steps run in order as one job. The first
+// failing step aborts the run: the remaining steps are skipped and the
+// containers the run created are removed again.
+type Recipe struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name" binding:"required,resourcename"`
+	Description string       `json:"description"`
+	Steps       []RecipeStep `json:"steps" binding:"required,min=1,max=50,dive"`
+	CreatedBy   string       `json:"created_by"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+// RecipeStep is one operation of a recipe. Which fields apply depends on
+// the action:
+//
+//	pull    image
+//	create  container (the new name), image, port, env, args, network
+//	start   container
+//	wait    container, wait_for, timeout
+//	exec    container, command, timeout
+//	stop    container
+//	remove  container
+type RecipeStep struct {
+	// Shown in the run status, defaults to the action
+	Name      string            `json:"name,omitempty" binding:"max=100"`
+	Action    string            `json:"action" binding:"required,oneof=pull create start wait exec stop remove"`
+	Image     string            `json:"image,omitempty" binding:"omitempty,imageref"`
+	Container string            `json:"container,omitempty" binding:"omitempty,containerref"`
+	Port      string            `json:"port,omitempty"`
+	Env       map[string]string `json:"env,omitempty" binding:"dive,keys,envname,endkeys"`
+	Args      []string          `json:"args,omitempty"`
+	Network   string            `json:"network,omitempty"`
+	// Run with sh -c, a non-zero exit code fails the step
+	Command string `json:"command,omitempty"`
+	WaitFor string `json:"wait_for,omitempty" binding:"omitempty,oneof=healthy running"`
+	// Seconds, for wait and exec
+	Timeout int `json:"timeout,omitempty" binding:"omitempty,min=1,max=3600"`
+}
+
+func (s RecipeStep) label() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Action
+}
+
+func (s RecipeStep) timeout(def time.Duration) time.Duration {
+	if s.Timeout > 0 {
+		return time.Duration(s.Timeout) * time.Second
+	}
+	return def
+}
+
+func validateRecipe(r *Recipe) error {
+	for i, step := range r.Steps {
+		var missing string
+		switch {
+		case (step.Action == recipeStepPull || step.Action == recipeStepCreate) && step.Image == "":
+			missing = "image"
+		case step.Action != recipeStepPull && step.Container == "":
+			missing = "container"
+		case step.Action == recipeStepExec && strings.TrimSpace(step.Command) == "":
+			missing = "command"
+		}
+		if missing != "" {
+			return fmt.Errorf("step %d (%s): %s is required", i+1, step.Action, missing)
+		}
+		if step.Port != "" {
+			if step.Action != recipeStepCreate {
+				return fmt.Errorf("step %d (%s): port only applies to create", i+1, step.Action)
+			}
+			if _, err := nat.ParsePortSpec(step.Port); err != nil {
+				return fmt.Errorf("step %d (create): invalid port %q: %v", i+1, step.Port, err)
+			}
+		}
+		if step.Action == recipeStepCreate {
+			if _, err := buildEnv("", step.Env); err != nil {
+				return fmt.Errorf("step %d (create): %v", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Store) CreateRecipe(r *Recipe) error {
+	steps, err := json.Marshal(r.Steps)
+	if err != nil {
+		return err
+	}
+	r.ID = newID()
+	r.CreatedAt = time.Now()
+	_, err = s.exec(`INSERT INTO recipes (id, name, description, steps, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		r.ID, r.Name, r.Description, string(steps), r.CreatedBy, r.CreatedAt.Unix())
+	return err
+}
+
+func (s *Store) UpdateRecipe(r *Recipe) error {
+	steps, err := json.Marshal(r.Steps)
+	if err != nil {
+		return err
+	}
+	_, err = s.exec(`UPDATE recipes SET name = ?, description = ?, steps = ? WHERE id = ?`,
+		r.Name, r.Description, string(steps), r.ID)
+	return err
+}
+
+func (s *Store) DeleteRecipe(id string) (bool, error) {
+	res, err := s.exec(`DELETE FROM recipes WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// GetRecipe looks a recipe up by ID or name
+func (s *Store) GetRecipe(idOrName string) (*Recipe, error) {
+	return scanRecipe(s.queryRow(`SELECT id, name, description, steps, created_by, created_at
+		FROM recipes WHERE id = ? OR name = ?`, idOrName, idOrName))
+}
+
+func (s *Store) ListRecipes() ([]Recipe, error) {
+	rows, err := s.query(`SELECT id, name, description, steps, created_by, created_at FROM recipes ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipes := []Recipe{}
+	for rows.Next() {
+		r, err := scanRecipe(rows)
+		if err != nil {
+			return nil, err
+		}
+		recipes = append(recipes, *r)
+	}
+	return recipes, rows.Err()
+}
+
+func scanRecipe(row rowScanner) (*Recipe, error) {
+	var r Recipe
+	var steps string
+	var createdAt int64
+	if err := row.Scan(&r.ID, &r.Name, &r.Description, &steps, &r.CreatedBy, &createdAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(steps), &r.Steps); err != nil {
+		return nil, err
+	}
+	r.CreatedAt = time.Unix(createdAt, 0)
+	return &r, nil
+}
+
+// RecipeStepStatus is the progress of one step in a recipe run
+type RecipeStepStatus struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	// pending, running, succeeded, failed or skipped
+	Status      string     `json:"status"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	Duration    string     `json:"duration,omitempty"`
+	Output      string     `json:"output,omitempty"`
+	ExitCode    *int       `json:"exit_code,omitempty"`
+	ContainerID string     `json:"container_id,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// RecipeRun is the result of a recipe job, saved after every step so
+// GET /jobs/:id shows how far the run got
+type RecipeRun struct {
+	Recipe string             `json:"recipe"`
+	Actor  string             `json:"actor"`
+	Steps  []RecipeStepStatus `json:"steps"`
+	// Containers the run created and removed again after a failure
+	RolledBack     []string `json:"rolled_back,omitempty"`
+	RollbackErrors []string `json:"rollback_errors,omitempty"`
+}
+
+// recipeRunner runs the steps of one recipe. Exec steps are checked
+// against the exec policy as the caller who started the run.
+type recipeRunner struct {
+	store         *Store
+	actor, role   string
+	keepOnFailure bool
+	created       []string
+}
+
+// startRecipe records a running job for the recipe and runs it in the
+// background, saving the job after every step
+func startRecipe(store *Store, recipe *Recipe, actor, role string, keepOnFailure bool) (string, error) {
+	run := &RecipeRun{Recipe: recipe.Name, Actor: actor, Steps: make([]RecipeStepStatus, len(recipe.Steps))}
+	for i, step := range recipe.Steps {
+		run.Steps[i] = RecipeStepStatus{Name: step.label(), Action: step.Action, Status: "pending"}
+	}
+	result, err := json.Marshal(run)
+	if err != nil {
+		return "", err
+	}
+	job := &Job{Type: recipeJobType, Status: "running", Result: result}
+	if err := store.SaveJob(job); err != nil {
+		return "", err
+	}
+	runner := &recipeRunner{store: store, actor: actor, role: role, keepOnFailure: keepOnFailure}
+	go finishJob(store, job, func() (any, error) {
+		return run, runner.run(recipe, run, func() {
+			job.Result, _ = json.Marshal(run)
+			if err := store.SaveJob(job); err != nil {
+				fmt.Printf("⚠️  Error saving recipe job: %v\n", err)
+			}
+		})
+	})
+	return job.ID, nil
+}
+
+// run executes the steps in order, calling progress after each status
+// change. The first failure skips the remaining steps and, unless
+// keepOnFailure is set, removes the containers created so far.
+func (r *recipeRunner) run(recipe *Recipe, run *RecipeRun, progress func()) error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return fmt.Errorf("cannot connect to Docker daemon: %w", err)
+	}
+	defer cli.Close()
+	ctx := withActor(context.Background(), r.actor)
+
+	fmt.Printf("📜 Running recipe %s for %s\n", recipe.Name, r.actor)
+	for i, step := range recipe.Steps {
+		status := &run.Steps[i]
+		started := time.Now()
+		status.StartedAt = &started
+		status.Status = "running"
+		progress()
+
+		err := r.runStep(ctx, cli, step, status)
+		status.Duration = time.Since(started).Round(time.Millisecond).String()
+		if err == nil {
+			status.Status = "succeeded"
+			continue
+		}
+		status.Status = "failed"
+		status.Error = err.Error()
+		for j := i + 1; j < len(run.Steps); j++ {
+			run.Steps[j].Status = "skipped"
+		}
+		if !r.keepOnFailure {
+			r.rollback(cli, run)
+		}
+		return fmt.Errorf("step %d (%s) failed: %w", i+1, status.Name, err)
+	}
+	return nil
+}
+
+func (r *recipeRunner) runStep(ctx context.Context, cli *client.Client, step RecipeStep, status *RecipeStepStatus) error {
+	switch step.Action {
+	case recipeStepPull:
+		if err := checkDiskSpace(ctx, cli); err != nil {
+			return err
+		}
+		return pullImage(ctx, cli, step.Image)
+
+	case recipeStepCreate:
+		spec, err := recipeContainerSpec(step)
+		if err != nil {
+			return err
+		}
+		if err := ensureImage(ctx, cli, step.Image); err != nil {
+			return fmt.Errorf("image %s: %w", step.Image, err)
+		}
+		id, err := createFromSpec(ctx, cli, spec, step.Container)
+		if err != nil {
+			return err
+		}
+		r.created = append(r.created, id)
+		status.ContainerID = id
+		return nil
+
+	case recipeStepStart:
+		return startContainer(ctx, cli, step.Container, container.StartOptions{})
+
+	case recipeStepWait:
+		waitFor := step.WaitFor
+		if waitFor == "" {
+			waitFor = waitForHealthy
+		}
+		_, err := waitForContainer(ctx, cli, step.Container, waitFor, step.timeout(defaultHealthWait))
+		return err
+
+	case recipeStepExec:
+		return r.exec(ctx, cli, step, status)
+
+	case recipeStepStop:
+		if err := checkProtected(ctx, cli, r.store, step.Container); err != nil {
+			return err
+		}
+		return stopContainer(ctx, cli, step.Container, container.StopOptions{})
+
+	case recipeStepRemove:
+		if err := checkProtected(ctx, cli, r.store, step.Container); err != nil {
+			return err
+		}
+		return removeContainer(ctx, cli, step.Container, container.RemoveOptions{Force: true})
+	}
+	return fmt.Errorf("unknown action %q", step.Action)
+}
+
+func (r *recipeRunner) exec(ctx context.Context, cli *client.Client, step RecipeStep, status *RecipeStepStatus) error {
+	info, err := cli.ContainerInspect(ctx, step.Container)
+	if err != nil {
+		return err
+	}
+	decision, err := r.store.CheckExec(r.actor, r.role, strings.TrimPrefix(info.Name, "/"), step.Command)
+	if err != nil {
+		return fmt.Errorf("checking exec policy: %w", err)
+	}
+	if !decision.Allowed {
+		return fmt.Errorf("command not allowed: %s", decision.Reason)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, step.timeout(defaultRecipeExecTimeout))
+	defer cancel()
+	execResp, err := cli.ContainerExecCreate(ctx, info.ID, container.ExecOptions{
+		Cmd:          []string{"sh", "-c", step.Command},
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := cli.ContainerExecAttach(ctx, execResp.ID, container.ExecStartOptions{})
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+	var output bytes.Buffer
+	if _, err := stdcopy.StdCopy(&output, &output, resp.Reader); err != nil {
+		return err
+	}
+	status.Output = output.String()
+	inspect, err := cli.ContainerExecInspect(ctx, execResp.ID)
+	if err != nil {
+		return err
+	}
+	status.ExitCode = &inspect.ExitCode
+	if inspect.ExitCode != 0 {
+		return fmt.Errorf("command exited with code %d", inspect.ExitCode)
+	}
+	return nil
+}
+
+// rollback removes the containers the run created, newest first
+func (r *recipeRunner) rollback(cli *client.Client, run *RecipeRun) {
+	for i := len(r.created) - 1; i >= 0; i-- {
+		id := r.created[i]
+		err := cli.ContainerRemove(context.Background(), id, container.RemoveOptions{Force: true})
+		if err != nil && !client.IsErrNotFound(err) {
+			run.RollbackErrors = append(run.RollbackErrors, fmt.Sprintf("%s: %v", id, err))
+			continue
+		}
+		run.RolledBack = append(run.RolledBack, id)
+	}
+}
+
+// recipeContainerSpec builds the container a create step describes
+func recipeContainerSpec(step RecipeStep) (*ContainerSpec, error) {
+	env, err := buildEnv("", step.Env)
+	if err != nil {
+		return nil, err
+	}
+	spec := &ContainerSpec{
+		Config:     &container.Config{Image: step.Image, Env: env, Cmd: step.Args},
+		HostConfig: &container.HostConfig{},
+	}
+	if step.Network != "" {
+		spec.HostConfig.NetworkMode = container.NetworkMode(step.Network)
+	}
+	if step.Port != "" {
+		mappings, err := nat.ParsePortSpec(step.Port)
+		if err != nil {
+			return nil, err
+		}
+		spec.Config.ExposedPorts = nat.PortSet{}
+		spec.HostConfig.PortBindings = nat.PortMap{}
+		for _, m := range mappings {
+			spec.Config.ExposedPorts[m.Port] = struct{}{}
+			spec.HostConfig.PortBindings[m.Port] = append(spec.HostConfig.PortBindings[m.Port], m.Binding)
+		}
+	}
+	return spec, nil
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	units "github.com/docker/go-units"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	recordingKindExec   = "exec"
+	recordingKindAttach = "attach"
+)
+
+// Largest recording kept by default, later output is dropped
+const defaultRecordingMaxSize = 10 << 20
+
+// Terminal size written to recordings that don't know it
+const (
+	defaultRecordingCols = 80
+	defaultRecordingRows = 24
+)
+
+// Recording is a recorded exec terminal or attach session, stored as an
+// asciicast v2 file (https://docs.asciinema.org/manual/asciicast/v2/)
+type Recording struct {
+	ID            string     `json:"id"`
+	Kind          string     `json:"kind"`
+	ContainerID   string     `json:"container_id"`
+	ContainerName string     `json:"container_name"`
+	Command       string     `json:"command"`
+	RecordedBy    string     `json:"recorded_by"`
+	Size          int        `json:"size"`
+	Truncated     bool       `json:"truncated"`
+	ExitCode      *int       `json:"exit_code"`
+	StartedAt     time.Time  `json:"started_at"`
+	EndedAt       *time.Time `json:"ended_at"`
+}
+
+// SessionRecorder collects the events of one session in asciicast v2 format
+// and saves them when the session ends. A nil recorder records nothing, so
+// callers don't have to check whether recording is on.
+type SessionRecorder struct {
+	store   *Store
+	maxSize int
+	rec     Recording
+	start   time.Time
+
+	mu     sync.Mutex
+	cols   uint
+	rows   uint
+	events bytes.Buffer
+	closed bool
+	// Start of a UTF-8 sequence split across output chunks
+	partial []byte
+}
+
+// recordingEnabled reports whether sessions are recorded: RECORD_SESSIONS,
+// on unless set to false
+func recordingEnabled() bool {
+	enabled, err := strconv.ParseBool(os.Getenv("RECORD_SESSIONS"))
+	return err != nil || enabled
+}
+
+// newSessionRecorder starts recording a session, or returns nil when
+// recording is disabled
+func newSessionRecorder(store *Store, kind, containerID, containerName, command, actor string, cols, rows uint) *SessionRecorder {
+	if !recordingEnabled() {
+		return nil
+	}
+	maxSize := defaultRecordingMaxSize
+	if v := os.Getenv("RECORDING_MAX_SIZE"); v != "" {
+		size, err := units.RAMInBytes(v)
+		if err != nil || size <= 0 {
+			fmt.Printf("⚠️  Invalid RECORDING_MAX_SIZE %q, using %s\n", v, units.BytesSize(defaultRecordingMaxSize))
+		} else {
+			maxSize = int(size)
+		}
+	}
+	if cols == 0 || rows == 0 {
+		cols, rows = defaultRecordingCols, defaultRecordingRows
+	}
+	now := time.Now()
+	return &SessionRecorder{
+		store:   store,
+		maxSize: maxSize,
+		start:   now,
+		cols:    cols,
+		rows:    rows,
+		rec: Recording{
+			ID:            newID(),
+			Kind:          kind,
+			ContainerID:   containerID,
+			ContainerName: strings.TrimPrefix(containerName, "/"),
+			Command:       command,
+			RecordedBy:    actor,
+			StartedAt:     now,
+		},
+	}
+}
+
+// event appends one [time, code, data] line
+func (r *SessionRecorder) event(code, data string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || r.rec.Truncated {
+		return
+	}
+	line, _ := json.Marshal([]any{time.Since(r.start).Seconds(), code, data})
+	if r.events.Len()+len(line)+1 > r.maxSize {
+		r.rec.Truncated = true
+		return
+	}
+	r.events.Write(line)
+	r.events.WriteByte('\n')
+}
+
+func (r *SessionRecorder) ID() string {
+	return r.rec.ID
+}
+
+func (r *SessionRecorder) Output(p []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	data := append(r.partial, p...)
+	r.partial = nil
+	// Hold back an incomplete character, JSON would mangle it
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				r.partial = append([]byte(nil), data[i:]...)
+				data = data[:i]
+			}
+			break
+		}
+	}
+	r.mu.Unlock()
+	if len(data) > 0 {
+		r.event("o", string(data))
+	}
+}
+
+func (r *SessionRecorder) Input(data string) {
+	r.event("i", data)
+}
+
+func (r *SessionRecorder) Resize(cols, rows uint) {
+	r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Close saves the recording. exitCode is nil when it isn't known.
+func (r *SessionRecorder) Close(exitCode *int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	ended := time.Now()
+	r.rec.EndedAt = &ended
+	r.rec.ExitCode = exitCode
+	header, _ := json.Marshal(map[string]any{
+		"version":   2,
+		"width":     r.cols,
+		"height":    r.rows,
+		"timestamp": r.start.Unix(),
+		"duration":  ended.Sub(r.start).Seconds(),
+		"command":   r.rec.Command,
+		"title":     r.rec.Kind + " " + r.rec.ContainerName,
+	})
+	cast := string(header) + "\n" + r.events.String()
+	r.rec.Size = len(cast)
+	r.mu.Unlock()
+
+	if err := r.store.SaveRecording(&r.rec, cast); err != nil {
+		fmt.Printf("⚠️  Error saving session recording: %v\n", err)
+	}
+}
+
+// recordingForCaller loads a recording the caller may see: admins see all
+// of them, users only their own. It answers the error itself.
+func recordingForCaller(ctx *gin.Context, store *Store) (*Recording, bool) {
+	rec, err := store.GetRecording(ctx.Param("id"))
+	if err == nil && !isAdmin(ctx) && (currentUser(ctx) == nil || rec.RecordedBy != actorName(ctx)) {
+		err = errors.New("not visible to the caller")
+	}
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Recording not found: " + ctx.Param("id")})
+		return nil, false
+	}
+	return rec, true
+}
+
+// castEvent is one event line of an asciicast v2 file
+type castEvent struct {
+	Time float64
+	Code string
+	Data string
+}
+
+// parseCast splits an asciicast v2 file into its header and events
+func parseCast(cast string) (map[string]any, []castEvent, error) {
+	scanner := bufio.NewScanner(strings.NewReader(cast))
+	scanner.Buffer(make([]byte, 64*1024), defaultRecordingMaxSize)
+	var header map[string]any
+	if !scanner.Scan() {
+		return nil, nil, fmt.Errorf("empty recording")
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, nil, fmt.Errorf("invalid recording header: %w", err)
+	}
+	events := []castEvent{}
+	for scanner.Scan() {
+		var raw []any
+		if err := json.Unmarshal(scanner.Bytes(), &raw); err != nil || len(raw) != 3 {
+			continue
+		}
+		t, _ := raw[0].(float64)
+		code, _ := raw[1].(string)
+		data, _ := raw[2].(string)
+		events = append(events, castEvent{Time: t, Code: code, Data: data})
+	}
+	return header, events, scanner.Err()
+}
+
+func (s *Store) SaveRecording(r *Recording, cast string) error {
+	var endedAt int64
+	if r.EndedAt != nil {
+		endedAt = r.EndedAt.Unix()
+	}
+	exitCode := -1
+	if r.ExitCode != nil {
+		exitCode = *r.ExitCode
+	}
+	_, err := s.exec(`INSERT INTO session_recordings (id, kind, container_id, container_name, command, recorded_by, size, truncated, exit_code, started_at, ended_at, data) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ID, r.Kind, r.ContainerID, r.ContainerName, r.Command, r.RecordedBy, r.Size, r.Truncated, exitCode, r.StartedAt.Unix(), endedAt, cast)
+	return err
+}
+
+const recordingColumns = `id, kind, container_id, container_name, command, recorded_by, size, truncated, exit_code, started_at, ended_at`
+
+func scanRecording(row rowScanner) (*Recording, error) {
+	var r Recording
+	var exitCode int
+	var startedAt, endedAt int64
+	if err := row.Scan(&r.ID, &r.Kind, &r.ContainerID, &r.ContainerName, &r.Command, &r.RecordedBy, &r.Size, &r.Truncated, &exitCode, &startedAt, &endedAt); err != nil {
+		return nil, err
+	}
+	if exitCode >= 0 {
+		r.ExitCode = &exitCode
+	}
+	r.StartedAt = time.Unix(startedAt, 0)
+	if endedAt > 0 {
+		ended := time.Unix(endedAt, 0)
+		r.EndedAt = &ended
+	}
+	return &r, nil
+}
+
+// ListRecordings returns recordings newest first, optionally only those of
+// one container (by name or ID) or one user
+func (s *Store) ListRecordings(containerRef, recordedBy string, limit int) ([]Recording, error) {
+	query := `SELECT ` + recordingColumns + ` FROM session_recordings WHERE 1 = 1`
+	args := []any{}
+	if containerRef != "" {
+		query += ` AND (container_name = ? OR container_id LIKE ?)`
+		args = append(args, strings.TrimPrefix(containerRef, "/"), containerRef+"%")
+	}
+	if recordedBy != "" {
+		query += ` AND recorded_by = ?`
+		args = append(args, recordedBy)
+	}
+	query += ` ORDER BY started_at DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recordings := []Recording{}
+	for rows.Next() {
+		r, err := scanRecording(rows)
+		if err != nil {
+			return nil, err
+		}
+		recordings = append(recordings, *r)
+	}
+	return recordings, rows.Err()
+}
+
+func (s *Store) GetRecording(id string) (*Recording, error) {
+	return scanRecording(s.queryRow(`SELECT `+recordingColumns+` FROM session_recordings WHERE id = ?`, id))
+}
+
+// RecordingData returns the asciicast file of a recording
+func (s *Store) RecordingData(id string) (string, error) {
+	var data string
+	err := s.queryRow(`SELECT data FROM session_recordings WHERE id = ?`, id).Scan(&data)
+	return data, err
+}
+
+func (s *Store) DeleteRecording(id string) (bool, error) {
+	res, err := s.exec(`DELETE FROM session_recordings WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+)
+
+// registryMirrors maps registries such as "docker.io" to the pull-through
+// mirror images from them are pulled from, see REGISTRY_MIRRORS
+var registryMirrors = map[string]string{}
+
+// loadRegistryMirrors reads REGISTRY_MIRRORS, a comma-separated list of
+// registry=mirror pairs. A mirror without a registry is for Docker Hub:
+//
+//	REGISTRY_MIRRORS=mirror.gcr.io,ghcr.io=ghcr-cache.internal:5000
+func loadRegistryMirrors() (map[string]string, error) {
+	mirrors := map[string]string{}
+	for _, entry := range strings.Split(os.Getenv("REGISTRY_MIRRORS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		registry, mirror, ok := strings.Cut(entry, "=")
+		if !ok {
+			registry, mirror = "docker.io", entry
+		}
+		registry, mirror = strings.TrimSpace(registry), strings.TrimSuffix(strings.TrimSpace(mirror), "/")
+		// Hosts only, the daemon decides between https and insecure http
+		if strings.Contains(mirror, "://") {
+			return nil, fmt.Errorf("mirror %q must be a host[:port], without a scheme", mirror)
+		}
+		if _, err := reference.ParseNormalizedNamed(mirror + "/probe"); err != nil || mirror == "" {
+			return nil, fmt.Errorf("invalid mirror %q for %s", mirror, registry)
+		}
+		if _, dup := mirrors[registry]; dup {
+			return nil, fmt.Errorf("more than one mirror for %s", registry)
+		}
+		mirrors[registry] = mirror
+	}
+	return mirrors, nil
+}
+
+// mirrorRef rewrites an image reference to the mirror of its registry, and
+// returns the full upstream reference the image is tagged with afterwards.
+// References by digest aren't rewritten: the image pulled from the mirror
+// couldn't be tagged back under the original digest reference.
+func mirrorRef(ref string) (mirrored, upstream string, ok bool) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", "", false
+	}
+	if _, digested := named.(reference.Digested); digested {
+		return "", "", false
+	}
+	mirror, ok := registryMirrors[reference.Domain(named)]
+	if !ok {
+		return "", "", false
+	}
+	tagged := reference.TagNameOnly(named).(reference.NamedTagged)
+	return mirror + "/" + reference.Path(tagged) + ":" + tagged.Tag(), tagged.String(), true
+}
+
+// pullFromMirror pulls ref through the mirror of its registry and tags the
+// image with the original reference, so containers and later lookups use
+// the upstream name. It reports false when there is no mirror for ref or
+// the mirror failed, and the image should be pulled from upstream.
+func pullFromMirror(ctx context.Context, cli *client.Client, ref string) bool {
+	mirrored, upstream, ok := mirrorRef(ref)
+	if !ok {
+		return false
+	}
+	if err := pullAndWait(ctx, cli, mirrored); err != nil {
+		fmt.Printf("⚠️  Pulling %s from mirror failed, falling back to the upstream registry: %v\n", ref, err)
+		return false
+	}
+	if err := cli.ImageTag(ctx, mirrored, upstream); err != nil {
+		fmt.Printf("⚠️  Tagging %s as %s failed, falling back to the upstream registry: %v\n", mirrored, upstream, err)
+		return false
+	}
+	// Only the mirror's tag goes, the image stays under the original name
+	if _, err := cli.ImageRemove(ctx, mirrored, image.RemoveOptions{}); err != nil {
+		fmt.Printf("⚠️  Error removing mirror tag %s: %v\n", mirrored, err)
+	}
+	fmt.Printf("🪞 Pulled %s from mirror %s\n", ref, mirrored)
+	return true
+}
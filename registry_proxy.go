@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Value of REGISTRY_PROXY_HOSTS that sends a registry around the proxy
+const proxyDirect = "direct"
+
+// Hosts Docker Hub is reached on besides docker.io itself
+var dockerHubHosts = []string{"hub.docker.com", "index.docker.io", "registry-1.docker.io", "auth.docker.io"}
+
+// RegistryProxy picks the outbound proxy for the server's own registry
+// requests: a proxy per registry host first, then the global one
+type RegistryProxy struct {
+	global *httpproxy.Config
+	// Registry host to proxy, nil for a direct connection
+	hosts map[string]*url.URL
+}
+
+// loadRegistryProxy reads REGISTRY_PROXY, the proxy for every registry
+// (default HTTPS_PROXY/HTTP_PROXY/NO_PROXY of the environment), and
+// REGISTRY_PROXY_HOSTS, comma-separated host=proxy pairs overriding it for
+// some registries, where the proxy "direct" means none:
+//
+//	REGISTRY_PROXY_HOSTS=ghcr.io=http://proxy.corp:3128,registry.internal=direct
+func loadRegistryProxy() (*RegistryProxy, error) {
+	p := &RegistryProxy{global: httpproxy.FromEnvironment(), hosts: map[string]*url.URL{}}
+	if global := os.Getenv("REGISTRY_PROXY"); global != "" {
+		if _, err := parseProxyURL(global); err != nil {
+			return nil, err
+		}
+		p.global = &httpproxy.Config{HTTPProxy: global, HTTPSProxy: global, NoProxy: p.global.NoProxy}
+	}
+
+	for _, entry := range strings.Split(os.Getenv("REGISTRY_PROXY_HOSTS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, proxy, ok := strings.Cut(entry, "=")
+		if !ok || host == "" {
+			return nil, fmt.Errorf("%q is not a host=proxy pair", entry)
+		}
+		var proxyURL *url.URL
+		if proxy != proxyDirect {
+			var err error
+			if proxyURL, err = parseProxyURL(proxy); err != nil {
+				return nil, err
+			}
+		}
+		hosts := []string{strings.ToLower(host)}
+		if hosts[0] == "docker.io" {
+			hosts = append(hosts, dockerHubHosts...)
+		}
+		for _, h := range hosts {
+			p.hosts[h] = proxyURL
+		}
+	}
+	return p, nil
+}
+
+func parseProxyURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q, expected e.g. http://proxy.corp:3128", raw)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+		return u, nil
+	}
+	return nil, fmt.Errorf("proxy %q must use http, https or socks5", raw)
+}
+
+// Proxy is an http.Transport Proxy function
+func (p *RegistryProxy) Proxy(req *http.Request) (*url.URL, error) {
+	host := strings.ToLower(req.URL.Host)
+	if proxyURL, ok := p.hosts[host]; ok {
+		return proxyURL, nil
+	}
+	if proxyURL, ok := p.hosts[strings.ToLower(req.URL.Hostname())]; ok {
+		return proxyURL, nil
+	}
+	return p.global.ProxyFunc()(req.URL)
+}
+
+// Install routes registryHTTPClient through the proxy
+func (p *RegistryProxy) Install() {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = p.Proxy
+	registryHTTPClient.Transport = transport
+}
+
+// Status describes the proxies in effect, without credentials. Pulls and
+// searches are made by the Docker daemon, which only uses its own proxy
+// settings, so those are reported too.
+func (p *RegistryProxy) Status(ctx context.Context, cli *client.Client) map[string]any {
+	hosts := map[string]string{}
+	for host, proxyURL := range p.hosts {
+		hosts[host] = proxyDirect
+		if proxyURL != nil {
+			hosts[host] = proxyURL.Redacted()
+		}
+	}
+	server := map[string]any{
+		"http_proxy":  redactProxy(p.global.HTTPProxy),
+		"https_proxy": redactProxy(p.global.HTTPSProxy),
+		"no_proxy":    p.global.NoProxy,
+		"hosts":       hosts,
+	}
+	status := map[string]any{"server": server}
+
+	info, err := cli.Info(ctx)
+	if err != nil {
+		status["daemon_error"] = err.Error()
+		return status
+	}
+	status["daemon"] = map[string]any{
+		"http_proxy":  info.HTTPProxy,
+		"https_proxy": info.HTTPSProxy,
+		"no_proxy":    info.NoProxy,
+	}
+	if (p.global.HTTPSProxy != "" || len(p.hosts) > 0) && info.HTTPSProxy == "" && info.HTTPProxy == "" {
+		status["warning"] = "The Docker daemon has no proxy configured: pulls and searches will connect directly. " +
+			`Set "proxies" in daemon.json or HTTPS_PROXY in the docker service environment and restart the daemon.`
+	}
+	return status
+}
+
+func redactProxy(raw string) string {
+	if u, err := url.Parse(raw); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return raw
+}
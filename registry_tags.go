@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// The registry host comes from the caller, so requests never follow a
+// redirect to another host
+var registryHTTPClient = &http.Client{
+	Timeout: 15 * time.Second,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		if req.URL.Scheme != "https" || req.URL.Host != via[0].URL.Host {
+			return fmt.Errorf("registry redirected to another host: %s", req.URL.Redacted())
+		}
+		return nil
+	},
+}
+
+type ImageTag struct {
+	Name        string    `json:"name"`
+	Digest      string    `json:"digest,omitempty"`
+	Size        int64     `json:"size,omitempty"`
+	LastUpdated time.Time `json:"last_updated,omitempty"`
+}
+
+// splitRepository splits an image repository into registry host and path,
+// applying the Docker Hub defaults (docker.io, library/ namespace)
+func splitRepository(name string) (string, string) {
+	name = strings.TrimSpace(name)
+	if i := strings.IndexAny(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	// Strip a tag but not a registry port (registry:5000/app)
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		host := parts[0]
+		if host == "docker.io" || host == "index.docker.io" || host == "registry-1.docker.io" {
+			return "docker.io", addLibraryPrefix(parts[1])
+		}
+		return host, parts[1]
+	}
+	return "docker.io", addLibraryPrefix(name)
+}
+
+// escapeRepository escapes each path segment of a repository for a URL
+func escapeRepository(repo string) string {
+	segments := strings.Split(repo, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func addLibraryPrefix(repo string) string {
+	if !strings.Contains(repo, "/") {
+		return "library/" + repo
+	}
+	return repo
+}
+
+// listRepositoryTags lists available tags for a repository. Docker Hub is queried
+// through its web API (which includes sizes and dates), other registries through
+// the standard v2 tags/list endpoint.
+func listRepositoryTags(ctx context.Context, name string, limit int) ([]ImageTag, error) {
+	host, repo := splitRepository(name)
+	if host == "docker.io" {
+		return listDockerHubTags(ctx, repo, limit)
+	}
+	return listRegistryV2Tags(ctx, host, repo, limit)
+}
+
+func listDockerHubTags(ctx context.Context, repo string, limit int) ([]ImageTag, error) {
+	pageSize := limit
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	next := fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/tags?page_size=%d&ordering=last_updated", escapeRepository(repo), pageSize)
+
+	var tags []ImageTag
+	for next != "" && len(tags) < limit {
+		var page struct {
+			Next    string `json:"next"`
+			Results []struct {
+				Name        string    `json:"name"`
+				Digest      string    `json:"digest"`
+				FullSize    int64     `json:"full_size"`
+				LastUpdated time.Time `json:"last_updated"`
+			} `json:"results"`
+		}
+		if err := getRegistryJSON(ctx, next, "", &page); err != nil {
+			return nil, err
+		}
+		for _, t := range page.Results {
+			tags = append(tags, ImageTag{Name: t.Name, Digest: t.Digest, Size: t.FullSize, LastUpdated: t.LastUpdated})
+		}
+		next = page.Next
+	}
+
+	if len(tags) > limit {
+		tags = tags[:limit]
+	}
+	return tags, nil
+}
+
+func listRegistryV2Tags(ctx context.Context, host, repo string, limit int) ([]ImageTag, error) {
+	tagsURL := fmt.Sprintf("https://%s/v2/%s/tags/list?n=%d", host, escapeRepository(repo), limit)
+
+	// Anonymous pull access still requires a bearer token on most registries
+	token, err := registryToken(ctx, host, tagsURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Tags []string `json:"tags"`
+	}
+	if err := getRegistryJSON(ctx, tagsURL, token, &list); err != nil {
+		return nil, err
+	}
+
+	var tags []ImageTag
+	for _, name := range list.Tags {
+		tags = append(tags, ImageTag{Name: name})
+	}
+	if len(tags) > limit {
+		tags = tags[:limit]
+	}
+	return tags, nil
+}
+
+// registryAuthAllowed reports whether a token realm may be fetched for a
+// registry: over https, on the registry's own host or on one listed in
+// REGISTRY_AUTH_HOSTS (comma-separated, e.g. gitlab.com for
+// registry.gitlab.com). Anything else would let the registry, which the
+// caller picks, point the server at arbitrary URLs.
+func registryAuthAllowed(registryHost string, realm *url.URL) bool {
+	if realm.Scheme != "https" || realm.User != nil {
+		return false
+	}
+	host := strings.ToLower(realm.Hostname())
+	if registry, err := url.Parse("https://" + registryHost); err == nil && host == strings.ToLower(registry.Hostname()) {
+		return true
+	}
+	for _, allowed := range strings.Split(os.Getenv("REGISTRY_AUTH_HOSTS"), ",") {
+		if allowed = strings.ToLower(strings.TrimSpace(allowed)); allowed != "" && host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// registryToken follows the WWW-Authenticate challenge of a registry and
+// fetches an anonymous bearer token. It returns an empty token when the
+// registry doesn't require one.
+func registryToken(ctx context.Context, registryHost, target string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := registryHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		return "", nil
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return "", fmt.Errorf("registry requires unsupported authentication: %s", challenge)
+	}
+
+	params := map[string]string{}
+	for _, part := range strings.Split(challenge[len("bearer "):], ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) == 2 {
+			params[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+	if params["realm"] == "" {
+		return "", fmt.Errorf("registry auth challenge has no realm")
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || !registryAuthAllowed(registryHost, realm) {
+		return "", fmt.Errorf("registry auth realm %q is not allowed: it must use https on %s or a host in REGISTRY_AUTH_HOSTS", params["realm"], registryHost)
+	}
+
+	query := realm.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	if params["scope"] != "" {
+		query.Set("scope", params["scope"])
+	}
+
+	var tokenResp struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	realm.RawQuery = query.Encode()
+	if err := getRegistryJSON(ctx, realm.String(), "", &tokenResp); err != nil {
+		return "", err
+	}
+	if tokenResp.Token != "" {
+		return tokenResp.Token, nil
+	}
+	return tokenResp.AccessToken, nil
+}
+
+func getRegistryJSON(ctx context.Context, target, token string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := registryHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("repository not found")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// replicaGroupLabel names the replica group of a container. Replicas are
+// interchangeable containers of the same service, created with
+// "replica_group" in POST /create.
+const replicaGroupLabel = labelPrefix + "replica-group"
+
+// How often a replica is checked while it is being observed
+const canaryCheckInterval = 5 * time.Second
+
+// listReplicaGroup returns the replicas of a group, sorted by name
+func listReplicaGroup(ctx context.Context, cli *client.Client, group string) ([]container.Summary, error) {
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", replicaGroupLabel+"="+group)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(containers, func(i, j int) bool { return summaryName(containers[i]) < summaryName(containers[j]) })
+	return containers, nil
+}
+
+// CanaryRequest configures a canary rollout of a replica group
+type CanaryRequest struct {
+	Image string `json:"image" binding:"required,imageref"`
+	Pull  *bool  `json:"pull"`
+	// Seconds the canary is observed before the rest is updated
+	Window int `json:"window" binding:"omitempty,min=1,max=3600"`
+	// Replicas updated at once after the canary, and seconds each batch is
+	// observed (0 only waits until it is ready)
+	BatchSize   int `json:"batch_size" binding:"omitempty,min=1"`
+	BatchWindow int `json:"batch_window" binding:"omitempty,min=0,max=3600"`
+	// Optional limits; a replica going over them fails the rollout
+	MaxCPUPercent    float64 `json:"max_cpu_percent" binding:"omitempty,gt=0"`
+	MaxMemoryPercent float64 `json:"max_memory_percent" binding:"omitempty,gt=0,lte=100"`
+}
+
+// CanaryResult reports a canary rollout step by step
+type CanaryResult struct {
+	Group      string   `json:"group"`
+	Image      string   `json:"image"`
+	Canary     string   `json:"canary"`
+	Updated    []string `json:"updated"`
+	RolledBack []string `json:"rolled_back"`
+	Steps      []string `json:"steps"`
+}
+
+func (r *CanaryResult) step(format string, args ...any) {
+	r.Steps = append(r.Steps, fmt.Sprintf(format, args...))
+}
+
+// Groups with a rollout in progress
+var (
+	rolloutsMu sync.Mutex
+	rollouts   = map[string]bool{}
+)
+
+// claimRollout reports false when the group already has a rollout running
+func claimRollout(group string) bool {
+	rolloutsMu.Lock()
+	defer rolloutsMu.Unlock()
+	if rollouts[group] {
+		return false
+	}
+	rollouts[group] = true
+	return true
+}
+
+func releaseRollout(group string) {
+	rolloutsMu.Lock()
+	defer rolloutsMu.Unlock()
+	delete(rollouts, group)
+}
+
+// observeReplica watches a replica for window and fails when it stops,
+// restarts, turns unhealthy or goes over the resource limits
+func observeReplica(ctx context.Context, cli *client.Client, containerID string, window time.Duration, req CanaryRequest) error {
+	info, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return err
+	}
+	restarts := info.RestartCount
+	deadline := time.Now().Add(window)
+	for {
+		info, err := cli.ContainerInspect(ctx, containerID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.State == nil:
+			return fmt.Errorf("container has no state")
+		case !info.State.Running:
+			return fmt.Errorf("stopped (exit code %d)", info.State.ExitCode)
+		case info.RestartCount > restarts:
+			return fmt.Errorf("restarted %d times", info.RestartCount-restarts)
+		case info.State.Health != nil && info.State.Health.Status == "unhealthy":
+			return fmt.Errorf("unhealthy")
+		}
+		if req.MaxCPUPercent > 0 || req.MaxMemoryPercent > 0 {
+			usage, err := containerUsage(ctx, cli, containerID)
+			if err == nil {
+				if req.MaxCPUPercent > 0 && usage.CPUPercent > req.MaxCPUPercent {
+					return fmt.Errorf("CPU at %.1f%%, limit %.1f%%", usage.CPUPercent, req.MaxCPUPercent)
+				}
+				if req.MaxMemoryPercent > 0 && usage.MemoryLimit > 0 {
+					percent := float64(usage.MemoryUsage) / float64(usage.MemoryLimit) * 100
+					if percent > req.MaxMemoryPercent {
+						return fmt.Errorf("memory at %.1f%%, limit %.1f%%", percent, req.MaxMemoryPercent)
+					}
+				}
+			}
+		}
+		if !time.Now().Before(deadline) {
+			return nil
+		}
+		select {
+		case <-time.After(min(canaryCheckInterval, time.Until(deadline))):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// canaryRollout updates one replica of a group to a new image, observes it
+// for the window, then updates the others batch by batch. When a replica
+// fails every updated replica goes back to its previous configuration.
+func canaryRollout(ctx context.Context, cli *client.Client, store *Store, box *SecretBox, group string, replicas []container.Summary, req CanaryRequest, actor string) (*CanaryResult, error) {
+	result := &CanaryResult{Group: group, Image: req.Image, Canary: summaryName(replicas[0]), Updated: []string{}, RolledBack: []string{}, Steps: []string{}}
+	window := time.Duration(req.Window) * time.Second
+	if window == 0 {
+		window = defaultHealthWait
+	}
+	batchSize := max(req.BatchSize, 1)
+
+	// Previous configurations, to roll back to
+	previous := map[string]*ContainerSpec{}
+	for _, c := range replicas {
+		info, err := cli.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			return result, fmt.Errorf("inspecting %s: %w", summaryName(c), err)
+		}
+		previous[summaryName(c)] = specFromInspect(info)
+	}
+
+	replace := func(c container.Summary) (string, error) {
+		name := summaryName(c)
+		spec := *previous[name]
+		cfg := *spec.Config
+		cfg.Image = req.Image
+		spec.Config = &cfg
+		if err := resolveSecretEnv(store, box, spec.Config); err != nil {
+			return "", fmt.Errorf("%s: resolving secrets: %w", name, err)
+		}
+		newID, err := recreateContainer(ctx, cli, c.ID, &spec, true)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+		result.Updated = append(result.Updated, name)
+		return newID, nil
+	}
+	verify := func(name, newID string, observe time.Duration) error {
+		if err := waitReady(ctx, cli, newID, defaultHealthWait); err != nil {
+			return fmt.Errorf("%s is not ready: %w", name, err)
+		}
+		if observe > 0 {
+			if err := observeReplica(ctx, cli, newID, observe, req); err != nil {
+				return fmt.Errorf("%s failed during observation: %w", name, err)
+			}
+		}
+		if _, err := recordDeployment(ctx, cli, store, newID, "canary", actor); err != nil {
+			fmt.Printf("⚠️  Error recording deployment history: %v\n", err)
+		}
+		return nil
+	}
+	// updateBatch replaces a batch of replicas, then verifies them in
+	// parallel and returns the first failure
+	updateBatch := func(batch []container.Summary, observe time.Duration) error {
+		ids := map[string]string{}
+		for _, c := range batch {
+			newID, err := replace(c)
+			if err != nil {
+				return err
+			}
+			ids[summaryName(c)] = newID
+		}
+		errs := make(chan error, len(ids))
+		for name, newID := range ids {
+			go func(name, newID string) { errs <- verify(name, newID, observe) }(name, newID)
+		}
+		var first error
+		for range ids {
+			if err := <-errs; err != nil && first == nil {
+				first = err
+			}
+		}
+		return first
+	}
+
+	rollback := func(cause error) (*CanaryResult, error) {
+		bg := withoutHooks(context.Background())
+		for _, name := range result.Updated {
+			newID, err := recreateContainer(bg, cli, name, previous[name], true)
+			if err != nil {
+				result.step("rolling back %s failed: %v", name, err)
+				continue
+			}
+			if _, err := recordDeployment(bg, cli, store, newID, "rollback", actor); err != nil {
+				fmt.Printf("⚠️  Error recording deployment history: %v\n", err)
+			}
+			result.RolledBack = append(result.RolledBack, name)
+			result.step("rolled back %s", name)
+		}
+		return result, cause
+	}
+
+	if err := updateBatch(replicas[:1], window); err != nil {
+		return rollback(fmt.Errorf("canary %w", err))
+	}
+	result.step("canary %s healthy for %s", result.Canary, window)
+
+	rest := replicas[1:]
+	for len(rest) > 0 {
+		batch := rest[:min(batchSize, len(rest))]
+		rest = rest[len(batch):]
+		if err := updateBatch(batch, time.Duration(req.BatchWindow)*time.Second); err != nil {
+			return rollback(err)
+		}
+		result.step("updated %d of %d replicas", len(result.Updated), len(replicas))
+	}
+	return result, nil
+}
+
+// startCanaryRollout runs canaryRollout as a background job with its own
+// client, releasing the group when it's done
+func startCanaryRollout(store *Store, box *SecretBox, group string, replicas []container.Summary, req CanaryRequest, actor string) (string, error) {
+	return startJob(store, "canary", func() (any, error) {
+		defer releaseRollout(group)
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			return nil, err
+		}
+		defer cli.Close()
+		result, err := canaryRollout(withActor(context.Background(), actor), cli, store, box, group, replicas, req, actor)
+		if err != nil {
+			fmt.Printf("🐤 Canary rollout of %s failed: %v\n", group, err)
+		} else {
+			fmt.Printf("🐤 Canary rollout of %s to %s finished\n", group, req.Image)
+		}
+		return result, err
+	})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+)
+
+// RetentionRule limits how many tags of a repository are kept. A tag survives
+// if it is among the KeepLast newest or younger than MaxAgeDays; a zero
+// setting doesn't keep anything by itself.
+type RetentionRule struct {
+	ID         string    `json:"id"`
+	Repository string    `json:"repository" binding:"required"`
+	KeepLast   int       `json:"keep_last" binding:"min=0"`
+	MaxAgeDays int       `json:"max_age_days" binding:"min=0"`
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func validateRetentionRule(r *RetentionRule) error {
+	if r.Repository == "" || strings.ContainsAny(r.Repository, "@ ") {
+		return fmt.Errorf("invalid repository %q", r.Repository)
+	}
+	if repo, _ := splitRepoTag(r.Repository); repo != r.Repository {
+		return fmt.Errorf("repository must not include a tag: %q", r.Repository)
+	}
+	if r.KeepLast < 0 || r.MaxAgeDays < 0 {
+		return fmt.Errorf("keep_last and max_age_days must not be negative")
+	}
+	if r.KeepLast == 0 && r.MaxAgeDays == 0 {
+		return fmt.Errorf("set keep_last, max_age_days or both")
+	}
+	return nil
+}
+
+func (s *Store) CreateRetentionRule(r *RetentionRule) error {
+	r.ID = newID()
+	r.CreatedAt = time.Now()
+	_, err := s.exec(`INSERT INTO retention_rules (id, repository, keep_last, max_age_days, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		r.ID, r.Repository, r.KeepLast, r.MaxAgeDays, r.CreatedBy, r.CreatedAt.Unix())
+	return err
+}
+
+func (s *Store) DeleteRetentionRule(id string) (bool, error) {
+	res, err := s.exec(`DELETE FROM retention_rules WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) ListRetentionRules() ([]RetentionRule, error) {
+	rows, err := s.query(`SELECT id, repository, keep_last, max_age_days, created_by, created_at FROM retention_rules ORDER BY repository`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []RetentionRule{}
+	for rows.Next() {
+		var r RetentionRule
+		var createdAt int64
+		if err := rows.Scan(&r.ID, &r.Repository, &r.KeepLast, &r.MaxAgeDays, &r.CreatedBy, &createdAt); err != nil {
+			return nil, err
+		}
+		r.CreatedAt = time.Unix(createdAt, 0)
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// splitRepoTag splits "registry:5000/app:v1" into repository and tag, the
+// colon of a registry port isn't a tag separator
+func splitRepoTag(ref string) (string, string) {
+	i := strings.LastIndex(ref, ":")
+	if i < 0 || strings.Contains(ref[i:], "/") {
+		return ref, ""
+	}
+	return ref[:i], ref[i+1:]
+}
+
+// RetentionResult reports what a rule removed, or would remove on a dry run
+type RetentionResult struct {
+	Repository string   `json:"repository"`
+	Kept       []string `json:"kept"`
+	Removed    []string `json:"removed"`
+	Errors     []string `json:"errors,omitempty"`
+}
+
+type taggedImage struct {
+	ref     string
+	id      string
+	created int64
+}
+
+// applyRetention enforces every rule. Tags whose image is still used by a
+// container, running or not, are always kept.
+func applyRetention(ctx context.Context, cli *client.Client, store *Store, dryRun bool) ([]RetentionResult, error) {
+	rules, err := store.ListRetentionRules()
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return []RetentionResult{}, nil
+	}
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	inUse := map[string]bool{}
+	for _, c := range containers {
+		inUse[c.ImageID] = true
+	}
+
+	results := []RetentionResult{}
+	for _, rule := range rules {
+		images, err := cli.ImageList(ctx, image.ListOptions{
+			Filters: filters.NewArgs(filters.Arg("reference", rule.Repository)),
+		})
+		if err != nil {
+			return results, err
+		}
+
+		var tags []taggedImage
+		for _, img := range images {
+			for _, ref := range img.RepoTags {
+				if repo, _ := splitRepoTag(ref); repo == rule.Repository {
+					tags = append(tags, taggedImage{ref: ref, id: img.ID, created: img.Created})
+				}
+			}
+		}
+		sort.SliceStable(tags, func(i, j int) bool { return tags[i].created > tags[j].created })
+
+		result := RetentionResult{Repository: rule.Repository, Kept: []string{}, Removed: []string{}}
+		cutoff := time.Now().AddDate(0, 0, -rule.MaxAgeDays).Unix()
+		for i, tag := range tags {
+			if i < rule.KeepLast || (rule.MaxAgeDays > 0 && tag.created >= cutoff) || inUse[tag.id] {
+				result.Kept = append(result.Kept, tag.ref)
+				continue
+			}
+			if !dryRun {
+				if _, err := cli.ImageRemove(ctx, tag.ref, image.RemoveOptions{PruneChildren: true}); err != nil {
+					result.Errors = append(result.Errors, tag.ref+": "+err.Error())
+					continue
+				}
+			}
+			result.Removed = append(result.Removed, tag.ref)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// retentionTask is the scheduler task enforcing the retention rules
+func retentionTask(store *Store) func(ctx context.Context, cli *client.Client) (any, error) {
+	return func(ctx context.Context, cli *client.Client) (any, error) {
+		return applyRetention(ctx, cli, store, false)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// runLabel marks containers created by POST /run, so leftovers of a crashed
+// server can be told apart from user containers
+const runLabel = labelPrefix + "run"
+
+const (
+	defaultRunTimeout = 60 * time.Second
+	maxRunTimeout     = 30 * time.Minute
+	// Output beyond this is dropped, the run endpoint isn't for bulk data
+	maxRunOutput = 1 << 20
+)
+
+type RunResult struct {
+	ExitCode  int64   `json:"exit_code"`
+	Stdout    string  `json:"stdout"`
+	Stderr    string  `json:"stderr"`
+	TimedOut  bool    `json:"timed_out"`
+	Truncated bool    `json:"truncated"`
+	Duration  float64 `json:"duration_seconds"`
+}
+
+// limitedBuffer keeps the first maxRunOutput bytes written to it
+type limitedBuffer struct {
+	bytes.Buffer
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxRunOutput - b.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// runTask creates and starts a container, waits for it to exit or for the
+// timeout, collects its output and removes it
+func runTask(ctx context.Context, cli *client.Client, config *container.Config, hostConfig *container.HostConfig, timeout time.Duration) (*RunResult, error) {
+	if config.Labels == nil {
+		config.Labels = map[string]string{}
+	}
+	config.Labels[runLabel] = "true"
+
+	resp, err := createContainer(ctx, cli, config, hostConfig, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	// Clean up even if the request was cancelled
+	defer cli.ContainerRemove(context.Background(), resp.ID, container.RemoveOptions{Force: true})
+
+	started := time.Now()
+	if err := startContainer(ctx, cli, resp.ID, container.StartOptions{}); err != nil {
+		return nil, err
+	}
+
+	result := &RunResult{}
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	statusCh, errCh := cli.ContainerWait(waitCtx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case status := <-statusCh:
+		result.ExitCode = status.StatusCode
+	case err := <-errCh:
+		if waitCtx.Err() != context.DeadlineExceeded {
+			return nil, err
+		}
+		result.TimedOut = true
+		result.ExitCode = -1
+		cli.ContainerKill(context.Background(), resp.ID, "KILL")
+	}
+	result.Duration = time.Since(started).Seconds()
+
+	logs, err := cli.ContainerLogs(context.Background(), resp.ID, container.LogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return nil, err
+	}
+	defer logs.Close()
+
+	var stdout, stderr limitedBuffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, logs); err != nil {
+		return nil, err
+	}
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	result.Truncated = stdout.truncated || stderr.truncated
+	return result, nil
+}
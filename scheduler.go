@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// Job is a record of one run of a background task, stored in the jobs table
+type Job struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Status    string          `json:"status"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// SaveJob inserts a new job or updates the status of an existing one
+func (s *Store) SaveJob(j *Job) error {
+	j.UpdatedAt = time.Now()
+	if j.ID == "" {
+		j.ID = newID()
+		j.CreatedAt = j.UpdatedAt
+		_, err := s.exec(`INSERT INTO jobs (id, type, status, result, error, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			j.ID, j.Type, j.Status, string(j.Result), j.Error, j.CreatedAt.Unix(), j.UpdatedAt.Unix())
+		return err
+	}
+	_, err := s.exec(`UPDATE jobs SET status = ?, result = ?, error = ?, updated_at = ? WHERE id = ?`,
+		j.Status, string(j.Result), j.Error, j.UpdatedAt.Unix(), j.ID)
+	return err
+}
+
+// ListJobs returns the latest jobs, optionally of one type
+func (s *Store) ListJobs(jobType string, limit int) ([]Job, error) {
+	rows, err := s.query(`SELECT id, type, status, result, error, created_at, updated_at FROM jobs
+		WHERE ? = '' OR type = ? ORDER BY created_at DESC LIMIT ?`, jobType, jobType, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		var j Job
+		var result string
+		var createdAt, updatedAt int64
+		if err := rows.Scan(&j.ID, &j.Type, &j.Status, &result, &j.Error, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		if result != "" {
+			j.Result = json.RawMessage(result)
+		}
+		j.CreatedAt = time.Unix(createdAt, 0)
+		j.UpdatedAt = time.Unix(updatedAt, 0)
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// GetJob returns one job by ID
+func (s *Store) GetJob(id string) (*Job, error) {
+	var j Job
+	var result string
+	var createdAt, updatedAt int64
+	err := s.queryRow(`SELECT id, type, status, result, error, created_at, updated_at FROM jobs WHERE id = ?`, id).
+		Scan(&j.ID, &j.Type, &j.Status, &result, &j.Error, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if result != "" {
+		j.Result = json.RawMessage(result)
+	}
+	j.CreatedAt = time.Unix(createdAt, 0)
+	j.UpdatedAt = time.Unix(updatedAt, 0)
+	return &j, nil
+}
+
+// runJob runs fn and records the outcome as a job of the given type
+func runJob(store *Store, jobType string, fn func() (any, error)) (*Job, error) {
+	job := &Job{Type: jobType, Status: "running"}
+	if err := store.SaveJob(job); err != nil {
+		return nil, err
+	}
+	return job, finishJob(store, job, fn)
+}
+
+// startJob records a running job and runs fn in the background. Callers
+// get the job ID to follow it in GET /jobs/:id.
+func startJob(store *Store, jobType string, fn func() (any, error)) (string, error) {
+	job := &Job{Type: jobType, Status: "running"}
+	if err := store.SaveJob(job); err != nil {
+		return "", err
+	}
+	go finishJob(store, job, fn)
+	return job.ID, nil
+}
+
+func finishJob(store *Store, job *Job, fn func() (any, error)) error {
+	started := time.Now()
+	result, err := fn()
+	job.Status = "succeeded"
+	if err != nil {
+		job.Status = "failed"
+		job.Error = err.Error()
+	}
+	if result != nil {
+		job.Result, _ = json.Marshal(result)
+	}
+	if saveErr := store.SaveJob(job); saveErr != nil {
+		fmt.Printf("⚠️  Error saving %s job: %v\n", job.Type, saveErr)
+	}
+	fileLogs.Operation(map[string]any{
+		"kind":     "job",
+		"job_id":   job.ID,
+		"type":     job.Type,
+		"status":   job.Status,
+		"error":    job.Error,
+		"duration": time.Since(started).String(),
+	})
+	return err
+}
+
+type scheduledTask struct {
+	name     string
+	interval time.Duration
+	// run returns the job result, or nil result and error when there was
+	// nothing to do
+	run func(ctx context.Context, cli *client.Client) (any, error)
+}
+
+// Scheduler runs maintenance tasks in the background, each on its own
+// interval, recording every run in the jobs table
+type Scheduler struct {
+	store *Store
+	tasks []scheduledTask
+	// Runs are skipped while paused returns true
+	paused func() bool
+}
+
+func newScheduler(store *Store) *Scheduler {
+	return &Scheduler{store: store}
+}
+
+// PauseWhen skips all task runs while paused returns true
+func (s *Scheduler) PauseWhen(paused func() bool) {
+	s.paused = paused
+}
+
+func (s *Scheduler) Add(name string, interval time.Duration, run func(ctx context.Context, cli *client.Client) (any, error)) {
+	s.tasks = append(s.tasks, scheduledTask{name: name, interval: interval, run: run})
+}
+
+// Start runs every task in its own goroutine for the life of the process
+func (s *Scheduler) Start() {
+	for _, task := range s.tasks {
+		go s.loop(task)
+	}
+}
+
+func (s *Scheduler) loop(task scheduledTask) {
+	ticker := time.NewTicker(task.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.runTask(task)
+	}
+}
+
+func (s *Scheduler) runTask(task scheduledTask) {
+	if s.paused != nil && s.paused() {
+		return
+	}
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		fmt.Printf("⚠️  Scheduler: cannot connect to Docker daemon: %v\n", err)
+		return
+	}
+	defer cli.Close()
+
+	result, err := task.run(context.Background(), cli)
+	if err == nil && result == nil {
+		// Nothing to do this time, don't fill the job history with no-op runs
+		return
+	}
+	job := &Job{Type: task.name, Status: "succeeded"}
+	if err != nil {
+		fmt.Printf("⚠️  Scheduled task %s failed: %v\n", task.name, err)
+		job.Status = "failed"
+		job.Error = err.Error()
+	}
+	if result != nil {
+		job.Result, _ = json.Marshal(result)
+	}
+	if err := s.store.SaveJob(job); err != nil {
+		fmt.Printf("⚠️  Error saving %s job: %v\n", task.name, err)
+	}
+}
+
+// intervalFromEnv reads a duration setting such as CLEANUP_INTERVAL=30m
+func intervalFromEnv(name string, def time.Duration) time.Duration {
+	if v := os.Getenv(name); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+		fmt.Printf("⚠️  Invalid %s %q, using %s\n", name, v, def)
+	}
+	return def
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/registry"
+)
+
+// Docker Hub search results change slowly, so cache them for a while
+const searchCacheTTL = 5 * time.Minute
+
+type searchCacheEntry struct {
+	results  []registry.SearchResult
+	cachedAt time.Time
+}
+
+type searchCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]searchCacheEntry
+}
+
+func newSearchCache(ttl time.Duration) *searchCache {
+	return &searchCache{
+		ttl:     ttl,
+		entries: make(map[string]searchCacheEntry),
+	}
+}
+
+func searchCacheKey(term string, limit int, officialOnly bool, minStars int) string {
+	return strings.ToLower(strings.TrimSpace(term)) + "|" + strconv.Itoa(limit) + "|" +
+		strconv.FormatBool(officialOnly) + "|" + strconv.Itoa(minStars)
+}
+
+// get returns the cached results for key and when they were cached, if still fresh
+func (c *searchCache) get(key string) ([]registry.SearchResult, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	if time.Since(entry.cachedAt) > c.ttl {
+		delete(c.entries, key)
+		return nil, time.Time{}, false
+	}
+	return entry.results, entry.cachedAt, true
+}
+
+func (c *searchCache) set(key string, results []registry.SearchResult) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.entries[key] = searchCacheEntry{results: results, cachedAt: now}
+
+	// Drop expired entries so the map doesn't grow with every unique term
+	for k, entry := range c.entries {
+		if now.Sub(entry.cachedAt) > c.ttl {
+			delete(c.entries, k)
+		}
+	}
+	return now
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/gin-gonic/gin"
+)
+
+// secretEnvLabel records which env vars of a container were injected from
+// the secrets store, as ENV=secret-name pairs, so they can be redacted in API
+// responses and re-resolved when the container is recreated
+const secretEnvLabel = labelPrefix + "secrets"
+
+const redactedValue = "********"
+
+// Secret metadata. The value is only ever held encrypted in the database
+// and decrypted when injected into a container.
+type Secret struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SecretBox encrypts secret values with AES-256-GCM
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+// loadMasterKey reads the master key from SECRETS_MASTER_KEY, or from
+// data/master.key, generating that file on first start. Any passphrase is
+// accepted, it's stretched to 32 bytes with SHA-256.
+func loadMasterKey() ([]byte, error) {
+	if key := os.Getenv("SECRETS_MASTER_KEY"); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		return sum[:], nil
+	}
+
+	path := os.Getenv("SECRETS_MASTER_KEY_FILE")
+	if path == "" {
+		path = "data/master.key"
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(key)), 0o600); err != nil {
+			return nil, err
+		}
+		fmt.Printf("🔑 Generated secrets master key at %s, back it up or secrets can't be decrypted\n", path)
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("invalid master key in %s: expected 64 hex characters", path)
+	}
+	return key, nil
+}
+
+func newSecretBox(key []byte) (*SecretBox, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretBox{aead: aead}, nil
+}
+
+// Seal encrypts a value, binding it to the secret name so ciphertexts can't
+// be swapped between rows
+func (b *SecretBox) Seal(name, plaintext string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), []byte(name))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (b *SecretBox) Open(name, ciphertext string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < b.aead.NonceSize() {
+		return "", fmt.Errorf("ciphertext too short")
+	}
+	nonce, sealed := data[:b.aead.NonceSize()], data[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, sealed, []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt secret %s: wrong master key?", name)
+	}
+	return string(plaintext), nil
+}
+
+func (s *Store) CreateSecret(box *SecretBox, secret *Secret, value string) error {
+	ciphertext, err := box.Seal(secret.Name, value)
+	if err != nil {
+		return err
+	}
+	secret.ID = newID()
+	secret.CreatedAt = time.Now()
+	secret.UpdatedAt = secret.CreatedAt
+	_, err = s.exec(`INSERT INTO secrets (id, name, description, ciphertext, created_by, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		secret.ID, secret.Name, secret.Description, ciphertext, secret.CreatedBy, secret.CreatedAt.Unix(), secret.UpdatedAt.Unix())
+	return err
+}
+
+func (s *Store) UpdateSecret(box *SecretBox, secret *Secret, value string) error {
+	ciphertext, err := box.Seal(secret.Name, value)
+	if err != nil {
+		return err
+	}
+	secret.UpdatedAt = time.Now()
+	_, err = s.exec(`UPDATE secrets SET description = ?, ciphertext = ?, updated_at = ? WHERE id = ?`,
+		secret.Description, ciphertext, secret.UpdatedAt.Unix(), secret.ID)
+	return err
+}
+
+func (s *Store) DeleteSecret(id string) error {
+	_, err := s.exec(`DELETE FROM secrets WHERE id = ?`, id)
+	return err
+}
+
+func (s *Store) GetSecret(name string) (*Secret, error) {
+	var secret Secret
+	var createdAt, updatedAt int64
+	err := s.queryRow(`SELECT id, name, description, created_by, created_at, updated_at FROM secrets WHERE name = ?`, name).
+		Scan(&secret.ID, &secret.Name, &secret.Description, &secret.CreatedBy, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	secret.CreatedAt = time.Unix(createdAt, 0)
+	secret.UpdatedAt = time.Unix(updatedAt, 0)
+	return &secret, nil
+}
+
+func (s *Store) ListSecrets() ([]Secret, error) {
+	rows, err := s.query(`SELECT id, name, description, created_by, created_at, updated_at FROM secrets ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	secrets := []Secret{}
+	for rows.Next() {
+		var secret Secret
+		var createdAt, updatedAt int64
+		if err := rows.Scan(&secret.ID, &secret.Name, &secret.Description, &secret.CreatedBy, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		secret.CreatedAt = time.Unix(createdAt, 0)
+		secret.UpdatedAt = time.Unix(updatedAt, 0)
+		secrets = append(secrets, secret)
+	}
+	return secrets, rows.Err()
+}
+
+// SecretValue decrypts a secret for injection into a container
+func (s *Store) SecretValue(box *SecretBox, name string) (string, error) {
+	var ciphertext string
+	if err := s.queryRow(`SELECT ciphertext FROM secrets WHERE name = ?`, name).Scan(&ciphertext); err != nil {
+		return "", fmt.Errorf("secret not found: %s", name)
+	}
+	return box.Open(name, ciphertext)
+}
+
+var errSecretForbidden = errors.New("secret belongs to another user")
+
+// checkSecretAccess reports whether a secret may be injected into a
+// container of user: admins use every secret, other users only those they
+// created. Anyone able to exec into the container can read the value.
+func (s *Store) checkSecretAccess(user, name string) error {
+	secret, err := s.GetSecret(name)
+	if err != nil {
+		return fmt.Errorf("secret not found: %s", name)
+	}
+	if secret.CreatedBy == user {
+		return nil
+	}
+	if role, err := s.UserRole(user); err == nil && role == roleAdmin {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", errSecretForbidden, name)
+}
+
+// respondSecretError answers a failed injectSecrets
+func respondSecretError(ctx *gin.Context, err error) {
+	if errors.Is(err, errSecretForbidden) {
+		ctx.JSON(http.StatusForbidden, gin.H{
+			"error":      "Error injecting secrets: " + err.Error(),
+			"suggestion": "Chỉ dùng secret do bạn tạo, hoặc nhờ admin triển khai container",
+		})
+		return
+	}
+	ctx.JSON(http.StatusBadRequest, gin.H{
+		"error":      "Error injecting secrets: " + err.Error(),
+		"suggestion": "Kiểm tra tên secret trong GET /secrets",
+	})
+}
+
+// injectSecrets adds the referenced secrets (env var -> secret name) to a
+// container config of user as env vars and records the mapping in
+// secretEnvLabel
+func injectSecrets(store *Store, box *SecretBox, config *container.Config, refs map[string]string, user string) error {
+	if len(refs) == 0 {
+		return nil
+	}
+
+	var pairs []string
+	for env, name := range refs {
+		if err := store.checkSecretAccess(user, name); err != nil {
+			return err
+		}
+		value, err := store.SecretValue(box, name)
+		if err != nil {
+			return err
+		}
+		config.Env = setEnv(config.Env, env, value)
+		pairs = append(pairs, env+"="+name)
+	}
+	sort.Strings(pairs)
+
+	if config.Labels == nil {
+		config.Labels = map[string]string{}
+	}
+	config.Labels[secretEnvLabel] = strings.Join(pairs, ",")
+	return nil
+}
+
+func secretRefs(config *container.Config) map[string]string {
+	refs := map[string]string{}
+	if config == nil || config.Labels[secretEnvLabel] == "" {
+		return refs
+	}
+	for _, pair := range strings.Split(config.Labels[secretEnvLabel], ",") {
+		if env, name, ok := strings.Cut(pair, "="); ok {
+			refs[env] = name
+		}
+	}
+	return refs
+}
+
+// redactSecretEnv hides the values of secret-backed env vars
+func redactSecretEnv(config *container.Config) {
+	refs := secretRefs(config)
+	if len(refs) == 0 {
+		return
+	}
+	env := make([]string, len(config.Env))
+	for i, kv := range config.Env {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, ok := refs[name]; ok {
+			kv = name + "=" + redactedValue
+		}
+		env[i] = kv
+	}
+	config.Env = env
+}
+
+// resolveSecretEnv puts current secret values back into a config whose
+// secret env vars were redacted (e.g. a stored deployment snapshot). The
+// container's owner must still be allowed to use each secret.
+func resolveSecretEnv(store *Store, box *SecretBox, config *container.Config) error {
+	for env, name := range secretRefs(config) {
+		if err := store.checkSecretAccess(config.Labels[ownerLabel], name); err != nil {
+			return err
+		}
+		value, err := store.SecretValue(box, name)
+		if err != nil {
+			return err
+		}
+		config.Env = setEnv(config.Env, env, value)
+	}
+	return nil
+}
+
+// setEnv sets or replaces NAME=value in an env list
+func setEnv(env []string, name, value string) []string {
+	for i, kv := range env {
+		if strings.HasPrefix(kv, name+"=") {
+			env[i] = name + "=" + value
+			return env
+		}
+	}
+	return append(env, name+"="+value)
+}
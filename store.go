@@ -0,0 +1,615 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// Store keeps application metadata (users, API keys, audit logs, jobs,
+// templates, deployment history) that doesn't belong in Docker itself.
+// SQLite is used by default; set DB_DRIVER=postgres and DB_DSN to use Postgres.
+type Store struct {
+	db     *sql.DB
+	driver string
+}
+
+type User struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AuditLog struct {
+	ID        string    `json:"id"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Status    int       `json:"status"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type migration struct {
+	version int
+	name    string
+	stmts   []string
+}
+
+// Migrations are applied in order and recorded in schema_migrations.
+// Never edit a released migration, append a new one instead.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "initial schema",
+		stmts: []string{
+			`CREATE TABLE users (
+				id TEXT PRIMARY KEY,
+				username TEXT NOT NULL UNIQUE,
+				role TEXT NOT NULL DEFAULT 'user',
+				created_at BIGINT NOT NULL
+			)`,
+			`CREATE TABLE api_keys (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				name TEXT NOT NULL DEFAULT '',
+				key_hash TEXT NOT NULL UNIQUE,
+				created_at BIGINT NOT NULL,
+				last_used_at BIGINT
+			)`,
+			`CREATE TABLE audit_logs (
+				id TEXT PRIMARY KEY,
+				actor TEXT NOT NULL DEFAULT '',
+				action TEXT NOT NULL,
+				target TEXT NOT NULL DEFAULT '',
+				status INTEGER NOT NULL DEFAULT 0,
+				details TEXT NOT NULL DEFAULT '',
+				created_at BIGINT NOT NULL
+			)`,
+			`CREATE INDEX idx_audit_logs_created_at ON audit_logs (created_at)`,
+			`CREATE TABLE jobs (
+				id TEXT PRIMARY KEY,
+				type TEXT NOT NULL,
+				status TEXT NOT NULL,
+				payload TEXT NOT NULL DEFAULT '',
+				result TEXT NOT NULL DEFAULT '',
+				error TEXT NOT NULL DEFAULT '',
+				created_at BIGINT NOT NULL,
+				updated_at BIGINT NOT NULL
+			)`,
+			`CREATE TABLE templates (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL UNIQUE,
+				description TEXT NOT NULL DEFAULT '',
+				image TEXT NOT NULL,
+				definition TEXT NOT NULL DEFAULT '',
+				created_at BIGINT NOT NULL,
+				updated_at BIGINT NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 2,
+		name:    "deployment history",
+		stmts: []string{
+			`CREATE TABLE deployments (
+				id TEXT PRIMARY KEY,
+				container_id TEXT NOT NULL,
+				container_name TEXT NOT NULL,
+				action TEXT NOT NULL,
+				image TEXT NOT NULL,
+				image_digest TEXT NOT NULL DEFAULT '',
+				spec TEXT NOT NULL,
+				actor TEXT NOT NULL DEFAULT '',
+				created_at BIGINT NOT NULL
+			)`,
+			`CREATE INDEX idx_deployments_container_name ON deployments (container_name, created_at)`,
+		},
+	},
+	{
+		version: 3,
+		name:    "notes and annotations",
+		stmts: []string{
+			`CREATE TABLE annotations (
+				resource_type TEXT NOT NULL,
+				resource_id TEXT NOT NULL,
+				notes TEXT NOT NULL DEFAULT '',
+				annotations TEXT NOT NULL DEFAULT '{}',
+				updated_by TEXT NOT NULL DEFAULT '',
+				updated_at BIGINT NOT NULL,
+				PRIMARY KEY (resource_type, resource_id)
+			)`,
+		},
+	},
+	{
+		version: 4,
+		name:    "favorites",
+		stmts: []string{
+			`CREATE TABLE favorites (
+				username TEXT NOT NULL,
+				resource_type TEXT NOT NULL,
+				resource_id TEXT NOT NULL,
+				pinned BOOLEAN NOT NULL DEFAULT FALSE,
+				created_at BIGINT NOT NULL,
+				PRIMARY KEY (username, resource_type, resource_id)
+			)`,
+		},
+	},
+	{
+		version: 5,
+		name:    "projects",
+		stmts: []string{
+			`CREATE TABLE projects (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL UNIQUE,
+				description TEXT NOT NULL DEFAULT '',
+				created_by TEXT NOT NULL DEFAULT '',
+				created_at BIGINT NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 6,
+		name:    "secrets",
+		stmts: []string{
+			`CREATE TABLE secrets (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL UNIQUE,
+				description TEXT NOT NULL DEFAULT '',
+				ciphertext TEXT NOT NULL,
+				created_by TEXT NOT NULL DEFAULT '',
+				created_at BIGINT NOT NULL,
+				updated_at BIGINT NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 7,
+		name:    "config_files",
+		stmts: []string{
+			`CREATE TABLE config_files (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL UNIQUE,
+				description TEXT NOT NULL DEFAULT '',
+				content TEXT NOT NULL,
+				created_by TEXT NOT NULL DEFAULT '',
+				created_at BIGINT NOT NULL,
+				updated_at BIGINT NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 8,
+		name:    "retention_rules",
+		stmts: []string{
+			`CREATE TABLE retention_rules (
+				id TEXT PRIMARY KEY,
+				repository TEXT NOT NULL UNIQUE,
+				keep_last INTEGER NOT NULL DEFAULT 0,
+				max_age_days INTEGER NOT NULL DEFAULT 0,
+				created_by TEXT NOT NULL DEFAULT '',
+				created_at BIGINT NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 9,
+		name:    "quotas",
+		stmts: []string{
+			`CREATE TABLE quotas (
+				id TEXT PRIMARY KEY,
+				scope TEXT NOT NULL,
+				subject TEXT NOT NULL,
+				max_containers INTEGER NOT NULL DEFAULT 0,
+				max_memory TEXT NOT NULL DEFAULT '',
+				max_volumes INTEGER NOT NULL DEFAULT 0,
+				updated_by TEXT NOT NULL DEFAULT '',
+				updated_at BIGINT NOT NULL,
+				UNIQUE (scope, subject)
+			)`,
+		},
+	},
+	{
+		version: 10,
+		name:    "approvals",
+		stmts: []string{
+			`CREATE TABLE approvals (
+				id TEXT PRIMARY KEY,
+				action TEXT NOT NULL,
+				targets TEXT NOT NULL DEFAULT '',
+				status TEXT NOT NULL,
+				requested_by TEXT NOT NULL DEFAULT '',
+				decided_by TEXT NOT NULL DEFAULT '',
+				reason TEXT NOT NULL DEFAULT '',
+				result TEXT NOT NULL DEFAULT '',
+				error TEXT NOT NULL DEFAULT '',
+				created_at BIGINT NOT NULL,
+				decided_at BIGINT NOT NULL DEFAULT 0
+			)`,
+			`CREATE INDEX idx_approvals_status ON approvals (status)`,
+		},
+	},
+	{
+		version: 11,
+		name:    "trash",
+		stmts: []string{
+			`CREATE TABLE trash (
+				container_id TEXT PRIMARY KEY,
+				original_name TEXT NOT NULL,
+				trash_name TEXT NOT NULL,
+				restart_policy TEXT NOT NULL DEFAULT '',
+				was_running BOOLEAN NOT NULL DEFAULT FALSE,
+				trashed_by TEXT NOT NULL DEFAULT '',
+				trashed_at BIGINT NOT NULL,
+				expires_at BIGINT NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 12,
+		name:    "protected_containers",
+		stmts: []string{
+			`CREATE TABLE protected_containers (
+				container_name TEXT PRIMARY KEY,
+				reason TEXT NOT NULL DEFAULT '',
+				protected_by TEXT NOT NULL DEFAULT '',
+				created_at BIGINT NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 13,
+		name:    "exec_rules",
+		stmts: []string{
+			`CREATE TABLE exec_rules (
+				id TEXT PRIMARY KEY,
+				effect TEXT NOT NULL,
+				command TEXT NOT NULL,
+				containers TEXT NOT NULL DEFAULT '',
+				roles TEXT NOT NULL DEFAULT '',
+				priority INTEGER NOT NULL DEFAULT 0,
+				description TEXT NOT NULL DEFAULT '',
+				created_by TEXT NOT NULL DEFAULT '',
+				created_at BIGINT NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 14,
+		name:    "session_recordings",
+		stmts: []string{
+			`CREATE TABLE session_recordings (
+				id TEXT PRIMARY KEY,
+				kind TEXT NOT NULL,
+				container_id TEXT NOT NULL,
+				container_name TEXT NOT NULL DEFAULT '',
+				command TEXT NOT NULL DEFAULT '',
+				recorded_by TEXT NOT NULL DEFAULT '',
+				size INTEGER NOT NULL DEFAULT 0,
+				truncated BOOLEAN NOT NULL DEFAULT FALSE,
+				exit_code INTEGER NOT NULL DEFAULT -1,
+				started_at BIGINT NOT NULL,
+				ended_at BIGINT NOT NULL DEFAULT 0,
+				data TEXT NOT NULL
+			)`,
+			`CREATE INDEX idx_session_recordings_started_at ON session_recordings (started_at)`,
+		},
+	},
+	{
+		version: 15,
+		name:    "proxy_routes",
+		stmts: []string{
+			`CREATE TABLE proxy_routes (
+				id TEXT PRIMARY KEY,
+				host TEXT NOT NULL DEFAULT '',
+				path TEXT NOT NULL DEFAULT '/',
+				container TEXT NOT NULL,
+				port INTEGER NOT NULL DEFAULT 0,
+				strip_path BOOLEAN NOT NULL DEFAULT FALSE,
+				created_by TEXT NOT NULL DEFAULT '',
+				created_at BIGINT NOT NULL,
+				UNIQUE (host, path)
+			)`,
+		},
+	},
+	{
+		version: 16,
+		name:    "proxy_routes_tls",
+		stmts: []string{
+			`ALTER TABLE proxy_routes ADD COLUMN tls BOOLEAN NOT NULL DEFAULT FALSE`,
+		},
+	},
+	{
+		version: 17,
+		name:    "desired_containers",
+		stmts: []string{
+			`CREATE TABLE desired_containers (
+				name TEXT PRIMARY KEY,
+				image TEXT NOT NULL,
+				image_digest TEXT NOT NULL DEFAULT '',
+				running BOOLEAN NOT NULL DEFAULT TRUE,
+				spec TEXT NOT NULL,
+				updated_by TEXT NOT NULL DEFAULT '',
+				updated_at BIGINT NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 18,
+		name:    "heal_rules",
+		stmts: []string{
+			`CREATE TABLE heal_rules (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				trigger_type TEXT NOT NULL,
+				containers TEXT NOT NULL DEFAULT '',
+				label TEXT NOT NULL DEFAULT '',
+				action TEXT NOT NULL,
+				webhook_url TEXT NOT NULL DEFAULT '',
+				cooldown TEXT NOT NULL DEFAULT '',
+				disabled BOOLEAN NOT NULL DEFAULT FALSE,
+				created_by TEXT NOT NULL DEFAULT '',
+				created_at BIGINT NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 19,
+		name:    "recipes",
+		stmts: []string{
+			`CREATE TABLE recipes (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL UNIQUE,
+				description TEXT NOT NULL DEFAULT '',
+				steps TEXT NOT NULL,
+				created_by TEXT NOT NULL DEFAULT '',
+				created_at BIGINT NOT NULL
+			)`,
+		},
+	},
+}
+
+func openStore() (*Store, error) {
+	driver := os.Getenv("DB_DRIVER")
+	dsn := os.Getenv("DB_DSN")
+
+	switch driver {
+	case "", "sqlite", "sqlite3":
+		driver = "sqlite"
+		if dsn == "" {
+			dsn = "data/app.db"
+		}
+		if err := os.MkdirAll(filepath.Dir(dsn), 0o755); err != nil {
+			return nil, fmt.Errorf("creating database directory: %w", err)
+		}
+		// Foreign keys are off by default in SQLite, and a busy timeout avoids
+		// "database is locked" errors when requests write concurrently
+		dsn = "file:" + dsn + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	case "postgres", "postgresql":
+		driver = "postgres"
+		if dsn == "" {
+			return nil, fmt.Errorf("DB_DSN is required when DB_DRIVER=postgres")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported DB_DRIVER %q (use sqlite or postgres)", driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if driver == "sqlite" {
+		// SQLite allows a single writer, serialize access instead of failing
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to %s database: %w", driver, err)
+	}
+
+	s := &Store{db: db, driver: driver}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at BIGINT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	applied := map[int]bool{}
+	rows, err := s.db.Query(`SELECT version FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[v] = true
+	}
+	rows.Close()
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, stmt := range m.stmts {
+			if _, err := tx.Exec(stmt); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+		}
+		if _, err := tx.Exec(s.rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+			m.version, m.name, time.Now().Unix()); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		fmt.Printf("🗄️  Applied migration %d: %s\n", m.version, m.name)
+	}
+	return nil
+}
+
+// rebind converts ? placeholders to $1, $2... for Postgres
+func (s *Store) rebind(query string) string {
+	if s.driver != "postgres" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *Store) exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.db.Exec(s.rebind(query), args...)
+}
+
+func (s *Store) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.db.Query(s.rebind(query), args...)
+}
+
+func (s *Store) queryRow(query string, args ...interface{}) *sql.Row {
+	return s.db.QueryRow(s.rebind(query), args...)
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Store) CreateUser(username, role string) (*User, error) {
+	u := &User{ID: newID(), Username: username, Role: role, CreatedAt: time.Now()}
+	_, err := s.exec(`INSERT INTO users (id, username, role, created_at) VALUES (?, ?, ?, ?)`,
+		u.ID, u.Username, u.Role, u.CreatedAt.Unix())
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// EnsureAdmin creates an "admin" user with an API key when the database has
+// no users yet. The key is returned so it can be shown once at startup.
+func (s *Store) EnsureAdmin() (string, error) {
+	var count int
+	if err := s.queryRow(`SELECT COUNT(*) FROM users`).Scan(&count); err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return "", nil
+	}
+
+	user, err := s.CreateUser("admin", roleAdmin)
+	if err != nil {
+		return "", err
+	}
+	return s.CreateAPIKey(user.ID, "bootstrap")
+}
+
+// CreateAPIKey generates a new API key for the user. Only its hash is stored,
+// the plaintext key is returned once and can't be recovered later.
+func (s *Store) CreateAPIKey(userID, name string) (string, error) {
+	b := make([]byte, 24)
+	rand.Read(b)
+	key := "dk_" + hex.EncodeToString(b)
+
+	_, err := s.exec(`INSERT INTO api_keys (id, user_id, name, key_hash, created_at) VALUES (?, ?, ?, ?, ?)`,
+		newID(), userID, name, hashAPIKey(key), time.Now().Unix())
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func (s *Store) UserByAPIKey(key string) (*User, error) {
+	var u User
+	var createdAt int64
+	err := s.queryRow(`SELECT u.id, u.username, u.role, u.created_at FROM users u
+		JOIN api_keys k ON k.user_id = u.id WHERE k.key_hash = ?`, hashAPIKey(key)).
+		Scan(&u.ID, &u.Username, &u.Role, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	u.CreatedAt = time.Unix(createdAt, 0)
+
+	s.exec(`UPDATE api_keys SET last_used_at = ? WHERE key_hash = ?`, time.Now().Unix(), hashAPIKey(key))
+	return &u, nil
+}
+
+// UserRole returns the role of a user by name
+func (s *Store) UserRole(username string) (string, error) {
+	var role string
+	err := s.queryRow(`SELECT role FROM users WHERE username = ?`, username).Scan(&role)
+	return role, err
+}
+
+func (s *Store) RecordAudit(actor, action, target string, status int, details string) error {
+	_, err := s.exec(`INSERT INTO audit_logs (id, actor, action, target, status, details, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		newID(), actor, action, target, status, details, time.Now().Unix())
+	return err
+}
+
+func (s *Store) ListAudit(limit int) ([]AuditLog, error) {
+	rows, err := s.query(`SELECT id, actor, action, target, status, details, created_at FROM audit_logs
+		ORDER BY created_at DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := []AuditLog{}
+	for rows.Next() {
+		var l AuditLog
+		var createdAt int64
+		if err := rows.Scan(&l.ID, &l.Actor, &l.Action, &l.Target, &l.Status, &l.Details, &createdAt); err != nil {
+			return nil, err
+		}
+		l.CreatedAt = time.Unix(createdAt, 0)
+		logs = append(logs, l)
+	}
+	return logs, rows.Err()
+}
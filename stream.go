@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseWriter forwards everything written to it as server-sent events of one
+// type, flushing after each write so the client sees output as it happens
+type sseWriter struct {
+	ctx   *gin.Context
+	event string
+}
+
+func (w sseWriter) Write(p []byte) (int, error) {
+	w.ctx.SSEvent(w.event, string(p))
+	w.ctx.Writer.Flush()
+	return len(p), w.ctx.Request.Context().Err()
+}
+
+// startSSE sets the headers for a server-sent events response
+func startSSE(ctx *gin.Context) {
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	// Disable response buffering in nginx reverse proxies
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	ctx.Writer.Flush()
+}
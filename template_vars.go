@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// TemplateVar is a typed variable that can be referenced from any string
+// field of an application template as {{ .Name }}
+type TemplateVar struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Type is string (default), int, port, bool or password
+	Type     string `json:"type,omitempty"`
+	Required bool   `json:"required,omitempty"`
+	Default  string `json:"default,omitempty"`
+	Pattern  string `json:"pattern,omitempty"`
+	// Secret values are never echoed back in API responses
+	Secret bool `json:"secret,omitempty"`
+	// Generate a random value (e.g. a password) when none is supplied
+	Generate bool `json:"generate,omitempty"`
+}
+
+var templateVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func hasPlaceholder(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+func validateTemplateVars(t *AppTemplate) error {
+	seen := map[string]bool{}
+	for _, v := range t.Variables {
+		if !templateVarName.MatchString(v.Name) {
+			return fmt.Errorf("invalid variable name %q: use letters, digits and underscores", v.Name)
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("duplicate variable %q", v.Name)
+		}
+		seen[v.Name] = true
+
+		switch v.Type {
+		case "", "string", "int", "port", "bool", "password":
+		default:
+			return fmt.Errorf("variable %s: unknown type %q", v.Name, v.Type)
+		}
+		if v.Pattern != "" {
+			if _, err := regexp.Compile(v.Pattern); err != nil {
+				return fmt.Errorf("variable %s: invalid pattern: %v", v.Name, err)
+			}
+		}
+		if v.Default != "" {
+			if err := checkTemplateVar(v, v.Default); err != nil {
+				return fmt.Errorf("variable %s: default value: %v", v.Name, err)
+			}
+		}
+	}
+
+	if err := checkSecretPlaceholders(t); err != nil {
+		return err
+	}
+
+	// Placeholders must refer to declared variables, catch typos before deploy
+	values := map[string]string{}
+	for _, v := range t.Variables {
+		values[v.Name] = "0"
+	}
+	if _, err := renderTemplate(t, values); err != nil {
+		return err
+	}
+	return nil
+}
+
+func checkTemplateVar(v TemplateVar, value string) error {
+	switch v.Type {
+	case "int":
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+	case "port":
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("must be a port number between 1 and 65535")
+		}
+	case "bool":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("must be true or false")
+		}
+	}
+	if v.Pattern != "" && !regexp.MustCompile(v.Pattern).MatchString(value) {
+		return fmt.Errorf("must match %s", v.Pattern)
+	}
+	return nil
+}
+
+// resolveTemplateVars validates supplied values against the variable
+// definitions and fills in defaults and generated values
+func resolveTemplateVars(vars []TemplateVar, supplied map[string]string) (map[string]string, error) {
+	values := map[string]string{}
+	var problems []string
+
+	for _, v := range vars {
+		value, ok := supplied[v.Name]
+		if !ok || value == "" {
+			value = v.Default
+		}
+		if value == "" && (v.Generate || v.Type == "password") {
+			value = randomPassword(20)
+		}
+		if value == "" {
+			if v.Required {
+				problems = append(problems, v.Name+" is required")
+			}
+			values[v.Name] = ""
+			continue
+		}
+		if err := checkTemplateVar(v, value); err != nil {
+			problems = append(problems, v.Name+" "+err.Error())
+			continue
+		}
+		values[v.Name] = value
+	}
+
+	declared := map[string]bool{}
+	for _, v := range vars {
+		declared[v.Name] = true
+	}
+	for name := range supplied {
+		if !declared[name] {
+			problems = append(problems, "unknown variable "+name)
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return values, nil
+}
+
+// isSecret reports whether a variable's value must be kept out of plaintext
+func (v TemplateVar) isSecret() bool {
+	return v.Secret || v.Type == "password"
+}
+
+func secretTemplateVars(vars []TemplateVar) map[string]bool {
+	secret := map[string]bool{}
+	for _, v := range vars {
+		if v.isSecret() {
+			secret[v.Name] = true
+		}
+	}
+	return secret
+}
+
+// usesSecretVar reports whether a placeholder string references one of the
+// secret variables
+func usesSecretVar(s string, secret map[string]bool) bool {
+	if len(secret) == 0 || !hasPlaceholder(s) {
+		return false
+	}
+	tmpl, err := template.New("").Parse(s)
+	if err != nil || tmpl.Tree == nil {
+		return false
+	}
+	found := false
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n != nil {
+				for _, child := range n.Nodes {
+					walk(child)
+				}
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n != nil {
+				for _, cmd := range n.Cmds {
+					walk(cmd)
+				}
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.FieldNode:
+			found = found || secret[n.Ident[0]]
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		}
+	}
+	walk(tmpl.Tree.Root)
+	return found
+}
+
+// checkSecretPlaceholders allows secret variables only in env defaults,
+// the one place their values can be moved into the secrets store
+func checkSecretPlaceholders(t *AppTemplate) error {
+	secret := secretTemplateVars(t.Variables)
+	fields := append([]string{t.Image}, t.Command...)
+	for _, p := range t.Ports {
+		fields = append(fields, p.ContainerPort, p.HostPort)
+	}
+	for _, v := range t.Volumes {
+		fields = append(fields, v.ContainerPath)
+	}
+	for _, field := range fields {
+		if usesSecretVar(field, secret) {
+			return fmt.Errorf("secret variables can only be used in env defaults, found one in %q", field)
+		}
+	}
+	return nil
+}
+
+var errSecretExists = errors.New("secret already exists")
+
+// storeTemplateSecrets saves env values rendered from secret variables as
+// managed secrets named <container>-<ENV>, so they are injected, redacted
+// and encrypted like any other secret instead of being kept in plaintext in
+// the container spec and deployment history. It returns env var -> secret
+// name for injectSecrets.
+func storeTemplateSecrets(store *Store, box *SecretBox, templateName, containerName, actor string, env map[string]string) (map[string]string, error) {
+	refs := map[string]string{}
+	description := "Generated by template " + templateName + " for " + containerName
+	for name, value := range env {
+		secretName := containerName + "-" + name
+		if existing, err := store.GetSecret(secretName); err == nil {
+			// Left over from an earlier deployment under the same name
+			if existing.Description != description {
+				return nil, fmt.Errorf("%w: %s", errSecretExists, secretName)
+			}
+			if err := store.UpdateSecret(box, existing, value); err != nil {
+				return nil, err
+			}
+		} else {
+			secret := &Secret{Name: secretName, Description: description, CreatedBy: actor}
+			if err := store.CreateSecret(box, secret, value); err != nil {
+				return nil, err
+			}
+		}
+		refs[name] = secretName
+	}
+	return refs, nil
+}
+
+// renderTemplate returns a copy of t with all placeholders substituted
+func renderTemplate(t *AppTemplate, values map[string]string) (*AppTemplate, error) {
+	var err error
+	render := func(s string) string {
+		if err != nil || !hasPlaceholder(s) {
+			return s
+		}
+		var out string
+		out, err = renderString(s, values)
+		return out
+	}
+
+	rendered := *t
+	rendered.Image = render(t.Image)
+
+	rendered.Command = nil
+	for _, c := range t.Command {
+		rendered.Command = append(rendered.Command, render(c))
+	}
+	rendered.Ports = nil
+	for _, p := range t.Ports {
+		p.ContainerPort = render(p.ContainerPort)
+		p.HostPort = render(p.HostPort)
+		rendered.Ports = append(rendered.Ports, p)
+	}
+	rendered.Env = nil
+	for _, e := range t.Env {
+		e.Default = render(e.Default)
+		rendered.Env = append(rendered.Env, e)
+	}
+	rendered.Volumes = nil
+	for _, v := range t.Volumes {
+		v.ContainerPath = render(v.ContainerPath)
+		rendered.Volumes = append(rendered.Volumes, v)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return &rendered, nil
+}
+
+func renderString(s string, values map[string]string) (string, error) {
+	tmpl, err := template.New("").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid placeholder in %q: %v", s, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, values); err != nil {
+		return "", fmt.Errorf("undefined variable in %q", s)
+	}
+	return buf.String(), nil
+}
+
+// publicTemplateVars returns the values safe to show the caller: generated
+// values are included once so the user learns them, other secrets are not
+func publicTemplateVars(vars []TemplateVar, values map[string]string, supplied map[string]string) map[string]string {
+	public := map[string]string{}
+	for _, v := range vars {
+		_, userSupplied := supplied[v.Name]
+		if v.isSecret() && userSupplied {
+			continue
+		}
+		public[v.Name] = values[v.Name]
+	}
+	return public
+}
+
+func randomPassword(length int) string {
+	const alphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	b := make([]byte, length)
+	for i := range b {
+		n, _ := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		b[i] = alphabet[n.Int64()]
+	}
+	return string(b)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"golang.org/x/net/websocket"
+)
+
+// terminalMessage is a control message of the exec terminal WebSocket
+// protocol. The client sends JSON text frames:
+//
+//	{"type": "input", "data": "ls -la\r"}
+//	{"type": "resize", "cols": 120, "rows": 40}
+//
+// The server sends terminal output as binary frames and, when the process
+// ends, {"type": "exit", "exit_code": 0} as a text frame.
+type terminalMessage struct {
+	Type     string `json:"type"`
+	Data     string `json:"data,omitempty"`
+	Cols     uint   `json:"cols,omitempty"`
+	Rows     uint   `json:"rows,omitempty"`
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+// terminalHandshake picks the subprotocol of a terminal WebSocket: the first
+// one the client offered that isn't its API key, which must not be echoed
+func terminalHandshake(config *websocket.Config, _ *http.Request) error {
+	offered := config.Protocol
+	config.Protocol = nil
+	for _, protocol := range offered {
+		if !strings.HasPrefix(protocol, websocketKeyProtocol) {
+			config.Protocol = []string{protocol}
+			break
+		}
+	}
+	return nil
+}
+
+// execTerminal runs cmd in a container with a TTY and bridges it to ws,
+// recording the session with rec
+func execTerminal(ws *websocket.Conn, cli *client.Client, containerID string, cmd []string, cols, rows uint, rec *SessionRecorder) {
+	// Saved without an exit code when the client leaves first
+	defer rec.Close(nil)
+	defer ws.Close()
+	ctx, cancel := context.WithCancel(ws.Request().Context())
+	defer cancel()
+
+	fail := func(err error) {
+		websocket.JSON.Send(ws, terminalMessage{Type: "error", Error: err.Error()})
+	}
+
+	var consoleSize *[2]uint
+	if cols > 0 && rows > 0 {
+		consoleSize = &[2]uint{rows, cols}
+	}
+	exec, err := cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          cmd,
+		Tty:          true,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		ConsoleSize:  consoleSize,
+	})
+	if err != nil {
+		fail(err)
+		return
+	}
+	resp, err := cli.ContainerExecAttach(ctx, exec.ID, container.ExecStartOptions{Tty: true, ConsoleSize: consoleSize})
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer resp.Close()
+
+	// Container -> client
+	go func() {
+		defer cancel()
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := resp.Reader.Read(buf)
+			if n > 0 {
+				rec.Output(buf[:n])
+				if websocket.Message.Send(ws, buf[:n]) != nil {
+					return
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		msg := terminalMessage{Type: "exit"}
+		if inspect, err := cli.ContainerExecInspect(context.Background(), exec.ID); err == nil {
+			msg.ExitCode = inspect.ExitCode
+			rec.Close(&inspect.ExitCode)
+		}
+		websocket.JSON.Send(ws, msg)
+		ws.Close()
+	}()
+
+	// Client -> container
+	for ctx.Err() == nil {
+		var msg terminalMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			return
+		}
+		switch msg.Type {
+		case "input":
+			rec.Input(msg.Data)
+			if _, err := resp.Conn.Write([]byte(msg.Data)); err != nil {
+				return
+			}
+		case "resize":
+			if msg.Cols == 0 || msg.Rows == 0 {
+				continue
+			}
+			if err := cli.ContainerExecResize(ctx, exec.ID, container.ResizeOptions{Height: msg.Rows, Width: msg.Cols}); err != nil {
+				fail(fmt.Errorf("resize: %w", err))
+				continue
+			}
+			rec.Resize(msg.Cols, msg.Rows)
+		}
+	}
+}
+
+// wsOutput sends everything written to it as binary frames, and records it
+type wsOutput struct {
+	ws  *websocket.Conn
+	rec *SessionRecorder
+}
+
+func (w wsOutput) Write(p []byte) (int, error) {
+	w.rec.Output(p)
+	if err := websocket.Message.Send(w.ws, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// attachTerminal attaches ws to the main process of a container, using the
+// exec terminal protocol. Closing the WebSocket detaches without stopping
+// the container; when the process exits the client gets its exit code.
+func attachTerminal(ws *websocket.Conn, cli *client.Client, info container.InspectResponse, logs bool, cols, rows uint, rec *SessionRecorder) {
+	defer rec.Close(nil)
+	defer ws.Close()
+	ctx, cancel := context.WithCancel(ws.Request().Context())
+	defer cancel()
+
+	fail := func(err error) {
+		websocket.JSON.Send(ws, terminalMessage{Type: "error", Error: err.Error()})
+	}
+
+	tty := info.Config != nil && info.Config.Tty
+	stdin := info.Config != nil && info.Config.OpenStdin
+	resp, err := cli.ContainerAttach(ctx, info.ID, container.AttachOptions{
+		Stream: true,
+		Stdin:  stdin,
+		Stdout: true,
+		Stderr: true,
+		Logs:   logs,
+	})
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer resp.Close()
+
+	resize := func(cols, rows uint) error {
+		if !tty || cols == 0 || rows == 0 {
+			return nil
+		}
+		return cli.ContainerResize(ctx, info.ID, container.ResizeOptions{Height: rows, Width: cols})
+	}
+	if err := resize(cols, rows); err != nil {
+		fail(fmt.Errorf("resize: %w", err))
+	}
+
+	// Container -> client; without a TTY stdout and stderr are multiplexed
+	go func() {
+		defer cancel()
+		out := wsOutput{ws: ws, rec: rec}
+		if tty {
+			io.Copy(out, resp.Reader)
+		} else {
+			stdcopy.StdCopy(out, out, resp.Reader)
+		}
+		// The stream also ends when the daemon detaches us, only report an
+		// exit when the process is gone
+		inspect, err := cli.ContainerInspect(context.Background(), info.ID)
+		if err != nil || inspect.State == nil || inspect.State.Running {
+			ws.Close()
+			return
+		}
+		rec.Close(&inspect.State.ExitCode)
+		websocket.JSON.Send(ws, terminalMessage{Type: "exit", ExitCode: inspect.State.ExitCode})
+		ws.Close()
+	}()
+
+	// Client -> container
+	for ctx.Err() == nil {
+		var msg terminalMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			return
+		}
+		switch msg.Type {
+		case "input":
+			if !stdin {
+				fail(errors.New("container was not created with stdin open"))
+				continue
+			}
+			rec.Input(msg.Data)
+			if _, err := resp.Conn.Write([]byte(msg.Data)); err != nil {
+				return
+			}
+		case "resize":
+			if err := resize(msg.Cols, msg.Rows); err != nil {
+				fail(fmt.Errorf("resize: %w", err))
+				continue
+			}
+			if tty && msg.Cols > 0 && msg.Rows > 0 {
+				rec.Resize(msg.Cols, msg.Rows)
+			}
+		}
+	}
+}
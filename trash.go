@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// Trashed containers are renamed into this namespace so they are easy to
+// tell apart in `docker ps -a`
+const trashPrefix = "trash-"
+
+// TrashedContainer is a removed container kept stopped until its grace
+// period ends
+type TrashedContainer struct {
+	ContainerID   string                  `json:"container_id"`
+	OriginalName  string                  `json:"original_name"`
+	TrashName     string                  `json:"trash_name"`
+	RestartPolicy container.RestartPolicy `json:"restart_policy"`
+	WasRunning    bool                    `json:"was_running"`
+	TrashedBy     string                  `json:"trashed_by"`
+	TrashedAt     time.Time               `json:"trashed_at"`
+	ExpiresAt     time.Time               `json:"expires_at"`
+}
+
+func (s *Store) SaveTrashed(t *TrashedContainer) error {
+	policy, err := json.Marshal(t.RestartPolicy)
+	if err != nil {
+		return err
+	}
+	_, err = s.exec(`INSERT INTO trash (container_id, original_name, trash_name, restart_policy, was_running, trashed_by, trashed_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.ContainerID, t.OriginalName, t.TrashName, string(policy), t.WasRunning, t.TrashedBy, t.TrashedAt.Unix(), t.ExpiresAt.Unix())
+	return err
+}
+
+func (s *Store) DeleteTrashed(containerID string) error {
+	_, err := s.exec(`DELETE FROM trash WHERE container_id = ?`, containerID)
+	return err
+}
+
+const trashColumns = `container_id, original_name, trash_name, restart_policy, was_running, trashed_by, trashed_at, expires_at`
+
+func scanTrashed(row rowScanner) (*TrashedContainer, error) {
+	var t TrashedContainer
+	var policy string
+	var trashedAt, expiresAt int64
+	if err := row.Scan(&t.ContainerID, &t.OriginalName, &t.TrashName, &policy, &t.WasRunning, &t.TrashedBy, &trashedAt, &expiresAt); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(policy), &t.RestartPolicy)
+	t.TrashedAt = time.Unix(trashedAt, 0)
+	t.ExpiresAt = time.Unix(expiresAt, 0)
+	return &t, nil
+}
+
+// GetTrashed finds a trashed container by ID, ID prefix, trash name or
+// original name (the most recently trashed one wins)
+func (s *Store) GetTrashed(ref string) (*TrashedContainer, error) {
+	return scanTrashed(s.queryRow(`SELECT `+trashColumns+` FROM trash
+		WHERE container_id = ? OR container_id LIKE ? OR trash_name = ? OR original_name = ?
+		ORDER BY trashed_at DESC LIMIT 1`, ref, ref+"%", ref, ref))
+}
+
+func (s *Store) ListTrashed() ([]TrashedContainer, error) {
+	rows, err := s.query(`SELECT ` + trashColumns + ` FROM trash ORDER BY trashed_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trashed := []TrashedContainer{}
+	for rows.Next() {
+		t, err := scanTrashed(rows)
+		if err != nil {
+			return nil, err
+		}
+		trashed = append(trashed, *t)
+	}
+	return trashed, rows.Err()
+}
+
+// Trash turns container removal into a soft delete when TRASH_GRACE_PERIOD
+// is set: containers are stopped and renamed, and only removed for good once
+// the grace period is over
+type Trash struct {
+	store *Store
+	grace time.Duration
+}
+
+func newTrash(store *Store) *Trash {
+	t := &Trash{store: store}
+	if v := os.Getenv("TRASH_GRACE_PERIOD"); v != "" {
+		grace, err := parseTTL(v)
+		if err != nil {
+			fmt.Printf("⚠️  Invalid TRASH_GRACE_PERIOD %q, trash disabled: %v\n", v, err)
+		} else {
+			t.grace = grace
+		}
+	}
+	return t
+}
+
+func (t *Trash) Enabled() bool {
+	return t.grace > 0
+}
+
+// Remove deletes a container, or moves it to the trash when the trash is
+// enabled and permanent isn't set. It reports whether it was trashed.
+// Either way the remove hooks run around it.
+func (t *Trash) Remove(ctx context.Context, cli *client.Client, containerID, actor string, permanent bool) (bool, error) {
+	ctx = withActor(ctx, actor)
+	var trashed bool
+	err := onContainer(ctx, cli, hookRemove, containerID, func() (err error) {
+		trashed, err = t.remove(ctx, cli, containerID, actor, permanent)
+		return err
+	})
+	return trashed, err
+}
+
+func (t *Trash) remove(ctx context.Context, cli *client.Client, containerID, actor string, permanent bool) (bool, error) {
+	info, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return false, err
+	}
+	name := strings.TrimPrefix(info.Name, "/")
+
+	if !t.Enabled() || permanent {
+		if err := cli.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true}); err != nil {
+			return false, err
+		}
+		// A permanent remove may empty the trash early
+		t.store.DeleteTrashed(containerID)
+		untrackDesired(t.store, name)
+		return false, nil
+	}
+
+	if strings.HasPrefix(name, trashPrefix) {
+		return false, fmt.Errorf("container %s is already in the trash", name)
+	}
+	// Stopping removes auto_remove containers anyway, there's nothing to keep
+	if info.HostConfig != nil && info.HostConfig.AutoRemove {
+		return false, cli.ContainerRemove(ctx, info.ID, container.RemoveOptions{Force: true})
+	}
+
+	now := time.Now()
+	trashed := &TrashedContainer{
+		ContainerID:  info.ID,
+		OriginalName: name,
+		TrashName:    trashPrefix + strconv.FormatInt(now.Unix(), 10) + "-" + name,
+		WasRunning:   info.State != nil && info.State.Running,
+		TrashedBy:    actor,
+		TrashedAt:    now,
+		ExpiresAt:    now.Add(t.grace),
+	}
+	if info.HostConfig != nil {
+		trashed.RestartPolicy = info.HostConfig.RestartPolicy
+	}
+
+	if trashed.WasRunning {
+		if err := cli.ContainerStop(ctx, info.ID, container.StopOptions{}); err != nil {
+			return false, fmt.Errorf("stopping container: %w", err)
+		}
+	}
+	// A restart policy would bring the container back when the daemon restarts
+	if _, err := cli.ContainerUpdate(ctx, info.ID, container.UpdateConfig{
+		RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyDisabled},
+	}); err != nil {
+		return false, fmt.Errorf("clearing restart policy: %w", err)
+	}
+	if err := cli.ContainerRename(ctx, info.ID, trashed.TrashName); err != nil {
+		return false, fmt.Errorf("renaming container: %w", err)
+	}
+	if err := t.store.SaveTrashed(trashed); err != nil {
+		cli.ContainerRename(ctx, info.ID, name)
+		return false, err
+	}
+	// Removed on purpose, reconcile must not bring it back
+	untrackDesired(t.store, name)
+	return true, nil
+}
+
+// Restore gives a trashed container its name and restart policy back, and
+// starts it again if it was running when it was trashed
+func (t *Trash) Restore(ctx context.Context, cli *client.Client, trashed *TrashedContainer) error {
+	if err := cli.ContainerRename(ctx, trashed.ContainerID, trashed.OriginalName); err != nil {
+		return fmt.Errorf("renaming container: %w", err)
+	}
+	if _, err := cli.ContainerUpdate(ctx, trashed.ContainerID, container.UpdateConfig{RestartPolicy: trashed.RestartPolicy}); err != nil {
+		return fmt.Errorf("restoring restart policy: %w", err)
+	}
+	if err := t.store.DeleteTrashed(trashed.ContainerID); err != nil {
+		return err
+	}
+	if trashed.WasRunning {
+		if err := startContainer(ctx, cli, trashed.ContainerID, container.StartOptions{}); err != nil {
+			return fmt.Errorf("starting container: %w", err)
+		}
+	}
+	return nil
+}
+
+// Purge removes trashed containers whose grace period is over. Containers
+// already gone from docker are dropped from the trash as well.
+func (t *Trash) Purge(ctx context.Context, cli *client.Client) ([]string, error) {
+	trashed, err := t.store.ListTrashed()
+	if err != nil {
+		return nil, err
+	}
+	purged := []string{}
+	now := time.Now()
+	for _, c := range trashed {
+		if c.ExpiresAt.After(now) {
+			continue
+		}
+		if err := removeContainer(ctx, cli, c.ContainerID, container.RemoveOptions{Force: true}); err != nil && !client.IsErrNotFound(err) {
+			fmt.Printf("⚠️  Error purging trashed container %s: %v\n", c.TrashName, err)
+			continue
+		}
+		if err := t.store.DeleteTrashed(c.ContainerID); err != nil {
+			return purged, err
+		}
+		purged = append(purged, c.OriginalName)
+	}
+	return purged, nil
+}
+
+// purgeTask is the scheduler task emptying expired trash
+func (t *Trash) purgeTask() func(ctx context.Context, cli *client.Client) (any, error) {
+	return func(ctx context.Context, cli *client.Client) (any, error) {
+		purged, err := t.Purge(ctx, cli)
+		if err == nil && len(purged) == 0 {
+			return nil, nil
+		}
+		return purged, err
+	}
+}
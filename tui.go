@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-units"
+	"github.com/moby/term"
+)
+
+// How often the terminal UI reloads containers, stats and logs
+const tuiRefresh = 2 * time.Second
+
+type tuiRow struct {
+	container.Summary
+	usage     *ContainerUsage
+	protected bool
+}
+
+type tuiState struct {
+	rows     []tuiRow
+	images   int
+	lowDisk  bool
+	logs     []string
+	err      error
+	updated  time.Time
+	selected string
+}
+
+// runTUI shows a live container list with stats and the logs of the selected
+// container, for operators on the docker host. It reads the same Docker
+// daemon and app database as the API.
+func runTUI(store *Store) error {
+	fd, isTerminal := term.GetFdInfo(os.Stdin)
+	if !isTerminal {
+		return fmt.Errorf("--tui needs an interactive terminal")
+	}
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	oldState, err := term.SetRawTerminal(fd)
+	if err != nil {
+		return err
+	}
+	defer term.RestoreTerminal(fd, oldState)
+	// Alternate screen, hidden cursor; undone on exit
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan string)
+	go readKeys(keys)
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+	defer signal.Stop(resize)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	state := &tuiState{}
+	showLogs := true
+	refresh := func() {
+		loadTUIState(ctx, cli, store, state, showLogs)
+		drawTUI(fd, state, showLogs)
+	}
+	refresh()
+
+	ticker := time.NewTicker(tuiRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			refresh()
+		case <-resize:
+			drawTUI(fd, state, showLogs)
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			switch key {
+			case "q", "\x03":
+				return nil
+			case "up", "k":
+				state.move(-1)
+				refresh()
+			case "down", "j":
+				state.move(1)
+				refresh()
+			case "l":
+				showLogs = !showLogs
+				refresh()
+			case "r":
+				refresh()
+			}
+		}
+	}
+}
+
+// readKeys turns raw terminal input into key names
+func readKeys(keys chan<- string) {
+	defer close(keys)
+	buf := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		input := string(buf[:n])
+		switch input {
+		case "\x1b[A":
+			keys <- "up"
+		case "\x1b[B":
+			keys <- "down"
+		default:
+			for _, r := range input {
+				keys <- string(r)
+			}
+		}
+	}
+}
+
+func (s *tuiState) move(delta int) {
+	if len(s.rows) == 0 {
+		return
+	}
+	i := 0
+	for j, row := range s.rows {
+		if row.ID == s.selected {
+			i = j
+		}
+	}
+	i = min(max(i+delta, 0), len(s.rows)-1)
+	s.selected = s.rows[i].ID
+}
+
+func loadTUIState(ctx context.Context, cli *client.Client, store *Store, state *tuiState, withLogs bool) {
+	state.updated = time.Now()
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		state.err = err
+		return
+	}
+	state.err = nil
+
+	// Same view as /status: no trashed containers, protection marked
+	inTrash := map[string]bool{}
+	if trashed, err := store.ListTrashed(); err == nil {
+		for _, t := range trashed {
+			inTrash[t.ContainerID] = true
+		}
+	}
+	rows := []tuiRow{}
+	for _, c := range containers {
+		if inTrash[c.ID] {
+			continue
+		}
+		rows = append(rows, tuiRow{Summary: c, protected: protectionReason(store, summaryName(c), c.Labels) != ""})
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if (rows[i].State == "running") != (rows[j].State == "running") {
+			return rows[i].State == "running"
+		}
+		return summaryName(rows[i].Summary) < summaryName(rows[j].Summary)
+	})
+
+	running := []string{}
+	for _, row := range rows {
+		if row.State == "running" {
+			running = append(running, row.ID)
+		}
+	}
+	usage := containersUsage(ctx, cli, running)
+	for i := range rows {
+		rows[i].usage = usage[rows[i].ID]
+	}
+	state.rows = rows
+
+	found := false
+	for _, row := range rows {
+		found = found || row.ID == state.selected
+	}
+	if !found && len(rows) > 0 {
+		state.selected = rows[0].ID
+	}
+
+	if images, err := cli.ImageList(ctx, image.ListOptions{}); err == nil {
+		state.images = len(images)
+	}
+	state.lowDisk = lowDiskSpace(ctx, cli) != nil
+
+	state.logs = nil
+	if withLogs && state.selected != "" {
+		state.logs = tailLogs(ctx, cli, state.selected, 50)
+	}
+}
+
+func tailLogs(ctx context.Context, cli *client.Client, containerID string, lines int) []string {
+	info, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return []string{"error: " + err.Error()}
+	}
+	logs, err := cli.ContainerLogs(ctx, containerID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       fmt.Sprint(lines),
+	})
+	if err != nil {
+		return []string{"error: " + err.Error()}
+	}
+	defer logs.Close()
+
+	var buf bytes.Buffer
+	if err := copyLogs(&buf, logs, info.Config != nil && info.Config.Tty); err != nil {
+		return []string{"error: " + err.Error()}
+	}
+	text := strings.ReplaceAll(strings.TrimRight(buf.String(), "\n"), "\r", "")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+func drawTUI(fd uintptr, state *tuiState, showLogs bool) {
+	width, height := 80, 24
+	if ws, err := term.GetWinsize(fd); err == nil && ws.Width > 0 {
+		width, height = int(ws.Width), int(ws.Height)
+	}
+
+	var lines []string
+	running := 0
+	for _, row := range state.rows {
+		if row.State == "running" {
+			running++
+		}
+	}
+	header := fmt.Sprintf(" Docker Manager  %d containers (%d running)  %d images  %s",
+		len(state.rows), running, state.images, state.updated.Format("15:04:05"))
+	if state.lowDisk {
+		header += "  \x1b[31mLOW DISK\x1b[0;7m"
+	}
+	lines = append(lines, "\x1b[7m"+pad(header, width)+"\x1b[0m")
+	if state.err != nil {
+		lines = append(lines, "\x1b[31m"+clip(" "+state.err.Error(), width)+"\x1b[0m")
+	}
+	lines = append(lines, "\x1b[1m"+clip(fmt.Sprintf("   %-28s %-10s %-28s %7s %18s", "NAME", "STATE", "IMAGE", "CPU %", "MEMORY"), width)+"\x1b[0m")
+
+	listTop := len(lines)
+	listHeight := height - len(lines) - 1
+	if showLogs {
+		listHeight = (height - len(lines)) / 2
+	}
+	// Keep the selection in view
+	offset := 0
+	for i, row := range state.rows {
+		if row.ID == state.selected && i >= listHeight {
+			offset = i - listHeight + 1
+		}
+	}
+	for i := offset; i < len(state.rows) && i-offset < listHeight; i++ {
+		row := state.rows[i]
+		cpu, mem := "-", "-"
+		if row.usage != nil {
+			cpu = fmt.Sprintf("%.1f", row.usage.CPUPercent)
+			mem = units.BytesSize(float64(row.usage.MemoryUsage))
+			if row.usage.MemoryLimit > 0 {
+				mem += " / " + units.BytesSize(float64(row.usage.MemoryLimit))
+			}
+		}
+		marker := " "
+		if row.protected {
+			marker = "🔒"
+		}
+		line := fmt.Sprintf(" %s %-28s %-10s %-28s %7s %18s", marker, clip(summaryName(row.Summary), 28), row.State, clip(row.Image, 28), cpu, mem)
+		if row.ID == state.selected {
+			line = "\x1b[7m" + pad(line, width) + "\x1b[0m"
+		} else {
+			line = clip(line, width)
+		}
+		lines = append(lines, line)
+	}
+
+	if showLogs {
+		// The logs pane starts at a fixed row however many containers there are
+		for len(lines) < listTop+listHeight {
+			lines = append(lines, "")
+		}
+		title := " Logs"
+		for _, row := range state.rows {
+			if row.ID == state.selected {
+				title += ": " + summaryName(row.Summary)
+			}
+		}
+		lines = append(lines, "\x1b[7m"+pad(title, width)+"\x1b[0m")
+		logHeight := height - len(lines) - 1
+		logs := state.logs
+		if len(logs) > logHeight {
+			logs = logs[len(logs)-logHeight:]
+		}
+		for _, l := range logs {
+			lines = append(lines, clip(l, width))
+		}
+	}
+
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	lines = append(lines[:height-1], "\x1b[2m"+clip(" ↑/↓ select   l toggle logs   r refresh   q quit", width)+"\x1b[0m")
+
+	var out strings.Builder
+	out.WriteString("\x1b[H")
+	for i, l := range lines {
+		out.WriteString(l + "\x1b[K")
+		if i < len(lines)-1 {
+			out.WriteString("\r\n")
+		}
+	}
+	os.Stdout.WriteString(out.String())
+}
+
+// clip cuts s to width runes
+func clip(s string, width int) string {
+	r := []rune(s)
+	if len(r) > width {
+		return string(r[:width])
+	}
+	return s
+}
+
+// pad clips s and fills it with spaces up to width, for highlighted bars
+func pad(s string, width int) string {
+	s = clip(s, width)
+	if n := width - len([]rune(s)); n > 0 {
+		s += strings.Repeat(" ", n)
+	}
+	return s
+}
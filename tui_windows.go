@@ -0,0 +1,7 @@
+package main
+
+import "os"
+
+// notifyResize does nothing: Windows consoles have no resize signal, the
+// next refresh picks up the new size
+func notifyResize(ch chan<- os.Signal) {}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// Tunnel lifetimes when none is given, and at most
+const (
+	defaultTunnelTTL = time.Hour
+	maxTunnelTTL     = 24 * time.Hour
+)
+
+// Address tunnel listeners bind to unless TUNNEL_BIND_ADDR says otherwise.
+// Loopback keeps them reachable only through an SSH session on the server.
+const defaultTunnelBindAddr = "127.0.0.1"
+
+// Tunnel forwards TCP connections from a port on the management server to a
+// port inside a container, over the container's network address, so the
+// port doesn't need to be published. Only addresses in AllowFrom may
+// connect; the WebSocket endpoint authenticates with the API key instead.
+type Tunnel struct {
+	ID            string    `json:"id"`
+	ContainerID   string    `json:"container_id"`
+	ContainerName string    `json:"container_name"`
+	Port          int       `json:"port"`
+	Address       string    `json:"address"`
+	AllowFrom     []string  `json:"allow_from"`
+	CreatedBy     string    `json:"created_by"`
+	CreatedAt     time.Time `json:"created_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	Connections   int       `json:"connections"`
+
+	listener net.Listener
+	allowed  []*net.IPNet
+	timer    *time.Timer
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+}
+
+// Tunnels holds the open tunnels. They live in memory only and close when
+// the server stops.
+type Tunnels struct {
+	mu      sync.Mutex
+	tunnels map[string]*Tunnel
+}
+
+func newTunnels() *Tunnels {
+	return &Tunnels{tunnels: map[string]*Tunnel{}}
+}
+
+// parseAllowFrom turns IPs and CIDRs into networks
+func parseAllowFrom(entries []string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			entry = ip.String() + "/" + strconv.Itoa(bits)
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// Open starts listening for a new tunnel to port in the container and
+// closes it after ttl
+func (t *Tunnels) Open(info container.InspectResponse, port int, ttl time.Duration, actor string, allowFrom []string) (*Tunnel, error) {
+	allowed, err := parseAllowFrom(allowFrom)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := containerAddress(info, port); err != nil {
+		return nil, err
+	}
+	bind := os.Getenv("TUNNEL_BIND_ADDR")
+	if bind == "" {
+		bind = defaultTunnelBindAddr
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(bind, "0"))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tunnel := &Tunnel{
+		ID:            newID(),
+		ContainerID:   info.ID,
+		ContainerName: strings.TrimPrefix(info.Name, "/"),
+		Port:          port,
+		Address:       listener.Addr().String(),
+		AllowFrom:     allowFrom,
+		CreatedBy:     actor,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(ttl),
+		listener:      listener,
+		allowed:       allowed,
+		conns:         map[net.Conn]struct{}{},
+	}
+	tunnel.timer = time.AfterFunc(ttl, func() {
+		if t.Close(tunnel.ID) {
+			fmt.Printf("⏱️  Tunnel %s to %s:%d expired\n", tunnel.ID, tunnel.ContainerName, port)
+		}
+	})
+	t.mu.Lock()
+	t.tunnels[tunnel.ID] = tunnel
+	t.mu.Unlock()
+	go tunnel.serve()
+	return tunnel, nil
+}
+
+func (t *Tunnels) Get(id string) (*Tunnel, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tunnel, ok := t.tunnels[id]
+	return tunnel, ok
+}
+
+// List returns the open tunnels, oldest first
+func (t *Tunnels) List() []*Tunnel {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list := make([]*Tunnel, 0, len(t.tunnels))
+	for _, tunnel := range t.tunnels {
+		list = append(list, tunnel)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Close tears a tunnel down, cutting its connections, and reports whether
+// it was open
+func (t *Tunnels) Close(id string) bool {
+	t.mu.Lock()
+	tunnel, ok := t.tunnels[id]
+	delete(t.tunnels, id)
+	t.mu.Unlock()
+	if !ok {
+		return false
+	}
+	tunnel.timer.Stop()
+	tunnel.listener.Close()
+	tunnel.mu.Lock()
+	for conn := range tunnel.conns {
+		conn.Close()
+	}
+	tunnel.mu.Unlock()
+	return true
+}
+
+// Snapshot copies the tunnel for JSON while connections come and go
+func (tn *Tunnel) Snapshot() Tunnel {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+	return Tunnel{
+		ID: tn.ID, ContainerID: tn.ContainerID, ContainerName: tn.ContainerName, Port: tn.Port,
+		Address: tn.Address, AllowFrom: tn.AllowFrom, CreatedBy: tn.CreatedBy,
+		CreatedAt: tn.CreatedAt, ExpiresAt: tn.ExpiresAt, Connections: len(tn.conns),
+	}
+}
+
+func (tn *Tunnel) permits(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, n := range tn.allowed {
+		if n.Contains(tcp.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func (tn *Tunnel) serve() {
+	for {
+		conn, err := tn.listener.Accept()
+		if err != nil {
+			return
+		}
+		if !tn.permits(conn.RemoteAddr()) {
+			fmt.Printf("🚫 Tunnel %s refused a connection from %s\n", tn.ID, conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		go tn.forward(conn)
+	}
+}
+
+// track registers a connection so Close can cut it, until the returned
+// func is called
+func (tn *Tunnel) track(conn net.Conn) func() {
+	tn.mu.Lock()
+	tn.conns[conn] = struct{}{}
+	tn.mu.Unlock()
+	return func() {
+		tn.mu.Lock()
+		delete(tn.conns, conn)
+		tn.mu.Unlock()
+	}
+}
+
+// forward copies between a client connection and the container until either
+// side closes
+func (tn *Tunnel) forward(conn net.Conn) {
+	defer conn.Close()
+	defer tn.track(conn)()
+	upstream, err := tn.dial(context.Background())
+	if err != nil {
+		fmt.Printf("⚠️  Tunnel %s: %v\n", tn.ID, err)
+		return
+	}
+	defer upstream.Close()
+	defer tn.track(upstream)()
+
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(upstream, conn); done <- struct{}{} }()
+	go func() { io.Copy(conn, upstream); done <- struct{}{} }()
+	<-done
+}
+
+// dial connects to the container port, looking the address up again since
+// a restart may have changed it
+func (tn *Tunnel) dial(ctx context.Context) (net.Conn, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+	info, err := cli.ContainerInspect(ctx, tn.ContainerID)
+	if err != nil {
+		return nil, err
+	}
+	if info.State == nil || !info.State.Running {
+		return nil, errors.New("container " + tn.ContainerName + " is not running")
+	}
+	addr, err := containerAddress(info, tn.Port)
+	if err != nil {
+		return nil, err
+	}
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+// containerAddress returns the address of a container port on the first of
+// its networks with an IP, by network name
+func containerAddress(info container.InspectResponse, port int) (string, error) {
+	if info.NetworkSettings != nil {
+		names := make([]string, 0, len(info.NetworkSettings.Networks))
+		for name := range info.NetworkSettings.Networks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if ep := info.NetworkSettings.Networks[name]; ep != nil && ep.IPAddress != "" {
+				return net.JoinHostPort(ep.IPAddress, strconv.Itoa(port)), nil
+			}
+		}
+	}
+	return "", errors.New("container " + strings.TrimPrefix(info.Name, "/") + " has no network address")
+}
+
+// tunnelForCaller finds a tunnel the caller may use: admins all of them,
+// users their own. It answers the error itself.
+func tunnelForCaller(ctx *gin.Context, tunnels *Tunnels) (*Tunnel, bool) {
+	tunnel, ok := tunnels.Get(ctx.Param("id"))
+	if ok && !isAdmin(ctx) && (currentUser(ctx) == nil || tunnel.CreatedBy != actorName(ctx)) {
+		ok = false
+	}
+	if !ok {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Tunnel not found: " + ctx.Param("id")})
+	}
+	return tunnel, ok
+}
+
+// serveTunnelWebSocket bridges binary WebSocket frames to the container
+// port, for clients that can't reach the tunnel's TCP port
+func serveTunnelWebSocket(ctx *gin.Context, tunnel *Tunnel) {
+	websocket.Server{Handler: func(ws *websocket.Conn) {
+		ws.PayloadType = websocket.BinaryFrame
+		tunnel.forward(ws)
+	}}.ServeHTTP(ctx.Writer, ctx.Request)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/gin-gonic/gin"
+)
+
+// ContainerUsage is a point-in-time CPU and memory reading of a container
+type ContainerUsage struct {
+	CPUPercent  float64
+	MemoryUsage uint64
+	MemoryLimit uint64
+	// Cumulative network counters, in total and by interface
+	Network    NetworkCounters
+	Interfaces map[string]NetworkCounters
+}
+
+// containerUsage reads one stats sample. The daemon waits for a second
+// sample before answering, so precpu_stats is filled in for the CPU delta.
+func containerUsage(ctx context.Context, cli *client.Client, containerID string) (*ContainerUsage, error) {
+	resp, err := cli.ContainerStats(ctx, containerID, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var stats container.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, err
+	}
+
+	usage := &ContainerUsage{MemoryLimit: stats.MemoryStats.Limit}
+	usage.Network, usage.Interfaces = networkCounters(stats)
+	if stats.ID != "" && len(stats.Networks) > 0 {
+		networkHistory.Record(stats.ID, NetworkSample{Time: stats.Read, NetworkCounters: usage.Network})
+	}
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	cpus := float64(stats.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		usage.CPUPercent = cpuDelta / systemDelta * cpus * 100
+	}
+	// Same as docker stats: page cache doesn't count as used memory
+	usage.MemoryUsage = stats.MemoryStats.Usage
+	if cache, ok := stats.MemoryStats.Stats["inactive_file"]; ok && cache < usage.MemoryUsage {
+		usage.MemoryUsage -= cache
+	}
+	return usage, nil
+}
+
+// containersUsage samples several containers concurrently, as each stats
+// call takes about a second. Containers that fail are left out.
+func containersUsage(ctx context.Context, cli *client.Client, containerIDs []string) map[string]*ContainerUsage {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	usage := map[string]*ContainerUsage{}
+	for _, id := range containerIDs {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if u, err := containerUsage(ctx, cli, id); err == nil {
+				mu.Lock()
+				usage[id] = u
+				mu.Unlock()
+			}
+		}(id)
+	}
+	wg.Wait()
+	return usage
+}
+
+// ContainerResourceUsage is one entry of the top containers in /stats
+type ContainerResourceUsage struct {
+	ID            string  `json:"id"`
+	Name          string  `json:"name"`
+	Image         string  `json:"image"`
+	CPUPercent    float64 `json:"cpu_percent"`
+	MemoryUsage   uint64  `json:"memory_usage"`
+	MemoryLimit   uint64  `json:"memory_limit"`
+	MemoryPercent float64 `json:"memory_percent"`
+}
+
+// topContainers samples all running containers and returns the n heaviest
+// by CPU and by memory
+func topContainers(ctx context.Context, cli *client.Client, containers []container.Summary, n int) gin.H {
+	running := []string{}
+	for _, c := range containers {
+		if c.State == "running" {
+			running = append(running, c.ID)
+		}
+	}
+	usage := containersUsage(ctx, cli, running)
+
+	entries := []ContainerResourceUsage{}
+	for _, c := range containers {
+		u, ok := usage[c.ID]
+		if !ok {
+			continue
+		}
+		entry := ContainerResourceUsage{
+			ID:          c.ID[:12],
+			Name:        summaryName(c),
+			Image:       c.Image,
+			CPUPercent:  u.CPUPercent,
+			MemoryUsage: u.MemoryUsage,
+			MemoryLimit: u.MemoryLimit,
+		}
+		if u.MemoryLimit > 0 {
+			entry.MemoryPercent = float64(u.MemoryUsage) / float64(u.MemoryLimit) * 100
+		}
+		entries = append(entries, entry)
+	}
+
+	top := func(less func(a, b ContainerResourceUsage) bool) []ContainerResourceUsage {
+		sorted := append([]ContainerResourceUsage{}, entries...)
+		sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+		return sorted[:min(n, len(sorted))]
+	}
+	return gin.H{
+		"sampled": len(entries),
+		// Sampling just added a point, so every container has a recent rate
+		"network": topTalkers(containers, n),
+		"cpu":     top(func(a, b ContainerResourceUsage) bool { return a.CPUPercent > b.CPUPercent }),
+		"memory":  top(func(a, b ContainerResourceUsage) bool { return a.MemoryUsage > b.MemoryUsage }),
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	units "github.com/docker/go-units"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Default request body limits: JSON bodies are small, uploads (multipart
+// forms with .env files) get more room
+const (
+	defaultMaxBodySize   = 1 << 20
+	defaultMaxUploadSize = 10 << 20
+)
+
+// Container names as the daemon accepts them
+var containerNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Custom validators usable in binding tags, on top of the validator's
+// built-in ones (required, oneof, min, max, ...)
+var customValidators = map[string]validator.Func{
+	// Name for a new container
+	"containername": func(fl validator.FieldLevel) bool {
+		return validateContainerName(fl.Field().String()) == nil
+	},
+	// Existing container, by name or ID
+	"containerref": func(fl validator.FieldLevel) bool {
+		return validateContainerRef(fl.Field().String()) == nil
+	},
+	// Image reference such as "nginx", "nginx:1.27" or "ghcr.io/org/app@sha256:..."
+	"imageref": func(fl validator.FieldLevel) bool {
+		return validateImageRef(fl.Field().String()) == nil
+	},
+	// Byte size such as "512m" or "1g"
+	"bytesize": func(fl validator.FieldLevel) bool {
+		size, err := units.RAMInBytes(fl.Field().String())
+		return err == nil && size >= 0
+	},
+	// Lifetime such as "2h" or "7d", see parseTTL
+	"ttl": func(fl validator.FieldLevel) bool {
+		_, err := parseTTL(fl.Field().String())
+		return err == nil
+	},
+	// Environment variable name
+	"envname": func(fl validator.FieldLevel) bool {
+		return envVarName.MatchString(fl.Field().String())
+	},
+	// Secret, config and project names
+	"resourcename": func(fl validator.FieldLevel) bool {
+		return configName.MatchString(fl.Field().String())
+	},
+	// One DNS label, for automatic proxy subdomains
+	"subdomain": func(fl validator.FieldLevel) bool {
+		return subdomainPattern.MatchString(fl.Field().String())
+	},
+}
+
+// Messages for validation failures, by tag; %s is the tag parameter
+var validationMessages = map[string]string{
+	"required":      "is required",
+	"min":           "must be at least %s",
+	"max":           "must be at most %s",
+	"oneof":         "must be one of: %s",
+	"gte":           "must be at least %s",
+	"lte":           "must be at most %s",
+	"containername": "must be a valid container name (letters, digits, '_', '.', '-')",
+	"containerref":  "must be a container name or ID",
+	"imageref":      "must be a valid image reference such as nginx:1.27",
+	"bytesize":      "must be a size such as 512m or 1g",
+	"ttl":           "must be a duration between 1m and 365d such as 2h or 7d",
+	"envname":       "must be a valid environment variable name",
+	"resourcename":  "may only contain letters, digits, '_', '.' and '-'",
+	"cidr|ip":       "must be an IP address or a CIDR network such as 10.0.0.0/8",
+	"subdomain":     "must be a DNS label: lowercase letters, digits and '-', at most 63 characters",
+}
+
+// Validators whose own error explains the problem better than the message
+// above
+var validationDetails = map[string]func(string) error{
+	"containername": validateContainerName,
+	"containerref":  validateContainerRef,
+	"imageref":      validateImageRef,
+}
+
+// Namespace element of embedded structs such as ResourceOptions, whose
+// fields JSON flattens into the parent
+const embeddedFieldName = "<embedded>"
+
+// registerValidators adds the custom validators to gin's binding and makes
+// validation errors use JSON field names
+func registerValidators() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" && field.Anonymous {
+			return embeddedFieldName
+		}
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	for tag, fn := range customValidators {
+		v.RegisterValidation(tag, fn)
+	}
+}
+
+// FieldError is one invalid request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func fieldErrors(errs validator.ValidationErrors) []FieldError {
+	fields := make([]FieldError, 0, len(errs))
+	for _, e := range errs {
+		// Namespace is Struct.field.sub[0], the struct name isn't useful
+		field := strings.ReplaceAll(e.Namespace(), embeddedFieldName+".", "")
+		if _, rest, ok := strings.Cut(field, "."); ok {
+			field = rest
+		}
+		message, ok := validationMessages[e.Tag()]
+		if !ok {
+			message = "is invalid (" + e.Tag() + ")"
+		} else if strings.Contains(message, "%s") {
+			message = fmt.Sprintf(message, e.Param())
+		}
+		message = field + " " + message
+		if detail, ok := validationDetails[e.Tag()]; ok {
+			if value, ok := e.Value().(string); ok {
+				if err := detail(value); err != nil {
+					message = field + ": " + err.Error()
+				}
+			}
+		}
+		fields = append(fields, FieldError{Field: field, Rule: e.Tag(), Message: message})
+	}
+	return fields
+}
+
+// respondBindError answers a failed bind: 413 for oversized bodies, 400 with
+// per-field errors for failed validation, 400 for malformed JSON
+func respondBindError(ctx *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	var invalid validator.ValidationErrors
+	switch {
+	case errors.As(err, &tooLarge):
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":      fmt.Sprintf("Request body too large, the limit is %s", units.BytesSize(float64(tooLarge.Limit))),
+			"suggestion": "Giảm kích thước dữ liệu gửi lên hoặc tăng MAX_BODY_SIZE / MAX_UPLOAD_SIZE",
+		})
+	case errors.As(err, &invalid):
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":      "Validation failed",
+			"fields":     fieldErrors(invalid),
+			"suggestion": "Kiểm tra lại các trường được liệt kê trong 'fields'",
+		})
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format: " + err.Error()})
+	}
+}
+
+// bindJSON binds and validates the request body, answering the error itself
+// and returning false when it fails
+func bindJSON(ctx *gin.Context, obj any) bool {
+	if err := ctx.ShouldBindJSON(obj); err != nil {
+		respondBindError(ctx, err)
+		return false
+	}
+	return true
+}
+
+// bindOptionalJSON is bindJSON for endpoints where the body may be empty.
+// Validation still runs on the zero value.
+func bindOptionalJSON(ctx *gin.Context, obj any) bool {
+	err := ctx.ShouldBindJSON(obj)
+	if err == io.EOF {
+		err = binding.Validator.ValidateStruct(obj)
+	}
+	if err != nil {
+		respondBindError(ctx, err)
+		return false
+	}
+	return true
+}
+
+// bodyLimitMiddleware caps request bodies at MAX_BODY_SIZE, or
+// MAX_UPLOAD_SIZE for multipart uploads and MAX_IMAGE_BUNDLE_SIZE for image
+// bundles. Bodies announcing a larger
+// Content-Length are refused before they are read.
+func bodyLimitMiddleware() gin.HandlerFunc {
+	maxBody := sizeFromEnv("MAX_BODY_SIZE", defaultMaxBodySize)
+	maxUpload := sizeFromEnv("MAX_UPLOAD_SIZE", defaultMaxUploadSize)
+	maxImageBundle := sizeFromEnv("MAX_IMAGE_BUNDLE_SIZE", defaultMaxImageBundleSize)
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+		limit := maxBody
+		switch {
+		case strings.HasPrefix(c.ContentType(), "multipart/"):
+			limit = maxUpload
+		case c.ContentType() == imageBundleContentType:
+			limit = maxImageBundle
+		}
+		if c.Request.ContentLength > limit {
+			respondBindError(c, &http.MaxBytesError{Limit: limit})
+			c.Abort()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+func sizeFromEnv(name string, def int64) int64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	size, err := units.RAMInBytes(v)
+	if err != nil || size <= 0 {
+		fmt.Printf("⚠️  Invalid %s %q, using %s\n", name, v, units.BytesSize(float64(def)))
+		return def
+	}
+	return size
+}
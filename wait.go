@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/gin-gonic/gin"
+)
+
+// Conditions /create and /start can wait for
+const (
+	waitForHealthy = "healthy"
+	waitForRunning = "running"
+)
+
+// errNotReadyInTime is returned when the wait timed out, as opposed to the
+// container exiting or turning unhealthy
+var errNotReadyInTime = errors.New("timed out")
+
+// WaitOptions make /create and /start wait until the container is running or
+// has passed its health check. With wait_async the request returns at once
+// and the outcome is recorded as a job.
+type WaitOptions struct {
+	WaitFor string `json:"wait_for" form:"wait_for" binding:"omitempty,oneof=healthy running"`
+	// Seconds, defaults to defaultHealthWait
+	WaitTimeout int  `json:"wait_timeout" form:"wait_timeout" binding:"omitempty,min=1,max=3600"`
+	WaitAsync   bool `json:"wait_async" form:"wait_async"`
+}
+
+func (o WaitOptions) timeout() time.Duration {
+	if o.WaitTimeout > 0 {
+		return time.Duration(o.WaitTimeout) * time.Second
+	}
+	return defaultHealthWait
+}
+
+// WaitResult reports how a wait ended
+type WaitResult struct {
+	WaitFor        string `json:"wait_for"`
+	Ready          bool   `json:"ready"`
+	Status         string `json:"status"`
+	HasHealthcheck bool   `json:"has_healthcheck"`
+	Waited         string `json:"waited"`
+	Error          string `json:"error,omitempty"`
+}
+
+// waitForContainer polls a container until condition holds. A container
+// without a health check counts as healthy once it runs.
+func waitForContainer(ctx context.Context, cli *client.Client, containerID, condition string, timeout time.Duration) (*WaitResult, error) {
+	start := time.Now()
+	deadline := start.Add(timeout)
+	result := &WaitResult{WaitFor: condition}
+	fail := func(err error) (*WaitResult, error) {
+		result.Waited = time.Since(start).Round(time.Millisecond).String()
+		result.Error = err.Error()
+		return result, err
+	}
+	for {
+		info, err := cli.ContainerInspect(ctx, containerID)
+		if err != nil {
+			return fail(err)
+		}
+		state := info.State
+		if state == nil {
+			return fail(fmt.Errorf("container has no state"))
+		}
+		result.Status = state.Status
+		result.HasHealthcheck = state.Health != nil
+		if state.Health != nil {
+			result.Status = state.Health.Status
+		}
+		switch {
+		case !state.Running && !state.Restarting:
+			return fail(fmt.Errorf("container %s (exit code %d)", state.Status, state.ExitCode))
+		case state.Running && (condition == waitForRunning || state.Health == nil):
+			result.Ready = true
+		case state.Health != nil && state.Health.Status == "healthy":
+			result.Ready = true
+		case state.Health != nil && state.Health.Status == "unhealthy":
+			return fail(fmt.Errorf("container is unhealthy"))
+		}
+		if result.Ready {
+			result.Waited = time.Since(start).Round(time.Millisecond).String()
+			return result, nil
+		}
+		if time.Now().After(deadline) {
+			return fail(fmt.Errorf("%w: not %s after %s", errNotReadyInTime, condition, timeout))
+		}
+		select {
+		case <-time.After(500 * time.Millisecond):
+		case <-ctx.Done():
+			return fail(ctx.Err())
+		}
+	}
+}
+
+// respondAfterWait sends the response of a create or start, first waiting
+// for the container when the caller asked for it. A failed wait answers 504
+// on timeout and 500 when the container exited or turned unhealthy, with
+// the wait result and the original response fields.
+func respondAfterWait(ctx *gin.Context, store *Store, cli *client.Client, containerID string, opts WaitOptions, response gin.H) {
+	if opts.WaitFor == "" {
+		ctx.JSON(http.StatusOK, response)
+		return
+	}
+
+	if opts.WaitAsync {
+		// The request's client and context end with the request
+		jobID, err := startJob(store, "wait_"+opts.WaitFor, func() (any, error) {
+			bg, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+			if err != nil {
+				return nil, err
+			}
+			defer bg.Close()
+			return waitForContainer(context.Background(), bg, containerID, opts.WaitFor, opts.timeout())
+		})
+		if err != nil {
+			response["wait_error"] = "Error recording wait job: " + err.Error()
+			ctx.JSON(http.StatusOK, response)
+			return
+		}
+		response["wait_job_id"] = jobID
+		ctx.JSON(http.StatusAccepted, response)
+		return
+	}
+
+	result, err := waitForContainer(ctx.Request.Context(), cli, containerID, opts.WaitFor, opts.timeout())
+	response["wait"] = result
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errNotReadyInTime) {
+			status = http.StatusGatewayTimeout
+		}
+		response["error"] = "Container is not " + opts.WaitFor + ": " + err.Error()
+		response["suggestion"] = "Kiểm tra logs và healthcheck của container, hoặc tăng wait_timeout"
+		ctx.JSON(status, response)
+		return
+	}
+	ctx.JSON(http.StatusOK, response)
+}